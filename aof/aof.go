@@ -1,12 +1,14 @@
 package aof
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"github.com/xzwsloser/Go-redis/config"
 	"github.com/xzwsloser/Go-redis/interface/database"
 	"github.com/xzwsloser/Go-redis/lib/logger"
 	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/rdb"
 	"github.com/xzwsloser/Go-redis/resp/connection"
 	"github.com/xzwsloser/Go-redis/resp/parse"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
@@ -15,6 +17,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -50,6 +53,16 @@ type Persister struct {
 	curDBIndex  int
 	AppendOnly  bool
 	Load        bool
+	// UseRdbPreamble means the rewritten aof file begins with the rdb snapshot
+	UseRdbPreamble bool
+	// the state of the rewrite and the writing shown by INFO, they are accessed atomically
+	rewriting         int32
+	rewriteStart      int64
+	lastRewriteNanos  int64
+	lastRewriteFailed int32
+	rewrites          int64
+	lastWriteFailed   int32
+	baseSize          int64
 }
 
 type payLoad struct {
@@ -82,6 +95,11 @@ func NewPersister() *Persister {
 		aofFsync:    aofFileSync,
 		aofFileName: aofFileName,
 		buffer:      buf,
+		// -1 means the aof file is never rewritten
+		lastRewriteNanos: -1,
+	}
+	if info, err := aofFileWriter.Stat(); err == nil {
+		persister.baseSize = info.Size()
 	}
 
 	if config.GetAofConfig().AppendOnly == "on" {
@@ -92,6 +110,10 @@ func NewPersister() *Persister {
 		persister.Load = true
 	}
 
+	if config.GetAofConfig().UseRdbPreamble == "on" {
+		persister.UseRdbPreamble = true
+	}
+
 	go persister.listenCmd()
 
 	if persister.aofFsync == AOF_FSYNC_SECOND {
@@ -147,6 +169,7 @@ func (persister *Persister) writeAof(p *payLoad) {
 		data := protocol.NewMultiReply(selectDBCmd).ToByte()
 		_, err := persister.aofWriter.Write(data)
 		if err != nil {
+			atomic.StoreInt32(&persister.lastWriteFailed, 1)
 			logger.Error("write into aof file buffer err: %v", err.Error())
 			return
 		}
@@ -157,9 +180,11 @@ func (persister *Persister) writeAof(p *payLoad) {
 	data := protocol.NewMultiReply(p.cmdLine).ToByte()
 	_, err := persister.aofWriter.Write(data)
 	if err != nil {
+		atomic.StoreInt32(&persister.lastWriteFailed, 1)
 		logger.Error("write into aof file buffer err: %v", err.Error())
 		return
 	}
+	atomic.StoreInt32(&persister.lastWriteFailed, 0)
 
 	if persister.aofFsync == AOF_FSYNC_ALWAYS {
 		err := persister.aofWriter.Sync()
@@ -203,6 +228,15 @@ func (persister *Persister) fsyncEverySecond() {
 	}
 }
 
+// HasAofData judge whether there are commands in the aof file
+func (persister *Persister) HasAofData() bool {
+	info, err := persister.aofWriter.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Size() > 0
+}
+
 func (persister *Persister) LoadAof() {
 	file, err := os.OpenFile(persister.aofFileName,
 		os.O_RDONLY,
@@ -211,9 +245,22 @@ func (persister *Persister) LoadAof() {
 		logger.Error("failed to open file err: %v", err)
 		return
 	}
-
-	var reader io.Reader
-	reader = file
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	// the rewritten aof file may begin with the rdb snapshot, the commands follow it
+	header, err := reader.Peek(len(rdb.RDB_MAGIC))
+	if err == nil && string(header) == rdb.RDB_MAGIC {
+		dec := rdb.NewDecoder(reader)
+		err = dec.Parse(func(dbIndex int, key string, entity *database.DataEntity, expireAt time.Time) bool {
+			persister.db.LoadEntity(dbIndex, key, entity, expireAt)
+			return true
+		})
+		if err != nil {
+			logger.Error("load the rdb preamble of aof file err: %v", err)
+			return
+		}
+	}
 
 	fake := connection.NewFakeConnection()
 	ch := parse.ParseStream(reader)
@@ -259,30 +306,98 @@ func (persister *Persister) LoadAof() {
 func (persister *Persister) generatorAof(ctx *RewriteCtx) error {
 	persister.pauseLock.Lock()
 	defer persister.pauseLock.Unlock()
-	handler := persister.newRewriteHandler()
 	tmpFile := ctx.tmpFile
 	if tmpFile == nil {
 		logger.Warn("temp file fd is not open")
 		return errors.New("temp file fd is not open")
 	}
+	// no command is written when the lock is held, so the commands after
+	// the current size will be appended by FinishRewrite in the current db
+	stat, err := os.Stat(persister.aofFileName)
+	if err != nil {
+		return err
+	}
+	ctx.fileSize = stat.Size()
+	ctx.dbIndex = persister.curDBIndex
+
+	handler := persister.newRewriteHandler()
 	handler.LoadAof()
-	// rewrite the aof file
-	selectCmd := utils.CmdLine1("SELECT", strconv.Itoa(ctx.dbIndex))
-	selectReply := protocol.NewMultiReply(selectCmd)
-	_, err := tmpFile.Write(selectReply.ToByte())
+	writer := bufio.NewWriter(tmpFile)
+	if persister.UseRdbPreamble {
+		err = writeRdbPreamble(writer, handler.db)
+	} else {
+		err = writeAofCommands(writer, handler.db)
+	}
 	if err != nil {
-		logger.Error("write select command into database failed")
+		logger.Error("failed to rewrite message into temp aof file err: %s", err.Error())
 		return err
 	}
-	handler.db.ForEach(ctx.dbIndex, func(key string, value *database.DataEntity) bool {
-		cmdLine := EntityToCmd(key, value)
-		cmd := protocol.NewMultiReply(cmdLine).ToByte()
-		_, err = tmpFile.Write(cmd)
+	return writer.Flush()
+}
+
+// writeAofCommands write one command for every key and the expire command of the key
+func writeAofCommands(writer io.Writer, db database.DBEngine) error {
+	var err error
+	for i := 0; i < db.DBNumber(); i++ {
+		selected := false
+		db.ForEach(i, func(key string, value *database.DataEntity, expireAt time.Time) bool {
+			if !selected {
+				selectCmd := utils.CmdLine1("SELECT", strconv.Itoa(i))
+				_, err = writer.Write(protocol.NewMultiReply(selectCmd).ToByte())
+				if err != nil {
+					return false
+				}
+				selected = true
+			}
+			_, err = writer.Write(protocol.NewMultiReply(EntityToCmd(key, value)).ToByte())
+			if err != nil {
+				return false
+			}
+			if !expireAt.IsZero() {
+				_, err = writer.Write(protocol.NewMultiReply(utils.ExpireCmd(key, expireAt)).ToByte())
+			}
+			return err == nil
+		})
 		if err != nil {
-			logger.Error("failed to rewrite message into temp aof file err: %s", err.Error())
-			return false
+			return err
 		}
-		return true
-	})
+	}
 	return nil
 }
+
+// writeRdbPreamble write all the databases as the rdb snapshot
+func writeRdbPreamble(writer io.Writer, db database.DBEngine) error {
+	enc := rdb.NewEncoder(writer)
+	err := enc.WriteHeader(map[string]string{
+		"aof-preamble": "1",
+		"ctime":        strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	if err != nil {
+		return err
+	}
+	for i := 0; i < db.DBNumber(); i++ {
+		size, expires := 0, 0
+		db.ForEach(i, func(key string, value *database.DataEntity, expireAt time.Time) bool {
+			size++
+			if !expireAt.IsZero() {
+				expires++
+			}
+			return true
+		})
+		if size == 0 {
+			continue
+		}
+		err = enc.WriteDBHeader(i, size, expires)
+		if err != nil {
+			return err
+		}
+		db.ForEach(i, func(key string, value *database.DataEntity, expireAt time.Time) bool {
+			err = enc.WriteEntry(key, value, expireAt)
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return enc.WriteEnd()
+}
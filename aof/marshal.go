@@ -1,7 +1,9 @@
 package aof
 
 import (
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
 	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
 	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
 	"github.com/xzwsloser/Go-redis/interface/database"
 	"strconv"
@@ -11,16 +13,22 @@ const (
 	STRING_SET_COMMAND  = "SET"
 	LIST_PUSH_COMMAND   = "RPUSH"
 	ZSET_INSERT_COMMAND = "ZADD"
+	HASH_SET_COMMAND    = "HSET"
+	SET_ADD_COMMAND     = "SADD"
 )
 
 func EntityToCmd(key string, data *database.DataEntity) [][]byte {
 	switch data.Data.(type) {
 	case []byte:
 		return newStringCmd(key, data.Data.([]byte))
-	case *list.LinkedList:
-		return newListCmd(key, data.Data.(*list.LinkedList))
+	case *list.List:
+		return newListCmd(key, data.Data.(*list.List))
 	case *sortedset.SortedSet:
 		return newSortedSet(key, data.Data.(*sortedset.SortedSet))
+	case *hash.Hash:
+		return newHashCmd(key, data.Data.(*hash.Hash))
+	case *set.Set:
+		return newSetCmd(key, data.Data.(*set.Set))
 	default:
 		return [][]byte{}
 	}
@@ -34,13 +42,18 @@ func newStringCmd(key string, value []byte) [][]byte {
 	return result
 }
 
-func newListCmd(key string, value *list.LinkedList) [][]byte {
+func newListCmd(key string, value *list.List) [][]byte {
 	result := make([][]byte, 2+value.Len())
 	result[0] = []byte(LIST_PUSH_COMMAND)
 	result[1] = []byte(key)
 	i := 0
 	value.ForEach(func(key any) bool {
-		result[i+2] = key.([]byte)
+		switch v := key.(type) {
+		case []byte:
+			result[i+2] = v
+		case string:
+			result[i+2] = []byte(v)
+		}
 		i++
 		return true
 	})
@@ -53,10 +66,37 @@ func newSortedSet(key string, value *sortedset.SortedSet) [][]byte {
 	result[1] = []byte(key)
 	i := 2
 	value.ForEach(func(score float64, key string) bool {
-		result[i] = []byte(strconv.FormatFloat(score, 'f', 2, 10))
+		result[i] = []byte(strconv.FormatFloat(score, 'f', -1, 64))
 		result[i+1] = []byte(key)
 		i += 2
 		return true
 	})
 	return result
 }
+
+func newHashCmd(key string, value *hash.Hash) [][]byte {
+	result := make([][]byte, 2+value.Len()*2)
+	result[0] = []byte(HASH_SET_COMMAND)
+	result[1] = []byte(key)
+	i := 2
+	value.ForEach(func(field string, v []byte) bool {
+		result[i] = []byte(field)
+		result[i+1] = v
+		i += 2
+		return true
+	})
+	return result
+}
+
+func newSetCmd(key string, value *set.Set) [][]byte {
+	result := make([][]byte, 2+value.Len())
+	result[0] = []byte(SET_ADD_COMMAND)
+	result[1] = []byte(key)
+	i := 2
+	value.ForEach(func(member string) bool {
+		result[i] = []byte(member)
+		i++
+		return true
+	})
+	return result
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -29,6 +31,20 @@ func (persister *Persister) newRewriteHandler() *Persister {
 
 // Rewrite do the rewrite operation
 func (persister *Persister) Rewrite() (err error) {
+	start := time.Now()
+	atomic.StoreInt64(&persister.rewriteStart, start.UnixNano())
+	atomic.StoreInt32(&persister.rewriting, 1)
+	defer func() {
+		atomic.StoreInt64(&persister.lastRewriteNanos, int64(time.Since(start)))
+		if err != nil {
+			atomic.StoreInt32(&persister.lastRewriteFailed, 1)
+		} else {
+			atomic.StoreInt32(&persister.lastRewriteFailed, 0)
+			atomic.AddInt64(&persister.rewrites, 1)
+		}
+		atomic.StoreInt32(&persister.rewriting, 0)
+	}()
+
 	ctx, err := persister.PreRewrite()
 	if err != nil {
 		return
@@ -59,7 +75,7 @@ func (persister *Persister) PreRewrite() (ctx *RewriteCtx, err error) {
 	}
 	fileSize := stat.Size()
 	tmpFile, err := os.OpenFile(AOF_REWRITE_TEMP_NAME,
-		os.O_CREATE|os.O_RDWR|os.O_APPEND,
+		os.O_CREATE|os.O_RDWR|os.O_TRUNC,
 		0644)
 	if err != nil {
 		logger.Error("failed to open temp file pointer err: %s", err.Error())
@@ -79,6 +95,10 @@ func (persister *Persister) FinishRewrite(ctx *RewriteCtx) (err error) {
 		logger.Error("tmp file fd is not open")
 		return errors.New("tmp file fd is not open")
 	}
+	defer tmpFile.Close()
+	// stop writing the aof file until the new file replaces it
+	persister.pauseLock.Lock()
+	defer persister.pauseLock.Unlock()
 
 	file, err := os.OpenFile(persister.aofFileName,
 		os.O_RDONLY,
@@ -87,6 +107,7 @@ func (persister *Persister) FinishRewrite(ctx *RewriteCtx) (err error) {
 		logger.Error("open aof file failed err: %s", err.Error())
 		return err
 	}
+	defer file.Close()
 
 	_, err = file.Seek(ctx.fileSize, 0)
 	if err != nil {
@@ -117,14 +138,18 @@ func (persister *Persister) FinishRewrite(ctx *RewriteCtx) (err error) {
 		return err
 	}
 
-	file, err = os.OpenFile(persister.aofFileName,
+	aofWriter, err := os.OpenFile(persister.aofFileName,
 		os.O_RDWR|os.O_CREATE|os.O_APPEND,
 		0644)
 	if err != nil {
 		panic(err)
 	}
 
-	persister.aofWriter = file
+	_ = persister.aofWriter.Close()
+	persister.aofWriter = aofWriter
+	if info, err := aofWriter.Stat(); err == nil {
+		atomic.StoreInt64(&persister.baseSize, info.Size())
+	}
 	selectCmd = protocol.
 		NewMultiReply(utils.CmdLine1("SELECT",
 			strconv.Itoa(persister.curDBIndex))).ToByte()
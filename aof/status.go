@@ -0,0 +1,48 @@
+package aof
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// Status is the state of the aof shown by INFO persistence
+type Status struct {
+	Enabled           bool
+	RewriteInProgress bool
+	// CurrentRewriteSeconds is the duration of the rewrite in progress, -1 if no rewrite is in progress
+	CurrentRewriteSeconds int64
+	// LastRewriteSeconds is the duration of the last rewrite, -1 if the aof file is never rewritten
+	LastRewriteSeconds int64
+	LastRewriteOk      bool
+	Rewrites           int64
+	LastWriteOk        bool
+	// CurrentSize is the size of the aof file now, BaseSize is the size after the last rewrite or startup
+	CurrentSize int64
+	BaseSize    int64
+}
+
+// Status collect the state of the aof, the file is not locked so that the rewrite does not block it
+func (persister *Persister) Status() *Status {
+	status := &Status{
+		Enabled:               persister.AppendOnly,
+		RewriteInProgress:     atomic.LoadInt32(&persister.rewriting) == 1,
+		CurrentRewriteSeconds: -1,
+		LastRewriteSeconds:    -1,
+		LastRewriteOk:         atomic.LoadInt32(&persister.lastRewriteFailed) == 0,
+		Rewrites:              atomic.LoadInt64(&persister.rewrites),
+		LastWriteOk:           atomic.LoadInt32(&persister.lastWriteFailed) == 0,
+		BaseSize:              atomic.LoadInt64(&persister.baseSize),
+	}
+	if status.RewriteInProgress {
+		start := time.Unix(0, atomic.LoadInt64(&persister.rewriteStart))
+		status.CurrentRewriteSeconds = int64(time.Since(start).Seconds())
+	}
+	if nanos := atomic.LoadInt64(&persister.lastRewriteNanos); nanos >= 0 {
+		status.LastRewriteSeconds = int64(time.Duration(nanos).Seconds())
+	}
+	if info, err := os.Stat(persister.aofFileName); err == nil {
+		status.CurrentSize = info.Size()
+	}
+	return status
+}
@@ -7,6 +7,10 @@ import (
 type RedisServerConfig struct {
 	Address string `yaml:"Address"`
 	Port    int    `yaml:"Port"`
+	// UnixSocket is the path of the unix socket, empty means not listening on it
+	UnixSocket string `yaml:"UnixSocket"`
+	// UnixSocketPerm is the permission of the socket file in octal e.g 700
+	UnixSocketPerm string `yaml:"UnixSocketPerm"`
 }
 
 type LogConfig struct {
@@ -26,6 +30,72 @@ type AofConfig struct {
 	AppendOnly     string `yaml:"AppendOnly"`
 	AppendFileName string `yaml:"AppendFileName"`
 	AppendFileSync string `yaml:"AppendFileSync"`
+	UseRdbPreamble string `yaml:"UseRdbPreamble"`
+}
+
+type RdbConfig struct {
+	Load       string   `yaml:"Load"`
+	DBFileName string   `yaml:"DBFileName"`
+	Save       []string `yaml:"Save"`
+}
+
+type ReplicationConfig struct {
+	ReplicaOf   string `yaml:"ReplicaOf"`
+	BacklogSize int    `yaml:"BacklogSize"`
+	MasterUser  string `yaml:"MasterUser"`
+	MasterAuth  string `yaml:"MasterAuth"`
+}
+
+type ClusterConfig struct {
+	Enabled      string `yaml:"Enabled"`
+	ConfigFile   string `yaml:"ConfigFile"`
+	AnnounceHost string `yaml:"AnnounceHost"`
+}
+
+type AuthConfig struct {
+	RequirePass string `yaml:"RequirePass"`
+	AclFile     string `yaml:"AclFile"`
+}
+
+type TlsConfig struct {
+	Port       int    `yaml:"Port"`
+	CertFile   string `yaml:"CertFile"`
+	KeyFile    string `yaml:"KeyFile"`
+	CaCertFile string `yaml:"CaCertFile"`
+	// AuthClients is yes, no or optional like tls-auth-clients of redis
+	AuthClients string `yaml:"AuthClients"`
+	MinVersion  string `yaml:"MinVersion"`
+}
+
+type SlowlogConfig struct {
+	// LogSlowerThan is the threshold in microseconds like slowlog-log-slower-than of redis,
+	// zero logs every command and the negative value disables the slowlog
+	LogSlowerThan int64 `yaml:"LogSlowerThan"`
+	// MaxLen is the max number of the entries kept like slowlog-max-len
+	MaxLen int `yaml:"MaxLen"`
+}
+
+type MemoryConfig struct {
+	// MaxMemory is the limit of the memory used by the keys like maxmemory of redis e.g 100mb,
+	// 0 means no limit
+	MaxMemory string `yaml:"MaxMemory"`
+	// MaxMemoryPolicy is the eviction policy like maxmemory-policy e.g allkeys-lru
+	MaxMemoryPolicy string `yaml:"MaxMemoryPolicy"`
+	// MaxMemorySamples is the number of the keys sampled by an eviction like maxmemory-samples
+	MaxMemorySamples int `yaml:"MaxMemorySamples"`
+}
+
+type EncodingConfig struct {
+	// ListMaxListpackSize is list-max-listpack-size of redis, the positive value is the max number of the
+	// elements in the listpack and -1 ~ -5 limits the listpack to 4kb ~ 64kb
+	ListMaxListpackSize int `yaml:"ListMaxListpackSize"`
+	// ListCompressDepth is list-compress-depth of redis, the number of the quicklist nodes kept uncompressed
+	// at both ends of the list, 0 disables the compression
+	ListCompressDepth int `yaml:"ListCompressDepth"`
+	// ZsetMaxListpackEntries is the max number of the members of the sorted set kept in the listpack
+	ZsetMaxListpackEntries int `yaml:"ZsetMaxListpackEntries"`
+	// ZsetMaxListpackValue is the max length of the member of the sorted set kept in the listpack
+	ZsetMaxListpackValue int `yaml:"ZsetMaxListpackValue"`
 }
 
 func init() {
@@ -37,6 +107,15 @@ var (
 	logConfig         *LogConfig         = new(LogConfig)
 	dbConfig          *DBConfig          = new(DBConfig)
 	aofConfig         *AofConfig         = new(AofConfig)
+	rdbConfig         *RdbConfig         = new(RdbConfig)
+	replicationConfig *ReplicationConfig = new(ReplicationConfig)
+	clusterConfig     *ClusterConfig     = new(ClusterConfig)
+	authConfig        *AuthConfig        = new(AuthConfig)
+	tlsConfig         *TlsConfig         = new(TlsConfig)
+	// the defaults of redis are kept when the section is missing
+	slowlogConfig  *SlowlogConfig  = &SlowlogConfig{LogSlowerThan: 10000, MaxLen: 128}
+	memoryConfig   *MemoryConfig   = &MemoryConfig{MaxMemory: "0", MaxMemoryPolicy: "noeviction", MaxMemorySamples: 5}
+	encodingConfig *EncodingConfig = &EncodingConfig{ListMaxListpackSize: -2, ZsetMaxListpackEntries: 128, ZsetMaxListpackValue: 64}
 )
 
 func GetRedisServerConfig() *RedisServerConfig {
@@ -55,6 +134,38 @@ func GetAofConfig() *AofConfig {
 	return aofConfig
 }
 
+func GetRdbConfig() *RdbConfig {
+	return rdbConfig
+}
+
+func GetReplicationConfig() *ReplicationConfig {
+	return replicationConfig
+}
+
+func GetClusterConfig() *ClusterConfig {
+	return clusterConfig
+}
+
+func GetAuthConfig() *AuthConfig {
+	return authConfig
+}
+
+func GetTlsConfig() *TlsConfig {
+	return tlsConfig
+}
+
+func GetSlowlogConfig() *SlowlogConfig {
+	return slowlogConfig
+}
+
+func GetMemoryConfig() *MemoryConfig {
+	return memoryConfig
+}
+
+func GetEncodingConfig() *EncodingConfig {
+	return encodingConfig
+}
+
 func InitConfig() {
 	viper.SetConfigName("redis")
 	viper.SetConfigType("yaml")
@@ -85,4 +196,44 @@ func InitConfig() {
 	if err != nil {
 		panic(err)
 	}
+
+	err = viper.UnmarshalKey("Rdb", rdbConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Replication", replicationConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Cluster", clusterConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Auth", authConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Tls", tlsConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Slowlog", slowlogConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Memory", memoryConfig)
+	if err != nil {
+		panic(err)
+	}
+
+	err = viper.UnmarshalKey("Encoding", encodingConfig)
+	if err != nil {
+		panic(err)
+	}
 }
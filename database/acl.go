@@ -0,0 +1,560 @@
+package database
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/xzwsloser/Go-redis/lib/wildcard"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+the acl users, each user has:
+1. on/off: whether the user can authenticate
+2. the passwords (stored as sha256) or nopass
+3. the command rules e.g +@all -@dangerous +get +config|get, applied in order
+4. the key patterns e.g ~* ~cache:* %R~log:* %W~tmp:*
+the acl file has a user per line in the format of ACL LIST:
+	user alice on #<sha256> ~cache:* +@read
+*/
+
+const (
+	DEFAULT_USER    = "default"
+	ACL_LOG_MAX_LEN = 128
+)
+
+const (
+	aclKeyRead = 1 << iota
+	aclKeyWrite
+)
+
+// aclCategories record the commands of each category, the command not in any category only matches @all
+var aclCategories = map[string][]string{
+	"keyspace": {"del", "exists", "persister", "expire", "pexpire", "expireat", "pexpireat", "type", "rename",
+		"renamenx", "copy", "randomkey", "ttl", "pttl", "expiretime", "pexpiretime", "keys", "scan", "dump",
+		"restore", "restore-asking", "migrate", "object"},
+	"read": {"get", "mget", "slen", "getversion", "hget", "hmget", "hexists", "hlen", "hkeys", "hvals", "hgetall",
+		"hstrlen", "hscan", "lindex", "llen", "lrange", "lpos", "smembers", "sismember", "smismember", "scard",
+		"srandmember", "sinter", "sunion", "sdiff", "sscan", "zcard", "zcount", "zlexcount", "zrank", "zrevrank",
+		"zscore", "zmscore", "zrange", "zrevrange", "zrangebyscore", "zrevrangebyscore", "zrangebylex",
+		"zrevrangebylex", "zrandmember", "zunion", "zinter", "zdiff", "zintercard", "zscan", "exists", "type",
+		"ttl", "pttl", "expiretime", "pexpiretime", "keys", "scan", "randomkey", "dump", "object", "memory"},
+	"write": {"set", "setnx", "getset", "incr", "decr", "mset", "setex", "hset", "hdel", "hincrby", "hincrbyfloat",
+		"hsetnx", "lpush", "rpush", "lpushx", "rpushx", "lpop", "rpop", "lrem", "lset", "linsert", "ltrim", "lmove",
+		"rpoplpush", "lmpop", "blpop", "brpop", "brpoplpush", "blmove", "sadd", "srem", "spop", "smove", "sinterstore",
+		"sunionstore", "sdiffstore", "zadd", "zincrby", "zrem", "zremrangebyrank", "zremrangebyscore",
+		"zremrangebylex", "zpopmin", "zpopmax", "bzpopmin", "bzpopmax", "zunionstore", "zinterstore", "zdiffstore",
+		"zrangestore", "del", "persister", "expire", "pexpire", "expireat", "pexpireat", "rename", "renamenx", "copy",
+		"restore", "restore-asking", "migrate"},
+	"string": {"get", "set", "setnx", "getset", "incr", "decr", "slen", "mget", "mset", "setex", "getversion"},
+	"hash": {"hset", "hget", "hmget", "hdel", "hexists", "hlen", "hkeys", "hvals", "hgetall", "hincrby",
+		"hincrbyfloat", "hsetnx", "hstrlen", "hscan"},
+	"list": {"lindex", "llen", "lpop", "lpush", "lpushx", "rpop", "rpush", "rpushx", "lrem", "lrange", "lset",
+		"linsert", "ltrim", "lpos", "lmove", "rpoplpush", "lmpop", "blpop", "brpop", "brpoplpush", "blmove"},
+	"set": {"sadd", "srem", "sismember", "smismember", "smembers", "scard", "spop", "srandmember", "smove",
+		"sinter", "sunion", "sdiff", "sinterstore", "sunionstore", "sdiffstore", "sscan"},
+	"sortedset": {"zadd", "zcard", "zcount", "zlexcount", "zincrby", "zrank", "zrevrank", "zscore", "zmscore",
+		"zrange", "zrevrange", "zrangebyscore", "zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zrem",
+		"zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zpopmin", "zpopmax", "bzpopmin", "bzpopmax",
+		"zrandmember", "zunion", "zinter", "zdiff", "zintercard", "zunionstore", "zinterstore", "zdiffstore",
+		"zrangestore", "zscan"},
+	"pubsub":      {"subscribe", "unsubscribe", "publish"},
+	"blocking":    {"blpop", "brpop", "brpoplpush", "blmove", "bzpopmin", "bzpopmax"},
+	"transaction": {"multi", "exec", "discard", "watch"},
+	"connection":  {"ping", "select", "hello", "auth", "asking", "client"},
+	"admin": {"bgwriteaof", "save", "bgsave", "lastsave", "replicaof", "slaveof", "psync", "replconf", "role",
+		"cluster", "acl", "client", "slowlog", "monitor"},
+	"dangerous": {"keys", "bgwriteaof", "save", "bgsave", "lastsave", "replicaof", "slaveof", "psync",
+		"replconf", "role", "cluster", "acl", "migrate", "restore", "restore-asking", "client", "info", "slowlog",
+		"monitor"},
+}
+
+// commandCategories is the reversed index of aclCategories
+var commandCategories = func() map[string]map[string]bool {
+	index := make(map[string]map[string]bool)
+	for category, cmdNames := range aclCategories {
+		for _, cmdName := range cmdNames {
+			if index[cmdName] == nil {
+				index[cmdName] = make(map[string]bool)
+			}
+			index[cmdName][category] = true
+		}
+	}
+	return index
+}()
+
+// isKnownCommand judge whether the command is registered or handled by the server
+func isKnownCommand(cmdName string) bool {
+	if _, ok := commandTable[cmdName]; ok {
+		return true
+	}
+	_, ok := commandCategories[cmdName]
+	return ok
+}
+
+// aclCommandRule is a rule like +get -@write +config|get
+type aclCommandRule struct {
+	allow bool
+	// category is the name without @, "all" matches any command
+	category string
+	name     string
+	// sub is the first argument of the command, empty matches any argument
+	sub string
+}
+
+func (rule *aclCommandRule) match(cmdName string, cmdLine [][]byte) bool {
+	if rule.category != "" {
+		return rule.category == "all" || commandCategories[cmdName][rule.category]
+	}
+	if rule.name != cmdName {
+		return false
+	}
+	return rule.sub == "" || (len(cmdLine) > 1 && strings.EqualFold(rule.sub, string(cmdLine[1])))
+}
+
+func (rule *aclCommandRule) String() string {
+	prefix := "-"
+	if rule.allow {
+		prefix = "+"
+	}
+	if rule.category != "" {
+		return prefix + "@" + rule.category
+	}
+	if rule.sub != "" {
+		return prefix + rule.name + "|" + rule.sub
+	}
+	return prefix + rule.name
+}
+
+type aclKeyPattern struct {
+	flags   int
+	raw     string
+	pattern *wildcard.Pattern
+}
+
+func (p *aclKeyPattern) String() string {
+	switch p.flags {
+	case aclKeyRead:
+		return "%R~" + p.raw
+	case aclKeyWrite:
+		return "%W~" + p.raw
+	}
+	return "~" + p.raw
+}
+
+type aclUser struct {
+	name    string
+	enabled bool
+	nopass  bool
+	// passwords is the set of the sha256 hex of the passwords
+	passwords    map[string]bool
+	commandRules []*aclCommandRule
+	keyPatterns  []*aclKeyPattern
+}
+
+func newAclUser(name string) *aclUser {
+	return &aclUser{
+		name:      name,
+		passwords: make(map[string]bool),
+	}
+}
+
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// applyRule apply a rule of ACL SETUSER to the user
+func (u *aclUser) applyRule(rule string) error {
+	lower := strings.ToLower(rule)
+	switch {
+	case lower == "on":
+		u.enabled = true
+	case lower == "off":
+		u.enabled = false
+	case lower == "nopass":
+		u.nopass = true
+		u.passwords = make(map[string]bool)
+	case lower == "resetpass":
+		u.nopass = false
+		u.passwords = make(map[string]bool)
+	case lower == "allkeys":
+		return u.applyRule("~*")
+	case lower == "resetkeys":
+		u.keyPatterns = nil
+	case lower == "allcommands":
+		u.commandRules = []*aclCommandRule{{allow: true, category: "all"}}
+	case lower == "nocommands":
+		u.commandRules = nil
+	case lower == "reset":
+		*u = *newAclUser(u.name)
+	case rule[0] == '>':
+		u.passwords[hashPassword(rule[1:])] = true
+		u.nopass = false
+	case rule[0] == '<':
+		delete(u.passwords, hashPassword(rule[1:]))
+	case rule[0] == '#' || rule[0] == '!':
+		hash := strings.ToLower(rule[1:])
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase hexadecimal characters")
+		}
+		if rule[0] == '#' {
+			u.passwords[hash] = true
+			u.nopass = false
+		} else {
+			delete(u.passwords, hash)
+		}
+	case rule[0] == '~' || rule[0] == '%':
+		return u.addKeyPattern(rule)
+	case rule[0] == '+' || rule[0] == '-':
+		return u.addCommandRule(rule[0] == '+', lower[1:])
+	default:
+		return errors.New("Syntax error")
+	}
+	return nil
+}
+
+func (u *aclUser) addKeyPattern(rule string) error {
+	flags := aclKeyRead | aclKeyWrite
+	raw := rule[1:]
+	if rule[0] == '%' {
+		idx := strings.IndexByte(rule, '~')
+		if idx < 2 {
+			return errors.New("Syntax error")
+		}
+		flags = 0
+		for _, c := range strings.ToUpper(rule[1:idx]) {
+			switch c {
+			case 'R':
+				flags |= aclKeyRead
+			case 'W':
+				flags |= aclKeyWrite
+			default:
+				return errors.New("Syntax error")
+			}
+		}
+		raw = rule[idx+1:]
+	}
+	pattern, err := wildcard.CompilePattern(raw)
+	if err != nil {
+		return err
+	}
+	u.keyPatterns = append(u.keyPatterns, &aclKeyPattern{
+		flags:   flags,
+		raw:     raw,
+		pattern: pattern,
+	})
+	return nil
+}
+
+func (u *aclUser) addCommandRule(allow bool, name string) error {
+	rule := &aclCommandRule{allow: allow}
+	if strings.HasPrefix(name, "@") {
+		rule.category = name[1:]
+		if _, ok := aclCategories[rule.category]; !ok && rule.category != "all" {
+			return errors.New("Unknown command category")
+		}
+		// +@all and -@all override all the rules before them
+		if rule.category == "all" {
+			u.commandRules = nil
+			if !allow {
+				return nil
+			}
+		}
+	} else {
+		rule.name = name
+		if idx := strings.IndexByte(name, '|'); idx >= 0 {
+			rule.name, rule.sub = name[:idx], name[idx+1:]
+			if rule.sub == "" {
+				return errors.New("Syntax error")
+			}
+		}
+		if !isKnownCommand(rule.name) {
+			return errors.New("Unknown command")
+		}
+	}
+	u.commandRules = append(u.commandRules, rule)
+	return nil
+}
+
+// canRun judge whether the user can run the command, the later rule wins
+func (u *aclUser) canRun(cmdLine [][]byte) bool {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	allow := false
+	for _, rule := range u.commandRules {
+		if rule.match(cmdName, cmdLine) {
+			allow = rule.allow
+		}
+	}
+	return allow
+}
+
+// canAccess judge whether the user can access the key by the flags
+func (u *aclUser) canAccess(key string, flags int) bool {
+	for _, p := range u.keyPatterns {
+		if p.flags&flags == flags && p.pattern.IsMatch(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *aclUser) checkPassword(password string) bool {
+	return u.nopass || u.passwords[hashPassword(password)]
+}
+
+func (u *aclUser) flagsOf() []string {
+	flags := []string{"off"}
+	if u.enabled {
+		flags[0] = "on"
+	}
+	if u.nopass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+func (u *aclUser) sortedPasswords() []string {
+	passwords := make([]string, 0, len(u.passwords))
+	for hash := range u.passwords {
+		passwords = append(passwords, hash)
+	}
+	sort.Strings(passwords)
+	return passwords
+}
+
+func (u *aclUser) commandsText() string {
+	if len(u.commandRules) == 0 {
+		return "-@all"
+	}
+	rules := make([]string, len(u.commandRules))
+	for i, rule := range u.commandRules {
+		rules[i] = rule.String()
+	}
+	return strings.Join(rules, " ")
+}
+
+func (u *aclUser) keysText() string {
+	patterns := make([]string, len(u.keyPatterns))
+	for i, p := range u.keyPatterns {
+		patterns[i] = p.String()
+	}
+	return strings.Join(patterns, " ")
+}
+
+// describe the user in the format of ACL LIST and the acl file
+func (u *aclUser) describe() string {
+	parts := []string{"user", u.name}
+	parts = append(parts, u.flagsOf()...)
+	for _, hash := range u.sortedPasswords() {
+		parts = append(parts, "#"+hash)
+	}
+	if keys := u.keysText(); keys != "" {
+		parts = append(parts, keys)
+	}
+	parts = append(parts, u.commandsText())
+	return strings.Join(parts, " ")
+}
+
+// aclLogEntry records a denied command or a failed authentication
+type aclLogEntry struct {
+	count      int64
+	reason     string
+	context    string
+	object     string
+	username   string
+	createdAt  time.Time
+	updatedAt  time.Time
+	clientInfo string
+}
+
+type acl struct {
+	mu    sync.RWMutex
+	users map[string]*aclUser
+	// logs is the latest entries first
+	logs    []*aclLogEntry
+	aclFile string
+}
+
+// newAcl create the acl with the default user which can do anything without password
+func newAcl() *acl {
+	a := &acl{
+		users: make(map[string]*aclUser),
+	}
+	a.users[DEFAULT_USER] = newDefaultUser()
+	return a
+}
+
+func newDefaultUser() *aclUser {
+	u := newAclUser(DEFAULT_USER)
+	for _, rule := range []string{"on", "nopass", "~*", "+@all"} {
+		_ = u.applyRule(rule)
+	}
+	return u
+}
+
+func (a *acl) getUser(name string) *aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.users[name]
+}
+
+// setUser apply the rules to the copy of the user, the user is not changed if any rule is invalid
+func (a *acl) setUser(name string, rules []string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	u := newAclUser(name)
+	if old, ok := a.users[name]; ok {
+		*u = *old
+		u.passwords = make(map[string]bool, len(old.passwords))
+		for hash := range old.passwords {
+			u.passwords[hash] = true
+		}
+		u.commandRules = append([]*aclCommandRule(nil), old.commandRules...)
+		u.keyPatterns = append([]*aclKeyPattern(nil), old.keyPatterns...)
+	}
+	for _, rule := range rules {
+		if rule == "" {
+			return errors.New("Error in ACL SETUSER modifier '': Syntax error")
+		}
+		if err := u.applyRule(rule); err != nil {
+			return errors.New("Error in ACL SETUSER modifier '" + rule + "': " + err.Error())
+		}
+	}
+	a.users[name] = u
+	return nil
+}
+
+func (a *acl) sortedUsers() []*aclUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	users := make([]*aclUser, 0, len(a.users))
+	for _, u := range a.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].name < users[j].name
+	})
+	return users
+}
+
+// authenticate return the user if the password is right and the user is enabled
+func (a *acl) authenticate(name, password string) *aclUser {
+	u := a.getUser(name)
+	if u == nil || !u.enabled || !u.checkPassword(password) {
+		return nil
+	}
+	return u
+}
+
+// addLog record the denied operation, the same entry within 60 seconds is merged
+func (a *acl) addLog(reason, context, object, username, clientInfo string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	for _, entry := range a.logs {
+		if entry.reason == reason && entry.context == context && entry.object == object &&
+			entry.username == username && now.Sub(entry.updatedAt) < time.Minute {
+			entry.count++
+			entry.updatedAt = now
+			entry.clientInfo = clientInfo
+			return
+		}
+	}
+	entry := &aclLogEntry{
+		count:      1,
+		reason:     reason,
+		context:    context,
+		object:     object,
+		username:   username,
+		createdAt:  now,
+		updatedAt:  now,
+		clientInfo: clientInfo,
+	}
+	a.logs = append([]*aclLogEntry{entry}, a.logs...)
+	if len(a.logs) > ACL_LOG_MAX_LEN {
+		a.logs = a.logs[:ACL_LOG_MAX_LEN]
+	}
+}
+
+// parseAclFile parse the users in the acl file, the users are not applied if any line is invalid
+func parseAclFile(filename string) (map[string]*aclUser, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tmp := newAcl()
+	delete(tmp.users, DEFAULT_USER)
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "user" {
+			return nil, errors.New(filename + ":" + strconv.Itoa(lineNo) + ": should start with user keyword")
+		}
+		if _, ok := tmp.users[fields[1]]; ok {
+			return nil, errors.New(filename + ":" + strconv.Itoa(lineNo) + ": duplicate user '" + fields[1] + "'")
+		}
+		if err := tmp.setUser(fields[1], fields[2:]); err != nil {
+			return nil, errors.New(filename + ":" + strconv.Itoa(lineNo) + ": " + err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// the default user is created if it is not in the file
+	if _, ok := tmp.users[DEFAULT_USER]; !ok {
+		tmp.users[DEFAULT_USER] = newDefaultUser()
+	}
+	return tmp.users, nil
+}
+
+// loadFile replace all the users by the acl file
+func (a *acl) loadFile() error {
+	users, err := parseAclFile(a.aclFile)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+	return nil
+}
+
+// saveFile write the users to a temp file and rename it to the acl file
+func (a *acl) saveFile() error {
+	var buf strings.Builder
+	for _, u := range a.sortedUsers() {
+		buf.WriteString(u.describe())
+		buf.WriteString("\n")
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(a.aclFile), "temp-acl-*.acl")
+	if err != nil {
+		return err
+	}
+	if _, err = tmpFile.WriteString(buf.String()); err == nil {
+		err = tmpFile.Sync()
+	}
+	_ = tmpFile.Close()
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), a.aclFile)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+	}
+	return err
+}
@@ -0,0 +1,319 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+AUTH [username] password
+ACL SETUSER username [rule [rule ...]]
+ACL GETUSER username
+ACL DELUSER username [username ...]
+ACL LIST
+ACL USERS
+ACL WHOAMI
+ACL CAT [category]
+ACL LOG [count | RESET]
+ACL LOAD
+ACL SAVE
+*/
+
+const (
+	NOAUTH_ERR             = "NOAUTH Authentication required."
+	WRONGPASS_ERR          = "WRONGPASS invalid username-password pair or user is disabled."
+	NOPERM_KEY_ERR         = "NOPERM No permissions to access a key"
+	NO_ACL_FILE_ERR        = "ERR This Redis instance is not configured to use an ACL file. You may want to specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis configuration file set) in order to store users in the Redis configuration."
+	AUTH_NO_PASS_ERR       = "ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?"
+	DEL_DEFAULT_ERR        = "ERR The 'default' user cannot be removed"
+	ACL_UNKNOWN_SUBCMD_ERR = "ERR unknown subcommand or wrong number of arguments for 'ACL'"
+)
+
+// initAcl set the password of the default user and load the acl file by the config
+func (r *RedisServer) initAcl() {
+	authConfig := config.GetAuthConfig()
+	if authConfig.AclFile != "" {
+		r.acl.aclFile = authConfig.AclFile
+		if authConfig.RequirePass != "" {
+			logger.Warn("the RequirePass is ignored because the AclFile is set")
+		}
+		err := r.acl.loadFile()
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("load acl file err: %v", err)
+		}
+		return
+	}
+	if authConfig.RequirePass != "" {
+		_ = r.acl.setUser(DEFAULT_USER, []string{"resetpass", ">" + authConfig.RequirePass})
+	}
+}
+
+// checkAcl authenticate the connection and check the permissions of the command and its keys
+func (r *RedisServer) checkAcl(conn redis.Conn, cmdLine [][]byte) *protocol.ErrReply {
+	username := conn.GetUser()
+	if username == connection.INTERNAL_USER {
+		return nil
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	// AUTH and HELLO are always allowed, they authenticate the connection by themselves
+	if cmdName == "auth" || cmdName == "hello" {
+		return nil
+	}
+
+	if username == "" {
+		if !r.authenticateDefault(conn) {
+			return protocol.NewErrReply(NOAUTH_ERR)
+		}
+		username = DEFAULT_USER
+	}
+	u := r.acl.getUser(username)
+	if u == nil || !u.enabled {
+		// the user is deleted or disabled after authentication
+		conn.SetUser("")
+		return protocol.NewErrReply(NOAUTH_ERR)
+	}
+
+	context := "toplevel"
+	if conn.InitMulti() {
+		context = "multi"
+	}
+	if !u.canRun(cmdLine) {
+		object := cmdName
+		if len(cmdLine) > 1 && commandHasSubcommand(cmdName) {
+			object += "|" + strings.ToLower(string(cmdLine[1]))
+		}
+		r.acl.addLog("command", context, object, u.name, conn.RemoteAddr())
+		return protocol.NewErrReply("NOPERM User " + u.name + " has no permissions to run the '" + object + "' command")
+	}
+
+	cmd, ok := commandTable[cmdName]
+	if !ok || cmd.prepare == nil || validCommand(cmdLine) != nil {
+		return nil
+	}
+	wks, rks := cmd.prepare(cmdLine[1:])
+	for _, key := range wks {
+		if !u.canAccess(key, aclKeyWrite) {
+			r.acl.addLog("key", context, key, u.name, conn.RemoteAddr())
+			return protocol.NewErrReply(NOPERM_KEY_ERR)
+		}
+	}
+	for _, key := range rks {
+		if !u.canAccess(key, aclKeyRead) {
+			r.acl.addLog("key", context, key, u.name, conn.RemoteAddr())
+			return protocol.NewErrReply(NOPERM_KEY_ERR)
+		}
+	}
+	return nil
+}
+
+// authenticateDefault authenticate the connection as the default user if it needs no password
+func (r *RedisServer) authenticateDefault(conn redis.Conn) bool {
+	if u := r.acl.getUser(DEFAULT_USER); u == nil || !u.enabled || !u.nopass {
+		return false
+	}
+	conn.SetUser(DEFAULT_USER)
+	return true
+}
+
+func commandHasSubcommand(cmdName string) bool {
+	return cmdName == "acl" || cmdName == "cluster"
+}
+
+// authenticate the connection as the user, the failure is recorded in the acl log
+func (r *RedisServer) authenticate(conn redis.Conn, username, password string) redis.Reply {
+	if r.acl.authenticate(username, password) == nil {
+		r.acl.addLog("auth", "toplevel", "AUTH", username, conn.RemoteAddr())
+		return protocol.NewErrReply(WRONGPASS_ERR)
+	}
+	conn.SetUser(username)
+	return protocol.NewOkReply()
+}
+
+// AUTH [username] password
+func (r *RedisServer) execAuth(conn redis.Conn, args [][]byte) redis.Reply {
+	if len(args) == 1 {
+		if u := r.acl.getUser(DEFAULT_USER); u != nil && u.nopass {
+			return protocol.NewErrReply(AUTH_NO_PASS_ERR)
+		}
+		return r.authenticate(conn, DEFAULT_USER, string(args[0]))
+	}
+	if len(args) == 2 {
+		return r.authenticate(conn, string(args[0]), string(args[1]))
+	}
+	return protocol.NewErrReply("ERR wrong number of arguments for 'auth' command")
+}
+
+func (r *RedisServer) execAcl(conn redis.Conn, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewErrReply("ERR wrong number of arguments for 'acl' command")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch {
+	case subCmd == "setuser" && len(args) >= 1:
+		rules := make([]string, len(args)-1)
+		for i, arg := range args[1:] {
+			rules[i] = string(arg)
+		}
+		if err := r.acl.setUser(string(args[0]), rules); err != nil {
+			return protocol.NewErrReply("ERR " + err.Error())
+		}
+		return protocol.NewOkReply()
+	case subCmd == "getuser" && len(args) == 1:
+		return r.execAclGetUser(string(args[0]))
+	case subCmd == "deluser" && len(args) >= 1:
+		return r.execAclDelUser(args)
+	case subCmd == "list" && len(args) == 0:
+		users := r.acl.sortedUsers()
+		lines := make([][]byte, len(users))
+		for i, u := range users {
+			lines[i] = []byte(u.describe())
+		}
+		return protocol.NewMultiReply(lines)
+	case subCmd == "users" && len(args) == 0:
+		users := r.acl.sortedUsers()
+		names := make([][]byte, len(users))
+		for i, u := range users {
+			names[i] = []byte(u.name)
+		}
+		return protocol.NewMultiReply(names)
+	case subCmd == "whoami" && len(args) == 0:
+		username := conn.GetUser()
+		if username == "" || username == connection.INTERNAL_USER {
+			username = DEFAULT_USER
+		}
+		return protocol.NewBulkReply([]byte(username))
+	case subCmd == "cat" && len(args) <= 1:
+		return execAclCat(args)
+	case subCmd == "log" && len(args) <= 1:
+		return r.execAclLog(args)
+	case subCmd == "load" && len(args) == 0:
+		if r.acl.aclFile == "" {
+			return protocol.NewErrReply(NO_ACL_FILE_ERR)
+		}
+		if err := r.acl.loadFile(); err != nil {
+			return protocol.NewErrReply("ERR " + err.Error())
+		}
+		return protocol.NewOkReply()
+	case subCmd == "save" && len(args) == 0:
+		if r.acl.aclFile == "" {
+			return protocol.NewErrReply(NO_ACL_FILE_ERR)
+		}
+		if err := r.acl.saveFile(); err != nil {
+			logger.Error("save acl file err: %v", err)
+			return protocol.NewErrReply("ERR There was an error trying to save the ACLs. Please check the server logs for more information")
+		}
+		return protocol.NewOkReply()
+	}
+	return protocol.NewErrReply(ACL_UNKNOWN_SUBCMD_ERR)
+}
+
+// ACL GETUSER username, reply a map of flags, passwords, commands and keys
+func (r *RedisServer) execAclGetUser(name string) redis.Reply {
+	u := r.acl.getUser(name)
+	if u == nil {
+		return protocol.NewNullBulkReply()
+	}
+	flags := u.flagsOf()
+	flagReplies := make([]redis.Reply, len(flags))
+	for i, flag := range flags {
+		flagReplies[i] = protocol.NewBulkReply([]byte(flag))
+	}
+	passwords := u.sortedPasswords()
+	passwordReplies := make([]redis.Reply, len(passwords))
+	for i, hash := range passwords {
+		passwordReplies[i] = protocol.NewBulkReply([]byte(hash))
+	}
+	return protocol.NewMapReply([]redis.Reply{
+		protocol.NewBulkReply([]byte("flags")), protocol.NewSetReply(flagReplies),
+		protocol.NewBulkReply([]byte("passwords")), protocol.NewMultiRawReply(passwordReplies),
+		protocol.NewBulkReply([]byte("commands")), protocol.NewBulkReply([]byte(u.commandsText())),
+		protocol.NewBulkReply([]byte("keys")), protocol.NewBulkReply([]byte(u.keysText())),
+	})
+}
+
+// ACL DELUSER username [username ...]
+func (r *RedisServer) execAclDelUser(args [][]byte) redis.Reply {
+	r.acl.mu.Lock()
+	defer r.acl.mu.Unlock()
+	for _, arg := range args {
+		if string(arg) == DEFAULT_USER {
+			return protocol.NewErrReply(DEL_DEFAULT_ERR)
+		}
+	}
+	var deleted int64
+	for _, arg := range args {
+		if _, ok := r.acl.users[string(arg)]; ok {
+			delete(r.acl.users, string(arg))
+			deleted++
+		}
+	}
+	return protocol.NewIntReply(deleted)
+}
+
+// ACL CAT [category]
+func execAclCat(args [][]byte) redis.Reply {
+	var names []string
+	if len(args) == 0 {
+		for category := range aclCategories {
+			names = append(names, category)
+		}
+	} else {
+		cmdNames, ok := aclCategories[strings.ToLower(string(args[0]))]
+		if !ok {
+			return protocol.NewErrReply("ERR Unknown category '" + string(args[0]) + "'")
+		}
+		names = append(names, cmdNames...)
+	}
+	sort.Strings(names)
+	replies := make([][]byte, len(names))
+	for i, name := range names {
+		replies[i] = []byte(name)
+	}
+	return protocol.NewMultiReply(replies)
+}
+
+// ACL LOG [count | RESET]
+func (r *RedisServer) execAclLog(args [][]byte) redis.Reply {
+	count := 10
+	if len(args) == 1 {
+		if strings.ToLower(string(args[0])) == "reset" {
+			r.acl.mu.Lock()
+			r.acl.logs = nil
+			r.acl.mu.Unlock()
+			return protocol.NewOkReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return protocol.NewErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	r.acl.mu.RLock()
+	defer r.acl.mu.RUnlock()
+	now := time.Now()
+	replies := make([]redis.Reply, 0, count)
+	for i := 0; i < len(r.acl.logs) && i < count; i++ {
+		entry := r.acl.logs[i]
+		age := strconv.FormatFloat(now.Sub(entry.createdAt).Seconds(), 'f', 3, 64)
+		replies = append(replies, protocol.NewMapReply([]redis.Reply{
+			protocol.NewBulkReply([]byte("count")), protocol.NewIntReply(entry.count),
+			protocol.NewBulkReply([]byte("reason")), protocol.NewBulkReply([]byte(entry.reason)),
+			protocol.NewBulkReply([]byte("context")), protocol.NewBulkReply([]byte(entry.context)),
+			protocol.NewBulkReply([]byte("object")), protocol.NewBulkReply([]byte(entry.object)),
+			protocol.NewBulkReply([]byte("username")), protocol.NewBulkReply([]byte(entry.username)),
+			protocol.NewBulkReply([]byte("age-seconds")), protocol.NewBulkReply([]byte(age)),
+			protocol.NewBulkReply([]byte("client-info")), protocol.NewBulkReply([]byte(entry.clientInfo)),
+		}))
+	}
+	return protocol.NewMultiRawReply(replies)
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newClientConn create the connection of a client which is not authenticated
+func newClientConn() *connection.FakeConnection {
+	conn := connection.NewFakeConnection()
+	conn.SetUser("")
+	return conn
+}
+
+func TestAuth(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	if reply := replyOf(server, conn, "SET", "k", "v"); reply != "+OK\r\n" {
+		t.Error("the default user needs no password: ", reply)
+	}
+	if reply := replyOf(server, conn, "AUTH", "pass"); reply != "-"+AUTH_NO_PASS_ERR+"\r\n" {
+		t.Error("auth without password configured err: ", reply)
+	}
+
+	replyOf(server, conn, "ACL", "SETUSER", "default", "resetpass", ">pass")
+	conn = newClientConn()
+	if reply := replyOf(server, conn, "GET", "k"); reply != "-"+NOAUTH_ERR+"\r\n" {
+		t.Error("noauth err: ", reply)
+	}
+	if reply := replyOf(server, conn, "HELLO", "3"); reply != "-"+HELLO_AUTH_ERR+"\r\n" {
+		t.Error("hello without auth err: ", reply)
+	}
+	if reply := replyOf(server, conn, "AUTH", "wrong"); reply != "-"+WRONGPASS_ERR+"\r\n" {
+		t.Error("wrongpass err: ", reply)
+	}
+	if reply := replyOf(server, conn, "AUTH", "pass"); reply != "+OK\r\n" {
+		t.Error("auth err: ", reply)
+	}
+	if reply := replyOf(server, conn, "GET", "k"); reply != "$1\r\nv\r\n" {
+		t.Error("get after auth err: ", reply)
+	}
+
+	conn = newClientConn()
+	if reply := replyOf(server, conn, "HELLO", "2", "AUTH", "default", "pass"); !strings.Contains(reply, "proto") {
+		t.Error("hello with auth err: ", reply)
+	}
+	if reply := replyOf(server, conn, "ACL", "WHOAMI"); reply != "$7\r\ndefault\r\n" {
+		t.Error("whoami err: ", reply)
+	}
+	if reply := replyOf(server, conn, "ACL", "LOG", "1"); !strings.Contains(reply, "$4\r\nauth\r\n") {
+		t.Error("the failed auth should be logged: ", reply)
+	}
+}
+
+func TestAclUser(t *testing.T) {
+	server := NewPureServer()
+	admin := connection.NewFakeConnection()
+	reply := replyOf(server, admin, "ACL", "SETUSER", "alice", "on", ">secret", "~cache:*", "%R~log:*",
+		"+@read", "+set", "-keys")
+	if reply != "+OK\r\n" {
+		t.Fatal("setuser err: ", reply)
+	}
+	if reply = replyOf(server, admin, "ACL", "SETUSER", "bob", "+nosuchcmd"); !strings.HasPrefix(reply, "-ERR Error in ACL SETUSER modifier '+nosuchcmd'") {
+		t.Error("setuser with unknown command err: ", reply)
+	}
+	if reply = replyOf(server, admin, "ACL", "USERS"); reply != "*2\r\n$5\r\nalice\r\n$7\r\ndefault\r\n" {
+		t.Error("the invalid user should not be created: ", reply)
+	}
+	line := "user alice on #" + hashPassword("secret") + " ~cache:* %R~log:* +@read +set -keys"
+	if reply = replyOf(server, admin, "ACL", "LIST"); !strings.Contains(reply, line) {
+		t.Error("acl list err: ", reply)
+	}
+	if reply = replyOf(server, admin, "ACL", "GETUSER", "alice"); !strings.Contains(reply, "+@read +set -keys") {
+		t.Error("getuser err: ", reply)
+	}
+
+	conn := newClientConn()
+	replyOf(server, conn, "AUTH", "alice", "secret")
+	cases := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"SET", "cache:1", "v"}, "+OK\r\n"},
+		{[]string{"GET", "cache:1"}, "$1\r\nv\r\n"},
+		{[]string{"GET", "log:1"}, ""},
+		{[]string{"SET", "log:1", "v"}, "-" + NOPERM_KEY_ERR + "\r\n"},
+		{[]string{"GET", "other"}, "-" + NOPERM_KEY_ERR + "\r\n"},
+		{[]string{"DEL", "cache:1"}, "-NOPERM User alice has no permissions to run the 'del' command\r\n"},
+		{[]string{"KEYS", "*"}, "-NOPERM User alice has no permissions to run the 'keys' command\r\n"},
+		{[]string{"ACL", "SETUSER", "alice", "+@all"}, "-NOPERM User alice has no permissions to run the 'acl|setuser' command\r\n"},
+	}
+	for _, c := range cases {
+		reply := replyOf(server, conn, c.args...)
+		if c.expected == "" {
+			if strings.HasPrefix(reply, "-NOPERM") {
+				t.Errorf("%v should be allowed: %s", c.args, reply)
+			}
+		} else if reply != c.expected {
+			t.Errorf("%v expected %q, got %q", c.args, c.expected, reply)
+		}
+	}
+	if reply = replyOf(server, admin, "ACL", "LOG"); !strings.Contains(reply, "$3\r\ndel\r\n") ||
+		!strings.Contains(reply, "$5\r\nother\r\n") {
+		t.Error("acl log err: ", reply)
+	}
+	replyOf(server, admin, "ACL", "LOG", "RESET")
+	if reply = replyOf(server, admin, "ACL", "LOG"); reply != "*0\r\n" {
+		t.Error("acl log reset err: ", reply)
+	}
+
+	// the transaction is aborted by the denied command
+	replyOf(server, conn, "MULTI")
+	replyOf(server, conn, "SET", "cache:2", "v")
+	replyOf(server, conn, "SET", "other", "v")
+	if reply = replyOf(server, conn, "EXEC"); !strings.HasPrefix(reply, "-") {
+		t.Error("the transaction should be aborted: ", reply)
+	}
+
+	// the connection is not authenticated after the user is deleted
+	if reply = replyOf(server, admin, "ACL", "DELUSER", "alice", "nobody"); reply != ":1\r\n" {
+		t.Error("deluser err: ", reply)
+	}
+	if reply = replyOf(server, conn, "GET", "cache:1"); reply != "-"+NOAUTH_ERR+"\r\n" {
+		t.Error("get after the user is deleted err: ", reply)
+	}
+	if reply = replyOf(server, admin, "ACL", "DELUSER", "default"); reply != "-"+DEL_DEFAULT_ERR+"\r\n" {
+		t.Error("delete the default user err: ", reply)
+	}
+}
+
+func TestAclFile(t *testing.T) {
+	server := NewPureServer()
+	admin := connection.NewFakeConnection()
+	if reply := replyOf(server, admin, "ACL", "SAVE"); reply != "-"+NO_ACL_FILE_ERR+"\r\n" {
+		t.Error("save without acl file err: ", reply)
+	}
+	server.acl.aclFile = filepath.Join(t.TempDir(), "users.acl")
+	replyOf(server, admin, "ACL", "SETUSER", "alice", "on", ">secret", "allkeys", "+@all", "-@dangerous")
+	if reply := replyOf(server, admin, "ACL", "SAVE"); reply != "+OK\r\n" {
+		t.Fatal("acl save err: ", reply)
+	}
+	replyOf(server, admin, "ACL", "DELUSER", "alice")
+	if reply := replyOf(server, admin, "ACL", "LOAD"); reply != "+OK\r\n" {
+		t.Fatal("acl load err: ", reply)
+	}
+	u := server.acl.getUser("alice")
+	if u == nil || !u.checkPassword("secret") || !u.canRun([][]byte{[]byte("get")}) || u.canRun([][]byte{[]byte("save")}) {
+		t.Error("the loaded user err")
+	}
+
+	// the invalid file is not applied
+	_ = os.WriteFile(server.acl.aclFile, []byte("user bob on +nosuchcmd\n"), 0644)
+	if reply := replyOf(server, admin, "ACL", "LOAD"); !strings.HasPrefix(reply, "-ERR") {
+		t.Error("load the invalid file err: ", reply)
+	}
+	if server.acl.getUser("alice") == nil {
+		t.Error("the users should be kept when the file is invalid")
+	}
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+BLPOP key [key ...] timeout
+BRPOP key [key ...] timeout
+BRPOPLPUSH source destination timeout
+BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+BZPOPMIN key [key ...] timeout
+BZPOPMAX key [key ...] timeout
+the command is executed as the non-blocking one at first, the client waits for the keys when it gets nothing.
+the waiters of a key are served in FIFO order, the push wakes the first waiter and the waiter tries again
+under the key locks, so no lock is held while waiting. the commands never block inside MULTI
+*/
+
+const (
+	TIMEOUT_ERR          = "ERR timeout is not a float or out of range"
+	TIMEOUT_NEGATIVE_ERR = "ERR timeout is negative"
+)
+
+func init() {
+	RegisterCommand("BLPOP", execBLPop, prepareBlockingPop, rollbackBlockingPop, -3)
+	RegisterCommand("BRPOP", execBRPop, prepareBlockingPop, rollbackBlockingPop, -3)
+	RegisterCommand("BRPOPLPUSH", execBRPopLPush, prepareListMove, rollbackListMove, 4)
+	RegisterCommand("BLMOVE", execBLMove, prepareListMove, rollbackListMove, 6)
+}
+
+// blockingCommand is the command which blocks the client, ready filters the keys can be served now
+type blockingCommand struct {
+	exec func(db *Database, args [][]byte, ready func(key string) bool) redis.Reply
+	// keys get the keys the client waits for
+	keys func(args [][]byte) []string
+}
+
+var blockingCommands = map[string]*blockingCommand{
+	"blpop": {exec: func(db *Database, args [][]byte, ready func(key string) bool) redis.Reply {
+		return blockingPop(db, args, true, ready)
+	}, keys: blockingPopKeys},
+	"brpop": {exec: func(db *Database, args [][]byte, ready func(key string) bool) redis.Reply {
+		return blockingPop(db, args, false, ready)
+	}, keys: blockingPopKeys},
+	"brpoplpush": {exec: blockingRPopLPush, keys: blockingMoveKeys},
+	"blmove":     {exec: blockingMove, keys: blockingMoveKeys},
+	"bzpopmin": {exec: func(db *Database, args [][]byte, ready func(key string) bool) redis.Reply {
+		return blockingZPop(db, args, false, ready)
+	}, keys: blockingPopKeys},
+	"bzpopmax": {exec: func(db *Database, args [][]byte, ready func(key string) bool) redis.Reply {
+		return blockingZPop(db, args, true, ready)
+	}, keys: blockingPopKeys},
+}
+
+// blockedClient is the client waiting for the keys
+type blockedClient struct {
+	conn    redis.Conn
+	dbIndex int
+	keys    []string
+	// wake is signalled when the client may be served
+	wake chan struct{}
+	// done is closed when the client is disconnected
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type blockingKey struct {
+	dbIndex int
+	key     string
+}
+
+// blockingKeys keep the blocked clients of the keys, it is shared by all the databases of the server
+type blockingKeys struct {
+	mu sync.Mutex
+	// waiters: the clients blocked on the key in the order of arrival
+	waiters map[blockingKey][]*blockedClient
+	// clients: connection id -> the blocked client
+	clients map[int64]*blockedClient
+	// count is the number of the blocked clients, the pushes read it without the lock
+	count int32
+}
+
+func newBlockingKeys() *blockingKeys {
+	return &blockingKeys{
+		waiters: make(map[blockingKey][]*blockedClient),
+		clients: make(map[int64]*blockedClient),
+	}
+}
+
+func newBlockedClient(conn redis.Conn, dbIndex int, keys []string) *blockedClient {
+	return &blockedClient{
+		conn:    conn,
+		dbIndex: dbIndex,
+		keys:    keys,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// notify wake the client without blocking, the signal is kept until the client receives it
+func (client *blockedClient) notify() {
+	select {
+	case client.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *blockingKeys) add(client *blockedClient) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range client.keys {
+		bk := blockingKey{dbIndex: client.dbIndex, key: key}
+		b.waiters[bk] = append(b.waiters[bk], client)
+	}
+	b.clients[client.conn.GetID()] = client
+	atomic.AddInt32(&b.count, 1)
+}
+
+// remove the client from the keys, the next waiter is woken if the client was the first one
+// since the key may still have the elements
+func (b *blockingKeys) remove(client *blockedClient) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range client.keys {
+		bk := blockingKey{dbIndex: client.dbIndex, key: key}
+		queue := b.waiters[bk]
+		for i, waiter := range queue {
+			if waiter != client {
+				continue
+			}
+			queue = append(queue[:i], queue[i+1:]...)
+			if i == 0 && len(queue) > 0 {
+				queue[0].notify()
+			}
+			break
+		}
+		if len(queue) == 0 {
+			delete(b.waiters, bk)
+		} else {
+			b.waiters[bk] = queue
+		}
+	}
+	delete(b.clients, client.conn.GetID())
+	atomic.AddInt32(&b.count, -1)
+}
+
+// signal wake the first client blocked on the key
+func (b *blockingKeys) signal(dbIndex int, key string) {
+	if atomic.LoadInt32(&b.count) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if queue := b.waiters[blockingKey{dbIndex: dbIndex, key: key}]; len(queue) > 0 {
+		queue[0].notify()
+	}
+}
+
+// hasWaiters judge whether any client is blocked on the key
+func (b *blockingKeys) hasWaiters(dbIndex int, key string) bool {
+	if atomic.LoadInt32(&b.count) == 0 {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.waiters[blockingKey{dbIndex: dbIndex, key: key}]) > 0
+}
+
+// isFirst judge whether the client is the first one waiting for the key
+func (b *blockingKeys) isFirst(client *blockedClient, key string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queue := b.waiters[blockingKey{dbIndex: client.dbIndex, key: key}]
+	return len(queue) > 0 && queue[0] == client
+}
+
+// unblock wake the client blocked by the connection, it is called when the client is disconnected
+func (b *blockingKeys) unblock(conn redis.Conn) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if client, ok := b.clients[conn.GetID()]; ok {
+		client.closeOnce.Do(func() {
+			close(client.done)
+		})
+	}
+}
+
+func (b *blockingKeys) len() int {
+	return int(atomic.LoadInt32(&b.count))
+}
+
+// signalBlocked wake the first client blocked on the key after the key is pushed
+func (db *Database) signalBlocked(key string) {
+	db.blocking.signal(db.index, key)
+}
+
+// noWaiters is the filter of the keys for the clients not blocked, the key waited by others is left to them
+func (db *Database) noWaiters(key string) bool {
+	return !db.blocking.hasWaiters(db.index, key)
+}
+
+// prepareBlockingPop: BLPOP key [key ...] timeout
+func prepareBlockingPop(args [][]byte) ([]string, []string) {
+	return writeKeys(args[:len(args)-1])
+}
+
+func rollbackBlockingPop(db *Database, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, blockingPopKeys(args)...)
+}
+
+func blockingPopKeys(args [][]byte) []string {
+	keys, _ := writeKeys(args[:len(args)-1])
+	return keys
+}
+
+func blockingMoveKeys(args [][]byte) []string {
+	return []string{string(args[0])}
+}
+
+// parseTimeout parse the timeout in seconds, 0 means blocking forever
+func parseTimeout(arg []byte) (time.Duration, redis.Reply) {
+	timeout, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(timeout) || math.IsInf(timeout, 0) {
+		return 0, protocol.NewErrReply(TIMEOUT_ERR)
+	}
+	if timeout < 0 {
+		return 0, protocol.NewErrReply(TIMEOUT_NEGATIVE_ERR)
+	}
+	return time.Duration(timeout * float64(time.Second)), nil
+}
+
+// blockingPop pop from the first non-empty list of the keys, return the null array if all of them are empty
+func blockingPop(db *Database, args [][]byte, left bool, ready func(key string) bool) redis.Reply {
+	if _, errReply := parseTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, key := range blockingPopKeys(args) {
+		if !ready(key) {
+			continue
+		}
+		ll, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if ll == nil || ll.Empty() {
+			continue
+		}
+		value := db.popList(key, ll, left)
+		if left {
+			db.addAof(utils.CmdLine1("LPOP", key))
+		} else {
+			db.addAof(utils.CmdLine1("RPOP", key))
+		}
+		return protocol.NewMultiReply([][]byte{[]byte(key), []byte(value)})
+	}
+	return protocol.NewNullArrayReply()
+}
+
+// BLPOP key [key ...] timeout
+func execBLPop(db *Database, args [][]byte) redis.Reply {
+	return blockingPop(db, args, true, db.noWaiters)
+}
+
+// BRPOP key [key ...] timeout
+func execBRPop(db *Database, args [][]byte) redis.Reply {
+	return blockingPop(db, args, false, db.noWaiters)
+}
+
+func blockingMove(db *Database, args [][]byte, ready func(key string) bool) redis.Reply {
+	fromLeft, ok1 := parseListSide(args[2])
+	toLeft, ok2 := parseListSide(args[3])
+	if !ok1 || !ok2 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	if _, errReply := parseTimeout(args[4]); errReply != nil {
+		return errReply
+	}
+	return moveList(db, string(args[0]), string(args[1]), fromLeft, toLeft, ready)
+}
+
+func blockingRPopLPush(db *Database, args [][]byte, ready func(key string) bool) redis.Reply {
+	if _, errReply := parseTimeout(args[2]); errReply != nil {
+		return errReply
+	}
+	return moveList(db, string(args[0]), string(args[1]), false, true, ready)
+}
+
+// BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func execBLMove(db *Database, args [][]byte) redis.Reply {
+	return blockingMove(db, args, db.noWaiters)
+}
+
+// BRPOPLPUSH source destination timeout
+func execBRPopLPush(db *Database, args [][]byte) redis.Reply {
+	return blockingRPopLPush(db, args, db.noWaiters)
+}
+
+func isBlockedReply(reply redis.Reply) bool {
+	switch reply.(type) {
+	case *protocol.NullArrayReply, *protocol.NullBulkReply:
+		return true
+	}
+	return false
+}
+
+// blockClient wait for the keys of the blocking command until it is served, timeout or the client is disconnected,
+// nothing is the reply of the first try which is returned when the client gets nothing
+func (r *RedisServer) blockClient(conn redis.Conn, cmdName string, cmdLine [][]byte, nothing redis.Reply) redis.Reply {
+	blocking := blockingCommands[cmdName]
+	timeout, _ := parseTimeout(cmdLine[len(cmdLine)-1])
+	client := newBlockedClient(conn, conn.GetDBIndex(), blocking.keys(cmdLine[1:]))
+	r.blocking.add(client)
+	defer r.blocking.remove(client)
+
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	// the key may be pushed before the client is added, so it tries at once
+	for {
+		if reply := r.serveBlocked(client, cmdName, cmdLine); !isBlockedReply(reply) {
+			return reply
+		}
+		select {
+		case <-client.wake:
+		case <-deadline:
+			return nothing
+		case <-client.done:
+			return nothing
+		}
+	}
+}
+
+// serveBlocked try the blocking command again with the keys the client is the first waiter of
+func (r *RedisServer) serveBlocked(client *blockedClient, cmdName string, cmdLine [][]byte) redis.Reply {
+	ready := func(key string) bool {
+		return r.blocking.isFirst(client, key)
+	}
+	first := false
+	for _, key := range client.keys {
+		first = first || ready(key)
+	}
+	if !first {
+		return protocol.NewNullBulkReply()
+	}
+	db, err := r.selectDB(client.dbIndex)
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	blocking := blockingCommands[cmdName]
+	retry := *commandTable[cmdName]
+	retry.exector = func(db *Database, args [][]byte) redis.Reply {
+		return blocking.exec(db, args, ready)
+	}
+	return db.execLocked(cmdName, &retry, cmdLine)
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+// waitBlocked wait until there are n clients blocked
+func waitBlocked(t *testing.T, server *RedisServer, n int) {
+	deadline := time.Now().Add(time.Second)
+	for server.blocking.len() != n {
+		if time.Now().After(deadline) {
+			t.Fatal("blocked clients err: ", server.blocking.len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingReply exec the command in another goroutine
+func blockingReply(server *RedisServer, args ...string) <-chan string {
+	ch := make(chan string, 1)
+	conn := newClientConn()
+	go func() {
+		ch <- replyOf(server, conn, args...)
+	}()
+	return ch
+}
+
+func TestBlockingPop(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	replyOf(server, conn, "RPUSH", "list", "a", "b")
+	if reply := replyOf(server, conn, "BRPOP", "empty", "list", "0"); reply != "*2\r\n$4\r\nlist\r\n$1\r\nb\r\n" {
+		t.Error("brpop of the non-empty list err: ", reply)
+	}
+	if reply := replyOf(server, conn, "BLPOP", "list", "0"); reply != "*2\r\n$4\r\nlist\r\n$1\r\na\r\n" {
+		t.Error("blpop of the non-empty list err: ", reply)
+	}
+	if reply := replyOf(server, conn, "EXISTS", "list"); reply != ":0\r\n" {
+		t.Error("the empty list should be removed: ", reply)
+	}
+
+	start := time.Now()
+	if reply := replyOf(server, conn, "BLPOP", "list", "0.1"); reply != "*-1\r\n" || time.Since(start) < 100*time.Millisecond {
+		t.Error("blpop timeout err: ", reply, time.Since(start))
+	}
+	if reply := replyOf(server, conn, "BLPOP", "list", "-1"); reply != "-"+TIMEOUT_NEGATIVE_ERR+"\r\n" {
+		t.Error("negative timeout err: ", reply)
+	}
+	if reply := replyOf(server, conn, "BLPOP", "list", "abc"); reply != "-"+TIMEOUT_ERR+"\r\n" {
+		t.Error("invalid timeout err: ", reply)
+	}
+	replyOf(server, conn, "SET", "str", "v")
+	if reply := replyOf(server, conn, "BLPOP", "str", "0"); reply != "-"+WRONG_TYPE_ERR+"\r\n" {
+		t.Error("blpop of the wrong type err: ", reply)
+	}
+	if server.blocking.len() != 0 {
+		t.Error("no client should be blocked: ", server.blocking.len())
+	}
+}
+
+func TestBlockingFIFO(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	first := blockingReply(server, "BLPOP", "q1", "queue", "0")
+	waitBlocked(t, server, 1)
+	second := blockingReply(server, "BLPOP", "queue", "0")
+	waitBlocked(t, server, 2)
+
+	replyOf(server, conn, "RPUSH", "queue", "a", "b")
+	if reply := <-first; reply != "*2\r\n$5\r\nqueue\r\n$1\r\na\r\n" {
+		t.Error("the first waiter err: ", reply)
+	}
+	if reply := <-second; reply != "*2\r\n$5\r\nqueue\r\n$1\r\nb\r\n" {
+		t.Error("the second waiter err: ", reply)
+	}
+	waitBlocked(t, server, 0)
+}
+
+func TestBlockingMove(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	moved := blockingReply(server, "BLMOVE", "src", "dest", "LEFT", "RIGHT", "0")
+	waitBlocked(t, server, 1)
+	replyOf(server, conn, "LPUSH", "src", "x")
+	if reply := <-moved; reply != "$1\r\nx\r\n" {
+		t.Error("blmove err: ", reply)
+	}
+	if reply := replyOf(server, conn, "LINDEX", "dest", "0"); reply != "$1\r\nx\r\n" {
+		t.Error("blmove destination err: ", reply)
+	}
+
+	if reply := replyOf(server, conn, "BRPOPLPUSH", "dest", "dest", "0"); reply != "$1\r\nx\r\n" {
+		t.Error("brpoplpush rotation err: ", reply)
+	}
+	if reply := replyOf(server, conn, "LLEN", "dest"); reply != ":1\r\n" {
+		t.Error("brpoplpush rotation should keep the element: ", reply)
+	}
+	if reply := replyOf(server, conn, "BLMOVE", "dest", "src", "UP", "LEFT", "0"); reply != "-"+SYNTAX_ERR+"\r\n" {
+		t.Error("blmove syntax err: ", reply)
+	}
+	if reply := replyOf(server, conn, "BRPOPLPUSH", "none", "dest", "0.01"); reply != "$-1\r\n" {
+		t.Error("brpoplpush timeout err: ", reply)
+	}
+}
+
+func TestBlockingInMulti(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	replyOf(server, conn, "MULTI")
+	replyOf(server, conn, "BLPOP", "empty", "0")
+	done := make(chan string, 1)
+	go func() {
+		done <- replyOf(server, conn, "EXEC")
+	}()
+	select {
+	case reply := <-done:
+		if reply != "*1\r\n*-1\r\n" {
+			t.Error("blpop in multi err: ", reply)
+		}
+	case <-time.After(time.Second):
+		t.Error("blpop should not block in multi")
+	}
+}
+
+func TestBlockingDisconnect(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	done := make(chan string, 1)
+	go func() {
+		done <- replyOf(server, conn, "BRPOP", "queue", "0")
+	}()
+	waitBlocked(t, server, 1)
+	server.AfterClientClose(conn)
+	if reply := <-done; reply != "*-1\r\n" {
+		t.Error("the disconnected client err: ", reply)
+	}
+	waitBlocked(t, server, 0)
+
+	// the element pushed later is left in the list
+	replyOf(server, newClientConn(), "RPUSH", "queue", "a")
+	if reply := replyOf(server, newClientConn(), "LLEN", "queue"); reply != ":1\r\n" {
+		t.Error("the list after the disconnection err: ", reply)
+	}
+}
@@ -0,0 +1,434 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+CLIENT ID
+CLIENT INFO
+CLIENT LIST [TYPE normal|master|replica|pubsub] [ID client-id [client-id ...]]
+CLIENT KILL ip:port
+CLIENT KILL [ID client-id] [ADDR ip:port] [USER username] [TYPE normal|master|replica|pubsub] [SKIPME yes|no]
+CLIENT SETNAME connection-name
+CLIENT GETNAME
+CLIENT PAUSE timeout [WRITE|ALL]
+CLIENT UNPAUSE
+CLIENT NO-EVICT ON|OFF
+*/
+
+const (
+	CLIENT_UNKNOWN_SUBCMD_ERR = "ERR unknown subcommand or wrong number of arguments for 'CLIENT'"
+	CLIENT_NAME_ERR           = "ERR Client names cannot contain spaces, newlines or special characters."
+	NO_SUCH_CLIENT_ERR        = "ERR No such client"
+	PAUSE_TIMEOUT_ERR         = "ERR timeout is not an integer or out of range"
+	SYNTAX_ERR                = "ERR syntax error"
+)
+
+const (
+	CLIENT_TYPE_NORMAL  = "normal"
+	CLIENT_TYPE_REPLICA = "replica"
+	CLIENT_TYPE_PUBSUB  = "pubsub"
+	CLIENT_TYPE_MASTER  = "master"
+)
+
+// clientPause is the state set by CLIENT PAUSE, the commands of the clients are held until the end
+type clientPause struct {
+	// all: hold all the commands, otherwise only the write commands are held
+	all bool
+	end time.Time
+	// done is closed when the pause is replaced or cancelled, the waiting commands check the state again
+	done chan struct{}
+}
+
+// clientFilter is the filters of CLIENT LIST and CLIENT KILL, the zero value matches every client
+type clientFilter struct {
+	ids        map[int64]bool
+	addr       string
+	user       string
+	clientType string
+	skipConn   redis.Conn
+}
+
+func (r *RedisServer) AfterClientConnect(conn redis.Conn) {
+	r.clients.Store(conn.GetID(), conn)
+	atomic.AddInt64(&r.stats.totalConnections, 1)
+}
+
+func (r *RedisServer) execClient(conn redis.Conn, args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewErrReply(CLIENT_UNKNOWN_SUBCMD_ERR)
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch {
+	case subCmd == "id" && len(args) == 1:
+		return protocol.NewIntReply(conn.GetID())
+	case subCmd == "info" && len(args) == 1:
+		return protocol.NewVerbatimReply("txt", []byte(r.clientInfo(conn)+"\n"))
+	case subCmd == "list":
+		return r.execClientList(args[1:])
+	case subCmd == "kill" && len(args) >= 2:
+		return r.execClientKill(conn, args[1:])
+	case subCmd == "setname" && len(args) == 2:
+		name := string(args[1])
+		if !validClientName(name) {
+			return protocol.NewErrReply(CLIENT_NAME_ERR)
+		}
+		conn.SetName(name)
+		return protocol.NewOkReply()
+	case subCmd == "getname" && len(args) == 1:
+		name := conn.GetName()
+		if name == "" {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewBulkReply([]byte(name))
+	case subCmd == "pause" && (len(args) == 2 || len(args) == 3):
+		return r.execClientPause(args[1:])
+	case subCmd == "unpause" && len(args) == 1:
+		r.unpauseClients()
+		return protocol.NewOkReply()
+	case subCmd == "no-evict" && len(args) == 2:
+		switch strings.ToLower(string(args[1])) {
+		case "on":
+			conn.SetNoEvict(true)
+		case "off":
+			conn.SetNoEvict(false)
+		default:
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+		return protocol.NewOkReply()
+	}
+	return protocol.NewErrReply(CLIENT_UNKNOWN_SUBCMD_ERR)
+}
+
+func (r *RedisServer) execClientList(args [][]byte) redis.Reply {
+	filter := &clientFilter{}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if i+1 >= len(args) {
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+		switch option {
+		case "type":
+			clientType, ok := parseClientType(string(args[i+1]))
+			if !ok {
+				return protocol.NewErrReply("ERR Unknown client type '" + string(args[i+1]) + "'")
+			}
+			filter.clientType = clientType
+			i++
+		case "id":
+			// all the arguments left are the ids
+			filter.ids = make(map[int64]bool)
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(string(args[i]), 10, 64)
+				if err != nil || id <= 0 {
+					return protocol.NewErrReply("ERR Invalid client ID")
+				}
+				filter.ids[id] = true
+			}
+		default:
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+	}
+
+	var builder strings.Builder
+	for _, client := range r.filterClients(filter) {
+		builder.WriteString(r.clientInfo(client))
+		builder.WriteByte('\n')
+	}
+	return protocol.NewVerbatimReply("txt", []byte(builder.String()))
+}
+
+func (r *RedisServer) execClientKill(conn redis.Conn, args [][]byte) redis.Reply {
+	// the old form only has the address of the client
+	if len(args) == 1 {
+		clients := r.filterClients(&clientFilter{addr: string(args[0])})
+		if len(args[0]) == 0 || len(clients) == 0 {
+			return protocol.NewErrReply(NO_SUCH_CLIENT_ERR)
+		}
+		r.killClients(clients)
+		return protocol.NewOkReply()
+	}
+
+	filter := &clientFilter{skipConn: conn}
+	if len(args)%2 != 0 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return protocol.NewErrReply("ERR client-id should be greater than 0")
+			}
+			filter.ids = map[int64]bool{id: true}
+		case "addr":
+			filter.addr = value
+		case "user":
+			filter.user = value
+		case "type":
+			clientType, ok := parseClientType(value)
+			if !ok {
+				return protocol.NewErrReply("ERR Unknown client type '" + value + "'")
+			}
+			filter.clientType = clientType
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				filter.skipConn = conn
+			case "no":
+				filter.skipConn = nil
+			default:
+				return protocol.NewErrReply(SYNTAX_ERR)
+			}
+		default:
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+	}
+	clients := r.filterClients(filter)
+	r.killClients(clients)
+	return protocol.NewIntReply(int64(len(clients)))
+}
+
+// killClients close the connections, the handler of the connection cleans it up after the reading fails
+func (r *RedisServer) killClients(clients []redis.Conn) {
+	for _, client := range clients {
+		r.clients.Delete(client.GetID())
+		_ = client.Close()
+	}
+}
+
+// filterClients return the clients matching the filter in the order of id
+func (r *RedisServer) filterClients(filter *clientFilter) []redis.Conn {
+	clients := make([]redis.Conn, 0)
+	r.clients.Range(func(key, value any) bool {
+		client := value.(redis.Conn)
+		if r.matchClient(client, filter) {
+			clients = append(clients, client)
+		}
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].GetID() < clients[j].GetID()
+	})
+	return clients
+}
+
+func (r *RedisServer) matchClient(client redis.Conn, filter *clientFilter) bool {
+	if filter.skipConn != nil && filter.skipConn.GetID() == client.GetID() {
+		return false
+	}
+	if filter.ids != nil && !filter.ids[client.GetID()] {
+		return false
+	}
+	if filter.addr != "" && filter.addr != client.RemoteAddr() {
+		return false
+	}
+	if filter.user != "" && filter.user != clientUser(client) {
+		return false
+	}
+	return filter.clientType == "" || filter.clientType == r.clientType(client)
+}
+
+// clientType return the type of the client, the link to the master is not a client of the server,
+// so there is never a client of the master type
+func (r *RedisServer) clientType(client redis.Conn) string {
+	if r.repl != nil && r.repl.hasReplica(client) {
+		return CLIENT_TYPE_REPLICA
+	}
+	if client.SubsCount() > 0 {
+		return CLIENT_TYPE_PUBSUB
+	}
+	return CLIENT_TYPE_NORMAL
+}
+
+func parseClientType(s string) (string, bool) {
+	switch strings.ToLower(s) {
+	case CLIENT_TYPE_NORMAL:
+		return CLIENT_TYPE_NORMAL, true
+	case CLIENT_TYPE_REPLICA, "slave":
+		return CLIENT_TYPE_REPLICA, true
+	case CLIENT_TYPE_PUBSUB:
+		return CLIENT_TYPE_PUBSUB, true
+	case CLIENT_TYPE_MASTER:
+		return CLIENT_TYPE_MASTER, true
+	}
+	return "", false
+}
+
+// clientUser return the acl user of the client, the client not authenticated yet is shown as the default user
+func clientUser(client redis.Conn) string {
+	if user := client.GetUser(); user != "" {
+		return user
+	}
+	return DEFAULT_USER
+}
+
+// clientInfo format the client like a line of CLIENT LIST
+func (r *RedisServer) clientInfo(client redis.Conn) string {
+	now := time.Now()
+	clientType := r.clientType(client)
+	flags := ""
+	if clientType == CLIENT_TYPE_REPLICA {
+		flags += "S"
+	}
+	if clientType == CLIENT_TYPE_PUBSUB {
+		flags += "P"
+	}
+	if r.isMonitor(client) {
+		flags += "O"
+	}
+	multi := -1
+	if client.InitMulti() {
+		flags += "x"
+		multi = len(client.GetCmdLineInQueue())
+	}
+	if client.IsNoEvict() {
+		flags += "e"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+
+	fields := []string{
+		"id=" + strconv.FormatInt(client.GetID(), 10),
+		"addr=" + client.RemoteAddr(),
+		"name=" + client.GetName(),
+		"age=" + strconv.Itoa(int(now.Sub(client.GetCreatedAt()).Seconds())),
+		"idle=" + strconv.Itoa(int(now.Sub(client.GetLastInteraction()).Seconds())),
+		"flags=" + flags,
+		"db=" + strconv.Itoa(client.GetDBIndex()),
+		"sub=" + strconv.Itoa(client.SubsCount()),
+		"psub=0",
+		"multi=" + strconv.Itoa(multi),
+		"cmd=" + client.GetLastCmd(),
+		"user=" + clientUser(client),
+		"resp=" + strconv.Itoa(client.GetProtocol()),
+	}
+	return strings.Join(fields, " ")
+}
+
+// validClientName judge whether the name only contains the visible characters
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// fullCmdName return the name of the command shown by CLIENT LIST, the subcommand is included e.g. client|list
+func fullCmdName(cmdLine [][]byte) string {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	switch cmdName {
+	case "client", "acl", "cluster", "object", "memory":
+		if len(cmdLine) > 1 {
+			return cmdName + "|" + strings.ToLower(string(cmdLine[1]))
+		}
+	}
+	return cmdName
+}
+
+func (r *RedisServer) execClientPause(args [][]byte) redis.Reply {
+	timeout, err := strconv.ParseInt(string(args[0]), 10, 64)
+	if err != nil || timeout < 0 {
+		return protocol.NewErrReply(PAUSE_TIMEOUT_ERR)
+	}
+	all := true
+	if len(args) == 2 {
+		switch strings.ToLower(string(args[1])) {
+		case "write":
+			all = false
+		case "all":
+		default:
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+	}
+
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	pause := &clientPause{
+		all:  all,
+		end:  time.Now().Add(time.Duration(timeout) * time.Millisecond),
+		done: make(chan struct{}),
+	}
+	// the pause in progress is never shortened or weakened by the new one
+	if old := r.pause.Load(); old != nil {
+		if time.Now().Before(old.end) {
+			pause.all = pause.all || old.all
+			if old.end.After(pause.end) {
+				pause.end = old.end
+			}
+		}
+		close(old.done)
+	}
+	r.pause.Store(pause)
+	return protocol.NewOkReply()
+}
+
+func (r *RedisServer) unpauseClients() {
+	r.pauseMu.Lock()
+	defer r.pauseMu.Unlock()
+	if old := r.pause.Swap(nil); old != nil {
+		close(old.done)
+	}
+}
+
+// waitPause hold the command until the pause is over, the internal connections,
+// the replicas and CLIENT itself are never held so that the pause can be cancelled
+func (r *RedisServer) waitPause(conn redis.Conn, cmdLine [][]byte) {
+	if conn.GetUser() == connection.INTERNAL_USER {
+		return
+	}
+	switch strings.ToLower(string(cmdLine[0])) {
+	case "client", "psync", "replconf":
+		return
+	}
+	for {
+		pause := r.pause.Load()
+		if pause == nil || !pause.holds(conn, cmdLine) {
+			return
+		}
+		wait := time.Until(pause.end)
+		if wait <= 0 {
+			return
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-pause.done:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// holds judge whether the command is held by the pause
+func (pause *clientPause) holds(conn redis.Conn, cmdLine [][]byte) bool {
+	if pause.all {
+		return true
+	}
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "publish" {
+		return true
+	}
+	if cmdName == "exec" {
+		// the transaction is held when any write command is queued
+		for _, queued := range conn.GetCmdLineInQueue() {
+			if isWriteCommand(queued) {
+				return true
+			}
+		}
+		return false
+	}
+	// the commands are only queued in the transaction
+	return !conn.InitMulti() && isWriteCommand(cmdLine)
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	server := NewPureServer()
+	c1 := newClientConn()
+	c2 := newClientConn()
+	server.AfterClientConnect(c1)
+	server.AfterClientConnect(c2)
+	id1 := strconv.FormatInt(c1.GetID(), 10)
+	id2 := strconv.FormatInt(c2.GetID(), 10)
+
+	if reply := replyOf(server, c1, "CLIENT", "ID"); reply != ":"+id1+"\r\n" {
+		t.Error("client id err: ", reply)
+	}
+	if reply := replyOf(server, c1, "CLIENT", "GETNAME"); reply != "$-1\r\n" {
+		t.Error("getname without name err: ", reply)
+	}
+	if reply := replyOf(server, c1, "CLIENT", "SETNAME", "bad name"); reply != "-"+CLIENT_NAME_ERR+"\r\n" {
+		t.Error("invalid name err: ", reply)
+	}
+	replyOf(server, c1, "CLIENT", "SETNAME", "worker")
+	if reply := replyOf(server, c1, "CLIENT", "GETNAME"); reply != "$6\r\nworker\r\n" {
+		t.Error("getname err: ", reply)
+	}
+
+	replyOf(server, c2, "SELECT", "3")
+	replyOf(server, c2, "MULTI")
+	replyOf(server, c2, "SET", "k", "v")
+	reply := replyOf(server, c1, "CLIENT", "LIST")
+	lines := strings.Split(strings.TrimSpace(reply[strings.Index(reply, "\r\n")+2:]), "\n")
+	if len(lines) != 2 {
+		t.Fatal("client list err: ", reply)
+	}
+	if !strings.HasPrefix(lines[0], "id="+id1+" ") || !strings.Contains(lines[0], "name=worker") ||
+		!strings.Contains(lines[0], "flags=N") || !strings.Contains(lines[0], "cmd=client|list") {
+		t.Error("client list line err: ", lines[0])
+	}
+	if !strings.Contains(lines[1], "db=3") || !strings.Contains(lines[1], "flags=x") ||
+		!strings.Contains(lines[1], "multi=1") || !strings.Contains(lines[1], "cmd=set") {
+		t.Error("client list multi err: ", lines[1])
+	}
+	if reply := replyOf(server, c1, "CLIENT", "LIST", "ID", id2); strings.Contains(reply, "id="+id1+" ") {
+		t.Error("client list by id err: ", reply)
+	}
+	if reply := replyOf(server, c2, "CLIENT", "INFO"); !strings.Contains(reply, "id="+id2+" ") {
+		t.Error("client info err: ", reply)
+	}
+	replyOf(server, c2, "DISCARD")
+
+	// the caller is skipped by default
+	if reply := replyOf(server, c1, "CLIENT", "KILL", "USER", "default"); reply != ":1\r\n" {
+		t.Error("kill by user err: ", reply)
+	}
+	if reply := replyOf(server, c1, "CLIENT", "KILL", "ID", id2); reply != ":0\r\n" {
+		t.Error("the killed client should be removed: ", reply)
+	}
+	if reply := replyOf(server, c1, "CLIENT", "KILL", "ID", id1, "SKIPME", "no"); reply != ":1\r\n" {
+		t.Error("kill myself err: ", reply)
+	}
+	if reply := replyOf(server, c1, "CLIENT", "KILL", "TYPE", "unknown"); !strings.HasPrefix(reply, "-ERR Unknown client type") {
+		t.Error("kill by unknown type err: ", reply)
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	server := NewPureServer()
+	admin := newClientConn()
+	conn := newClientConn()
+
+	replyOf(server, admin, "CLIENT", "PAUSE", "10000", "WRITE")
+	done := make(chan string, 1)
+	go func() {
+		done <- replyOf(server, conn, "SET", "k", "v")
+	}()
+	select {
+	case reply := <-done:
+		t.Fatal("the write command should be held: ", reply)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// the read command is not held by the write pause
+	if reply := replyOf(server, admin, "GET", "k"); !strings.HasPrefix(reply, "-") {
+		t.Error("get during pause err: ", reply)
+	}
+	replyOf(server, admin, "CLIENT", "UNPAUSE")
+	select {
+	case reply := <-done:
+		if reply != "+OK\r\n" {
+			t.Error("set after unpause err: ", reply)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the write command should go on after unpause")
+	}
+
+	start := time.Now()
+	replyOf(server, admin, "CLIENT", "PAUSE", "100")
+	if reply := replyOf(server, conn, "GET", "k"); reply != "$1\r\nv\r\n" {
+		t.Error("get after pause err: ", reply)
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Error("all the commands should be held until the timeout")
+	}
+}
+
+func TestClientListConcurrently(t *testing.T) {
+	server := NewPureServer()
+	c1 := newClientConn()
+	c2 := newClientConn()
+	server.AfterClientConnect(c1)
+	server.AfterClientConnect(c2)
+	// the flags and the user of c2 are changed by its own goroutine while c1 lists them
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			replyOf(server, c2, "MULTI")
+			replyOf(server, c2, "DISCARD")
+			replyOf(server, c2, "CLIENT", "NO-EVICT", "on")
+			c2.SetUser("default")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if reply := replyOf(server, c1, "CLIENT", "LIST"); reply[0] != '$' {
+			t.Error("client list err: ", reply)
+		}
+	}
+	<-done
+}
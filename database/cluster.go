@@ -0,0 +1,485 @@
+package database
+
+import (
+	"errors"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	CLUSTER_GOSSIP_INTERVAL = time.Second
+	CLUSTER_CALL_TIMEOUT    = time.Second
+	CLUSTER_FORGET_TTL      = time.Minute
+	CLUSTER_BUS_PORT_OFFSET = 10000
+	DEFAULT_CLUSTER_CONFIG  = "nodes.conf"
+)
+
+const (
+	NODE_CONNECTED    = "connected"
+	NODE_DISCONNECTED = "disconnected"
+)
+
+// clusterNode is a master node of the cluster
+type clusterNode struct {
+	id   string
+	host string
+	port int
+	// configEpoch decides the owner when two nodes claim the same slot
+	configEpoch uint64
+	linkState   string
+	// pongTime is the unix milli time of the last successful gossip
+	pongTime int64
+}
+
+func (node *clusterNode) addr() string {
+	return net.JoinHostPort(node.host, strconv.Itoa(node.port))
+}
+
+// cluster is the topology known by this node, the other nodes are learned from
+// CLUSTER MEET and the gossip of CLUSTER HELLO, which exchanges the output of CLUSTER NODES
+type cluster struct {
+	mu        sync.RWMutex
+	myself    *clusterNode
+	nodes     map[string]*clusterNode
+	slots     [SLOT_COUNT]*clusterNode
+	migrating [SLOT_COUNT]*clusterNode
+	importing [SLOT_COUNT]*clusterNode
+	// currentEpoch is the max config epoch known by this node
+	currentEpoch uint64
+	// forgotten is the node id -> the time the node could be learned from gossip again
+	forgotten  map[string]time.Time
+	configFile string
+	closeChan  chan struct{}
+}
+
+// nodeInfo is a line of CLUSTER NODES
+type nodeInfo struct {
+	id        string
+	host      string
+	port      int
+	myself    bool
+	epoch     uint64
+	slots     []int
+	migrating map[int]string
+	importing map[int]string
+}
+
+func newCluster(host string, port int, configFile string) *cluster {
+	c := &cluster{
+		nodes:      make(map[string]*clusterNode),
+		forgotten:  make(map[string]time.Time),
+		configFile: configFile,
+		closeChan:  make(chan struct{}),
+	}
+	if configFile != "" {
+		err := c.loadConfig()
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("load cluster config %s err: %v", configFile, err)
+		}
+	}
+	if c.myself == nil {
+		c.myself = &clusterNode{id: newReplID()}
+		c.nodes[c.myself.id] = c.myself
+	}
+	// the address may be changed since the config file is saved
+	c.myself.host = host
+	c.myself.port = port
+	c.myself.linkState = NODE_CONNECTED
+	c.saveConfig()
+	return c
+}
+
+// initCluster create the cluster state of the configured address and start the gossip
+func (server *RedisServer) initCluster() {
+	clusterConfig := config.GetClusterConfig()
+	host := clusterConfig.AnnounceHost
+	if host == "" {
+		host = config.GetRedisServerConfig().Address
+	}
+	if host == "" || host == "0.0.0.0" {
+		host = "127.0.0.1"
+	}
+	configFile := clusterConfig.ConfigFile
+	if configFile == "" {
+		configFile = DEFAULT_CLUSTER_CONFIG
+	}
+	server.cluster = newCluster(host, config.GetRedisServerConfig().Port, configFile)
+	go server.clusterCron()
+	logger.Info("cluster mode is enabled, my id: %s", server.cluster.myself.id)
+}
+
+func parseSlot(arg string) (int, bool) {
+	slot, err := strconv.Atoi(arg)
+	if err != nil || slot < 0 || slot >= SLOT_COUNT {
+		return 0, false
+	}
+	return slot, true
+}
+
+// parseNodeLine parse: <id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func parseNodeLine(line string) (*nodeInfo, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 8 {
+		return nil, errors.New("invalid node line: " + line)
+	}
+	address, _, _ := strings.Cut(fields[1], "@")
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, err
+	}
+	epoch, err := strconv.ParseUint(fields[6], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	info := &nodeInfo{
+		id:        fields[0],
+		host:      host,
+		port:      port,
+		myself:    strings.Contains(fields[2], "myself"),
+		epoch:     epoch,
+		slots:     make([]int, 0),
+		migrating: make(map[int]string),
+		importing: make(map[int]string),
+	}
+	for _, field := range fields[8:] {
+		// [slot->-node] is migrating and [slot-<-node] is importing
+		if strings.HasPrefix(field, "[") {
+			field = strings.Trim(field, "[]")
+			if slotStr, id, ok := strings.Cut(field, "->-"); ok {
+				if slot, ok := parseSlot(slotStr); ok {
+					info.migrating[slot] = id
+				}
+			} else if slotStr, id, ok := strings.Cut(field, "-<-"); ok {
+				if slot, ok := parseSlot(slotStr); ok {
+					info.importing[slot] = id
+				}
+			}
+			continue
+		}
+		startStr, endStr, isRange := strings.Cut(field, "-")
+		if !isRange {
+			endStr = startStr
+		}
+		start, ok1 := parseSlot(startStr)
+		end, ok2 := parseSlot(endStr)
+		if !ok1 || !ok2 || start > end {
+			return nil, errors.New("invalid slot range: " + field)
+		}
+		for slot := start; slot <= end; slot++ {
+			info.slots = append(info.slots, slot)
+		}
+	}
+	return info, nil
+}
+
+// slotRanges get the slot ranges owned by the node, c.mu must be locked
+func (c *cluster) slotRanges(node *clusterNode) [][2]int {
+	ranges := make([][2]int, 0)
+	for slot := 0; slot < SLOT_COUNT; slot++ {
+		if c.slots[slot] != node {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1][1] == slot-1 {
+			ranges[n-1][1] = slot
+		} else {
+			ranges = append(ranges, [2]int{slot, slot})
+		}
+	}
+	return ranges
+}
+
+// nodeLine format the node as a line of CLUSTER NODES, c.mu must be locked
+func (c *cluster) nodeLine(node *clusterNode) string {
+	flags := "master"
+	if node == c.myself {
+		flags = "myself,master"
+	} else if node.linkState == NODE_DISCONNECTED {
+		flags = "master,fail?"
+	}
+	fields := []string{
+		node.id,
+		node.addr() + "@" + strconv.Itoa(node.port+CLUSTER_BUS_PORT_OFFSET),
+		flags,
+		"-",
+		"0",
+		strconv.FormatInt(node.pongTime, 10),
+		strconv.FormatUint(node.configEpoch, 10),
+		node.linkState,
+	}
+	for _, r := range c.slotRanges(node) {
+		if r[0] == r[1] {
+			fields = append(fields, strconv.Itoa(r[0]))
+		} else {
+			fields = append(fields, strconv.Itoa(r[0])+"-"+strconv.Itoa(r[1]))
+		}
+	}
+	if node == c.myself {
+		for slot := 0; slot < SLOT_COUNT; slot++ {
+			if target := c.migrating[slot]; target != nil {
+				fields = append(fields, "["+strconv.Itoa(slot)+"->-"+target.id+"]")
+			}
+			if source := c.importing[slot]; source != nil {
+				fields = append(fields, "["+strconv.Itoa(slot)+"-<-"+source.id+"]")
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// nodesText get the output of CLUSTER NODES, c.mu must be locked
+func (c *cluster) nodesText() string {
+	var sb strings.Builder
+	sb.WriteString(c.nodeLine(c.myself))
+	sb.WriteString("\n")
+	for _, node := range c.nodes {
+		if node == c.myself {
+			continue
+		}
+		sb.WriteString(c.nodeLine(node))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// bumpEpoch take a new config epoch for myself, c.mu must be locked
+func (c *cluster) bumpEpoch() {
+	c.currentEpoch++
+	c.myself.configEpoch = c.currentEpoch
+}
+
+// mergeNodes merge the CLUSTER NODES of another node into the topology, c.mu must be locked.
+// the sender is authoritative about its own slots, the slot claimed by others is taken
+// only when the claim has a greater config epoch than the current owner
+func (c *cluster) mergeNodes(text string) bool {
+	changed := false
+	now := time.Now()
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		info, err := parseNodeLine(line)
+		if err != nil {
+			logger.Warn("skip the node of gossip: %v", err)
+			continue
+		}
+		if info.id == c.myself.id {
+			continue
+		}
+		if until, ok := c.forgotten[info.id]; ok {
+			if now.Before(until) {
+				continue
+			}
+			delete(c.forgotten, info.id)
+		}
+
+		node, exists := c.nodes[info.id]
+		if !exists {
+			node = &clusterNode{id: info.id, linkState: NODE_CONNECTED}
+			c.nodes[info.id] = node
+			changed = true
+		}
+		if !exists || info.myself {
+			if node.host != info.host || node.port != info.port {
+				node.host, node.port = info.host, info.port
+				changed = true
+			}
+		}
+		if info.myself {
+			node.linkState = NODE_CONNECTED
+			node.pongTime = now.UnixMilli()
+		}
+		c.currentEpoch = max(c.currentEpoch, info.epoch)
+		if info.epoch < node.configEpoch {
+			continue
+		}
+		if node.configEpoch != info.epoch {
+			node.configEpoch = info.epoch
+			changed = true
+		}
+
+		claimed := make(map[int]bool, len(info.slots))
+		for _, slot := range info.slots {
+			claimed[slot] = true
+			owner := c.slots[slot]
+			if owner == node || (owner != nil && owner.configEpoch >= info.epoch) {
+				continue
+			}
+			c.slots[slot] = node
+			if c.migrating[slot] == node {
+				c.migrating[slot] = nil
+			}
+			changed = true
+		}
+		if info.myself {
+			for slot := 0; slot < SLOT_COUNT; slot++ {
+				if c.slots[slot] == node && !claimed[slot] {
+					c.slots[slot] = nil
+					changed = true
+				}
+			}
+		}
+	}
+	return changed
+}
+
+// loadConfig load the topology saved by saveConfig
+func (c *cluster) loadConfig() error {
+	content, err := os.ReadFile(c.configFile)
+	if err != nil {
+		return err
+	}
+	infos := make([]*nodeInfo, 0)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if fields[0] == "vars" {
+			for i := 1; i+1 < len(fields); i += 2 {
+				if fields[i] == "currentEpoch" {
+					c.currentEpoch, _ = strconv.ParseUint(fields[i+1], 10, 64)
+				}
+			}
+			continue
+		}
+		info, err := parseNodeLine(line)
+		if err != nil {
+			return err
+		}
+		node := &clusterNode{
+			id:          info.id,
+			host:        info.host,
+			port:        info.port,
+			configEpoch: info.epoch,
+			linkState:   NODE_CONNECTED,
+		}
+		c.nodes[node.id] = node
+		if info.myself {
+			c.myself = node
+		}
+		for _, slot := range info.slots {
+			c.slots[slot] = node
+		}
+		infos = append(infos, info)
+	}
+	if c.myself == nil {
+		return errors.New("no myself node in the cluster config")
+	}
+	for _, info := range infos {
+		for slot, id := range info.migrating {
+			c.migrating[slot] = c.nodes[id]
+		}
+		for slot, id := range info.importing {
+			c.importing[slot] = c.nodes[id]
+		}
+	}
+	return nil
+}
+
+// saveConfig write the topology into the config file, c.mu must be locked
+func (c *cluster) saveConfig() {
+	if c.configFile == "" {
+		return
+	}
+	content := c.nodesText() + "vars currentEpoch " + strconv.FormatUint(c.currentEpoch, 10) + " lastVoteEpoch 0\n"
+	tmpFile := c.configFile + ".tmp"
+	err := os.WriteFile(tmpFile, []byte(content), 0644)
+	if err == nil {
+		err = os.Rename(tmpFile, c.configFile)
+	}
+	if err != nil {
+		logger.Error("save cluster config %s err: %v", c.configFile, err)
+	}
+}
+
+// clusterCron gossip with all the known nodes periodically until the server is closed
+func (server *RedisServer) clusterCron() {
+	ticker := time.NewTicker(CLUSTER_GOSSIP_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-server.cluster.closeChan:
+			return
+		case <-ticker.C:
+			server.clusterGossip()
+		}
+	}
+}
+
+// clusterGossip send CLUSTER HELLO to all the other nodes and merge their replies
+func (server *RedisServer) clusterGossip() {
+	c := server.cluster
+	c.mu.RLock()
+	addrs := make(map[string]string, len(c.nodes))
+	for id, node := range c.nodes {
+		if node != c.myself {
+			addrs[id] = node.addr()
+		}
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for id, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := server.clusterHello(addr)
+			if err == nil {
+				return
+			}
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if node, ok := c.nodes[id]; ok && node.linkState != NODE_DISCONNECTED {
+				logger.Warn("lost the link with node %s(%s): %v", id, addr, err)
+				node.linkState = NODE_DISCONNECTED
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// clusterHello send the topology of this node to addr and merge the topology of the reply
+func (server *RedisServer) clusterHello(addr string) error {
+	c := server.cluster
+	c.mu.RLock()
+	text := c.nodesText()
+	c.mu.RUnlock()
+
+	cmdLines := [][][]byte{utils.CmdLine1("CLUSTER", "HELLO", text)}
+	// the nodes authenticate each other by the password of the master
+	if auth := masterAuthCmd(); auth != nil {
+		cmdLines = [][][]byte{auth, cmdLines[0]}
+	}
+	replies, err := callNode(addr, CLUSTER_CALL_TIMEOUT, cmdLines...)
+	if err != nil {
+		return err
+	}
+	reply := replies[len(replies)-1]
+	bulk, ok := reply.(*protocol.BulkReply)
+	if !ok {
+		return errors.New("unexpected reply of hello: " + string(reply.ToByte()))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mergeNodes(string(bulk.Content())) {
+		c.saveConfig()
+	}
+	return nil
+}
+
+func (server *RedisServer) stopCluster() {
+	close(server.cluster.closeChan)
+}
@@ -0,0 +1,481 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	CLUSTER INFO | MYID | NODES | SLOTS | KEYSLOT key
+	CLUSTER ADDSLOTS slot [slot ...] | ADDSLOTSRANGE start end [start end ...] | DELSLOTS slot [slot ...]
+	CLUSTER MEET host port | FORGET node-id | SAVECONFIG
+	CLUSTER SETSLOT slot IMPORTING node-id | MIGRATING node-id | NODE node-id | STABLE
+	CLUSTER COUNTKEYSINSLOT slot | GETKEYSINSLOT slot count
+	CLUSTER HELLO nodes, which is sent between the nodes to exchange the topology
+	ASKING
+*/
+
+const (
+	CLUSTER_DISABLED_ERR  = "ERR This instance has cluster support disabled"
+	CROSS_SLOT_ERR        = "CROSSSLOT Keys in request don't hash to the same slot"
+	CLUSTER_DOWN_ERR      = "CLUSTERDOWN Hash slot not served"
+	TRY_AGAIN_ERR         = "TRYAGAIN Multiple keys request during rehashing of slot"
+	SELECT_IN_CLUSTER_ERR = "ERR SELECT is not allowed in cluster mode"
+	INVALID_SLOT_ERR      = "ERR Invalid or out of range slot"
+	UNKNOWN_NODE_ERR      = "ERR Unknown node "
+	UNKNOWN_SUBCMD_ERR    = "ERR unknown subcommand or wrong number of arguments for 'CLUSTER'"
+	FORGET_MYSELF_ERR     = "ERR I tried hard but I can't forget myself..."
+)
+
+func (server *RedisServer) execCluster(conn redis.Conn, args [][]byte) redis.Reply {
+	if server.cluster == nil {
+		return protocol.NewErrReply(CLUSTER_DISABLED_ERR)
+	}
+	if len(args) == 0 {
+		return protocol.NewErrReply(UNKNOWN_SUBCMD_ERR)
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch {
+	case subCmd == "info" && len(args) == 0:
+		return server.cluster.info()
+	case subCmd == "myid" && len(args) == 0:
+		return protocol.NewBulkReply([]byte(server.cluster.myself.id))
+	case subCmd == "nodes" && len(args) == 0:
+		server.cluster.mu.RLock()
+		defer server.cluster.mu.RUnlock()
+		return protocol.NewBulkReply([]byte(server.cluster.nodesText()))
+	case subCmd == "slots" && len(args) == 0:
+		return server.cluster.slotsReply()
+	case subCmd == "keyslot" && len(args) == 1:
+		return protocol.NewIntReply(int64(keySlot(string(args[0]))))
+	case subCmd == "addslots" && len(args) > 0:
+		return server.execAddSlots(args, false)
+	case subCmd == "addslotsrange" && len(args) > 0 && len(args)%2 == 0:
+		return server.execAddSlots(args, true)
+	case subCmd == "delslots" && len(args) > 0:
+		return server.execDelSlots(args)
+	case subCmd == "meet" && len(args) == 2:
+		return server.execMeet(args)
+	case subCmd == "forget" && len(args) == 1:
+		return server.execForget(string(args[0]))
+	case subCmd == "setslot" && (len(args) == 2 || len(args) == 3):
+		return server.execSetSlot(args)
+	case subCmd == "countkeysinslot" && len(args) == 1:
+		return server.execCountKeysInSlot(args[0])
+	case subCmd == "getkeysinslot" && len(args) == 2:
+		return server.execGetKeysInSlot(args[0], args[1])
+	case subCmd == "saveconfig" && len(args) == 0:
+		server.cluster.mu.Lock()
+		defer server.cluster.mu.Unlock()
+		server.cluster.saveConfig()
+		return protocol.NewOkReply()
+	case subCmd == "hello" && len(args) == 1:
+		return server.execClusterHello(string(args[0]))
+	}
+	return protocol.NewErrReply(UNKNOWN_SUBCMD_ERR)
+}
+
+// ASKING
+func (server *RedisServer) execAsking(conn redis.Conn) redis.Reply {
+	if server.cluster == nil {
+		return protocol.NewErrReply(CLUSTER_DISABLED_ERR)
+	}
+	conn.SetAsking(true)
+	return protocol.NewOkReply()
+}
+
+// CLUSTER INFO
+func (c *cluster) info() redis.Reply {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	assigned := 0
+	masters := make(map[*clusterNode]bool)
+	for _, node := range c.slots {
+		if node != nil {
+			assigned++
+			masters[node] = true
+		}
+	}
+	state := "ok"
+	if assigned < SLOT_COUNT {
+		state = "fail"
+	}
+	lines := []string{
+		"cluster_enabled:1",
+		"cluster_state:" + state,
+		"cluster_slots_assigned:" + strconv.Itoa(assigned),
+		"cluster_slots_ok:" + strconv.Itoa(assigned),
+		"cluster_slots_pfail:0",
+		"cluster_slots_fail:0",
+		"cluster_known_nodes:" + strconv.Itoa(len(c.nodes)),
+		"cluster_size:" + strconv.Itoa(len(masters)),
+		"cluster_current_epoch:" + strconv.FormatUint(c.currentEpoch, 10),
+		"cluster_my_epoch:" + strconv.FormatUint(c.myself.configEpoch, 10),
+	}
+	return protocol.NewBulkReply([]byte(strings.Join(lines, protocol.CRLF) + protocol.CRLF))
+}
+
+// CLUSTER SLOTS: [[start, end, [host, port, id]], ...]
+func (c *cluster) slotsReply() redis.Reply {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]redis.Reply, 0)
+	for slot := 0; slot < SLOT_COUNT; {
+		node := c.slots[slot]
+		end := slot
+		for end+1 < SLOT_COUNT && c.slots[end+1] == node {
+			end++
+		}
+		if node != nil {
+			result = append(result, protocol.NewMultiRawReply([]redis.Reply{
+				protocol.NewIntReply(int64(slot)),
+				protocol.NewIntReply(int64(end)),
+				protocol.NewMultiRawReply([]redis.Reply{
+					protocol.NewBulkReply([]byte(node.host)),
+					protocol.NewIntReply(int64(node.port)),
+					protocol.NewBulkReply([]byte(node.id)),
+				}),
+			}))
+		}
+		slot = end + 1
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+// parseSlotArgs parse the slots or the ranges of slots: start end [start end ...]
+func parseSlotArgs(args [][]byte, isRange bool) ([]int, redis.Reply) {
+	slots := make([]int, 0, len(args))
+	if !isRange {
+		for _, arg := range args {
+			slot, ok := parseSlot(string(arg))
+			if !ok {
+				return nil, protocol.NewErrReply(INVALID_SLOT_ERR)
+			}
+			slots = append(slots, slot)
+		}
+		return slots, nil
+	}
+	for i := 0; i < len(args); i += 2 {
+		start, ok1 := parseSlot(string(args[i]))
+		end, ok2 := parseSlot(string(args[i+1]))
+		if !ok1 || !ok2 || start > end {
+			return nil, protocol.NewErrReply(INVALID_SLOT_ERR)
+		}
+		for slot := start; slot <= end; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// CLUSTER ADDSLOTS slot [slot ...] or CLUSTER ADDSLOTSRANGE start end [start end ...]
+func (server *RedisServer) execAddSlots(args [][]byte, isRange bool) redis.Reply {
+	slots, errReply := parseSlotArgs(args, isRange)
+	if errReply != nil {
+		return errReply
+	}
+	c := server.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, slot := range slots {
+		if c.slots[slot] != nil {
+			return protocol.NewErrReply("ERR Slot " + strconv.Itoa(slot) + " is already busy")
+		}
+	}
+	for _, slot := range slots {
+		c.slots[slot] = c.myself
+		c.importing[slot] = nil
+	}
+	c.bumpEpoch()
+	c.saveConfig()
+	go server.clusterGossip()
+	return protocol.NewOkReply()
+}
+
+// CLUSTER DELSLOTS slot [slot ...]
+func (server *RedisServer) execDelSlots(args [][]byte) redis.Reply {
+	slots, errReply := parseSlotArgs(args, false)
+	if errReply != nil {
+		return errReply
+	}
+	c := server.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, slot := range slots {
+		if c.slots[slot] == nil {
+			return protocol.NewErrReply("ERR Slot " + strconv.Itoa(slot) + " is already unassigned")
+		}
+	}
+	for _, slot := range slots {
+		c.slots[slot] = nil
+		c.migrating[slot] = nil
+		c.importing[slot] = nil
+	}
+	c.saveConfig()
+	go server.clusterGossip()
+	return protocol.NewOkReply()
+}
+
+// CLUSTER MEET host port, the handshake is done in background
+func (server *RedisServer) execMeet(args [][]byte) redis.Reply {
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.NewErrReply("ERR Invalid node address specified: " + string(args[0]) + ":" + string(args[1]))
+	}
+	addr := net.JoinHostPort(string(args[0]), strconv.Itoa(port))
+	go func() {
+		if server.clusterHello(addr) == nil {
+			// let the other nodes know the new node
+			server.clusterGossip()
+		}
+	}()
+	return protocol.NewOkReply()
+}
+
+// CLUSTER FORGET node-id, the node is not learned from the gossip again in a minute
+func (server *RedisServer) execForget(id string) redis.Reply {
+	c := server.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id == c.myself.id {
+		return protocol.NewErrReply(FORGET_MYSELF_ERR)
+	}
+	node, ok := c.nodes[id]
+	if !ok {
+		return protocol.NewErrReply(UNKNOWN_NODE_ERR + id)
+	}
+	for slot := 0; slot < SLOT_COUNT; slot++ {
+		if c.slots[slot] == node {
+			c.slots[slot] = nil
+		}
+		if c.migrating[slot] == node {
+			c.migrating[slot] = nil
+		}
+		if c.importing[slot] == node {
+			c.importing[slot] = nil
+		}
+	}
+	delete(c.nodes, id)
+	c.forgotten[id] = time.Now().Add(CLUSTER_FORGET_TTL)
+	c.saveConfig()
+	return protocol.NewOkReply()
+}
+
+// CLUSTER SETSLOT slot IMPORTING node-id | MIGRATING node-id | NODE node-id | STABLE
+func (server *RedisServer) execSetSlot(args [][]byte) redis.Reply {
+	slot, ok := parseSlot(string(args[0]))
+	if !ok {
+		return protocol.NewErrReply(INVALID_SLOT_ERR)
+	}
+	action := strings.ToLower(string(args[1]))
+	if (action == "stable") != (len(args) == 2) {
+		return protocol.NewErrReply(UNKNOWN_SUBCMD_ERR)
+	}
+
+	c := server.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var node *clusterNode
+	if len(args) == 3 {
+		node, ok = c.nodes[string(args[2])]
+		if !ok {
+			return protocol.NewErrReply(UNKNOWN_NODE_ERR + string(args[2]))
+		}
+	}
+	slotStr := strconv.Itoa(slot)
+	switch action {
+	case "importing":
+		if c.slots[slot] == c.myself {
+			return protocol.NewErrReply("ERR I'm already the owner of hash slot " + slotStr)
+		}
+		if node == c.myself {
+			return protocol.NewErrReply("ERR I can't import hash slot " + slotStr + " from myself")
+		}
+		c.importing[slot] = node
+	case "migrating":
+		if c.slots[slot] != c.myself {
+			return protocol.NewErrReply("ERR I'm not the owner of hash slot " + slotStr)
+		}
+		if node == c.myself {
+			return protocol.NewErrReply("ERR I can't migrate hash slot " + slotStr + " to myself")
+		}
+		c.migrating[slot] = node
+	case "node":
+		if c.slots[slot] == c.myself && node != c.myself && server.countKeysInSlot(slot) > 0 {
+			return protocol.NewErrReply("ERR Can't assign hashslot " + slotStr +
+				" to a different node while I still hold keys for this hash slot.")
+		}
+		if node != c.myself {
+			c.migrating[slot] = nil
+		}
+		c.slots[slot] = node
+		// the new owner takes a greater epoch so that the other nodes accept the change
+		if node == c.myself && c.importing[slot] != nil {
+			c.importing[slot] = nil
+			c.bumpEpoch()
+		}
+	case "stable":
+		c.migrating[slot] = nil
+		c.importing[slot] = nil
+	default:
+		return protocol.NewErrReply(UNKNOWN_SUBCMD_ERR)
+	}
+	c.saveConfig()
+	if action == "node" {
+		go server.clusterGossip()
+	}
+	return protocol.NewOkReply()
+}
+
+// forEachKeyInSlot scan the keys of the slot in db 0, which is the only database in cluster mode
+func (server *RedisServer) forEachKeyInSlot(slot int, consumer func(key string) bool) {
+	db := server.mustSelectDB(0)
+	db.ForEach(func(key string, value *database.DataEntity) bool {
+		if keySlot(key) != slot || db.IsExpired(key) {
+			return true
+		}
+		return consumer(key)
+	})
+}
+
+func (server *RedisServer) countKeysInSlot(slot int) int64 {
+	var count int64
+	server.forEachKeyInSlot(slot, func(key string) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// CLUSTER COUNTKEYSINSLOT slot
+func (server *RedisServer) execCountKeysInSlot(arg []byte) redis.Reply {
+	slot, ok := parseSlot(string(arg))
+	if !ok {
+		return protocol.NewErrReply(INVALID_SLOT_ERR)
+	}
+	return protocol.NewIntReply(server.countKeysInSlot(slot))
+}
+
+// CLUSTER GETKEYSINSLOT slot count
+func (server *RedisServer) execGetKeysInSlot(slotArg []byte, countArg []byte) redis.Reply {
+	slot, ok := parseSlot(string(slotArg))
+	if !ok {
+		return protocol.NewErrReply(INVALID_SLOT_ERR)
+	}
+	count, err := strconv.Atoi(string(countArg))
+	if err != nil || count < 0 {
+		return protocol.NewErrReply("ERR Invalid number of keys")
+	}
+	keys := make([][]byte, 0, count)
+	server.forEachKeyInSlot(slot, func(key string) bool {
+		if len(keys) >= count {
+			return false
+		}
+		keys = append(keys, []byte(key))
+		return true
+	})
+	return protocol.NewMultiReply(keys)
+}
+
+// CLUSTER HELLO nodes, merge the topology of the sender and reply the topology of this node
+func (server *RedisServer) execClusterHello(text string) redis.Reply {
+	c := server.cluster
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.mergeNodes(text) {
+		c.saveConfig()
+	}
+	return protocol.NewBulkReply([]byte(c.nodesText()))
+}
+
+// commandKeys get the keys of the command by the prepare function
+func commandKeys(cmdLine [][]byte) []string {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	if cmdName == "watch" {
+		return bytesToString(cmdLine[1:])
+	}
+	if validCommand(cmdLine) != nil {
+		return nil
+	}
+	prepare := commandTable[cmdName].prepare
+	if prepare == nil {
+		return nil
+	}
+	wks, rks := prepare(cmdLine[1:])
+	return append(wks, rks...)
+}
+
+// clusterRoute check whether the command should be executed by this node,
+// return the error of MOVED, ASK, CROSSSLOT, TRYAGAIN or CLUSTERDOWN otherwise
+func (server *RedisServer) clusterRoute(conn redis.Conn, cmdLine [][]byte) *protocol.ErrReply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	asking := conn.IsAsking() || cmdName == "restore-asking"
+	conn.SetAsking(false)
+
+	keys := commandKeys(cmdLine)
+	if len(keys) == 0 {
+		return nil
+	}
+	slot := keySlot(keys[0])
+	for _, key := range keys[1:] {
+		if keySlot(key) != slot {
+			return protocol.NewErrReply(CROSS_SLOT_ERR)
+		}
+	}
+	// all the commands of the transaction should be in the same slot
+	if conn.InitMulti() {
+		for _, queued := range conn.GetCmdLineInQueue() {
+			if queuedKeys := commandKeys(queued); len(queuedKeys) > 0 && keySlot(queuedKeys[0]) != slot {
+				return protocol.NewErrReply(CROSS_SLOT_ERR)
+			}
+		}
+	}
+
+	c := server.cluster
+	c.mu.RLock()
+	owner := c.slots[slot]
+	migrating := c.migrating[slot]
+	importing := c.importing[slot]
+	c.mu.RUnlock()
+	if owner == nil {
+		return protocol.NewErrReply(CLUSTER_DOWN_ERR)
+	}
+	slotStr := strconv.Itoa(slot)
+	if owner != c.myself {
+		if importing != nil && asking {
+			if len(keys) > 1 && server.missingKeys(conn, keys) > 0 {
+				return protocol.NewErrReply(TRY_AGAIN_ERR)
+			}
+			return nil
+		}
+		return protocol.NewErrReply("MOVED " + slotStr + " " + owner.addr())
+	}
+	// the missing keys may have been moved to the target during the migration
+	if migrating != nil && cmdName != "migrate" {
+		missing := server.missingKeys(conn, keys)
+		if missing == len(keys) {
+			return protocol.NewErrReply("ASK " + slotStr + " " + migrating.addr())
+		}
+		if missing > 0 {
+			return protocol.NewErrReply(TRY_AGAIN_ERR)
+		}
+	}
+	return nil
+}
+
+func (server *RedisServer) missingKeys(conn redis.Conn, keys []string) int {
+	db := server.mustSelectDB(conn.GetDBIndex())
+	missing := 0
+	for _, key := range keys {
+		if _, exists := db.GetEntity(key); !exists {
+			missing++
+		}
+	}
+	return missing
+}
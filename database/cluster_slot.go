@@ -0,0 +1,43 @@
+package database
+
+import "strings"
+
+const SLOT_COUNT = 16384
+
+var crc16Table = makeCrc16Table()
+
+// makeCrc16Table create the table of CRC16-XMODEM (poly 0x1021) used by redis cluster
+func makeCrc16Table() *[256]uint16 {
+	table := new([256]uint16)
+	for i := 0; i < 256; i++ {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+func crc16(p []byte) uint16 {
+	var crc uint16
+	for _, b := range p {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^b]
+	}
+	return crc
+}
+
+// keySlot get the hash slot of the key, only the hashtag is hashed if the key
+// contains a non-empty {hashtag}, so that the related keys are in the same slot
+func keySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16([]byte(key)) % SLOT_COUNT)
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/pub"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestKeySlot(t *testing.T) {
+	if crc16([]byte("123456789")) != 0x31c3 {
+		t.Error("crc16 of 123456789 err")
+	}
+	cases := map[string]int{
+		"foo":         12182,
+		"bar":         5061,
+		"{foo}.x":     12182,
+		"a{bar}{foo}": 5061,
+		// the empty hashtag is ignored
+		"{}foo": int(crc16([]byte("{}foo")) % SLOT_COUNT),
+	}
+	for key, slot := range cases {
+		if keySlot(key) != slot {
+			t.Errorf("the slot of %s should be %d, got %d", key, slot, keySlot(key))
+		}
+	}
+}
+
+// newClusterServer create the server in cluster mode and serve it on a random port
+func newClusterServer(t *testing.T) (*RedisServer, string, int) {
+	server := NewPureServer()
+	server.hub = pub.NewHub()
+	listener, host, port := newTestListener(t)
+	server.cluster = newCluster(host, port, filepath.Join(t.TempDir(), DEFAULT_CLUSTER_CONFIG))
+	go server.clusterCron()
+	serveListener(t, server, listener)
+	return server, host, port
+}
+
+func TestCluster(t *testing.T) {
+	n1, host1, port1 := newClusterServer(t)
+	n2, host2, port2 := newClusterServer(t)
+	c1 := connection.NewFakeConnection()
+	c2 := connection.NewFakeConnection()
+	id1 := n1.cluster.myself.id
+	id2 := n2.cluster.myself.id
+	addr2 := net.JoinHostPort(host2, strconv.Itoa(port2))
+
+	if reply := replyOf(n1, c1, "CLUSTER", "ADDSLOTSRANGE", "0", "8191"); reply != "+OK\r\n" {
+		t.Fatal("addslotsrange err: ", reply)
+	}
+	if reply := replyOf(n2, c2, "CLUSTER", "ADDSLOTSRANGE", "8192", "16383"); reply != "+OK\r\n" {
+		t.Fatal("addslotsrange err: ", reply)
+	}
+	if reply := replyOf(n1, c1, "CLUSTER", "ADDSLOTS", "100"); !strings.HasPrefix(reply, "-ERR Slot 100 is already busy") {
+		t.Error("add the busy slot err: ", reply)
+	}
+	replyOf(n1, c1, "CLUSTER", "MEET", host2, strconv.Itoa(port2))
+	for _, node := range []*RedisServer{n1, n2} {
+		waitFor(t, "cluster state ok", func() bool {
+			return strings.Contains(replyOf(node, c1, "CLUSTER", "INFO"), "cluster_state:ok")
+		})
+	}
+	if reply := replyOf(n2, c2, "CLUSTER", "NODES"); !strings.Contains(reply, id1+" "+host1+":"+strconv.Itoa(port1)) {
+		t.Error("n2 should know n1: ", reply)
+	}
+	if reply := replyOf(n1, c1, "CLUSTER", "SLOTS"); !strings.Contains(reply, ":8192\r\n:16383\r\n") {
+		t.Error("cluster slots err: ", reply)
+	}
+
+	// the redirection and the keys in different slots
+	if reply := replyOf(n1, c1, "SET", "foo", "v"); reply != "-MOVED 12182 "+addr2+"\r\n" {
+		t.Error("moved err: ", reply)
+	}
+	if reply := replyOf(n1, c1, "MSET", "bar", "1", "{bar}.x", "2"); strings.HasPrefix(reply, "-") {
+		t.Error("mset in the same slot err: ", reply)
+	}
+	if reply := replyOf(n1, c1, "MGET", "bar", "foo"); reply != "-"+CROSS_SLOT_ERR+"\r\n" {
+		t.Error("crossslot err: ", reply)
+	}
+	if reply := replyOf(n1, c1, "SELECT", "1"); reply != "-"+SELECT_IN_CLUSTER_ERR+"\r\n" {
+		t.Error("select in cluster err: ", reply)
+	}
+	if reply := replyOf(n1, c1, "CLUSTER", "COUNTKEYSINSLOT", "5061"); reply != ":2\r\n" {
+		t.Error("countkeysinslot err: ", reply)
+	}
+
+	// the transaction is aborted if the keys span slots
+	replyOf(n1, c1, "MULTI")
+	replyOf(n1, c1, "SET", "bar", "3")
+	if reply := replyOf(n1, c1, "GET", "{a}"); reply != "-"+CROSS_SLOT_ERR+"\r\n" {
+		t.Error("crossslot in multi err: ", reply)
+	}
+	if reply := replyOf(n1, c1, "EXEC"); !strings.HasPrefix(reply, "-") {
+		t.Error("the transaction should be aborted: ", reply)
+	}
+	if reply := replyOf(n1, c1, "GET", "bar"); reply != "$1\r\n1\r\n" {
+		t.Error("the aborted transaction should not be executed: ", reply)
+	}
+
+	// migrate the slot 5061 of bar from n1 to n2
+	replyOf(n2, c2, "CLUSTER", "SETSLOT", "5061", "IMPORTING", id1)
+	replyOf(n1, c1, "CLUSTER", "SETSLOT", "5061", "MIGRATING", id2)
+	if reply := replyOf(n1, c1, "GET", "{bar}.y"); reply != "-ASK 5061 "+addr2+"\r\n" {
+		t.Error("ask err: ", reply)
+	}
+	if reply := replyOf(n2, c2, "GET", "bar"); !strings.HasPrefix(reply, "-MOVED 5061 ") {
+		t.Error("the importing slot needs asking: ", reply)
+	}
+	reply := replyOf(n1, c1, "CLUSTER", "GETKEYSINSLOT", "5061", "10")
+	if !strings.Contains(reply, "bar") || !strings.Contains(reply, "{bar}.x") {
+		t.Error("getkeysinslot err: ", reply)
+	}
+	if reply = replyOf(n1, c1, "CLUSTER", "SETSLOT", "5061", "NODE", id2); !strings.HasPrefix(reply, "-ERR Can't assign") {
+		t.Error("the slot with keys should not be assigned: ", reply)
+	}
+	reply = replyOf(n1, c1, "MIGRATE", host2, strconv.Itoa(port2), "", "0", "1000", "KEYS", "bar", "{bar}.x")
+	if reply != "+OK\r\n" {
+		t.Fatal("migrate err: ", reply)
+	}
+	replyOf(n2, c2, "ASKING")
+	if reply = replyOf(n2, c2, "GET", "bar"); reply != "$1\r\n1\r\n" {
+		t.Error("get the imported key err: ", reply)
+	}
+	replyOf(n2, c2, "CLUSTER", "SETSLOT", "5061", "NODE", id2)
+	replyOf(n1, c1, "CLUSTER", "SETSLOT", "5061", "NODE", id2)
+	if reply = replyOf(n1, c1, "GET", "bar"); reply != "-MOVED 5061 "+addr2+"\r\n" {
+		t.Error("moved after migration err: ", reply)
+	}
+	if reply = replyOf(n2, c2, "GET", "{bar}.x"); reply != "$1\r\n2\r\n" {
+		t.Error("get the migrated key err: ", reply)
+	}
+	// n1 accepts the greater epoch of n2 and keeps the slot after gossip
+	n1.clusterGossip()
+	n1.cluster.mu.RLock()
+	owner := n1.cluster.slots[5061]
+	n1.cluster.mu.RUnlock()
+	if owner == nil || owner.id != id2 {
+		t.Error("the owner of the migrated slot should be n2")
+	}
+
+	// the topology is loaded from the config file
+	n1.cluster.mu.RLock()
+	configFile := n1.cluster.configFile
+	n1.cluster.mu.RUnlock()
+	loaded := newCluster(host1, port1, configFile)
+	if loaded.myself.id != id1 || len(loaded.nodes) != 2 {
+		t.Error("load cluster config err: ", loaded.myself.id, len(loaded.nodes))
+	}
+	if loaded.slots[0] != loaded.myself || loaded.slots[5061] == nil || loaded.slots[5061].id != id2 {
+		t.Error("the slots of the loaded config err")
+	}
+
+	if reply = replyOf(n1, c1, "CLUSTER", "FORGET", id2); reply != "+OK\r\n" {
+		t.Error("forget err: ", reply)
+	}
+	if reply = replyOf(n1, c1, "GET", "foo"); reply != "-"+CLUSTER_DOWN_ERR+"\r\n" {
+		t.Error("the slot of the forgotten node should not be served: ", reply)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/xzwsloser/Go-redis/lib/utils"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -33,6 +34,16 @@ type Database struct {
 	//lockMap    *lock.Locks
 	addAof   func(cmdLine [][]byte)
 	timeHeap *timeheap.TimeHeap
+	// stats is the counters shown by INFO, it is shared by all the databases of the server
+	stats *serverStats
+	// usedMemory is the sum of the estimated size of the keys
+	usedMemory int64
+	// evictor is the maxmemory settings shared by all the databases of the server
+	evictor *evictor
+	// blocking is the clients blocked on the keys, it is shared by all the databases of the server
+	blocking *blockingKeys
+	// snapshot is the rdb dump in progress, the keys are captured by it before being written
+	snapshot atomic.Pointer[dbSnapshot]
 }
 
 func NewDatabase(idx int) *Database {
@@ -44,11 +55,19 @@ func NewDatabase(idx int) *Database {
 		addAof:   func(cmdLine [][]byte) {},
 		index:    idx,
 		timeHeap: timeheap.NewTimeHeap(DEFAULT_TICK_INTERVAL),
+		stats:    newServerStats(),
+		evictor:  newEvictor(0, POLICY_NO_EVICTION, DEFAULT_MAXMEMORY_SAMPLES),
+		blocking: newBlockingKeys(),
 	}
 	db.timeHeap.Start()
 	return db
 }
 
+// close stop the expiration of the keys by the time heap
+func (db *Database) close() {
+	db.timeHeap.Stop()
+}
+
 // ExecFunc the core method to invoke by the command
 type ExecFunc func(db *Database, cmdLine [][]byte) redis.Reply
 
@@ -58,6 +77,7 @@ type PreFunc func(cmdLine [][]byte) ([]string, []string)
 // UndoFunc get the undo logs of the current command
 type UndoFunc func(db *Database, args [][]byte) []CmdLine
 
+// GetEntity get the entity of the key, the expired key will be removed
 func (db *Database) GetEntity(key string) (entity *database.DataEntity, exists bool) {
 	value, exists := db.data.Get(key)
 	if !exists {
@@ -69,9 +89,18 @@ func (db *Database) GetEntity(key string) (entity *database.DataEntity, exists b
 		return nil, false
 	}
 
+	if db.IsExpired(key) {
+		db.RWLocks([]string{key}, nil)
+		defer db.RWUnlocks([]string{key}, nil)
+		db.expireIfNeeded(key)
+		return nil, false
+	}
+
 	return entity, true
 }
 
+// GetEntityWithLock get the entity when the key is locked, the expired key is hidden
+// and will be removed by expireIfNeeded under the write lock
 func (db *Database) GetEntityWithLock(key string) (entity *database.DataEntity, exists bool) {
 	value, exists := db.data.GetWithLock(key)
 	if !exists {
@@ -83,6 +112,10 @@ func (db *Database) GetEntityWithLock(key string) (entity *database.DataEntity,
 		return nil, false
 	}
 
+	if db.IsExpired(key) {
+		return nil, false
+	}
+
 	return entity, true
 }
 
@@ -152,6 +185,9 @@ func (db *Database) RemoveEntityWithLock(key string) (entity *database.DataEntit
 
 func (db *Database) RWLocks(wks []string, rks []string) {
 	db.data.RWLocks(wks, rks)
+	if snap := db.snapshot.Load(); snap != nil && len(wks) > 0 {
+		snap.capture(db, wks)
+	}
 }
 
 func (db *Database) RWUnlocks(wks []string, rks []string) {
@@ -176,18 +212,76 @@ func (db *Database) Persister(key string) {
 }
 
 func (db *Database) IsTTLKey(key string) bool {
-	expireKey := EXPIRE_PREFIX + key
-	_, exists := db.ttlMap.GetWithLock(expireKey)
+	_, exists := db.GetExpireTime(key)
 	return exists
 }
 
-func (db *Database) TTLCmd(key string) [][]byte {
+// GetExpireTime get the expire time of the key
+func (db *Database) GetExpireTime(key string) (expireAt time.Time, exists bool) {
 	expireKey := EXPIRE_PREFIX + key
-	value, exists := db.ttlMap.GetWithLock(expireKey)
+	value, exists := db.ttlMap.Get(expireKey)
+	if !exists {
+		return time.Time{}, false
+	}
+	return value.(time.Time), true
+}
+
+// IsExpired judge whether the deadline of the key has passed
+func (db *Database) IsExpired(key string) bool {
+	expireAt, exists := db.GetExpireTime(key)
+	if !exists {
+		return false
+	}
+	return time.Now().After(expireAt)
+}
+
+// expiredKeys get the keys which have passed the deadline
+func (db *Database) expiredKeys(keys []string) []string {
+	expired := make([]string, 0)
+	for _, key := range keys {
+		if db.IsExpired(key) {
+			expired = append(expired, key)
+		}
+	}
+	return expired
+}
+
+// expireIfNeeded remove the expired keys and write DEL into aof, the keys must be write locked
+func (db *Database) expireIfNeeded(keys ...string) {
+	for _, key := range keys {
+		if !db.IsExpired(key) {
+			continue
+		}
+		if entity, result := db.RemoveEntityWithLock(key); result > 0 {
+			atomic.AddInt64(&db.usedMemory, -entity.Size)
+		}
+		db.Persister(key)
+		db.AddVersion(key)
+		db.addAof(utils.CmdLine1("DEL", key))
+		atomic.AddInt64(&db.stats.expiredKeys, 1)
+	}
+}
+
+// flush remove all the keys of the database and write DEL into aof
+func (db *Database) flush() {
+	for _, key := range db.data.Keys() {
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		if entity, result := db.RemoveEntityWithLock(key); result > 0 {
+			atomic.AddInt64(&db.usedMemory, -entity.Size)
+			db.Persister(key)
+			db.AddVersion(key)
+			db.addAof(utils.CmdLine1("DEL", key))
+		}
+		db.RWUnlocks(keys, nil)
+	}
+}
+
+func (db *Database) TTLCmd(key string) [][]byte {
+	expireAt, exists := db.GetExpireTime(key)
 	if !exists {
 		return nil
 	}
-	expireAt := time.UnixMilli(value.(int64))
 	return utils.ExpireCmd(key, expireAt)
 }
 
@@ -200,20 +294,10 @@ func (db *Database) Expire(key string, expireAt time.Time) redis.Reply {
 	}
 	db.ttlMap.PutWithLock(expireKey, expireAt)
 	db.timeHeap.AddTask(expireAt, expireKey, func() {
-		db.data.RWLocks([]string{key}, nil)
-		db.ttlMap.RWLocks([]string{expireKey}, nil)
-		defer func() {
-			db.data.RWUnLocks([]string{key}, nil)
-			db.ttlMap.RWUnLocks([]string{expireKey}, nil)
-		}()
-
-		if value, ok := db.ttlMap.Get(expireKey); ok {
-			timeToExpire := value.(time.Time)
-			if time.Now().After(timeToExpire) {
-				db.data.RemoveWithLock(key)
-			}
-		}
-		db.ttlMap.RemoveWithLock(expireKey)
+		keys := []string{key}
+		db.RWLocks(keys, nil)
+		defer db.RWUnlocks(keys, nil)
+		db.expireIfNeeded(key)
 	})
 	return protocol.NewOkReply()
 }
@@ -266,6 +350,7 @@ func (db *Database) Exec(conn redis.Conn, cmdLine [][]byte) redis.Reply {
 	}
 
 	if validCommand(cmdLine) != nil {
+		db.stats.rejectCommand(cmdName)
 		return protocol.NewErrReply("in valid command")
 	}
 
@@ -278,19 +363,45 @@ func (db *Database) execNormalCommand(conn redis.Conn, cmdLine [][]byte) redis.R
 	if !ok {
 		return protocol.NewErrReply(COMMAND_NOT_FIND)
 	}
+	return db.execLocked(cmdName, cmd, cmdLine)
+}
 
+// execLocked lock the keys given by the prepare function and exec the command
+func (db *Database) execLocked(cmdName string, cmd *command, cmdLine [][]byte) redis.Reply {
 	prepare := cmd.prepare
-	if prepare != nil {
-		wks, rks := prepare(cmdLine[1:])
-		db.RWLocks(wks, rks)
-		defer db.RWUnlocks(wks, rks)
-		db.AddVersion(wks...)
+	if prepare == nil {
+		return db.execAndRecord(cmdName, cmd, cmdLine)
+	}
+
+	wks, rks := prepare(cmdLine[1:])
+	readOnly := len(wks) == 0
+	// the expired read keys need the write lock to be removed
+	wks = append(wks, db.expiredKeys(rks)...)
+	db.RWLocks(wks, rks)
+	defer db.RWUnlocks(wks, rks)
+	db.expireIfNeeded(wks...)
+	db.AddVersion(wks...)
+	if readOnly {
+		db.countKeyspace(rks)
 	}
+	sizes := db.sizesOf(wks)
+	reply := db.execAndRecord(cmdName, cmd, cmdLine)
+	touched := rks
+	if _, ok := noTouchCommands[cmdName]; ok {
+		touched = nil
+	}
+	db.afterWrite(sizes, touched)
+	return reply
+}
 
+// execAndRecord invoke the command and record the call in the command stats
+func (db *Database) execAndRecord(cmdName string, cmd *command, cmdLine [][]byte) redis.Reply {
+	start := time.Now()
 	reply := cmd.exector(db, cmdLine[1:])
 	if reply == nil {
-		return protocol.NewErrReply(EMPTY_REPLY)
+		reply = protocol.NewErrReply(EMPTY_REPLY)
 	}
+	db.stats.recordCommand(cmdName, time.Since(start), protocol.IsErrReply(reply))
 	return reply
 }
 
@@ -300,12 +411,7 @@ func (db *Database) execWithLock(conn redis.Conn, cmdLine [][]byte) redis.Reply
 	if !ok {
 		return protocol.NewErrReply(COMMAND_NOT_FIND)
 	}
-
-	reply := cmd.exector(db, cmdLine[1:])
-	if reply == nil {
-		return protocol.NewErrReply(EMPTY_REPLY)
-	}
-	return reply
+	return db.execAndRecord(cmdName, cmd, cmdLine)
 }
 
 func validCommand(commandLine [][]byte) error {
@@ -0,0 +1,474 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/**
+maxmemory
+the memory of every key is estimated when it is written, the keys are evicted by the policy
+before executing the command when the estimated memory is over the limit,
+the candidates are chosen from the sampled keys like redis
+*/
+
+const (
+	POLICY_NO_EVICTION     = "noeviction"
+	POLICY_ALLKEYS_LRU     = "allkeys-lru"
+	POLICY_ALLKEYS_LFU     = "allkeys-lfu"
+	POLICY_ALLKEYS_RANDOM  = "allkeys-random"
+	POLICY_VOLATILE_LRU    = "volatile-lru"
+	POLICY_VOLATILE_LFU    = "volatile-lfu"
+	POLICY_VOLATILE_RANDOM = "volatile-random"
+	POLICY_VOLATILE_TTL    = "volatile-ttl"
+
+	DEFAULT_MAXMEMORY_SAMPLES = 5
+	OOM_ERR                   = "OOM command not allowed when used memory > 'maxmemory'."
+
+	// the estimated overhead of the go runtime, e.g. the headers and the map entries
+	ENTITY_OVERHEAD     = 64
+	STRING_OVERHEAD     = 24
+	CONTAINER_OVERHEAD  = 48
+	LIST_NODE_OVERHEAD  = 56
+	HASH_ENTRY_OVERHEAD = 56
+	SET_ENTRY_OVERHEAD  = 32
+	ZSET_ENTRY_OVERHEAD = 112
+
+	// LFU_INIT_VAL, LFU_LOG_FACTOR and LFU_DECAY_MINUTES are the same as the defaults of redis
+	LFU_INIT_VAL      = 5
+	LFU_LOG_FACTOR    = 10
+	LFU_DECAY_MINUTES = 1
+	LFU_MAX_COUNTER   = 255
+)
+
+// noDenyOOMCommands are the write commands never growing the memory, they are allowed over the limit
+var noDenyOOMCommands = map[string]struct{}{
+	"del": {}, "lpop": {}, "rpop": {}, "blpop": {}, "brpop": {}, "lmpop": {}, "lrem": {}, "ltrim": {}, "srem": {},
+	"spop": {}, "smove": {}, "hdel": {}, "zrem": {}, "zremrangebyrank": {}, "zremrangebyscore": {},
+	"zremrangebylex": {}, "zpopmin": {}, "zpopmax": {}, "bzpopmin": {}, "bzpopmax": {}, "persister": {},
+	"expire": {}, "pexpire": {}, "expireat": {}, "pexpireat": {}, "rename": {}, "renamenx": {}, "migrate": {},
+}
+
+// evictor keeps the maxmemory settings of the server
+type evictor struct {
+	// maxMemory is the limit in bytes, 0 means no limit
+	maxMemory int64
+	policy    string
+	samples   int
+	// nextDB is the database to evict from by the random policies
+	nextDB uint32
+}
+
+func newEvictor(maxMemory int64, policy string, samples int) *evictor {
+	if samples <= 0 {
+		samples = DEFAULT_MAXMEMORY_SAMPLES
+	}
+	return &evictor{
+		maxMemory: maxMemory,
+		policy:    policy,
+		samples:   samples,
+	}
+}
+
+func newEvictorByConfig() *evictor {
+	cfg := config.GetMemoryConfig()
+	maxMemory, err := parseMemorySize(cfg.MaxMemory)
+	if err != nil {
+		logger.Error("invalid maxmemory %s, the memory is not limited", cfg.MaxMemory)
+		maxMemory = 0
+	}
+	policy := strings.ToLower(cfg.MaxMemoryPolicy)
+	if !validPolicy(policy) {
+		logger.Error("invalid maxmemory policy %s, use noeviction", cfg.MaxMemoryPolicy)
+		policy = POLICY_NO_EVICTION
+	}
+	return newEvictor(maxMemory, policy, cfg.MaxMemorySamples)
+}
+
+func validPolicy(policy string) bool {
+	switch policy {
+	case POLICY_NO_EVICTION, POLICY_ALLKEYS_LRU, POLICY_ALLKEYS_LFU, POLICY_ALLKEYS_RANDOM,
+		POLICY_VOLATILE_LRU, POLICY_VOLATILE_LFU, POLICY_VOLATILE_RANDOM, POLICY_VOLATILE_TTL:
+		return true
+	}
+	return false
+}
+
+// parseMemorySize parse the size with the unit like redis, k is 1000 and kb is 1024
+func parseMemorySize(size string) (int64, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	if size == "" {
+		return 0, nil
+	}
+	units := []struct {
+		suffix string
+		mul    int64
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000}, {"b", 1},
+	}
+	mul := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = strings.TrimSuffix(size, unit.suffix)
+			mul = unit.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return 0, strconv.ErrSyntax
+	}
+	return n * mul, nil
+}
+
+// usedMemory is the estimated memory of the keys of all the databases
+func (r *RedisServer) usedMemory() int64 {
+	var used int64
+	for i := range r.dbSet {
+		db, err := r.selectDB(i)
+		if err != nil {
+			continue
+		}
+		used += atomic.LoadInt64(&db.usedMemory)
+	}
+	return used
+}
+
+// denyOOM judge whether the command is rejected over the limit, EXEC is rejected
+// when any queued command is
+func denyOOM(conn redis.Conn, cmdName string, cmdLine [][]byte) bool {
+	if cmdName == "exec" && conn.InitMulti() {
+		for _, queued := range conn.GetCmdLineInQueue() {
+			if denyOOM(conn, strings.ToLower(string(queued[0])), queued) {
+				return true
+			}
+		}
+		return false
+	}
+	if _, ok := noDenyOOMCommands[cmdName]; ok {
+		return false
+	}
+	return isWriteCommand(cmdLine)
+}
+
+// freeMemoryIfNeeded evict the keys before executing the command when the memory is over the limit,
+// the OOM err is returned for the write commands when the keys can not be evicted.
+// the replica keeps the keys of the master and the internal connections are never rejected
+func (r *RedisServer) freeMemoryIfNeeded(conn redis.Conn, cmdName string, cmdLine [][]byte) redis.Reply {
+	if r.evictor.maxMemory <= 0 || conn.GetUser() == connection.INTERNAL_USER {
+		return nil
+	}
+	if r.repl != nil && r.repl.isReplica() {
+		return nil
+	}
+	if r.performEvictions() {
+		return nil
+	}
+	if !denyOOM(conn, cmdName, cmdLine) {
+		return nil
+	}
+	errReply := protocol.NewErrReply(OOM_ERR)
+	if conn.InitMulti() && cmdName != "exec" {
+		conn.AddTxErrors(errReply)
+	}
+	return errReply
+}
+
+// performEvictions evict the keys until the memory is under the limit, return false when it is not possible
+func (r *RedisServer) performEvictions() bool {
+	for r.usedMemory() > r.evictor.maxMemory {
+		if r.evictor.policy == POLICY_NO_EVICTION {
+			return false
+		}
+		db, key := r.evictionCandidate()
+		if db == nil {
+			return false
+		}
+		db.evictKey(key)
+	}
+	return true
+}
+
+func isVolatilePolicy(policy string) bool {
+	return strings.HasPrefix(policy, "volatile-")
+}
+
+// evictionCandidate choose the best key among the keys sampled from every database,
+// the random policies take a key of the databases in turn
+func (r *RedisServer) evictionCandidate() (*Database, string) {
+	policy := r.evictor.policy
+	volatile := isVolatilePolicy(policy)
+	if policy == POLICY_ALLKEYS_RANDOM || policy == POLICY_VOLATILE_RANDOM {
+		for i := 0; i < len(r.dbSet); i++ {
+			index := int(atomic.AddUint32(&r.evictor.nextDB, 1)) % len(r.dbSet)
+			db, err := r.selectDB(index)
+			if err != nil {
+				continue
+			}
+			if keys := db.sampleKeys(volatile, 1); len(keys) > 0 {
+				return db, keys[0]
+			}
+		}
+		return nil, ""
+	}
+
+	var bestDB *Database
+	var bestKey string
+	var bestScore int64
+	now := time.Now()
+	for i := range r.dbSet {
+		db, err := r.selectDB(i)
+		if err != nil {
+			continue
+		}
+		for _, key := range db.sampleKeys(volatile, r.evictor.samples) {
+			score, ok := db.evictionScore(key, policy, now)
+			if ok && (bestDB == nil || score > bestScore) {
+				bestDB, bestKey, bestScore = db, key, score
+			}
+		}
+	}
+	return bestDB, bestKey
+}
+
+// sampleKeys get the random keys of the database, only the keys with the ttl are sampled by the volatile policies
+func (db *Database) sampleKeys(volatile bool, count int) []string {
+	if !volatile {
+		return db.data.RandomDistinctKeys(count)
+	}
+	keys := db.ttlMap.RandomDistinctKeys(count)
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, EXPIRE_PREFIX)
+	}
+	return keys
+}
+
+// evictionScore is larger when the key is better to be evicted
+func (db *Database) evictionScore(key string, policy string, now time.Time) (int64, bool) {
+	if policy == POLICY_VOLATILE_TTL {
+		expireAt, ok := db.GetExpireTime(key)
+		if !ok {
+			return 0, false
+		}
+		return math.MaxInt64 - expireAt.UnixMilli(), true
+	}
+	value, ok := db.data.Get(key)
+	if !ok {
+		return 0, false
+	}
+	entity := value.(*database.DataEntity)
+	switch policy {
+	case POLICY_ALLKEYS_LFU, POLICY_VOLATILE_LFU:
+		return int64(LFU_MAX_COUNTER - lfuDecr(entity, now)), true
+	default:
+		return idleTime(entity, now).Milliseconds(), true
+	}
+}
+
+// evictKey remove the key and write DEL into aof, so the replicas evict it too
+func (db *Database) evictKey(key string) bool {
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWUnlocks(keys, nil)
+	entity, result := db.RemoveEntityWithLock(key)
+	if result == 0 {
+		return false
+	}
+	atomic.AddInt64(&db.usedMemory, -entity.Size)
+	db.Persister(key)
+	db.AddVersion(key)
+	db.addAof(utils.CmdLine1("DEL", key))
+	atomic.AddInt64(&db.stats.evictedKeys, 1)
+	return true
+}
+
+// sizesOf get the recorded size of the write keys before the command, the keys must be locked
+func (db *Database) sizesOf(keys []string) map[string]int64 {
+	sizes := make(map[string]int64, len(keys))
+	for _, key := range keys {
+		if value, ok := db.data.GetWithLock(key); ok {
+			sizes[key] = value.(*database.DataEntity).Size
+		} else {
+			sizes[key] = 0
+		}
+	}
+	return sizes
+}
+
+// afterWrite estimate the size of the write keys again to update the used memory, and
+// refresh the access time of all the keys used by the command, the keys must be locked
+func (db *Database) afterWrite(sizes map[string]int64, rks []string) {
+	now := time.Now()
+	var delta int64
+	for key, oldSize := range sizes {
+		value, ok := db.data.GetWithLock(key)
+		if !ok {
+			delta -= oldSize
+			continue
+		}
+		entity := value.(*database.DataEntity)
+		entity.Size = estimateSize(key, entity, DEFAULT_MAXMEMORY_SAMPLES)
+		delta += entity.Size - oldSize
+		touchEntity(entity, now)
+	}
+	if delta != 0 {
+		atomic.AddInt64(&db.usedMemory, delta)
+	}
+	db.touchKeys(rks, now)
+}
+
+// touchKeys refresh the access time of the read keys, the keys must be locked
+func (db *Database) touchKeys(keys []string, now time.Time) {
+	for _, key := range keys {
+		if value, ok := db.data.GetWithLock(key); ok {
+			touchEntity(value.(*database.DataEntity), now)
+		}
+	}
+}
+
+// estimateSize estimate the memory of the key by the sampled elements, samples <= 0 means all of them
+func estimateSize(key string, entity *database.DataEntity, samples int) int64 {
+	size := int64(ENTITY_OVERHEAD + len(key))
+	sampler := newSizeSampler(samples)
+	switch data := entity.Data.(type) {
+	case []byte:
+		return size + STRING_OVERHEAD + int64(len(data))
+	case *list.List:
+		if packed := data.ListpackBytes(); packed > 0 {
+			return size + CONTAINER_OVERHEAD + int64(packed)
+		}
+		data.ForEach(func(value any) bool {
+			// the elements are strings pushed by the commands or bytes loaded from the snapshot
+			length := 0
+			switch v := value.(type) {
+			case string:
+				length = len(v)
+			case []byte:
+				length = len(v)
+			}
+			return sampler.add(LIST_NODE_OVERHEAD + length)
+		})
+		return size + CONTAINER_OVERHEAD + sampler.total(int64(data.Len()))
+	case *hash.Hash:
+		data.ForEach(func(field string, value []byte) bool {
+			return sampler.add(HASH_ENTRY_OVERHEAD + len(field) + len(value))
+		})
+		return size + CONTAINER_OVERHEAD + sampler.total(int64(data.Len()))
+	case *set.Set:
+		data.ForEach(func(member string) bool {
+			return sampler.add(SET_ENTRY_OVERHEAD + len(member))
+		})
+		return size + CONTAINER_OVERHEAD + sampler.total(int64(data.Len()))
+	case *sortedset.SortedSet:
+		if packed := data.ListpackBytes(); packed > 0 {
+			return size + CONTAINER_OVERHEAD + int64(packed)
+		}
+		data.ForEach(func(score float64, member string) bool {
+			return sampler.add(ZSET_ENTRY_OVERHEAD + len(member))
+		})
+		return size + CONTAINER_OVERHEAD*2 + sampler.total(data.Len())
+	}
+	return size
+}
+
+// sizeSampler average the size of the first elements like MEMORY USAGE of redis
+type sizeSampler struct {
+	limit int
+	count int
+	sum   int64
+}
+
+func newSizeSampler(limit int) *sizeSampler {
+	return &sizeSampler{limit: limit}
+}
+
+// add the size of an element, return false when there are enough samples
+func (s *sizeSampler) add(size int) bool {
+	s.count++
+	s.sum += int64(size)
+	return s.limit <= 0 || s.count < s.limit
+}
+
+// total estimate the size of all the elements
+func (s *sizeSampler) total(length int64) int64 {
+	if s.count == 0 {
+		return 0
+	}
+	return s.sum * length / int64(s.count)
+}
+
+// lruClock is the access clock in milliseconds, it wraps around every 49 days like the clock of redis
+func lruClock(now time.Time) uint32 {
+	return uint32(now.UnixMilli())
+}
+
+// idleTime get the time since the last access, the key never accessed is the idlest
+func idleTime(entity *database.DataEntity, now time.Time) time.Duration {
+	lru := atomic.LoadUint32(&entity.LRU)
+	if lru == 0 {
+		return time.Duration(math.MaxUint32) * time.Millisecond
+	}
+	return time.Duration(lruClock(now)-lru) * time.Millisecond
+}
+
+// lfuMinutes is the 16 bits clock in minutes of the last decrement time
+func lfuMinutes(now time.Time) uint32 {
+	return uint32(now.Unix()/60) & 0xFFFF
+}
+
+// lfuDecr get the counter decreased by the time since the last decrement like LFUDecrAndReturn of redis
+func lfuDecr(entity *database.DataEntity, now time.Time) uint32 {
+	lfu := atomic.LoadUint32(&entity.LFU)
+	if lfu == 0 {
+		return LFU_INIT_VAL
+	}
+	counter := lfu & 0xFF
+	elapsed := (lfuMinutes(now) - lfu>>8) & 0xFFFF
+	periods := elapsed / LFU_DECAY_MINUTES
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// lfuLogIncr increase the counter logarithmically, the hotter the key is the harder the counter grows
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= LFU_MAX_COUNTER {
+		return LFU_MAX_COUNTER
+	}
+	baseval := float64(counter) - LFU_INIT_VAL
+	if baseval < 0 {
+		baseval = 0
+	}
+	if rand.Float64() < 1.0/(baseval*LFU_LOG_FACTOR+1) {
+		counter++
+	}
+	return counter
+}
+
+// touchEntity update the access time and the access counter of the entity,
+// the counter of the new entity starts from LFU_INIT_VAL like redis
+func touchEntity(entity *database.DataEntity, now time.Time) {
+	atomic.StoreUint32(&entity.LRU, lruClock(now))
+	counter := uint32(LFU_INIT_VAL)
+	if atomic.LoadUint32(&entity.LFU) != 0 {
+		counter = lfuLogIncr(lfuDecr(entity, now))
+	}
+	atomic.StoreUint32(&entity.LFU, lfuMinutes(now)<<8|counter)
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newEvictServer create the server without the limit, the limit is set after the keys are written
+func newEvictServer(policy string) *RedisServer {
+	server := NewPureServer()
+	// the evictor is shared with the databases, so it is changed in place
+	*server.evictor = *newEvictor(0, policy, DEFAULT_MAXMEMORY_SAMPLES)
+	return server
+}
+
+func TestParseMemorySize(t *testing.T) {
+	cases := map[string]int64{"0": 0, "100": 100, "1k": 1000, "1kb": 1024, "2MB": 2 << 20, "1gb": 1 << 30}
+	for size, expected := range cases {
+		if n, err := parseMemorySize(size); err != nil || n != expected {
+			t.Error("parse memory size err: ", size, n, err)
+		}
+	}
+	if _, err := parseMemorySize("10xb"); err == nil {
+		t.Error("the invalid size should be rejected")
+	}
+}
+
+func TestUsedMemory(t *testing.T) {
+	server := newEvictServer(POLICY_NO_EVICTION)
+	conn := newClientConn()
+	replyOf(server, conn, "SET", "k", "value")
+	used := server.usedMemory()
+	if used != ENTITY_OVERHEAD+1+STRING_OVERHEAD+5 {
+		t.Error("used memory of string err: ", used)
+	}
+	replyOf(server, conn, "RPUSH", "list", "a", "b", "c")
+	if server.usedMemory() <= used {
+		t.Error("used memory of list err: ", server.usedMemory())
+	}
+	replyOf(server, conn, "DEL", "k", "list")
+	if server.usedMemory() != 0 {
+		t.Error("used memory after del err: ", server.usedMemory())
+	}
+
+	replyOf(server, conn, "MULTI")
+	replyOf(server, conn, "SADD", "set", "a", "b")
+	replyOf(server, conn, "EXEC")
+	if server.usedMemory() == 0 {
+		t.Error("used memory of multi err")
+	}
+	replyOf(server, conn, "EXPIRE", "set", "0")
+	replyOf(server, conn, "SCARD", "set")
+	if server.usedMemory() != 0 {
+		t.Error("used memory after expired err: ", server.usedMemory())
+	}
+}
+
+func TestNoEviction(t *testing.T) {
+	server := newEvictServer(POLICY_NO_EVICTION)
+	conn := newClientConn()
+	replyOf(server, conn, "SET", "k1", "v1")
+	server.evictor.maxMemory = 1
+
+	if reply := replyOf(server, conn, "SET", "k2", "v2"); reply != "-"+OOM_ERR+"\r\n" {
+		t.Error("set over the limit err: ", reply)
+	}
+	if reply := replyOf(server, conn, "GET", "k1"); reply != "$2\r\nv1\r\n" {
+		t.Error("get over the limit err: ", reply)
+	}
+	replyOf(server, conn, "MULTI")
+	if reply := replyOf(server, conn, "SET", "k2", "v2"); reply != "-"+OOM_ERR+"\r\n" {
+		t.Error("queue over the limit err: ", reply)
+	}
+	replyOf(server, conn, "DISCARD")
+	if reply := replyOf(server, conn, "DEL", "k1"); reply != ":1\r\n" {
+		t.Error("del over the limit err: ", reply)
+	}
+	if reply := replyOf(server, conn, "SET", "k2", "v2"); reply != "+OK\r\n" {
+		t.Error("set under the limit err: ", reply)
+	}
+}
+
+type commandConn func(args ...string) string
+
+func TestEviction(t *testing.T) {
+	// the limit is a little less than the used memory, so a key is evicted before writing k5
+	testCases := []struct {
+		policy  string
+		prepare func(conn commandConn)
+		evicted string
+	}{
+		{POLICY_ALLKEYS_LRU, func(conn commandConn) {
+			for _, key := range []string{"k1", "k2", "k3", "k4"} {
+				time.Sleep(2 * time.Millisecond)
+				conn("SET", key, "v")
+			}
+			conn("GET", "k1")
+		}, "k2"},
+		{POLICY_ALLKEYS_LFU, func(conn commandConn) {
+			for _, key := range []string{"k1", "k2", "k3", "k4"} {
+				conn("SET", key, "v")
+			}
+			for i := 0; i < 10; i++ {
+				conn("GET", "k1")
+				conn("GET", "k2")
+				conn("GET", "k4")
+			}
+		}, "k3"},
+		{POLICY_VOLATILE_TTL, func(conn commandConn) {
+			for _, key := range []string{"k1", "k2", "k3", "k4"} {
+				conn("SET", key, "v")
+			}
+			conn("EXPIRE", "k1", "200")
+			conn("EXPIRE", "k2", "100")
+		}, "k2"},
+		{POLICY_VOLATILE_LRU, func(conn commandConn) {
+			for _, key := range []string{"k1", "k2", "k3", "k4"} {
+				conn("SET", key, "v")
+			}
+			conn("EXPIRE", "k3", "100")
+		}, "k3"},
+		{POLICY_VOLATILE_RANDOM, func(conn commandConn) {
+			for _, key := range []string{"k1", "k2", "k3", "k4"} {
+				conn("SET", key, "v")
+			}
+			conn("EXPIRE", "k4", "100")
+		}, "k4"},
+	}
+	for _, testCase := range testCases {
+		server := newEvictServer(testCase.policy)
+		conn := newClientConn()
+		var aofCmds []string
+		server.mustSelectDB(0).addAof = func(cmdLine [][]byte) {
+			aofCmds = append(aofCmds, string(cmdLine[0])+" "+string(cmdLine[1]))
+		}
+		testCase.prepare(func(args ...string) string {
+			return replyOf(server, conn, args...)
+		})
+		server.evictor.maxMemory = server.usedMemory() - 1
+		if reply := replyOf(server, conn, "SET", "k5", "v"); reply != "+OK\r\n" {
+			t.Error(testCase.policy, " set with eviction err: ", reply)
+		}
+		server.evictor.maxMemory = 0
+		if reply := replyOf(server, conn, "EXISTS", testCase.evicted); reply != ":0\r\n" {
+			t.Error(testCase.policy, " the key should be evicted: ", testCase.evicted)
+		}
+		if aofCmds[len(aofCmds)-2] != "DEL "+testCase.evicted {
+			t.Error(testCase.policy, " the eviction should be written into aof: ", aofCmds)
+		}
+		if reply := replyOf(server, conn, "INFO", "stats"); !strings.Contains(reply, "evicted_keys:1\r\n") {
+			t.Error(testCase.policy, " evicted keys err: ", reply)
+		}
+	}
+}
+
+func TestVolatileWithoutTTL(t *testing.T) {
+	server := newEvictServer(POLICY_VOLATILE_LRU)
+	conn := newClientConn()
+	replyOf(server, conn, "SET", "k1", "v1")
+	server.evictor.maxMemory = 1
+	if reply := replyOf(server, conn, "SET", "k2", "v2"); reply != "-"+OOM_ERR+"\r\n" {
+		t.Error("no key can be evicted without ttl: ", reply)
+	}
+
+	server = newEvictServer(POLICY_ALLKEYS_RANDOM)
+	for i := 0; i < 10; i++ {
+		server.Exec(conn, utils.CmdLine1("SET", "k"+string(rune('0'+i)), "v"))
+	}
+	server.evictor.maxMemory = server.usedMemory() / 2
+	replyOf(server, conn, "PING")
+	if used := server.usedMemory(); used > server.evictor.maxMemory || used == 0 {
+		t.Error("random eviction err: ", used)
+	}
+}
@@ -0,0 +1,357 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"math"
+	"strconv"
+)
+
+/*
+	HSET
+	HGET
+	HMGET
+	HDEL
+	HEXISTS
+	HLEN
+	HKEYS
+	HVALS
+	HGETALL
+	HINCRBY
+	HINCRBYFLOAT
+	HSETNX
+	HSTRLEN
+*/
+
+const (
+	HASH_VALUE_NOT_INT   = "ERR hash value is not an integer"
+	HASH_VALUE_NOT_FLOAT = "ERR hash value is not a float"
+	HASH_INCR_OVERFLOW   = "ERR increment or decrement would overflow"
+	HASH_INCR_NAN_OR_INF = "ERR increment would produce NaN or Infinity"
+)
+
+func init() {
+	RegisterCommand("HSET", execHSet, writeFirstKey, undoHSet, -4)
+	RegisterCommand("HGET", execHGet, readFirstKey, nil, 3)
+	RegisterCommand("HMGET", execHMGet, readFirstKey, nil, -3)
+	RegisterCommand("HDEL", execHDel, writeFirstKey, undoHDel, -3)
+	RegisterCommand("HEXISTS", execHExists, readFirstKey, nil, 3)
+	RegisterCommand("HLEN", execHLen, readFirstKey, nil, 2)
+	RegisterCommand("HKEYS", execHKeys, readFirstKey, nil, 2)
+	RegisterCommand("HVALS", execHVals, readFirstKey, nil, 2)
+	RegisterCommand("HGETALL", execHGetAll, readFirstKey, nil, 2)
+	RegisterCommand("HINCRBY", execHIncrBy, writeFirstKey, undoHField, 4)
+	RegisterCommand("HINCRBYFLOAT", execHIncrByFloat, writeFirstKey, undoHField, 4)
+	RegisterCommand("HSETNX", execHSetNx, writeFirstKey, undoHField, 4)
+	RegisterCommand("HSTRLEN", execHStrLen, readFirstKey, nil, 3)
+}
+
+// getAsHash get the hash of the key, return err reply if the key is not a hash
+func (db *Database) getAsHash(key string) (*hash.Hash, redis.Reply) {
+	entity, exists := db.GetEntityWithLock(key)
+	if !exists {
+		return nil, nil
+	}
+	h, ok := entity.Data.(*hash.Hash)
+	if !ok {
+		return nil, protocol.NewErrReply(WRONG_TYPE_ERR)
+	}
+	return h, nil
+}
+
+func (db *Database) getOrInitHash(key string) (*hash.Hash, redis.Reply) {
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if h == nil {
+		h = hash.NewHash()
+		db.PutEntityWithLock(key, &database.DataEntity{
+			Data: h,
+		})
+	}
+	return h, nil
+}
+
+// rollbackHashFields restore the given fields of the hash to the current value
+func rollbackHashFields(db *Database, key string, fields ...string) []CmdLine {
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return rollbackGivenKeys(db, key)
+	}
+	if h == nil {
+		return []CmdLine{utils.CmdLine1("DEL", key)}
+	}
+	undoCmdLines := make([]CmdLine, 0, len(fields))
+	for _, field := range fields {
+		value, exists := h.Get(field)
+		if exists {
+			undoCmdLines = append(undoCmdLines,
+				utils.CmdLine1("HSET", key, field, string(value)))
+		} else {
+			undoCmdLines = append(undoCmdLines,
+				utils.CmdLine1("HDEL", key, field))
+		}
+	}
+	return undoCmdLines
+}
+
+// undoHSet: HSET key field value [field value ...]
+func undoHSet(db *Database, args [][]byte) []CmdLine {
+	fields := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		fields = append(fields, string(args[i]))
+	}
+	return rollbackHashFields(db, string(args[0]), fields...)
+}
+
+// undoHDel: HDEL key field [field ...]
+func undoHDel(db *Database, args [][]byte) []CmdLine {
+	return rollbackHashFields(db, string(args[0]), bytesToString(args[1:])...)
+}
+
+// undoHField: HINCRBY/HSETNX key field ..., only one field changed
+func undoHField(db *Database, args [][]byte) []CmdLine {
+	return rollbackHashFields(db, string(args[0]), string(args[1]))
+}
+
+// HSET key field value [field value ...]
+func execHSet(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	if (len(cmdLine)-1)%2 == 1 {
+		return protocol.NewErrReply(ARGS_NUMBER_ERR_WARN)
+	}
+	h, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	var result int
+	for i := 1; i < len(cmdLine); i += 2 {
+		result += h.Put(string(cmdLine[i]), cmdLine[i+1])
+	}
+	db.addAof(utils.CmdLine2("HSET", cmdLine))
+	return protocol.NewIntReply(int64(result))
+}
+
+// HGET key field
+func execHGet(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewNullBulkReply()
+	}
+	value, exists := h.Get(string(cmdLine[1]))
+	if !exists {
+		return protocol.NewNullBulkReply()
+	}
+	return protocol.NewBulkReply(value)
+}
+
+// HMGET key field [field ...]
+func execHMGet(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]redis.Reply, len(cmdLine)-1)
+	for i, field := range cmdLine[1:] {
+		if h == nil {
+			replies[i] = protocol.NewNullBulkReply()
+			continue
+		}
+		value, exists := h.Get(string(field))
+		if !exists {
+			replies[i] = protocol.NewNullBulkReply()
+			continue
+		}
+		replies[i] = protocol.NewBulkReply(value)
+	}
+	return protocol.NewMultiRawReply(replies)
+}
+
+// HDEL key field [field ...]
+func execHDel(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewIntReply(0)
+	}
+	var result int
+	for _, field := range cmdLine[1:] {
+		result += h.Remove(string(field))
+	}
+	if h.Len() == 0 {
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+	}
+	if result > 0 {
+		db.addAof(utils.CmdLine2("HDEL", cmdLine))
+	}
+	return protocol.NewIntReply(int64(result))
+}
+
+// HEXISTS key field
+func execHExists(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil || !h.Exists(string(cmdLine[1])) {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(1)
+}
+
+// HLEN key
+func execHLen(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(int64(h.Len()))
+}
+
+// HKEYS key
+func execHKeys(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewEmptyReply()
+	}
+	return protocol.NewMultiReply(stringsToBytes(h.Fields()))
+}
+
+// HVALS key
+func execHVals(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewEmptyReply()
+	}
+	return protocol.NewMultiReply(h.Values())
+}
+
+// HGETALL key
+func execHGetAll(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewMapReply(nil)
+	}
+	args := make([][]byte, 0, h.Len()*2)
+	h.ForEach(func(field string, value []byte) bool {
+		args = append(args, []byte(field), value)
+		return true
+	})
+	return protocol.NewMapReply(protocol.BulkStrings(args))
+}
+
+// HINCRBY key field increment
+func execHIncrBy(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	field := string(cmdLine[1])
+	increment, err := strconv.ParseInt(string(cmdLine[2]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply(KEY_TYPE_CANNOT_TRANS)
+	}
+	h, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	var value int64
+	if raw, exists := h.Get(field); exists {
+		value, err = strconv.ParseInt(string(raw), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply(HASH_VALUE_NOT_INT)
+		}
+	}
+	if (increment > 0 && value > math.MaxInt64-increment) || (increment < 0 && value < math.MinInt64-increment) {
+		return protocol.NewErrReply(HASH_INCR_OVERFLOW)
+	}
+	value += increment
+	h.Put(field, []byte(strconv.FormatInt(value, 10)))
+	db.addAof(utils.CmdLine2("HINCRBY", cmdLine))
+	return protocol.NewIntReply(value)
+}
+
+// HINCRBYFLOAT key field increment
+func execHIncrByFloat(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	field := string(cmdLine[1])
+	increment, err := strconv.ParseFloat(string(cmdLine[2]), 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return protocol.NewErrReply(HASH_VALUE_NOT_FLOAT)
+	}
+	h, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	var value float64
+	if raw, exists := h.Get(field); exists {
+		value, err = strconv.ParseFloat(string(raw), 64)
+		if err != nil {
+			return protocol.NewErrReply(HASH_VALUE_NOT_FLOAT)
+		}
+	}
+	value += increment
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return protocol.NewErrReply(HASH_INCR_NAN_OR_INF)
+	}
+	result := []byte(strconv.FormatFloat(value, 'f', -1, 64))
+	h.Put(field, result)
+	// write the final value into aof to avoid the float error when reload
+	db.addAof(utils.CmdLine1("HSET", key, field, string(result)))
+	return protocol.NewBulkReply(result)
+}
+
+// HSETNX key field value
+func execHSetNx(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getOrInitHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	result := h.PutIfAbsent(string(cmdLine[1]), cmdLine[2])
+	if result > 0 {
+		db.addAof(utils.CmdLine2("HSETNX", cmdLine))
+	}
+	return protocol.NewIntReply(int64(result))
+}
+
+// HSTRLEN key field
+func execHStrLen(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	h, errReply := db.getAsHash(key)
+	if errReply != nil {
+		return errReply
+	}
+	if h == nil {
+		return protocol.NewIntReply(0)
+	}
+	value, _ := h.Get(string(cmdLine[1]))
+	return protocol.NewIntReply(int64(len(value)))
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"log"
+	"testing"
+)
+
+func TestHSet(t *testing.T) {
+	db := NewDatabase(0)
+	cmdLine := [][]byte{
+		[]byte("hash"),
+		[]byte("f1"),
+		[]byte("v1"),
+		[]byte("f2"),
+		[]byte("v2"),
+	}
+	reply := execHSet(db, cmdLine)
+	if string(reply.ToByte()) != ":2\r\n" {
+		t.Error("hset err: ", string(reply.ToByte()))
+	}
+
+	reply = execHGet(db, [][]byte{[]byte("hash"), []byte("f2")})
+	if string(reply.ToByte()) != "$2\r\nv2\r\n" {
+		t.Error("hget err: ", string(reply.ToByte()))
+	}
+
+	reply = execHMGet(db, [][]byte{[]byte("hash"), []byte("f1"), []byte("f3")})
+	log.Print(string(reply.ToByte()))
+
+	reply = execHGetAll(db, [][]byte{[]byte("hash")})
+	log.Print(string(reply.ToByte()))
+}
+
+func TestHIncrBy(t *testing.T) {
+	db := NewDatabase(0)
+	cmdLine := [][]byte{
+		[]byte("hash"),
+		[]byte("count"),
+		[]byte("5"),
+	}
+	execHIncrBy(db, cmdLine)
+	reply := execHIncrBy(db, cmdLine)
+	if string(reply.ToByte()) != ":10\r\n" {
+		t.Error("hincrby err: ", string(reply.ToByte()))
+	}
+
+	reply = execHIncrByFloat(db, [][]byte{[]byte("hash"), []byte("count"), []byte("0.5")})
+	if string(reply.ToByte()) != "$4\r\n10.5\r\n" {
+		t.Error("hincrbyfloat err: ", string(reply.ToByte()))
+	}
+
+	reply = execHIncrBy(db, cmdLine)
+	if string(reply.ToByte()) != "-ERR hash value is not an integer\r\n" {
+		t.Error("hincrby on float value should be err: ", string(reply.ToByte()))
+	}
+}
+
+func TestHIncrByRange(t *testing.T) {
+	db := NewDatabase(0)
+	execHSet(db, [][]byte{[]byte("hash"), []byte("int"), []byte("9223372036854775806"),
+		[]byte("float"), []byte("1.7e308")})
+	reply := execHIncrBy(db, [][]byte{[]byte("hash"), []byte("int"), []byte("2")})
+	if string(reply.ToByte()) != "-"+HASH_INCR_OVERFLOW+"\r\n" {
+		t.Error("hincrby overflow err: ", string(reply.ToByte()))
+	}
+	reply = execHIncrBy(db, [][]byte{[]byte("hash"), []byte("int"), []byte("1")})
+	if string(reply.ToByte()) != ":9223372036854775807\r\n" {
+		t.Error("hincrby to the max err: ", string(reply.ToByte()))
+	}
+	execHSet(db, [][]byte{[]byte("hash"), []byte("int"), []byte("-9223372036854775807")})
+	reply = execHIncrBy(db, [][]byte{[]byte("hash"), []byte("int"), []byte("-2")})
+	if string(reply.ToByte()) != "-"+HASH_INCR_OVERFLOW+"\r\n" {
+		t.Error("hincrby underflow err: ", string(reply.ToByte()))
+	}
+
+	reply = execHIncrByFloat(db, [][]byte{[]byte("hash"), []byte("float"), []byte("1e308")})
+	if string(reply.ToByte()) != "-"+HASH_INCR_NAN_OR_INF+"\r\n" {
+		t.Error("hincrbyfloat to inf err: ", string(reply.ToByte()))
+	}
+	for _, increment := range []string{"inf", "nan"} {
+		reply = execHIncrByFloat(db, [][]byte{[]byte("hash"), []byte("float"), []byte(increment)})
+		if string(reply.ToByte()) != "-"+HASH_VALUE_NOT_FLOAT+"\r\n" {
+			t.Error("hincrbyfloat by ", increment, " err: ", string(reply.ToByte()))
+		}
+	}
+	reply = execHGet(db, [][]byte{[]byte("hash"), []byte("float")})
+	if string(reply.ToByte()) != "$7\r\n1.7e308\r\n" {
+		t.Error("the value should be kept after the err: ", string(reply.ToByte()))
+	}
+}
+
+func TestHDel(t *testing.T) {
+	db := NewDatabase(0)
+	execHSet(db, [][]byte{[]byte("hash"), []byte("f1"), []byte("v1")})
+	reply := execHDel(db, [][]byte{[]byte("hash"), []byte("f1"), []byte("f2")})
+	if string(reply.ToByte()) != ":1\r\n" {
+		t.Error("hdel err: ", string(reply.ToByte()))
+	}
+	if _, exists := db.GetEntity("hash"); exists {
+		t.Error("empty hash should be removed")
+	}
+}
+
+func TestHashUndo(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewConnection(nil)
+	db.Exec(conn, [][]byte{[]byte("HSET"), []byte("hash"), []byte("f1"), []byte("v1")})
+	db.Exec(conn, [][]byte{[]byte("SET"), []byte("str"), []byte("v")})
+
+	db.Exec(conn, [][]byte{[]byte("MULTI")})
+	db.Exec(conn, [][]byte{[]byte("HSET"), []byte("hash"), []byte("f1"), []byte("v2"), []byte("f2"), []byte("v2")})
+	db.Exec(conn, [][]byte{[]byte("HDEL"), []byte("hash"), []byte("f1")})
+	db.Exec(conn, [][]byte{[]byte("HSET"), []byte("str"), []byte("f1"), []byte("v1")})
+	reply := db.Exec(conn, [][]byte{[]byte("EXEC")})
+	if !protocol.IsErrReply(reply) {
+		t.Error("exec should be aborted: ", string(reply.ToByte()))
+	}
+
+	reply = db.Exec(conn, [][]byte{[]byte("HGETALL"), []byte("hash")})
+	if string(reply.ToByte()) != "*2\r\n$2\r\nf1\r\n$2\r\nv1\r\n" {
+		t.Error("undo hash err: ", string(reply.ToByte()))
+	}
+}
+
+func TestHDelRemoveTTL(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	db.Exec(conn, utils.CmdLine1("HSET", "h", "f", "v"))
+	db.Exec(conn, utils.CmdLine1("EXPIRE", "h", "100"))
+	db.Exec(conn, utils.CmdLine1("HDEL", "h", "f"))
+	// the hash created again should not inherit the ttl of the removed one
+	db.Exec(conn, utils.CmdLine1("HSET", "h", "f", "v"))
+	if reply := db.Exec(conn, utils.CmdLine1("TTL", "h")); string(reply.ToByte()) != ":-1\r\n" {
+		t.Error("the ttl of the emptied hash should be removed: ", string(reply.ToByte()))
+	}
+}
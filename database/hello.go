@@ -0,0 +1,79 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"strconv"
+	"strings"
+)
+
+/**
+HELLO [protover [AUTH username password] [SETNAME clientname]]
+switch the protocol of the connection to resp2 or resp3 and reply the info of the server,
+the info is a map in resp3 and a flat array in resp2
+*/
+
+const (
+	SERVER_NAME    = "redis"
+	SERVER_VERSION = "7.0.0"
+	NOPROTO_ERR    = "NOPROTO unsupported protocol version"
+	HELLO_AUTH_ERR = "NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time"
+)
+
+func (r *RedisServer) execHello(conn redis.Conn, args [][]byte) redis.Reply {
+	version := conn.GetProtocol()
+	name, setName := "", false
+	if len(args) > 0 {
+		v, err := strconv.Atoi(string(args[0]))
+		if err != nil {
+			return protocol.NewErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if v != protocol.RESP2 && v != protocol.RESP3 {
+			return protocol.NewErrReply(NOPROTO_ERR)
+		}
+		for i := 1; i < len(args); i++ {
+			option := strings.ToLower(string(args[i]))
+			if option == "auth" && i+2 < len(args) {
+				if reply := r.authenticate(conn, string(args[i+1]), string(args[i+2])); protocol.IsErrReply(reply) {
+					return reply
+				}
+				i += 2
+			} else if option == "setname" && i+1 < len(args) {
+				name, setName = string(args[i+1]), true
+				if !validClientName(name) {
+					return protocol.NewErrReply(CLIENT_NAME_ERR)
+				}
+				i++
+			} else {
+				return protocol.NewErrReply("ERR Syntax error in HELLO option '" + option + "'")
+			}
+		}
+		version = v
+	}
+	if conn.GetUser() == "" && !r.authenticateDefault(conn) {
+		return protocol.NewErrReply(HELLO_AUTH_ERR)
+	}
+	conn.SetProtocol(version)
+	// the name is set only when the client is authenticated
+	if setName {
+		conn.SetName(name)
+	}
+
+	mode := "standalone"
+	if r.cluster != nil {
+		mode = "cluster"
+	}
+	role := ROLE_MASTER
+	if r.repl != nil && r.repl.isReplica() {
+		role = "replica"
+	}
+	return protocol.NewMapReply([]redis.Reply{
+		protocol.NewBulkReply([]byte("server")), protocol.NewBulkReply([]byte(SERVER_NAME)),
+		protocol.NewBulkReply([]byte("version")), protocol.NewBulkReply([]byte(SERVER_VERSION)),
+		protocol.NewBulkReply([]byte("proto")), protocol.NewIntReply(int64(version)),
+		protocol.NewBulkReply([]byte("id")), protocol.NewIntReply(conn.GetID()),
+		protocol.NewBulkReply([]byte("mode")), protocol.NewBulkReply([]byte(mode)),
+		protocol.NewBulkReply([]byte("role")), protocol.NewBulkReply([]byte(role)),
+		protocol.NewBulkReply([]byte("modules")), protocol.NewEmptyReply(),
+	})
+}
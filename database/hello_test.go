@@ -0,0 +1,95 @@
+package database
+
+import (
+	"bufio"
+	"github.com/xzwsloser/Go-redis/pub"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestHello(t *testing.T) {
+	server := NewPureServer()
+	conn := connection.NewFakeConnection()
+	replyOf(server, conn, "ZADD", "zset", "1.5", "m")
+	replyOf(server, conn, "HSET", "hash", "f", "v")
+	replyOf(server, conn, "SADD", "set", "a")
+
+	if reply := replyOf(server, conn, "ZSCORE", "zset", "m"); reply != "$3\r\n1.5\r\n" {
+		t.Error("zscore in resp2 err: ", reply)
+	}
+	if reply := replyOf(server, conn, "HELLO", "4"); reply != "-"+NOPROTO_ERR+"\r\n" {
+		t.Error("hello with the unsupported version err: ", reply)
+	}
+	reply := replyOf(server, conn, "HELLO", "3")
+	expected := "%7\r\n$6\r\nserver\r\n$5\r\nredis\r\n$7\r\nversion\r\n$5\r\n" + SERVER_VERSION + "\r\n" +
+		"$5\r\nproto\r\n:3\r\n$2\r\nid\r\n:" + strconv.FormatInt(conn.GetID(), 10) + "\r\n$4\r\nmode\r\n$10\r\nstandalone\r\n" +
+		"$4\r\nrole\r\n$6\r\nmaster\r\n$7\r\nmodules\r\n*0\r\n"
+	if reply != expected {
+		t.Error("hello 3 err: ", reply)
+	}
+	if reply = replyOf(server, conn, "ZSCORE", "zset", "m"); reply != ",1.5\r\n" {
+		t.Error("zscore in resp3 err: ", reply)
+	}
+	if reply = replyOf(server, conn, "HGETALL", "hash"); reply != "%1\r\n$1\r\nf\r\n$1\r\nv\r\n" {
+		t.Error("hgetall in resp3 err: ", reply)
+	}
+	if reply = replyOf(server, conn, "SMEMBERS", "set"); reply != "~1\r\n$1\r\na\r\n" {
+		t.Error("smembers in resp3 err: ", reply)
+	}
+	if reply = replyOf(server, conn, "HELLO", "2", "FOO", "x"); reply[0] != '-' {
+		t.Error("hello with the unsupported option err: ", reply)
+	}
+	replyOf(server, conn, "HELLO", "2", "SETNAME", "x")
+	if name := conn.GetName(); name != "x" {
+		t.Error("hello setname err: ", name)
+	}
+	if reply = replyOf(server, conn, "HGETALL", "hash"); reply != "*2\r\n$1\r\nf\r\n$1\r\nv\r\n" {
+		t.Error("hgetall after switching back to resp2 err: ", reply)
+	}
+}
+
+func TestHelloPush(t *testing.T) {
+	server := NewPureServer()
+	server.hub = pub.NewHub()
+	listener, host, port := newTestListener(t)
+	serveListener(t, server, listener)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	subscriber, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer subscriber.Close()
+	reader := bufio.NewReader(subscriber)
+	readExpected := func(expected string) {
+		buf := make([]byte, len(expected))
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != expected {
+			t.Fatalf("expected %q, got %q", expected, string(buf))
+		}
+	}
+
+	_, _ = subscriber.Write([]byte("*2\r\n$5\r\nHELLO\r\n$1\r\n3\r\n"))
+	if _, err := reader.ReadString('%'); err != nil {
+		t.Fatal(err)
+	}
+	// skip the rest of the map of hello
+	if _, err := reader.ReadString('*'); err != nil {
+		t.Fatal(err)
+	}
+	readExpected("0\r\n")
+
+	_, _ = subscriber.Write([]byte("*2\r\n$9\r\nSUBSCRIBE\r\n$2\r\nch\r\n"))
+	readExpected(">3\r\n$9\r\nsubscribe\r\n$2\r\nch\r\n:1\r\n")
+
+	publisher := connection.NewFakeConnection()
+	if reply := replyOf(server, publisher, "PUBLISH", "ch", "hi"); reply != ":1\r\n" {
+		t.Error("publish err: ", reply)
+	}
+	readExpected(">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$2\r\nhi\r\n")
+}
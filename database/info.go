@@ -0,0 +1,523 @@
+package database
+
+import (
+	"fmt"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+/**
+INFO [section [section ...]]
+the sections are server, clients, memory, persistence, stats, replication, cpu, commandstats, cluster and keyspace,
+"default" is all the sections except commandstats, "all" and "everything" are all the sections
+*/
+
+const (
+	// OPS_SAMPLES is the number of the samples to compute instantaneous_ops_per_sec like redis
+	OPS_SAMPLES         = 16
+	OPS_SAMPLE_INTERVAL = 100 * time.Millisecond
+)
+
+var defaultInfoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "cpu",
+	"cluster", "keyspace"}
+
+var allInfoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "cpu",
+	"commandstats", "cluster", "keyspace"}
+
+// commandStats is the calls and the latency of a command shown by INFO commandstats, accessed atomically
+type commandStats struct {
+	calls         int64
+	usec          int64
+	rejectedCalls int64
+	failedCalls   int64
+}
+
+// serverStats is the counters shown by INFO, it is shared by the server and all its databases
+type serverStats struct {
+	startTime        time.Time
+	runID            string
+	totalConnections int64
+	totalCommands    int64
+	keyspaceHits     int64
+	keyspaceMisses   int64
+	expiredKeys      int64
+	evictedKeys      int64
+	peakMemory       uint64
+	// cmdStats: command name -> *commandStats
+	cmdStats sync.Map
+
+	// the state of the rdb saving
+	rdbSaves         int64
+	rdbSaveStart     int64
+	rdbLastSaveNanos int64
+	rdbSaveFailed    int32
+
+	// opsSamples is the ring of the ops per second sampled every OPS_SAMPLE_INTERVAL
+	opsMu           sync.Mutex
+	opsSamples      [OPS_SAMPLES]int64
+	opsIndex        int
+	lastSampleTime  time.Time
+	lastSampleCount int64
+}
+
+func newServerStats() *serverStats {
+	return &serverStats{
+		startTime:        time.Now(),
+		runID:            newReplID(),
+		rdbLastSaveNanos: -1,
+	}
+}
+
+// bindStats share the counters and the maxmemory settings of the server with the databases
+func (server *RedisServer) bindStats() {
+	for i := 0; i < len(server.dbSet); i++ {
+		db := server.dbSet[i].Load().(*Database)
+		db.stats = server.stats
+		db.evictor = server.evictor
+		db.blocking = server.blocking
+	}
+}
+
+// updatePeakMemory record the peak of the used memory, return the peak
+func (s *serverStats) updatePeakMemory(used uint64) uint64 {
+	peak := atomic.LoadUint64(&s.peakMemory)
+	for used > peak {
+		if atomic.CompareAndSwapUint64(&s.peakMemory, peak, used) {
+			return used
+		}
+		peak = atomic.LoadUint64(&s.peakMemory)
+	}
+	return peak
+}
+
+// recordCommand count the call of the command and its latency
+func (s *serverStats) recordCommand(cmdName string, duration time.Duration, failed bool) {
+	stats := s.commandStatsOf(cmdName)
+	atomic.AddInt64(&stats.calls, 1)
+	atomic.AddInt64(&stats.usec, duration.Microseconds())
+	if failed {
+		atomic.AddInt64(&stats.failedCalls, 1)
+	}
+}
+
+// rejectCommand count the command rejected before executing, e.g. the arity err or the acl err,
+// only the commands in the command table are counted so that the unknown names never fill the stats
+func (s *serverStats) rejectCommand(cmdName string) {
+	if _, ok := commandTable[cmdName]; !ok {
+		return
+	}
+	atomic.AddInt64(&s.commandStatsOf(cmdName).rejectedCalls, 1)
+}
+
+func (s *serverStats) commandStatsOf(cmdName string) *commandStats {
+	if stats, ok := s.cmdStats.Load(cmdName); ok {
+		return stats.(*commandStats)
+	}
+	stats, _ := s.cmdStats.LoadOrStore(cmdName, &commandStats{})
+	return stats.(*commandStats)
+}
+
+// countKeyspace count the lookups of the read command, the keys must be locked
+func (db *Database) countKeyspace(keys []string) {
+	for _, key := range keys {
+		if _, exists := db.GetEntityWithLock(key); exists {
+			atomic.AddInt64(&db.stats.keyspaceHits, 1)
+		} else {
+			atomic.AddInt64(&db.stats.keyspaceMisses, 1)
+		}
+	}
+}
+
+// sampleOps record the ops per second since the last sample
+func (s *serverStats) sampleOps(now time.Time) {
+	count := atomic.LoadInt64(&s.totalCommands)
+	s.opsMu.Lock()
+	defer s.opsMu.Unlock()
+	if !s.lastSampleTime.IsZero() {
+		if elapsed := now.Sub(s.lastSampleTime); elapsed > 0 {
+			s.opsSamples[s.opsIndex] = (count - s.lastSampleCount) * int64(time.Second) / int64(elapsed)
+			s.opsIndex = (s.opsIndex + 1) % OPS_SAMPLES
+		}
+	}
+	s.lastSampleTime = now
+	s.lastSampleCount = count
+}
+
+func (s *serverStats) instantaneousOps() int64 {
+	s.opsMu.Lock()
+	defer s.opsMu.Unlock()
+	var sum int64
+	for _, sample := range s.opsSamples {
+		sum += sample
+	}
+	return sum / OPS_SAMPLES
+}
+
+func (server *RedisServer) statsCron() {
+	ticker := time.NewTicker(OPS_SAMPLE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			server.stats.sampleOps(now)
+		case <-server.closeChan:
+			return
+		}
+	}
+}
+
+func (r *RedisServer) execInfo(args [][]byte) redis.Reply {
+	sections := defaultInfoSections
+	if len(args) > 0 {
+		sections = make([]string, 0, len(args))
+		for _, arg := range args {
+			switch section := strings.ToLower(string(arg)); section {
+			case "default":
+				sections = append(sections, defaultInfoSections...)
+			case "all", "everything":
+				sections = append(sections, allInfoSections...)
+			default:
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	generators := map[string]func() []string{
+		"server":       r.infoServer,
+		"clients":      r.infoClients,
+		"memory":       r.infoMemory,
+		"persistence":  r.infoPersistence,
+		"stats":        r.infoStats,
+		"replication":  r.infoReplication,
+		"cpu":          infoCpu,
+		"commandstats": r.infoCommandStats,
+		"cluster":      r.infoCluster,
+		"keyspace":     r.infoKeyspace,
+	}
+	// the sections are written in the fixed order and only once
+	wanted := make(map[string]bool)
+	for _, section := range sections {
+		wanted[section] = true
+	}
+	var builder strings.Builder
+	for _, section := range allInfoSections {
+		if !wanted[section] {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString("\r\n")
+		}
+		builder.WriteString("# " + infoTitle(section) + "\r\n")
+		for _, line := range generators[section]() {
+			builder.WriteString(line + "\r\n")
+		}
+	}
+	return protocol.NewVerbatimReply("txt", []byte(builder.String()))
+}
+
+func infoTitle(section string) string {
+	switch section {
+	case "cpu":
+		return "CPU"
+	case "commandstats":
+		return "Commandstats"
+	}
+	return strings.ToUpper(section[:1]) + section[1:]
+}
+
+func (r *RedisServer) infoServer() []string {
+	mode := "standalone"
+	if r.cluster != nil {
+		mode = "cluster"
+	}
+	now := time.Now()
+	uptime := int64(now.Sub(r.stats.startTime).Seconds())
+	executable, _ := os.Executable()
+	return []string{
+		"redis_version:" + SERVER_VERSION,
+		"redis_git_sha1:00000000",
+		"redis_git_dirty:0",
+		"redis_mode:" + mode,
+		"os:" + runtime.GOOS + " " + runtime.GOARCH,
+		"arch_bits:" + strconv.Itoa(strconv.IntSize),
+		"go_version:" + runtime.Version(),
+		"process_id:" + strconv.Itoa(os.Getpid()),
+		"run_id:" + r.stats.runID,
+		"tcp_port:" + strconv.Itoa(config.GetRedisServerConfig().Port),
+		"server_time_usec:" + strconv.FormatInt(now.UnixMicro(), 10),
+		"uptime_in_seconds:" + strconv.FormatInt(uptime, 10),
+		"uptime_in_days:" + strconv.FormatInt(uptime/(3600*24), 10),
+		"hz:" + strconv.Itoa(int(time.Second/DEFAULT_TICK_INTERVAL)),
+		"executable:" + executable,
+	}
+}
+
+// infoClients count the clients by the registry of the server, every connection of the tcp server is registered
+func (r *RedisServer) infoClients() []string {
+	connected := 0
+	r.clients.Range(func(key, value any) bool {
+		connected++
+		return true
+	})
+	return []string{
+		"connected_clients:" + strconv.Itoa(connected),
+		"blocked_clients:" + strconv.Itoa(r.blocking.len()),
+		"tracking_clients:0",
+	}
+}
+
+func (r *RedisServer) infoMemory() []string {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	used := memStats.HeapAlloc
+	dataset := r.usedMemory()
+	peak := r.stats.updatePeakMemory(used)
+	return []string{
+		"used_memory:" + strconv.FormatUint(used, 10),
+		"used_memory_human:" + bytesToHuman(used),
+		// the memory obtained from the os by the go runtime is the closest to the rss
+		"used_memory_rss:" + strconv.FormatUint(memStats.Sys, 10),
+		"used_memory_rss_human:" + bytesToHuman(memStats.Sys),
+		"used_memory_peak:" + strconv.FormatUint(peak, 10),
+		"used_memory_peak_human:" + bytesToHuman(peak),
+		"used_memory_peak_perc:" + fmt.Sprintf("%.2f%%", float64(used)*100/float64(peak)),
+		// the dataset is the estimated memory of the keys limited by the maxmemory
+		"used_memory_dataset:" + strconv.FormatInt(dataset, 10),
+		"maxmemory:" + strconv.FormatInt(r.evictor.maxMemory, 10),
+		"maxmemory_human:" + bytesToHuman(uint64(r.evictor.maxMemory)),
+		"maxmemory_policy:" + r.evictor.policy,
+		"mem_fragmentation_ratio:" + fmt.Sprintf("%.2f", float64(memStats.Sys)/float64(used)),
+		"mem_allocator:go",
+	}
+}
+
+func (r *RedisServer) infoPersistence() []string {
+	saving := atomic.LoadInt32(&r.saving) == 1
+	currentSave := int64(-1)
+	if saving {
+		currentSave = int64(time.Since(time.Unix(0, atomic.LoadInt64(&r.stats.rdbSaveStart))).Seconds())
+	}
+	lastSave := int64(-1)
+	if nanos := atomic.LoadInt64(&r.stats.rdbLastSaveNanos); nanos >= 0 {
+		lastSave = int64(time.Duration(nanos).Seconds())
+	}
+	lines := []string{
+		"loading:0",
+		"rdb_changes_since_last_save:" + strconv.FormatInt(atomic.LoadInt64(&r.dirty), 10),
+		"rdb_bgsave_in_progress:" + boolToInfo(saving),
+		"rdb_last_save_time:" + strconv.FormatInt(atomic.LoadInt64(&r.lastSave), 10),
+		"rdb_last_bgsave_status:" + statusToInfo(atomic.LoadInt32(&r.stats.rdbSaveFailed) == 0),
+		"rdb_last_bgsave_time_sec:" + strconv.FormatInt(lastSave, 10),
+		"rdb_current_bgsave_time_sec:" + strconv.FormatInt(currentSave, 10),
+		"rdb_saves:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.rdbSaves), 10),
+	}
+	if r.persister == nil {
+		return append(lines,
+			"aof_enabled:0",
+			"aof_rewrite_in_progress:0",
+			"aof_rewrite_scheduled:0",
+			"aof_last_rewrite_time_sec:-1",
+			"aof_current_rewrite_time_sec:-1",
+			"aof_last_bgrewrite_status:ok",
+			"aof_rewrites:0",
+			"aof_last_write_status:ok")
+	}
+
+	status := r.persister.Status()
+	lines = append(lines,
+		"aof_enabled:"+boolToInfo(status.Enabled),
+		"aof_rewrite_in_progress:"+boolToInfo(status.RewriteInProgress),
+		"aof_rewrite_scheduled:0",
+		"aof_last_rewrite_time_sec:"+strconv.FormatInt(status.LastRewriteSeconds, 10),
+		"aof_current_rewrite_time_sec:"+strconv.FormatInt(status.CurrentRewriteSeconds, 10),
+		"aof_last_bgrewrite_status:"+statusToInfo(status.LastRewriteOk),
+		"aof_rewrites:"+strconv.FormatInt(status.Rewrites, 10),
+		"aof_last_write_status:"+statusToInfo(status.LastWriteOk))
+	if status.Enabled {
+		lines = append(lines,
+			"aof_current_size:"+strconv.FormatInt(status.CurrentSize, 10),
+			"aof_base_size:"+strconv.FormatInt(status.BaseSize, 10))
+	}
+	return lines
+}
+
+func (r *RedisServer) infoStats() []string {
+	pubsubChannels := 0
+	if r.hub != nil {
+		pubsubChannels = r.hub.ChannelCount()
+	}
+	return []string{
+		"total_connections_received:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.totalConnections), 10),
+		"total_commands_processed:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.totalCommands), 10),
+		"instantaneous_ops_per_sec:" + strconv.FormatInt(r.stats.instantaneousOps(), 10),
+		"rejected_connections:0",
+		"expired_keys:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.expiredKeys), 10),
+		"evicted_keys:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.evictedKeys), 10),
+		"keyspace_hits:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.keyspaceHits), 10),
+		"keyspace_misses:" + strconv.FormatInt(atomic.LoadInt64(&r.stats.keyspaceMisses), 10),
+		"pubsub_channels:" + strconv.Itoa(pubsubChannels),
+		"pubsub_patterns:0",
+	}
+}
+
+func (r *RedisServer) infoReplication() []string {
+	repl := r.repl
+	if repl == nil {
+		return []string{"role:master", "connected_slaves:0"}
+	}
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	lines := make([]string, 0)
+	if repl.role == ROLE_REPLICA {
+		linkStatus := "down"
+		if repl.linkState == LINK_CONNECTED {
+			linkStatus = "up"
+		}
+		lines = append(lines,
+			"role:slave",
+			"master_host:"+repl.masterHost,
+			"master_port:"+strconv.Itoa(repl.masterPort),
+			"master_link_status:"+linkStatus,
+			"master_sync_in_progress:"+boolToInfo(repl.linkState == LINK_SYNC),
+			"slave_repl_offset:"+strconv.FormatInt(repl.offset, 10),
+			"slave_read_only:1")
+	} else {
+		lines = append(lines, "role:master")
+	}
+
+	online := 0
+	for _, replica := range repl.replicas {
+		if replica.state != REPLICA_ONLINE {
+			continue
+		}
+		host, _, _ := net.SplitHostPort(replica.conn.RemoteAddr())
+		lines = append(lines, "slave"+strconv.Itoa(online)+":ip="+host+
+			",port="+strconv.Itoa(replica.listeningPort)+
+			",state=online,offset="+strconv.FormatInt(replica.ackOffset, 10)+",lag=0")
+		online++
+	}
+	lines = append(lines, "connected_slaves:"+strconv.Itoa(online))
+
+	backlogHist := 0
+	if repl.backlog != nil {
+		backlogHist = repl.backlog.histLen
+	}
+	replID2 := repl.replID2
+	if replID2 == "" {
+		replID2 = strings.Repeat("0", REPL_ID_LEN)
+	}
+	return append(lines,
+		"master_replid:"+repl.replID,
+		"master_replid2:"+replID2,
+		"master_repl_offset:"+strconv.FormatInt(repl.offset, 10),
+		"second_repl_offset:"+strconv.FormatInt(repl.secondOffset, 10),
+		"repl_backlog_active:"+boolToInfo(repl.backlog != nil),
+		"repl_backlog_size:"+strconv.Itoa(repl.backlogSize),
+		"repl_backlog_histlen:"+strconv.Itoa(backlogHist))
+}
+
+func infoCpu() []string {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return nil
+	}
+	return []string{
+		"used_cpu_sys:" + fmt.Sprintf("%.6f", time.Duration(usage.Stime.Nano()).Seconds()),
+		"used_cpu_user:" + fmt.Sprintf("%.6f", time.Duration(usage.Utime.Nano()).Seconds()),
+	}
+}
+
+func (r *RedisServer) infoCommandStats() []string {
+	names := make([]string, 0)
+	r.stats.cmdStats.Range(func(key, value any) bool {
+		names = append(names, key.(string))
+		return true
+	})
+	sort.Strings(names)
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		stats := r.stats.commandStatsOf(name)
+		calls := atomic.LoadInt64(&stats.calls)
+		usec := atomic.LoadInt64(&stats.usec)
+		perCall := 0.0
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		lines = append(lines, fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			name, calls, usec, perCall, atomic.LoadInt64(&stats.rejectedCalls), atomic.LoadInt64(&stats.failedCalls)))
+	}
+	return lines
+}
+
+func (r *RedisServer) infoCluster() []string {
+	return []string{"cluster_enabled:" + boolToInfo(r.cluster != nil)}
+}
+
+// infoKeyspace show the databases which are not empty, avg_ttl is the average ttl in milliseconds of the volatile keys
+func (r *RedisServer) infoKeyspace() []string {
+	lines := make([]string, 0)
+	now := time.Now()
+	for i := range r.dbSet {
+		db := r.mustSelectDB(i)
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		expires := 0
+		var totalTTL int64
+		db.ttlMap.ForEach(func(key string, value any) bool {
+			if ttl := value.(time.Time).Sub(now).Milliseconds(); ttl > 0 {
+				totalTTL += ttl
+				expires++
+			}
+			return true
+		})
+		avgTTL := int64(0)
+		if expires > 0 {
+			avgTTL = totalTTL / int64(expires)
+		}
+		lines = append(lines, fmt.Sprintf("db%d:keys=%d,expires=%d,avg_ttl=%d", i, keys, expires, avgTTL))
+	}
+	return lines
+}
+
+// bytesToHuman format the bytes like redis e.g. 1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"K", "M", "G", "T", "P"}
+	if n < 1024 {
+		return strconv.FormatUint(n, 10) + "B"
+	}
+	value := float64(n) / 1024
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.2f%s", value, units[i])
+}
+
+func boolToInfo(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+func statusToInfo(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "err"
+}
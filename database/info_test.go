@@ -0,0 +1,47 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInfo(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	server.AfterClientConnect(conn)
+
+	replyOf(server, conn, "SET", "k1", "v1")
+	replyOf(server, conn, "SET", "k2", "v2")
+	replyOf(server, conn, "EXPIRE", "k2", "100")
+	replyOf(server, conn, "GET", "k1")
+	replyOf(server, conn, "GET", "missing")
+	replyOf(server, conn, "GET")
+
+	reply := replyOf(server, conn, "INFO")
+	for _, expected := range []string{"# Server\r\n", "redis_version:" + SERVER_VERSION + "\r\n",
+		"\r\n\r\n# Clients\r\nconnected_clients:1\r\n", "# Memory\r\n", "aof_enabled:0\r\n",
+		"keyspace_hits:1\r\n", "keyspace_misses:1\r\n", "total_connections_received:1\r\n",
+		"role:master\r\n", "cluster_enabled:0\r\n", "db0:keys=2,expires=1,avg_ttl="} {
+		if !strings.Contains(reply, expected) {
+			t.Error("info lacks ", expected, ": ", reply)
+		}
+	}
+	if strings.Contains(reply, "# Commandstats") {
+		t.Error("commandstats is not a default section: ", reply)
+	}
+
+	reply = replyOf(server, conn, "INFO", "commandstats", "keyspace")
+	if !strings.HasPrefix(reply[strings.Index(reply, "\r\n")+2:], "# Commandstats\r\n") ||
+		!strings.Contains(reply, "# Keyspace\r\n") || strings.Contains(reply, "# Server") {
+		t.Error("info sections err: ", reply)
+	}
+	if !strings.Contains(reply, "cmdstat_get:calls=2,") || !strings.Contains(reply, "rejected_calls=1,failed_calls=1\r\n") {
+		t.Error("cmdstat_get err: ", reply)
+	}
+	if !strings.Contains(reply, "cmdstat_set:calls=2,") {
+		t.Error("cmdstat_set err: ", reply)
+	}
+	if reply = replyOf(server, conn, "INFO", "everything"); !strings.Contains(reply, "# Commandstats") {
+		t.Error("info everything err: ", reply)
+	}
+}
@@ -1,25 +1,49 @@
 package database
 
 import (
+	"github.com/xzwsloser/Go-redis/aof"
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
 	"github.com/xzwsloser/Go-redis/interface/database"
 	"github.com/xzwsloser/Go-redis/interface/redis"
 	"github.com/xzwsloser/Go-redis/lib/utils"
 	"github.com/xzwsloser/Go-redis/lib/wildcard"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
 	"strconv"
+	"strings"
 	"time"
 )
 
 func init() {
 	RegisterCommand("KEYS", execKeys, nil, nil, -2)
-	RegisterCommand("DEL", execKeys, writeKeys, nil, -2)
+	RegisterCommand("DEL", execDel, writeKeys, nil, -2)
 	RegisterCommand("PERSISTER", execPersister, writeKeys, nil, -2)
 	RegisterCommand("PEXPIREAT", execPExpireAt, writeFirstKey, nil, 3)
 	RegisterCommand("EXPIREAT", execExpireAt, writeFirstKey, nil, 3)
 	RegisterCommand("EXPIRE", execExpire, writeFirstKey, nil, 3)
 	RegisterCommand("PEXPIRE", execPExpire, writeFirstKey, nil, 3)
+	RegisterCommand("TYPE", execType, readFirstKey, nil, 2)
+	RegisterCommand("EXISTS", execExists, readKeys, nil, -2)
+	RegisterCommand("RENAME", execRename, prepareRename, undoRename, 3)
+	RegisterCommand("RENAMENX", execRenameNx, prepareRename, undoRename, 3)
+	RegisterCommand("COPY", execCopy, prepareCopy, undoCopy, -3)
+	RegisterCommand("RANDOMKEY", execRandomKey, nil, nil, 1)
+	RegisterCommand("TTL", execTTL, readFirstKey, nil, 2)
+	RegisterCommand("PTTL", execPTTL, readFirstKey, nil, 2)
+	RegisterCommand("EXPIRETIME", execExpireTime, readFirstKey, nil, 2)
+	RegisterCommand("PEXPIRETIME", execPExpireTime, readFirstKey, nil, 2)
 }
 
+const (
+	NO_SUCH_KEY_ERR   = "ERR no such key"
+	SAME_OBJECT_ERR   = "ERR source and destination objects are the same"
+	COPY_IN_MULTI_ERR = "ERR COPY to another database is not allowed in MULTI"
+	// RANDOMKEY_MAX_TRIES is the max times to pick a key when the picked ones are expired
+	RANDOMKEY_MAX_TRIES = 100
+)
+
 // execKeys: keys *
 func execKeys(db *Database, cmdLine [][]byte) redis.Reply {
 	patternStr := string(cmdLine[0])
@@ -51,6 +75,9 @@ func execDel(db *Database, cmdLine [][]byte) redis.Reply {
 	var r int
 	for _, key := range keysToDel {
 		_, result := db.RemoveEntityWithLock(key)
+		if result > 0 {
+			db.Persister(key)
+		}
 		r += result
 	}
 	db.addAof(utils.CmdLine2("DEL", cmdLine))
@@ -122,3 +149,269 @@ func execPExpire(db *Database, cmdLine [][]byte) redis.Reply {
 	db.addAof(utils.ExpireCmd(key, expireAt))
 	return protocol.NewIntReply(1)
 }
+
+// typeOf get the redis type name of the entity
+func typeOf(entity *database.DataEntity) string {
+	switch entity.Data.(type) {
+	case []byte:
+		return "string"
+	case *list.List:
+		return "list"
+	case *sortedset.SortedSet:
+		return "zset"
+	case *hash.Hash:
+		return "hash"
+	case *set.Set:
+		return "set"
+	default:
+		return "none"
+	}
+}
+
+// deepCopy make a copy of the entity which not share memory with the origin
+func deepCopy(entity *database.DataEntity) *database.DataEntity {
+	switch value := entity.Data.(type) {
+	case []byte:
+		b := make([]byte, len(value))
+		copy(b, value)
+		return &database.DataEntity{Data: b}
+	case *list.List:
+		ll := list.NewList()
+		value.ForEach(func(v any) bool {
+			ll.InsertTail(v)
+			return true
+		})
+		return &database.DataEntity{Data: ll}
+	case *sortedset.SortedSet:
+		ss := sortedset.NewSortedSet()
+		value.ForEach(func(score float64, member string) bool {
+			ss.Put(member, score)
+			return true
+		})
+		return &database.DataEntity{Data: ss}
+	case *hash.Hash:
+		h := hash.NewHash()
+		value.ForEach(func(field string, v []byte) bool {
+			h.Put(field, v)
+			return true
+		})
+		return &database.DataEntity{Data: h}
+	case *set.Set:
+		return &database.DataEntity{Data: set.Union(value)}
+	default:
+		return &database.DataEntity{Data: entity.Data}
+	}
+}
+
+// TYPE key
+func execType(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	entity, exists := db.GetEntityWithLock(key)
+	if !exists {
+		return protocol.NewStatusReply("none")
+	}
+	return protocol.NewStatusReply(typeOf(entity))
+}
+
+// EXISTS key [key ...], the same key will be counted many times
+func execExists(db *Database, cmdLine [][]byte) redis.Reply {
+	var result int64
+	for _, arg := range cmdLine {
+		if _, exists := db.GetEntityWithLock(string(arg)); exists {
+			result++
+		}
+	}
+	return protocol.NewIntReply(result)
+}
+
+// prepareRename: RENAME source destination
+func prepareRename(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+func undoRename(db *Database, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+// rename move the entity and the ttl from src to dest, the keys must be locked
+func (db *Database) rename(src string, dest string) {
+	entity, _ := db.GetEntityWithLock(src)
+	expireAt, hasTTL := db.GetExpireTime(src)
+	db.RemoveEntityWithLock(src)
+	db.PutEntityWithLock(dest, entity)
+	if db.IsTTLKey(dest) {
+		db.Persister(dest)
+	}
+	if hasTTL {
+		db.Persister(src)
+		db.Expire(dest, expireAt)
+	}
+}
+
+// RENAME source destination
+func execRename(db *Database, cmdLine [][]byte) redis.Reply {
+	src := string(cmdLine[0])
+	dest := string(cmdLine[1])
+	if _, exists := db.GetEntityWithLock(src); !exists {
+		return protocol.NewErrReply(NO_SUCH_KEY_ERR)
+	}
+	if src == dest {
+		return protocol.NewOkReply()
+	}
+	db.rename(src, dest)
+	db.addAof(utils.CmdLine2("RENAME", cmdLine))
+	return protocol.NewOkReply()
+}
+
+// RENAMENX source destination
+func execRenameNx(db *Database, cmdLine [][]byte) redis.Reply {
+	src := string(cmdLine[0])
+	dest := string(cmdLine[1])
+	if _, exists := db.GetEntityWithLock(src); !exists {
+		return protocol.NewErrReply(NO_SUCH_KEY_ERR)
+	}
+	if _, exists := db.GetEntityWithLock(dest); exists {
+		return protocol.NewIntReply(0)
+	}
+	db.rename(src, dest)
+	db.addAof(utils.CmdLine2("RENAMENX", cmdLine))
+	return protocol.NewIntReply(1)
+}
+
+// parseCopyArgs: COPY source destination [DB destination-db] [REPLACE], dbIndex is -1 without DB option
+func parseCopyArgs(args [][]byte) (dbIndex int, replace bool, errReply redis.Reply) {
+	dbIndex = -1
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "REPLACE" {
+			replace = true
+		} else if option == "DB" && i+1 < len(args) {
+			index, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || index < 0 {
+				return 0, false, protocol.NewErrReply(DB_INDEX_ERR)
+			}
+			dbIndex = index
+			i++
+		} else {
+			return 0, false, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+		}
+	}
+	return dbIndex, replace, nil
+}
+
+// prepareCopy: COPY source destination ...
+func prepareCopy(args [][]byte) ([]string, []string) {
+	return []string{string(args[1])}, []string{string(args[0])}
+}
+
+func undoCopy(db *Database, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[1]))
+}
+
+// copyEntity copy src of srcDB to dest of destDB with the ttl, the keys must be locked
+func copyEntity(srcDB *Database, destDB *Database, src string, dest string, replace bool) redis.Reply {
+	entity, exists := srcDB.GetEntityWithLock(src)
+	if !exists {
+		return protocol.NewIntReply(0)
+	}
+	if _, exists = destDB.GetEntityWithLock(dest); exists {
+		if !replace {
+			return protocol.NewIntReply(0)
+		}
+	}
+
+	newEntity := deepCopy(entity)
+	destDB.PutEntityWithLock(dest, newEntity)
+	if destDB.IsTTLKey(dest) {
+		destDB.Persister(dest)
+	}
+	destDB.addAof(utils.CmdLine1("DEL", dest))
+	destDB.addAof(aof.EntityToCmd(dest, newEntity))
+	if expireAt, hasTTL := srcDB.GetExpireTime(src); hasTTL {
+		destDB.Expire(dest, expireAt)
+		destDB.addAof(utils.ExpireCmd(dest, expireAt))
+	}
+	return protocol.NewIntReply(1)
+}
+
+// COPY source destination [DB destination-db] [REPLACE], the copy between databases is done by RedisServer
+func execCopy(db *Database, cmdLine [][]byte) redis.Reply {
+	dbIndex, replace, errReply := parseCopyArgs(cmdLine)
+	if errReply != nil {
+		return errReply
+	}
+	if dbIndex != -1 && dbIndex != db.index {
+		return protocol.NewErrReply(COPY_IN_MULTI_ERR)
+	}
+	src := string(cmdLine[0])
+	dest := string(cmdLine[1])
+	if src == dest {
+		return protocol.NewErrReply(SAME_OBJECT_ERR)
+	}
+	return copyEntity(db, db, src, dest, replace)
+}
+
+// RANDOMKEY
+func execRandomKey(db *Database, cmdLine [][]byte) redis.Reply {
+	// the expired key is removed and another one is picked, the tries are limited like redis
+	for i := 0; i < RANDOMKEY_MAX_TRIES; i++ {
+		// RANDOMKEY takes no lock, so the keys may be removed concurrently and nothing is returned
+		keys := db.data.RandomKeys(1)
+		if len(keys) == 0 {
+			return protocol.NewNullBulkReply()
+		}
+		if _, exists := db.GetEntity(keys[0]); exists {
+			return protocol.NewBulkReply([]byte(keys[0]))
+		}
+	}
+	return protocol.NewNullBulkReply()
+}
+
+// ttlOf return -2 if the key not exists, -1 if the key has no ttl, otherwise the expire time
+func (db *Database) ttlOf(key string) (expireAt time.Time, code int64) {
+	if _, exists := db.GetEntityWithLock(key); !exists {
+		return time.Time{}, -2
+	}
+	expireAt, exists := db.GetExpireTime(key)
+	if !exists {
+		return time.Time{}, -1
+	}
+	return expireAt, 0
+}
+
+// TTL key
+func execTTL(db *Database, cmdLine [][]byte) redis.Reply {
+	expireAt, code := db.ttlOf(string(cmdLine[0]))
+	if code < 0 {
+		return protocol.NewIntReply(code)
+	}
+	ttl := time.Until(expireAt)
+	return protocol.NewIntReply(int64(ttl.Round(time.Second) / time.Second))
+}
+
+// PTTL key
+func execPTTL(db *Database, cmdLine [][]byte) redis.Reply {
+	expireAt, code := db.ttlOf(string(cmdLine[0]))
+	if code < 0 {
+		return protocol.NewIntReply(code)
+	}
+	return protocol.NewIntReply(time.Until(expireAt).Milliseconds())
+}
+
+// EXPIRETIME key
+func execExpireTime(db *Database, cmdLine [][]byte) redis.Reply {
+	expireAt, code := db.ttlOf(string(cmdLine[0]))
+	if code < 0 {
+		return protocol.NewIntReply(code)
+	}
+	return protocol.NewIntReply(expireAt.Unix())
+}
+
+// PEXPIRETIME key
+func execPExpireTime(db *Database, cmdLine [][]byte) redis.Reply {
+	expireAt, code := db.ttlOf(string(cmdLine[0]))
+	if code < 0 {
+		return protocol.NewIntReply(code)
+	}
+	return protocol.NewIntReply(expireAt.UnixMilli())
+}
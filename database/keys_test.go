@@ -2,7 +2,10 @@ package database
 
 import (
 	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
 	"log"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -31,3 +34,174 @@ func TestPExpireAt(t *testing.T) {
 		time.Sleep(time.Second)
 	}
 }
+
+func TestType(t *testing.T) {
+	db := NewDatabase(0)
+	execSet(db, [][]byte{[]byte("str"), []byte("v")})
+	execHSet(db, [][]byte{[]byte("hash"), []byte("f"), []byte("v")})
+	execZAdd(db, [][]byte{[]byte("zset"), []byte("1"), []byte("a")})
+	types := map[string]string{
+		"str":  "+string\r\n",
+		"hash": "+hash\r\n",
+		"zset": "+zset\r\n",
+		"none": "+none\r\n",
+	}
+	for key, expected := range types {
+		reply := execType(db, [][]byte{[]byte(key)})
+		if string(reply.ToByte()) != expected {
+			t.Error("type err: ", key, string(reply.ToByte()))
+		}
+	}
+
+	reply := execExists(db, [][]byte{[]byte("str"), []byte("str"), []byte("none")})
+	if string(reply.ToByte()) != ":2\r\n" {
+		t.Error("exists err: ", string(reply.ToByte()))
+	}
+}
+
+func TestRename(t *testing.T) {
+	db := NewDatabase(0)
+	execSet(db, [][]byte{[]byte("k1"), []byte("v1")})
+	expireAt := time.Now().Add(time.Hour)
+	db.Expire("k1", expireAt)
+
+	reply := execRename(db, [][]byte{[]byte("k1"), []byte("k2")})
+	if !protocol.IsOkReply(reply) {
+		t.Error("rename err: ", string(reply.ToByte()))
+	}
+	if _, exists := db.GetEntity("k1"); exists {
+		t.Error("the source key should be removed")
+	}
+	if db.IsTTLKey("k1") {
+		t.Error("the ttl of source key should be removed")
+	}
+	ttl, exists := db.GetExpireTime("k2")
+	if !exists || ttl.UnixMilli() != expireAt.UnixMilli() {
+		t.Error("the ttl should be carried to the destination")
+	}
+
+	execSet(db, [][]byte{[]byte("k3"), []byte("v3")})
+	reply = execRenameNx(db, [][]byte{[]byte("k2"), []byte("k3")})
+	if string(reply.ToByte()) != ":0\r\n" {
+		t.Error("renamenx err: ", string(reply.ToByte()))
+	}
+}
+
+func TestCopy(t *testing.T) {
+	server := NewPureServer()
+	conn := connection.NewFakeConnection()
+	server.Exec(conn, utils.CmdLine1("SADD", "s1", "a", "b"))
+	reply := server.Exec(conn, utils.CmdLine1("COPY", "s1", "s2"))
+	if string(reply.ToByte()) != ":1\r\n" {
+		t.Error("copy err: ", string(reply.ToByte()))
+	}
+	server.Exec(conn, utils.CmdLine1("SADD", "s2", "c"))
+	reply = server.Exec(conn, utils.CmdLine1("SCARD", "s1"))
+	if string(reply.ToByte()) != ":2\r\n" {
+		t.Error("the copy should not share memory: ", string(reply.ToByte()))
+	}
+
+	reply = server.Exec(conn, utils.CmdLine1("COPY", "s2", "s1", "DB", "1"))
+	if string(reply.ToByte()) != ":1\r\n" {
+		t.Error("copy to another db err: ", string(reply.ToByte()))
+	}
+	conn.SelectDB(1)
+	reply = server.Exec(conn, utils.CmdLine1("SCARD", "s1"))
+	if string(reply.ToByte()) != ":3\r\n" {
+		t.Error("copy to another db err: ", string(reply.ToByte()))
+	}
+}
+
+func TestRandomKey(t *testing.T) {
+	db := NewDatabase(0)
+	reply := execRandomKey(db, nil)
+	if string(reply.ToByte()) != "$-1\r\n" {
+		t.Error("randomkey of empty db err: ", string(reply.ToByte()))
+	}
+	execSet(db, [][]byte{[]byte("k1"), []byte("v1")})
+	reply = execRandomKey(db, nil)
+	if string(reply.ToByte()) != "$2\r\nk1\r\n" {
+		t.Error("randomkey err: ", string(reply.ToByte()))
+	}
+}
+
+func TestTTL(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	db.Exec(conn, utils.CmdLine1("SET", "k1", "v1"))
+	reply := db.Exec(conn, utils.CmdLine1("TTL", "k1"))
+	if string(reply.ToByte()) != ":-1\r\n" {
+		t.Error("ttl of persistent key err: ", string(reply.ToByte()))
+	}
+	reply = db.Exec(conn, utils.CmdLine1("TTL", "none"))
+	if string(reply.ToByte()) != ":-2\r\n" {
+		t.Error("ttl of not exists key err: ", string(reply.ToByte()))
+	}
+
+	expireAt := time.Now().Add(100 * time.Second)
+	db.Exec(conn, utils.ExpireCmd("k1", expireAt))
+	reply = db.Exec(conn, utils.CmdLine1("TTL", "k1"))
+	if string(reply.ToByte()) != ":100\r\n" {
+		t.Error("ttl err: ", string(reply.ToByte()))
+	}
+	reply = db.Exec(conn, utils.CmdLine1("PEXPIRETIME", "k1"))
+	if string(reply.ToByte()) != ":"+strconv.FormatInt(expireAt.UnixMilli(), 10)+"\r\n" {
+		t.Error("pexpiretime err: ", string(reply.ToByte()))
+	}
+}
+
+func TestLazyExpire(t *testing.T) {
+	db := NewDatabase(0)
+	cmdLines := make([]CmdLine, 0)
+	db.addAof = func(cmdLine [][]byte) {
+		cmdLines = append(cmdLines, cmdLine)
+	}
+	conn := connection.NewFakeConnection()
+	db.Exec(conn, utils.CmdLine1("SET", "k1", "v1"))
+	// put the ttl directly to skip the time heap
+	db.ttlMap.Put(EXPIRE_PREFIX+"k1", time.Now().Add(-time.Second))
+
+	reply := db.Exec(conn, utils.CmdLine1("GET", "k1"))
+	if !protocol.IsErrReply(reply) {
+		t.Error("the expired key should not be read: ", string(reply.ToByte()))
+	}
+	if _, exists := db.data.Get("k1"); exists {
+		t.Error("the expired key should be removed")
+	}
+	if db.IsTTLKey("k1") {
+		t.Error("the ttl of expired key should be removed")
+	}
+	last := cmdLines[len(cmdLines)-1]
+	if string(last[0]) != "DEL" || string(last[1]) != "k1" {
+		t.Error("the expire should be written into aof as DEL")
+	}
+}
+
+func TestRandomKeyExpired(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	db.Exec(conn, utils.CmdLine1("SET", "k1", "v1"))
+	// put the ttl directly to skip the time heap
+	db.ttlMap.Put(EXPIRE_PREFIX+"k1", time.Now().Add(-time.Second))
+
+	reply := db.Exec(conn, utils.CmdLine1("RANDOMKEY"))
+	if string(reply.ToByte()) != "$-1\r\n" {
+		t.Error("the expired key should not be returned: ", string(reply.ToByte()))
+	}
+	if _, exists := db.data.Get("k1"); exists {
+		t.Error("the expired key should be removed")
+	}
+}
+
+func TestDelRemoveTTL(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	db.Exec(conn, utils.CmdLine1("SET", "k", "v"))
+	db.Exec(conn, utils.CmdLine1("EXPIRE", "k", "100"))
+	db.Exec(conn, utils.CmdLine1("DEL", "k"))
+	// the key created again should not inherit the ttl of the deleted one, RPUSH keeps the ttl unlike SET
+	db.Exec(conn, utils.CmdLine1("RPUSH", "k", "v"))
+	if reply := db.Exec(conn, utils.CmdLine1("TTL", "k")); string(reply.ToByte()) != ":-1\r\n" {
+		t.Error("the ttl of the deleted key should be removed: ", string(reply.ToByte()))
+	}
+}
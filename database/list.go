@@ -4,33 +4,57 @@ import (
 	"github.com/xzwsloser/Go-redis/datastruct/list"
 	"github.com/xzwsloser/Go-redis/interface/database"
 	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/utils"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"math"
 	"strconv"
+	"strings"
+)
+
+const (
+	POSITIVE_COUNT_ERR = "ERR value is out of range, must be positive"
+	LIST_INDEX_ERR     = "ERR index out of range"
+	LPOS_RANK_ERR      = "ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list"
+	// LPOS_RANK_RANGE_ERR: the min int64 can not be negated, so it is rejected like redis
+	LPOS_RANK_RANGE_ERR = "ERR value is out of range, value must between -9223372036854775807 and 9223372036854775807"
+	LPOS_COUNT_ERR      = "ERR COUNT can't be negative"
+	LPOS_MAXLEN_ERR     = "ERR MAXLEN can't be negative"
+	LMPOP_NUMKEYS_ERR   = "ERR numkeys should be greater than 0"
+	LMPOP_COUNT_ERR     = "ERR count should be greater than 0"
 )
 
 func init() {
 	RegisterCommand("LINDEX", execLIndex, readFirstKey, nil, 3)
 	RegisterCommand("LLEN", execLen, readFirstKey, nil, 2)
-	RegisterCommand("LPOP", execLPop, writeFirstKey, rollbackFirstKey, 2)
+	RegisterCommand("LPOP", execLPop, writeFirstKey, rollbackFirstKey, -2)
 	RegisterCommand("LPUSH", execLPush, writeFirstKey, rollbackFirstKey, -3)
-	RegisterCommand("RPOP", execRPop, writeFirstKey, rollbackFirstKey, 2)
+	RegisterCommand("LPUSHX", execLPushX, writeFirstKey, rollbackFirstKey, -3)
+	RegisterCommand("RPOP", execRPop, writeFirstKey, rollbackFirstKey, -2)
 	RegisterCommand("RPUSH", execRPush, writeFirstKey, rollbackFirstKey, -3)
+	RegisterCommand("RPUSHX", execRPushX, writeFirstKey, rollbackFirstKey, -3)
 	RegisterCommand("LREM", execLRem, writeFirstKey, rollbackFirstKey, 4)
 	RegisterCommand("LRANGE", execLRange, readFirstKey, nil, 4)
+	RegisterCommand("LSET", execLSet, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("LINSERT", execLInsert, writeFirstKey, rollbackFirstKey, 5)
+	RegisterCommand("LTRIM", execLTrim, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("LPOS", execLPos, readFirstKey, nil, -3)
+	RegisterCommand("LMOVE", execLMove, prepareListMove, rollbackListMove, 5)
+	RegisterCommand("RPOPLPUSH", execRPopLPush, prepareListMove, rollbackListMove, 3)
+	RegisterCommand("LMPOP", execLMPop, prepareLMPop, rollbackLMPop, -4)
 }
 
-func (db *Database) getOrInitLinkedList(key string) *list.LinkedList {
+func (db *Database) getOrInitList(key string) *list.List {
 	entity, exists := db.GetEntityWithLock(key)
 	if !exists {
-		ll := list.NewLinkedList()
+		ll := list.NewList()
 		db.PutEntityWithLock(key, &database.DataEntity{
 			Data: ll,
 		})
 		return ll
 	}
-	ll, ok := entity.Data.(*list.LinkedList)
+	ll, ok := entity.Data.(*list.List)
 	if !ok {
-		ll := list.NewLinkedList()
+		ll := list.NewList()
 		db.PutEntityWithLock(key, &database.DataEntity{
 			Data: ll,
 		})
@@ -39,6 +63,19 @@ func (db *Database) getOrInitLinkedList(key string) *list.LinkedList {
 	return ll
 }
 
+// getAsList get the list of the key, return err reply if the key is not a list
+func (db *Database) getAsList(key string) (*list.List, redis.Reply) {
+	entity, exists := db.GetEntityWithLock(key)
+	if !exists {
+		return nil, nil
+	}
+	ll, ok := entity.Data.(*list.List)
+	if !ok {
+		return nil, protocol.NewErrReply(WRONG_TYPE_ERR)
+	}
+	return ll, nil
+}
+
 // LIndex key 0
 func execLIndex(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
@@ -47,7 +84,7 @@ func execLIndex(db *Database, cmdLine [][]byte) redis.Reply {
 	if err != nil {
 		return protocol.NewErrReply("in valid argement of LINDEX")
 	}
-	ll := db.getOrInitLinkedList(key)
+	ll := db.getOrInitList(key)
 	res := ll.Get(value)
 	if res == nil {
 		return protocol.NewErrReply("in valid range of the index in LINDEX")
@@ -58,59 +95,89 @@ func execLIndex(db *Database, cmdLine [][]byte) redis.Reply {
 // LLEN key
 func execLen(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
-	ll := db.getOrInitLinkedList(key)
+	ll := db.getOrInitList(key)
 	l := ll.Len()
 	return protocol.NewIntReply(int64(l))
 }
 
-// LPOP list
+// LPOP key [count]
 func execLPop(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	ll := db.getOrInitLinkedList(key)
-	value := ll.RemoveHead()
-	if value == nil {
-		return protocol.NewBulkReply([]byte("nil"))
-	}
-	return protocol.NewBulkReply([]byte(value.(string)))
+	return db.execPop("LPOP", cmdLine, true)
 }
 
 // LPUSH list v1 v2 v3 ...
 func execLPush(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
-	ll := db.getOrInitLinkedList(key)
+	ll := db.getOrInitList(key)
 	for i := 0; i < len(cmdLine)-1; i++ {
 		ll.InsertHead(string(cmdLine[i+1]))
 	}
+	db.signalBlocked(key)
+	db.addAof(utils.CmdLine2("LPUSH", cmdLine))
 	return protocol.NewIntReply(int64(ll.Len()))
 }
 
-// RPop list
+// RPOP key [count]
 func execRPop(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	ll := db.getOrInitLinkedList(key)
-	value := ll.RemoveTail()
-	if value == nil {
-		return protocol.NewBulkReply([]byte("nil"))
-	}
-	return protocol.NewBulkReply([]byte(value.(string)))
+	return db.execPop("RPOP", cmdLine, false)
 }
 
 // RPUSH list v1 v2 ...
 func execRPush(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
-	ll := db.getOrInitLinkedList(key)
+	ll := db.getOrInitList(key)
 	for i := 0; i < len(cmdLine)-1; i++ {
 		ll.InsertTail(string(cmdLine[i+1]))
 	}
+	db.signalBlocked(key)
+	db.addAof(utils.CmdLine2("RPUSH", cmdLine))
 	return protocol.NewIntReply(int64(ll.Len()))
 }
 
+// execPop pop an element of the list, or count elements as an array when the count is given
+func (db *Database) execPop(cmdName string, cmdLine [][]byte, left bool) redis.Reply {
+	if len(cmdLine) > 2 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	key := string(cmdLine[0])
+	count := 1
+	if len(cmdLine) == 2 {
+		n, err := strconv.Atoi(string(cmdLine[1]))
+		if err != nil || n < 0 {
+			return protocol.NewErrReply(POSITIVE_COUNT_ERR)
+		}
+		count = n
+	}
+	ll, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ll == nil || ll.Empty() {
+		if len(cmdLine) == 2 {
+			return protocol.NewNullArrayReply()
+		}
+		return protocol.NewBulkReply([]byte("nil"))
+	}
+
+	values := make([][]byte, 0, min(count, ll.Len()))
+	for len(values) < count && !ll.Empty() {
+		values = append(values, []byte(db.popList(key, ll, left)))
+	}
+	if len(values) > 0 {
+		db.addAof(utils.CmdLine2(cmdName, cmdLine))
+	}
+	if len(cmdLine) == 1 {
+		return protocol.NewBulkReply(values[0])
+	}
+	return protocol.NewMultiReply(values)
+}
+
 // LRem list count value
 func execLRem(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
 	countStr := string(cmdLine[1])
 	value := string(cmdLine[2])
-	ll := db.getOrInitLinkedList(key)
+	ll := db.getOrInitList(key)
 	count, err := strconv.Atoi(countStr)
 	if err != nil {
 		return protocol.NewErrReply("invalid args of LREM")
@@ -129,6 +196,9 @@ func execLRem(db *Database, cmdLine [][]byte) redis.Reply {
 			res += temp
 		}
 	}
+	if res > 0 {
+		db.addAof(utils.CmdLine2("LREM", cmdLine))
+	}
 	return protocol.NewIntReply(int64(res))
 }
 
@@ -140,7 +210,7 @@ func execLRange(db *Database, cmdLine [][]byte) redis.Reply {
 	if err != nil {
 		return protocol.NewErrReply("invalid number for LRANGE")
 	}
-	ll := db.getOrInitLinkedList(key)
+	ll := db.getOrInitList(key)
 	values := ll.FindRangeValue(start, stop)
 	if len(values) == 0 {
 		return protocol.NewBulkReply([]byte("empty list"))
@@ -151,3 +221,392 @@ func execLRange(db *Database, cmdLine [][]byte) redis.Reply {
 	}
 	return protocol.NewMultiReply(res)
 }
+
+// LPUSHX key element [element ...]
+func execLPushX(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execPushX("LPUSHX", cmdLine, true)
+}
+
+// RPUSHX key element [element ...]
+func execRPushX(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execPushX("RPUSHX", cmdLine, false)
+}
+
+// execPushX push the elements only if the list exists
+func (db *Database) execPushX(cmdName string, cmdLine [][]byte, left bool) redis.Reply {
+	key := string(cmdLine[0])
+	ll, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ll == nil {
+		return protocol.NewIntReply(0)
+	}
+	for _, value := range cmdLine[1:] {
+		if left {
+			ll.InsertHead(string(value))
+		} else {
+			ll.InsertTail(string(value))
+		}
+	}
+	db.signalBlocked(key)
+	db.addAof(utils.CmdLine2(cmdName, cmdLine))
+	return protocol.NewIntReply(int64(ll.Len()))
+}
+
+// normalizeIndex convert the negative index to the index from the head
+func normalizeIndex(idx int, size int) int {
+	if idx < 0 {
+		return idx + size
+	}
+	return idx
+}
+
+// LSET key index element
+func execLSet(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	idx, err := strconv.Atoi(string(cmdLine[1]))
+	if err != nil {
+		return protocol.NewErrReply(INT_RANGE_ERR)
+	}
+	ll, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ll == nil {
+		return protocol.NewErrReply(NO_SUCH_KEY_ERR)
+	}
+	idx = normalizeIndex(idx, ll.Len())
+	if idx < 0 || idx >= ll.Len() {
+		return protocol.NewErrReply(LIST_INDEX_ERR)
+	}
+	ll.Set(idx, string(cmdLine[2]))
+	db.addAof(utils.CmdLine2("LSET", cmdLine))
+	return protocol.NewOkReply()
+}
+
+// LINSERT key BEFORE|AFTER pivot element
+func execLInsert(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	var before bool
+	switch strings.ToLower(string(cmdLine[1])) {
+	case "before":
+		before = true
+	case "after":
+		before = false
+	default:
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	ll, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ll == nil {
+		return protocol.NewIntReply(0)
+	}
+	pivot := string(cmdLine[2])
+	pos := -1
+	i := 0
+	ll.ForEach(func(value any) bool {
+		if value.(string) == pivot {
+			pos = i
+			return false
+		}
+		i++
+		return true
+	})
+	if pos < 0 {
+		return protocol.NewIntReply(-1)
+	}
+	if !before {
+		pos++
+	}
+	ll.Insert(pos, string(cmdLine[3]))
+	db.addAof(utils.CmdLine2("LINSERT", cmdLine))
+	return protocol.NewIntReply(int64(ll.Len()))
+}
+
+// LTRIM key start stop
+func execLTrim(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	start, err1 := strconv.Atoi(string(cmdLine[1]))
+	stop, err2 := strconv.Atoi(string(cmdLine[2]))
+	if err1 != nil || err2 != nil {
+		return protocol.NewErrReply(INT_RANGE_ERR)
+	}
+	ll, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ll == nil {
+		return protocol.NewOkReply()
+	}
+	size := ll.Len()
+	start = max(normalizeIndex(start, size), 0)
+	stop = min(normalizeIndex(stop, size), size-1)
+	removeHead, removeTail := size, 0
+	if start <= stop {
+		removeHead, removeTail = start, size-1-stop
+	}
+	for i := 0; i < removeHead; i++ {
+		ll.RemoveHead()
+	}
+	for i := 0; i < removeTail; i++ {
+		ll.RemoveTail()
+	}
+	if ll.Empty() {
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+	}
+	if removeHead+removeTail > 0 {
+		db.addAof(utils.CmdLine2("LTRIM", cmdLine))
+	}
+	return protocol.NewOkReply()
+}
+
+// LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func execLPos(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	element := string(cmdLine[1])
+	rank, count, maxLen := 1, -1, 0
+	for i := 2; i < len(cmdLine); i += 2 {
+		if i+1 >= len(cmdLine) {
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+		n, err := strconv.Atoi(string(cmdLine[i+1]))
+		if err != nil {
+			return protocol.NewErrReply(INT_RANGE_ERR)
+		}
+		switch strings.ToLower(string(cmdLine[i])) {
+		case "rank":
+			if n == 0 {
+				return protocol.NewErrReply(LPOS_RANK_ERR)
+			}
+			if n == math.MinInt64 {
+				return protocol.NewErrReply(LPOS_RANK_RANGE_ERR)
+			}
+			rank = n
+		case "count":
+			if n < 0 {
+				return protocol.NewErrReply(LPOS_COUNT_ERR)
+			}
+			count = n
+		case "maxlen":
+			if n < 0 {
+				return protocol.NewErrReply(LPOS_MAXLEN_ERR)
+			}
+			maxLen = n
+		default:
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+	}
+	ll, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	// count 0 means all the matches, no COUNT means the first one
+	limit := count
+	if count < 0 {
+		limit = 1
+	}
+	matches := make([]int, 0)
+	if ll != nil {
+		values := ll.FindRangeValue(0, ll.Len()-1)
+		skip := rank - 1
+		if rank < 0 {
+			skip = -rank - 1
+		}
+		for checked := 0; checked < len(values) && (maxLen == 0 || checked < maxLen); checked++ {
+			idx := checked
+			if rank < 0 {
+				idx = len(values) - 1 - checked
+			}
+			if values[idx].(string) != element {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			matches = append(matches, idx)
+			if len(matches) == limit {
+				break
+			}
+		}
+	}
+
+	if count >= 0 {
+		res := make([]redis.Reply, len(matches))
+		for i, idx := range matches {
+			res[i] = protocol.NewIntReply(int64(idx))
+		}
+		return protocol.NewMultiRawReply(res)
+	}
+	if len(matches) == 0 {
+		return protocol.NewNullBulkReply()
+	}
+	return protocol.NewIntReply(int64(matches[0]))
+}
+
+// prepareListMove: LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func prepareListMove(args [][]byte) ([]string, []string) {
+	return writeKeys(args[:2])
+}
+
+func rollbackListMove(db *Database, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, string(args[0]), string(args[1]))
+}
+
+// popList pop the element of the list, the key is removed when the list is empty
+func (db *Database) popList(key string, ll *list.List, left bool) string {
+	var value any
+	if left {
+		value = ll.RemoveHead()
+	} else {
+		value = ll.RemoveTail()
+	}
+	if ll.Empty() {
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+	}
+	return value.(string)
+}
+
+func parseListSide(arg []byte) (left bool, ok bool) {
+	switch strings.ToLower(string(arg)) {
+	case "left":
+		return true, true
+	case "right":
+		return false, true
+	}
+	return false, false
+}
+
+func formatListSide(left bool) string {
+	if left {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// moveList pop the element of the source and push it into the destination, return the null bulk if the source is empty
+func moveList(db *Database, source string, dest string, fromLeft bool, toLeft bool, ready func(key string) bool) redis.Reply {
+	if !ready(source) {
+		return protocol.NewNullBulkReply()
+	}
+	srcList, errReply := db.getAsList(source)
+	if errReply != nil {
+		return errReply
+	}
+	destList, errReply := db.getAsList(dest)
+	if errReply != nil {
+		return errReply
+	}
+	if srcList == nil || srcList.Empty() {
+		return protocol.NewNullBulkReply()
+	}
+	value := db.popList(source, srcList, fromLeft)
+	if destList == nil || (source == dest && srcList.Empty()) {
+		destList = db.getOrInitList(dest)
+	}
+	if toLeft {
+		destList.InsertHead(value)
+	} else {
+		destList.InsertTail(value)
+	}
+	db.signalBlocked(dest)
+	db.addAof(utils.CmdLine1("LMOVE", source, dest, formatListSide(fromLeft), formatListSide(toLeft)))
+	return protocol.NewBulkReply([]byte(value))
+}
+
+func alwaysReady(key string) bool {
+	return true
+}
+
+// LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *Database, cmdLine [][]byte) redis.Reply {
+	fromLeft, ok1 := parseListSide(cmdLine[2])
+	toLeft, ok2 := parseListSide(cmdLine[3])
+	if !ok1 || !ok2 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	return moveList(db, string(cmdLine[0]), string(cmdLine[1]), fromLeft, toLeft, alwaysReady)
+}
+
+// RPOPLPUSH source destination
+func execRPopLPush(db *Database, cmdLine [][]byte) redis.Reply {
+	return moveList(db, string(cmdLine[0]), string(cmdLine[1]), false, true, alwaysReady)
+}
+
+// lmpopKeys get the keys of LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count], nil if numkeys is invalid
+func lmpopKeys(args [][]byte) []string {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-2 {
+		return nil
+	}
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = string(args[i+1])
+	}
+	return keys
+}
+
+// prepareLMPop: LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func prepareLMPop(args [][]byte) ([]string, []string) {
+	return lmpopKeys(args), nil
+}
+
+func rollbackLMPop(db *Database, args [][]byte) []CmdLine {
+	return rollbackGivenKeys(db, lmpopKeys(args)...)
+}
+
+// LMPOP numkeys key [key ...] LEFT|RIGHT [COUNT count]
+func execLMPop(db *Database, cmdLine [][]byte) redis.Reply {
+	numKeys, err := strconv.Atoi(string(cmdLine[0]))
+	if err != nil || numKeys <= 0 {
+		return protocol.NewErrReply(LMPOP_NUMKEYS_ERR)
+	}
+	keys := lmpopKeys(cmdLine)
+	if keys == nil {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	rest := cmdLine[numKeys+1:]
+	left, ok := parseListSide(rest[0])
+	if !ok {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	count := 1
+	if len(rest) == 3 && strings.ToLower(string(rest[1])) == "count" {
+		count, err = strconv.Atoi(string(rest[2]))
+		if err != nil || count <= 0 {
+			return protocol.NewErrReply(LMPOP_COUNT_ERR)
+		}
+	} else if len(rest) != 1 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+
+	for _, key := range keys {
+		ll, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if ll == nil || ll.Empty() {
+			continue
+		}
+		values := make([][]byte, 0, min(count, ll.Len()))
+		for len(values) < count && !ll.Empty() {
+			values = append(values, []byte(db.popList(key, ll, left)))
+		}
+		cmdName := "RPOP"
+		if left {
+			cmdName = "LPOP"
+		}
+		db.addAof(utils.CmdLine1(cmdName, key, strconv.Itoa(len(values))))
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(key)),
+			protocol.NewMultiReply(values),
+		})
+	}
+	return protocol.NewNullArrayReply()
+}
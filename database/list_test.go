@@ -75,3 +75,118 @@ func TestLRange(t *testing.T) {
 	reply := execLRange(db, command)
 	log.Print(string(reply.ToByte()))
 }
+
+func TestListCommands(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	check := func(expected string, args ...string) {
+		t.Helper()
+		if reply := replyOf(server, conn, args...); reply != expected {
+			t.Errorf("%v err: %q", args, reply)
+		}
+	}
+
+	check(":0\r\n", "LPUSHX", "list", "a")
+	check(":0\r\n", "EXISTS", "list")
+	check(":3\r\n", "RPUSH", "list", "a", "b", "c")
+	check(":4\r\n", "LPUSHX", "list", "z")
+	check(":5\r\n", "RPUSHX", "list", "d")
+	check("+OK\r\n", "LSET", "list", "-1", "e")
+	check("$1\r\ne\r\n", "LINDEX", "list", "4")
+	check("-"+LIST_INDEX_ERR+"\r\n", "LSET", "list", "5", "x")
+	check("-"+NO_SUCH_KEY_ERR+"\r\n", "LSET", "missing", "0", "x")
+
+	check(":6\r\n", "LINSERT", "list", "BEFORE", "a", "y")
+	check(":7\r\n", "LINSERT", "list", "AFTER", "e", "f")
+	check(":-1\r\n", "LINSERT", "list", "AFTER", "none", "f")
+	check(":0\r\n", "LINSERT", "missing", "AFTER", "a", "f")
+	check("-"+SYNTAX_ERR+"\r\n", "LINSERT", "list", "UP", "a", "f")
+	// z y a b c e f
+	check("+OK\r\n", "LTRIM", "list", "1", "-2")
+	check(":5\r\n", "LLEN", "list")
+	check("$1\r\ny\r\n", "LINDEX", "list", "0")
+	check("+OK\r\n", "LTRIM", "list", "3", "1")
+	check(":0\r\n", "EXISTS", "list")
+
+	check(":6\r\n", "RPUSH", "list", "a", "b", "c", "a", "b", "a")
+	check(":0\r\n", "LPOS", "list", "a")
+	check(":3\r\n", "LPOS", "list", "a", "RANK", "2")
+	check(":3\r\n", "LPOS", "list", "a", "RANK", "-2")
+	check("*3\r\n:0\r\n:3\r\n:5\r\n", "LPOS", "list", "a", "COUNT", "0")
+	check("*2\r\n:5\r\n:3\r\n", "LPOS", "list", "a", "RANK", "-1", "COUNT", "2")
+	check("-"+LPOS_RANK_RANGE_ERR+"\r\n", "LPOS", "list", "a", "RANK", "-9223372036854775808")
+	check("*1\r\n:0\r\n", "LPOS", "list", "a", "COUNT", "0", "MAXLEN", "2")
+	check("$-1\r\n", "LPOS", "list", "x")
+	check("-"+LPOS_RANK_ERR+"\r\n", "LPOS", "list", "a", "RANK", "0")
+	check("-"+LPOS_COUNT_ERR+"\r\n", "LPOS", "list", "a", "COUNT", "-1")
+
+	check("*2\r\n$1\r\na\r\n$1\r\nb\r\n", "LPOP", "list", "2")
+	check("*1\r\n$1\r\na\r\n", "RPOP", "list", "1")
+	check("*0\r\n", "LPOP", "list", "0")
+	check("-"+POSITIVE_COUNT_ERR+"\r\n", "LPOP", "list", "-1")
+	check("*-1\r\n", "RPOP", "missing", "1")
+
+	// c a b
+	check("$1\r\nb\r\n", "RPOPLPUSH", "list", "dest")
+	check("$1\r\nc\r\n", "LMOVE", "list", "dest", "LEFT", "RIGHT")
+	check("$-1\r\n", "LMOVE", "missing", "dest", "LEFT", "RIGHT")
+	check("-"+SYNTAX_ERR+"\r\n", "LMOVE", "list", "dest", "UP", "RIGHT")
+
+	check("*2\r\n$4\r\ndest\r\n*2\r\n$1\r\nc\r\n$1\r\nb\r\n", "LMPOP", "2", "missing", "dest", "RIGHT", "COUNT", "5")
+	check("*2\r\n$4\r\nlist\r\n*1\r\n$1\r\na\r\n", "LMPOP", "2", "dest", "list", "LEFT")
+	check("*-1\r\n", "LMPOP", "1", "list", "LEFT")
+	check("-"+LMPOP_NUMKEYS_ERR+"\r\n", "LMPOP", "0", "list", "LEFT")
+	check("-"+LMPOP_COUNT_ERR+"\r\n", "LMPOP", "1", "list", "LEFT", "COUNT", "0")
+	check("-"+SYNTAX_ERR+"\r\n", "LMPOP", "3", "list", "LEFT")
+
+	replyOf(server, conn, "SET", "str", "v")
+	check("-"+WRONG_TYPE_ERR+"\r\n", "LPOS", "str", "v")
+	check("-"+WRONG_TYPE_ERR+"\r\n", "LMOVE", "str", "dest", "LEFT", "LEFT")
+}
+
+func TestListAof(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	cmdLines := make([]CmdLine, 0)
+	server.mustSelectDB(0).addAof = func(cmdLine [][]byte) {
+		cmdLines = append(cmdLines, cmdLine)
+	}
+	replyOf(server, conn, "RPUSH", "list", "a", "b", "c", "d", "e", "f")
+	replyOf(server, conn, "LSET", "list", "0", "z")
+	replyOf(server, conn, "LINSERT", "list", "AFTER", "c", "x")
+	replyOf(server, conn, "LTRIM", "list", "0", "-2")
+	replyOf(server, conn, "LPOP", "list", "2")
+	replyOf(server, conn, "RPOPLPUSH", "list", "other")
+	replyOf(server, conn, "LMPOP", "2", "other", "list", "RIGHT", "COUNT", "2")
+	replyOf(server, conn, "LPUSHX", "list", "y")
+	replyOf(server, conn, "BRPOP", "list", "0")
+
+	replayed := NewPureServer()
+	for _, cmdLine := range cmdLines {
+		replayed.Exec(conn, cmdLine)
+	}
+	for _, key := range []string{"list", "other"} {
+		expected := replyOf(server, conn, "LRANGE", key, "0", "100")
+		if reply := replyOf(replayed, conn, "LRANGE", key, "0", "100"); reply != expected {
+			t.Error("the replayed list err: ", key, reply, expected)
+		}
+	}
+}
+
+func TestListUndo(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	replyOf(server, conn, "RPUSH", "list", "a", "b", "c")
+	replyOf(server, conn, "MULTI")
+	replyOf(server, conn, "LSET", "list", "0", "z")
+	replyOf(server, conn, "LTRIM", "list", "1", "1")
+	replyOf(server, conn, "LMOVE", "list", "dest", "LEFT", "LEFT")
+	replyOf(server, conn, "GET", "missing")
+	replyOf(server, conn, "EXEC")
+	if reply := replyOf(server, conn, "LRANGE", "list", "0", "100"); reply != "*3\r\n$4\r\n0) a\r\n$4\r\n1) b\r\n$4\r\n2) c\r\n" {
+		t.Error("the list after the rollback err: ", reply)
+	}
+	if reply := replyOf(server, conn, "EXISTS", "dest"); reply != ":0\r\n" {
+		t.Error("the destination after the rollback err: ", reply)
+	}
+}
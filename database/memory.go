@@ -0,0 +1,152 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/**
+MEMORY USAGE key [SAMPLES count]
+MEMORY STATS
+MEMORY PURGE
+MEMORY HELP
+USAGE is executed by the database since it locks the key, the others are executed by the server
+*/
+
+const (
+	MEMORY_UNKNOWN_SUBCMD = "ERR unknown subcommand or wrong number of arguments for 'MEMORY'"
+	INT_RANGE_ERR         = "ERR value is not an integer or out of range"
+)
+
+var memoryHelp = []string{
+	"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"PURGE",
+	"    Return memory to the operating system.",
+	"STATS",
+	"    Return information about the memory usage of the server.",
+	"USAGE <key> [SAMPLES <count>]",
+	"    Return memory in bytes used by <key> and its value. Nested values are",
+	"    sampled up to <count> times (default: 5, 0 means sample all).",
+	"HELP",
+	"    Print this help.",
+}
+
+func init() {
+	RegisterCommand("MEMORY", execMemoryUsage, prepareMemory, nil, -2)
+}
+
+// prepareMemory: MEMORY USAGE key [SAMPLES count]
+func prepareMemory(args [][]byte) ([]string, []string) {
+	if !isMemoryUsage(args) {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+func isMemoryUsage(args [][]byte) bool {
+	return len(args) >= 2 && strings.EqualFold(string(args[0]), "usage")
+}
+
+// execMemoryUsage estimate the memory of the key, the elements of the collections are sampled
+func execMemoryUsage(db *Database, args [][]byte) redis.Reply {
+	if !isMemoryUsage(args) {
+		return protocol.NewErrReply(MEMORY_UNKNOWN_SUBCMD)
+	}
+	samples := DEFAULT_MAXMEMORY_SAMPLES
+	for i := 2; i < len(args); i++ {
+		if strings.EqualFold(string(args[i]), "samples") && i+1 < len(args) {
+			n, err := strconv.Atoi(string(args[i+1]))
+			if err != nil || n < 0 {
+				return protocol.NewErrReply(INT_RANGE_ERR)
+			}
+			// 0 means all the elements
+			samples = n
+			i++
+		} else {
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+	}
+	key := string(args[1])
+	entity, exists := db.GetEntityWithLock(key)
+	if !exists {
+		return protocol.NewNullBulkReply()
+	}
+	return protocol.NewIntReply(estimateSize(key, entity, samples))
+}
+
+func (r *RedisServer) execMemory(args [][]byte) redis.Reply {
+	if len(args) != 1 {
+		return protocol.NewErrReply(MEMORY_UNKNOWN_SUBCMD)
+	}
+	switch strings.ToLower(string(args[0])) {
+	case "stats":
+		return r.execMemoryStats()
+	case "purge":
+		debug.FreeOSMemory()
+		return protocol.NewOkReply()
+	case "help":
+		return helpReply(memoryHelp)
+	}
+	return protocol.NewErrReply(MEMORY_UNKNOWN_SUBCMD)
+}
+
+// execMemoryStats reply the memory of the server like MEMORY STATS of redis,
+// the allocated memory is the heap of the go runtime and the dataset is the estimated memory of the keys
+func (r *RedisServer) execMemoryStats() redis.Reply {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	allocated := memStats.HeapAlloc
+	peak := r.stats.updatePeakMemory(allocated)
+	dataset := r.usedMemory()
+
+	entries := []redis.Reply{
+		protocol.NewBulkReply([]byte("peak.allocated")), protocol.NewIntReply(int64(peak)),
+		protocol.NewBulkReply([]byte("total.allocated")), protocol.NewIntReply(int64(allocated)),
+		protocol.NewBulkReply([]byte("replication.backlog")), protocol.NewIntReply(r.backlogMemory()),
+	}
+	var keys int64
+	for i := range r.dbSet {
+		db := r.mustSelectDB(i)
+		dbKeys := db.data.Len()
+		if dbKeys == 0 {
+			continue
+		}
+		keys += int64(dbKeys)
+		entries = append(entries, protocol.NewBulkReply([]byte("db."+strconv.Itoa(i))), protocol.NewMapReply([]redis.Reply{
+			protocol.NewBulkReply([]byte("keys")), protocol.NewIntReply(int64(dbKeys)),
+			protocol.NewBulkReply([]byte("expires")), protocol.NewIntReply(int64(db.ttlMap.Len())),
+			protocol.NewBulkReply([]byte("dataset.bytes")), protocol.NewIntReply(atomic.LoadInt64(&db.usedMemory)),
+		}))
+	}
+	bytesPerKey := int64(0)
+	if keys > 0 {
+		bytesPerKey = dataset / keys
+	}
+	entries = append(entries,
+		protocol.NewBulkReply([]byte("keys.count")), protocol.NewIntReply(keys),
+		protocol.NewBulkReply([]byte("keys.bytes-per-key")), protocol.NewIntReply(bytesPerKey),
+		protocol.NewBulkReply([]byte("dataset.bytes")), protocol.NewIntReply(dataset),
+		protocol.NewBulkReply([]byte("dataset.percentage")), protocol.NewDoubleReply(float64(dataset)*100/float64(allocated)),
+		protocol.NewBulkReply([]byte("peak.percentage")), protocol.NewDoubleReply(float64(allocated)*100/float64(peak)),
+		protocol.NewBulkReply([]byte("fragmentation")), protocol.NewDoubleReply(float64(memStats.Sys)/float64(allocated)),
+	)
+	return protocol.NewMapReply(entries)
+}
+
+// backlogMemory is the size of the replication backlog, it is 0 before any replica connects
+func (r *RedisServer) backlogMemory() int64 {
+	if r.repl == nil {
+		return 0
+	}
+	r.repl.mu.Lock()
+	defer r.repl.mu.Unlock()
+	if r.repl.backlog == nil {
+		return 0
+	}
+	return int64(len(r.repl.backlog.buf))
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	replyOf(server, conn, "SET", "k", "value")
+	if reply := replyOf(server, conn, "MEMORY", "USAGE", "k"); reply != ":"+strconv.Itoa(ENTITY_OVERHEAD+1+STRING_OVERHEAD+5)+"\r\n" {
+		t.Error("memory usage of string err: ", reply)
+	}
+	if reply := replyOf(server, conn, "MEMORY", "USAGE", "missing"); reply != "$-1\r\n" {
+		t.Error("memory usage of missing key err: ", reply)
+	}
+
+	// the first elements are small, so sampling all of them gets the larger size,
+	// the last element is too large for the listpack so the elements are sampled from the quicklist
+	args := []string{"RPUSH", "list"}
+	for i := 0; i < 10; i++ {
+		args = append(args, "a")
+	}
+	for i := 0; i < 10; i++ {
+		args = append(args, strings.Repeat("b", 100))
+	}
+	args = append(args, strings.Repeat("c", 8192))
+	replyOf(server, conn, args...)
+	sampled := replyOf(server, conn, "MEMORY", "USAGE", "list")
+	all := replyOf(server, conn, "MEMORY", "USAGE", "list", "SAMPLES", "0")
+	if sampled == all || !strings.HasPrefix(all, ":") {
+		t.Error("memory usage samples err: ", sampled, all)
+	}
+	if reply := replyOf(server, conn, "MEMORY", "USAGE", "list", "SAMPLES", "-1"); reply != "-"+INT_RANGE_ERR+"\r\n" {
+		t.Error("memory usage invalid samples err: ", reply)
+	}
+
+	reply := replyOf(server, conn, "MEMORY", "STATS")
+	for _, expected := range []string{"$14\r\npeak.allocated\r\n", "$4\r\ndb.0\r\n*6\r\n$4\r\nkeys\r\n:2\r\n",
+		"$10\r\nkeys.count\r\n:2\r\n", "$13\r\ndataset.bytes\r\n"} {
+		if !strings.Contains(reply, expected) {
+			t.Error("memory stats lacks ", expected, ": ", reply)
+		}
+	}
+	if reply := replyOf(server, conn, "MEMORY", "PURGE"); reply != "+OK\r\n" {
+		t.Error("memory purge err: ", reply)
+	}
+	if reply := replyOf(server, conn, "MEMORY", "FOO"); reply != "-"+MEMORY_UNKNOWN_SUBCMD+"\r\n" {
+		t.Error("memory unknown subcommand err: ", reply)
+	}
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"errors"
+	"github.com/xzwsloser/Go-redis/aof"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/rdb"
+	"github.com/xzwsloser/Go-redis/resp/parse"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+	DUMP key
+	RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+	RESTORE-ASKING key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+	MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password] [AUTH2 username password]
+		[KEYS key [key ...]]
+*/
+
+const (
+	BUSY_KEY_ERR      = "BUSYKEY Target key name already exists."
+	BAD_PAYLOAD_ERR   = "ERR DUMP payload version or checksum are wrong"
+	INVALID_TTL_ERR   = "ERR Invalid TTL value, must be >= 0"
+	MIGRATE_IO_ERR    = "IOERR error or timeout"
+	MIGRATE_TARGET    = "ERR Target instance replied with error: "
+	MIGRATE_NO_KEY    = "NOKEY"
+	MIGRATE_KEYS_ERR  = "ERR When using MIGRATE KEYS option, the key argument must be set to the empty string"
+	DEFAULT_CALL_WAIT = time.Second
+)
+
+func init() {
+	RegisterCommand("DUMP", execDump, readFirstKey, nil, 2)
+	RegisterCommand("RESTORE", execRestore, writeFirstKey, rollbackFirstKey, -4)
+	// RESTORE-ASKING is sent by MIGRATE and allowed in the importing slot of cluster
+	RegisterCommand("RESTORE-ASKING", execRestore, writeFirstKey, rollbackFirstKey, -4)
+	RegisterCommand("MIGRATE", execMigrate, prepareMigrate, nil, -6)
+}
+
+// DUMP key
+func execDump(db *Database, cmdLine [][]byte) redis.Reply {
+	entity, exists := db.GetEntityWithLock(string(cmdLine[0]))
+	if !exists {
+		return protocol.NewNullBulkReply()
+	}
+	payload, err := rdb.DumpValue(entity)
+	if err != nil {
+		return protocol.NewErrReply("ERR " + err.Error())
+	}
+	return protocol.NewBulkReply(payload)
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func execRestore(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	ttl, err := strconv.ParseInt(string(cmdLine[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+	}
+	if ttl < 0 {
+		return protocol.NewErrReply(INVALID_TTL_ERR)
+	}
+	replace, absTTL := false, false
+	for i := 3; i < len(cmdLine); i++ {
+		switch strings.ToUpper(string(cmdLine[i])) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			// the lru and lfu info is not kept
+			i++
+			if i >= len(cmdLine) {
+				return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+			}
+		default:
+			return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+		}
+	}
+	if _, exists := db.GetEntityWithLock(key); exists && !replace {
+		return protocol.NewErrReply(BUSY_KEY_ERR)
+	}
+	entity, err := rdb.RestoreValue(cmdLine[2])
+	if err != nil {
+		return protocol.NewErrReply(BAD_PAYLOAD_ERR)
+	}
+
+	var expireAt time.Time
+	if ttl > 0 {
+		if absTTL {
+			expireAt = time.UnixMilli(ttl)
+		} else {
+			expireAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+	db.PutEntityWithLock(key, entity)
+	db.Persister(key)
+	db.addAof(utils.CmdLine1("DEL", key))
+	db.addAof(aof.EntityToCmd(key, entity))
+	if !expireAt.IsZero() {
+		db.Expire(key, expireAt)
+		db.addAof(utils.ExpireCmd(key, expireAt))
+	}
+	return protocol.NewOkReply()
+}
+
+type migrateArgs struct {
+	addr    string
+	dbIndex int
+	timeout time.Duration
+	copy    bool
+	replace bool
+	// auth is the AUTH command sent to the target before SELECT, nil if no password
+	auth [][]byte
+	keys []string
+}
+
+// parseMigrateArgs parse: host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password]
+// [AUTH2 username password] [KEYS key [key ...]]
+func parseMigrateArgs(args [][]byte) (*migrateArgs, redis.Reply) {
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+	}
+	dbIndex, err := strconv.Atoi(string(args[3]))
+	if err != nil || dbIndex < 0 {
+		return nil, protocol.NewErrReply(DB_INDEX_ERR)
+	}
+	timeout, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil || timeout < 0 {
+		return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+	}
+	if timeout == 0 {
+		timeout = DEFAULT_CALL_WAIT.Milliseconds()
+	}
+	ma := &migrateArgs{
+		addr:    net.JoinHostPort(string(args[0]), strconv.Itoa(port)),
+		dbIndex: dbIndex,
+		timeout: time.Duration(timeout) * time.Millisecond,
+	}
+	if len(args[2]) > 0 {
+		ma.keys = []string{string(args[2])}
+	}
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COPY":
+			ma.copy = true
+		case "REPLACE":
+			ma.replace = true
+		case "AUTH":
+			if i+1 >= len(args) {
+				return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+			}
+			ma.auth = utils.CmdLine2("AUTH", args[i+1:i+2])
+			i++
+		case "AUTH2":
+			if i+2 >= len(args) {
+				return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+			}
+			ma.auth = utils.CmdLine2("AUTH", args[i+1:i+3])
+			i += 2
+		case "KEYS":
+			if len(args[2]) > 0 {
+				return nil, protocol.NewErrReply(MIGRATE_KEYS_ERR)
+			}
+			ma.keys = bytesToString(args[i+1:])
+			i = len(args)
+		default:
+			return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+		}
+	}
+	return ma, nil
+}
+
+func prepareMigrate(args [][]byte) ([]string, []string) {
+	ma, errReply := parseMigrateArgs(args)
+	if errReply != nil {
+		return nil, nil
+	}
+	return ma.keys, nil
+}
+
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password] [AUTH2 username password]
+// [KEYS key [key ...]], the keys are sent by RESTORE-ASKING and removed after the target replies OK
+func execMigrate(db *Database, cmdLine [][]byte) redis.Reply {
+	ma, errReply := parseMigrateArgs(cmdLine)
+	if errReply != nil {
+		return errReply
+	}
+
+	keys := make([]string, 0, len(ma.keys))
+	var cmdLines [][][]byte
+	if ma.auth != nil {
+		cmdLines = append(cmdLines, ma.auth)
+	}
+	// the replies of AUTH and SELECT are before the replies of the keys
+	headLen := len(cmdLines) + 1
+	cmdLines = append(cmdLines, utils.CmdLine1("SELECT", strconv.Itoa(ma.dbIndex)))
+	for _, key := range ma.keys {
+		entity, exists := db.GetEntityWithLock(key)
+		if !exists {
+			continue
+		}
+		payload, err := rdb.DumpValue(entity)
+		if err != nil {
+			return protocol.NewErrReply("ERR " + err.Error())
+		}
+		var ttl int64
+		if expireAt, ok := db.GetExpireTime(key); ok {
+			ttl = max(time.Until(expireAt).Milliseconds(), 1)
+		}
+		restore := [][]byte{[]byte("RESTORE-ASKING"), []byte(key),
+			[]byte(strconv.FormatInt(ttl, 10)), payload}
+		if ma.replace {
+			restore = append(restore, []byte("REPLACE"))
+		}
+		keys = append(keys, key)
+		cmdLines = append(cmdLines, restore)
+	}
+	if len(keys) == 0 {
+		return protocol.NewStatusReply(MIGRATE_NO_KEY)
+	}
+
+	replies, err := callNode(ma.addr, ma.timeout, cmdLines...)
+	if err != nil {
+		return protocol.NewErrReply(MIGRATE_IO_ERR + " " + ma.addr + ": " + err.Error())
+	}
+	for _, reply := range replies[:headLen] {
+		if protocol.IsErrReply(reply) {
+			return protocol.NewErrReply(MIGRATE_TARGET + replyMessage(reply))
+		}
+	}
+	var errMsg string
+	for i, key := range keys {
+		reply := replies[i+headLen]
+		if protocol.IsErrReply(reply) {
+			if errMsg == "" {
+				errMsg = replyMessage(reply)
+			}
+			continue
+		}
+		if ma.copy {
+			continue
+		}
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+		db.addAof(utils.CmdLine1("DEL", key))
+	}
+	if errMsg != "" {
+		return protocol.NewErrReply(MIGRATE_TARGET + errMsg)
+	}
+	return protocol.NewOkReply()
+}
+
+func replyMessage(reply redis.Reply) string {
+	return strings.TrimSuffix(strings.TrimPrefix(string(reply.ToByte()), "-"), protocol.CRLF)
+}
+
+// callNode send the commands to another node in a pipeline and wait for all the replies
+func callNode(addr string, timeout time.Duration, cmdLines ...[][]byte) ([]redis.Reply, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(timeout))
+
+	request := make([]byte, 0)
+	for _, cmdLine := range cmdLines {
+		request = append(request, protocol.NewMultiReply(cmdLine).ToByte()...)
+	}
+	_, err = conn.Write(request)
+	if err != nil {
+		return nil, err
+	}
+
+	replies := make([]redis.Reply, 0, len(cmdLines))
+	ch := parse.ParseStream(conn)
+	for len(replies) < len(cmdLines) {
+		payLoad, ok := <-ch
+		if !ok {
+			return nil, errors.New("connection closed")
+		}
+		if payLoad.Error != nil {
+			return nil, payLoad.Error
+		}
+		replies = append(replies, payLoad.Data)
+	}
+	return replies, nil
+}
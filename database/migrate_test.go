@@ -0,0 +1,88 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"strconv"
+	"testing"
+)
+
+func TestDumpRestore(t *testing.T) {
+	server := NewPureServer()
+	conn := connection.NewFakeConnection()
+	replyOf(server, conn, "RPUSH", "list", "a", "b")
+	dump, ok := server.Exec(conn, utils.CmdLine1("DUMP", "list")).(*protocol.BulkReply)
+	if !ok {
+		t.Fatal("dump reply err")
+	}
+	payload := string(dump.Content())
+
+	reply := replyOf(server, conn, "RESTORE", "list", "0", payload)
+	if reply != "-"+BUSY_KEY_ERR+"\r\n" {
+		t.Error("restore the existed key err: ", reply)
+	}
+	reply = replyOf(server, conn, "RESTORE", "copy", "100000", payload)
+	if reply != "+OK\r\n" {
+		t.Fatal("restore err: ", reply)
+	}
+	if reply = replyOf(server, conn, "LINDEX", "copy", "1"); reply != "$1\r\nb\r\n" {
+		t.Error("the restored list err: ", reply)
+	}
+	if reply = replyOf(server, conn, "TTL", "copy"); reply != ":100\r\n" && reply != ":99\r\n" {
+		t.Error("the ttl of restored key err: ", reply)
+	}
+	reply = replyOf(server, conn, "RESTORE", "copy", "0", payload[:len(payload)-1]+"x", "REPLACE")
+	if reply != "-"+BAD_PAYLOAD_ERR+"\r\n" {
+		t.Error("the corrupt payload should be rejected: ", reply)
+	}
+	if reply = replyOf(server, conn, "DUMP", "none"); reply != "$-1\r\n" {
+		t.Error("dump the missing key err: ", reply)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	source, _, _ := newReplServer(t)
+	target, host, port := newReplServer(t)
+	sc := connection.NewFakeConnection()
+	tc := connection.NewFakeConnection()
+	replyOf(source, sc, "SET", "k1", "v1")
+	replyOf(source, sc, "SADD", "k2", "m")
+	replyOf(source, sc, "SET", "k3", "v3")
+	replyOf(target, tc, "SELECT", "1")
+	replyOf(target, tc, "SET", "k3", "old")
+
+	portStr := strconv.Itoa(port)
+	if reply := replyOf(source, sc, "MIGRATE", host, portStr, "none", "1", "1000"); reply != "+NOKEY\r\n" {
+		t.Error("migrate the missing key err: ", reply)
+	}
+	reply := replyOf(source, sc, "MIGRATE", host, portStr, "", "1", "1000", "KEYS", "k1", "k2")
+	if reply != "+OK\r\n" {
+		t.Fatal("migrate err: ", reply)
+	}
+	if reply = replyOf(source, sc, "EXISTS", "k1", "k2"); reply != ":0\r\n" {
+		t.Error("the migrated keys should be removed: ", reply)
+	}
+	if reply = replyOf(target, tc, "GET", "k1"); reply != "$2\r\nv1\r\n" {
+		t.Error("the migrated string err: ", reply)
+	}
+	if reply = replyOf(target, tc, "SISMEMBER", "k2", "m"); reply != ":1\r\n" {
+		t.Error("the migrated set err: ", reply)
+	}
+
+	// the existed key is kept without REPLACE
+	reply = replyOf(source, sc, "MIGRATE", host, portStr, "k3", "1", "1000", "COPY")
+	if reply != "-"+MIGRATE_TARGET+BUSY_KEY_ERR+"\r\n" {
+		t.Error("migrate the existed key err: ", reply)
+	}
+	reply = replyOf(source, sc, "MIGRATE", host, portStr, "k3", "1", "1000", "COPY", "REPLACE")
+	if reply != "+OK\r\n" {
+		t.Error("migrate with replace err: ", reply)
+	}
+	if reply = replyOf(source, sc, "GET", "k3"); reply != "$2\r\nv3\r\n" {
+		t.Error("the key should be kept with COPY: ", reply)
+	}
+	if reply = replyOf(target, tc, "GET", "k3"); reply != "$2\r\nv3\r\n" {
+		t.Error("the key should be replaced: ", reply)
+	}
+}
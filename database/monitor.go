@@ -0,0 +1,157 @@
+package database
+
+import (
+	"fmt"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/**
+MONITOR
+stream every command executed by the server to the client:
++1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+*/
+
+const (
+	// MONITOR_BUFFER_SIZE is the number of the lines waiting to be sent to a monitor,
+	// the monitor is disconnected when it falls behind too much like the output buffer limit of redis
+	MONITOR_BUFFER_SIZE = 1 << 12
+	MONITOR_IN_MULTI    = "ERR MONITOR is not allowed in MULTI"
+)
+
+// monitor is a client streaming the commands, the lines are written by its own goroutine
+// so that the slow monitor never blocks the commands
+type monitor struct {
+	conn      redis.Conn
+	lines     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (m *monitor) stop() {
+	m.closeOnce.Do(func() {
+		close(m.done)
+	})
+}
+
+func (m *monitor) serve() {
+	for {
+		select {
+		case line := <-m.lines:
+			if _, err := m.conn.Write(line); err != nil {
+				return
+			}
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (r *RedisServer) execMonitor(conn redis.Conn) redis.Reply {
+	if conn.InitMulti() {
+		return protocol.NewErrReply(MONITOR_IN_MULTI)
+	}
+	if r.isMonitor(conn) {
+		return protocol.NewOkReply()
+	}
+	m := &monitor{
+		conn:  conn,
+		lines: make(chan []byte, MONITOR_BUFFER_SIZE),
+		done:  make(chan struct{}),
+	}
+	// the OK is sent by the monitor before any line
+	m.lines <- protocol.NewOkReply().ToByte()
+	r.monitors.Store(conn.GetID(), m)
+	atomic.AddInt32(&r.monitorCount, 1)
+	go m.serve()
+	return protocol.NewNoReply()
+}
+
+func (r *RedisServer) isMonitor(conn redis.Conn) bool {
+	_, ok := r.monitors.Load(conn.GetID())
+	return ok
+}
+
+func (r *RedisServer) removeMonitor(conn redis.Conn) {
+	value, ok := r.monitors.LoadAndDelete(conn.GetID())
+	if !ok {
+		return
+	}
+	atomic.AddInt32(&r.monitorCount, -1)
+	value.(*monitor).stop()
+}
+
+// feedMonitors send the command to all the monitors, nothing is formatted when there is no monitor
+func (r *RedisServer) feedMonitors(conn redis.Conn, cmdLine [][]byte) {
+	if atomic.LoadInt32(&r.monitorCount) == 0 {
+		return
+	}
+	if conn.GetUser() == connection.INTERNAL_USER || hiddenCommand(string(cmdLine[0])) {
+		return
+	}
+	line := monitorLine(time.Now(), conn.GetDBIndex(), conn.RemoteAddr(), cmdLine)
+	r.monitors.Range(func(key, value any) bool {
+		m := value.(*monitor)
+		select {
+		case m.lines <- line:
+		default:
+			// closing the connection may wait for the writing, so it is closed in another goroutine
+			r.removeMonitor(m.conn)
+			go func() {
+				_ = m.conn.Close()
+			}()
+		}
+		return true
+	})
+}
+
+// monitorLine format the command like redis e.g. +1339518083.107412 [0 127.0.0.1:60866] "set" "k" "v"
+func monitorLine(now time.Time, dbIndex int, addr string, cmdLine [][]byte) []byte {
+	args := append([][]byte(nil), cmdLine...)
+	redactArgs(cmdLine, args)
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("+%d.%06d [%d %s]", now.Unix(), now.Nanosecond()/1000, dbIndex, addr))
+	for _, arg := range args {
+		builder.WriteByte(' ')
+		builder.WriteString(quoteArg(arg))
+	}
+	builder.WriteString(protocol.CRLF)
+	return []byte(builder.String())
+}
+
+// quoteArg quote the arg like sdscatrepr of redis, the invisible bytes are escaped
+func quoteArg(arg []byte) string {
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for _, b := range arg {
+		switch b {
+		case '\\', '"':
+			builder.WriteByte('\\')
+			builder.WriteByte(b)
+		case '\n':
+			builder.WriteString("\\n")
+		case '\r':
+			builder.WriteString("\\r")
+		case '\t':
+			builder.WriteString("\\t")
+		case '\a':
+			builder.WriteString("\\a")
+		case '\b':
+			builder.WriteString("\\b")
+		default:
+			if b >= ' ' && b <= '~' {
+				builder.WriteByte(b)
+			} else {
+				builder.WriteString("\\x" + fmt.Sprintf("%02x", b))
+			}
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
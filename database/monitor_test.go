@@ -0,0 +1,67 @@
+package database
+
+import (
+	"bufio"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMonitor(t *testing.T) {
+	server := NewPureServer()
+	listener, host, port := newTestListener(t)
+	serveListener(t, server, listener)
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+
+	monitorConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer monitorConn.Close()
+	reader := bufio.NewReader(monitorConn)
+	_, _ = monitorConn.Write([]byte("*1\r\n$7\r\nMONITOR\r\n"))
+	_ = monitorConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if line, err := reader.ReadString('\n'); err != nil || line != "+OK\r\n" {
+		t.Fatal("monitor err: ", line, err)
+	}
+
+	client, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	clientReader := bufio.NewReader(client)
+	_, _ = client.Write([]byte("*2\r\n$4\r\nAUTH\r\n$6\r\nsecret\r\n"))
+	_, _ = clientReader.ReadString('\n')
+	_, _ = client.Write([]byte("*3\r\n$3\r\nset\r\n$1\r\nk\r\n$4\r\na \"b\r\n"))
+	_, _ = clientReader.ReadString('\n')
+
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	// AUTH is hidden from the monitors
+	pattern := regexp.MustCompile(`^\+\d+\.\d{6} \[0 ` + regexp.QuoteMeta(client.LocalAddr().String()) + `\] "set" "k" "a \\"b"\r\n$`)
+	if !pattern.MatchString(line) {
+		t.Errorf("monitor line err: %q", line)
+	}
+
+	conn := newClientConn()
+	server.AfterClientConnect(conn)
+	if reply := replyOf(server, conn, "CLIENT", "LIST", "TYPE", "normal"); !strings.Contains(reply, "flags=O") {
+		t.Error("the monitor flag err: ", reply)
+	}
+	_ = monitorConn.Close()
+	waitFor(t, "the monitor is removed after closing", func() bool {
+		return !strings.Contains(replyOf(server, conn, "CLIENT", "LIST"), "flags=O")
+	})
+}
+
+func TestQuoteArg(t *testing.T) {
+	if quoted := quoteArg([]byte("a\"\\\r\n\t\x01é")); quoted != `"a\"\\\r\n\t\x01\xc3\xa9"` {
+		t.Error("quote arg err: ", quoted)
+	}
+}
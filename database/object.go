@@ -0,0 +1,149 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+OBJECT ENCODING key
+OBJECT IDLETIME key
+OBJECT FREQ key
+OBJECT REFCOUNT key
+OBJECT HELP
+*/
+
+const (
+	// EMBSTR_SIZE_LIMIT is the longest string of the embstr encoding like redis
+	EMBSTR_SIZE_LIMIT     = 44
+	OBJECT_UNKNOWN_SUBCMD = "ERR unknown subcommand or wrong number of arguments for 'OBJECT'"
+	OBJECT_IDLETIME_ERR   = "ERR An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."
+	OBJECT_FREQ_ERR       = "ERR An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust."
+)
+
+// noTouchCommands never refresh the access time of the keys like LOOKUP_NOTOUCH of redis,
+// so the introspection does not change what it shows
+var noTouchCommands = map[string]struct{}{
+	"object": {}, "memory": {}, "type": {}, "exists": {}, "ttl": {}, "pttl": {}, "expiretime": {},
+	"pexpiretime": {},
+}
+
+var objectHelp = []string{
+	"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+	"ENCODING <key>",
+	"    Return the kind of internal representation used in order to store the value",
+	"    associated with a <key>.",
+	"FREQ <key>",
+	"    Return the access frequency index of the <key>. The returned integer is",
+	"    proportional to the logarithm of the recent access frequency of the key.",
+	"IDLETIME <key>",
+	"    Return the idle time of the <key>, that is the approximated number of",
+	"    seconds elapsed since the last access to the key.",
+	"REFCOUNT <key>",
+	"    Return the number of references of the value associated with the specified",
+	"    <key>.",
+	"HELP",
+	"    Print this help.",
+}
+
+func init() {
+	RegisterCommand("OBJECT", execObject, prepareObject, nil, -2)
+}
+
+// prepareObject: OBJECT subcommand key
+func prepareObject(args [][]byte) ([]string, []string) {
+	if len(args) < 2 {
+		return nil, nil
+	}
+	return nil, []string{string(args[1])}
+}
+
+func execObject(db *Database, args [][]byte) redis.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	if subCmd == "help" && len(args) == 1 {
+		return helpReply(objectHelp)
+	}
+	if len(args) != 2 {
+		return protocol.NewErrReply(OBJECT_UNKNOWN_SUBCMD)
+	}
+	if subCmd != "encoding" && subCmd != "idletime" && subCmd != "freq" && subCmd != "refcount" {
+		return protocol.NewErrReply(OBJECT_UNKNOWN_SUBCMD)
+	}
+	entity, exists := db.GetEntityWithLock(string(args[1]))
+	if !exists {
+		return protocol.NewNullBulkReply()
+	}
+	lfu := isLFUPolicy(db.evictor.policy)
+	switch subCmd {
+	case "encoding":
+		return protocol.NewBulkReply([]byte(encodingOf(entity)))
+	case "idletime":
+		if lfu {
+			return protocol.NewErrReply(OBJECT_IDLETIME_ERR)
+		}
+		return protocol.NewIntReply(int64(idleTime(entity, time.Now()) / time.Second))
+	case "freq":
+		if !lfu {
+			return protocol.NewErrReply(OBJECT_FREQ_ERR)
+		}
+		return protocol.NewIntReply(int64(lfuDecr(entity, time.Now())))
+	default:
+		// the values are never shared between the keys
+		return protocol.NewIntReply(1)
+	}
+}
+
+func isLFUPolicy(policy string) bool {
+	return policy == POLICY_ALLKEYS_LFU || policy == POLICY_VOLATILE_LFU
+}
+
+// encodingOf get the name of the internal representation like OBJECT ENCODING of redis
+func encodingOf(entity *database.DataEntity) string {
+	switch value := entity.Data.(type) {
+	case []byte:
+		if len(value) <= 20 {
+			if _, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+				return "int"
+			}
+		}
+		if len(value) <= EMBSTR_SIZE_LIMIT {
+			return "embstr"
+		}
+		return "raw"
+	case *list.List:
+		return value.Encoding()
+	case *hash.Hash, *set.Set:
+		return "hashtable"
+	case *sortedset.SortedSet:
+		return value.Encoding()
+	default:
+		return "unknown"
+	}
+}
+
+// applyEncodingConfig set the thresholds of the compact encodings, the values created before keep their encodings
+func applyEncodingConfig() {
+	cfg := config.GetEncodingConfig()
+	list.ListpackSize = cfg.ListMaxListpackSize
+	list.CompressDepth = cfg.ListCompressDepth
+	sortedset.MaxListpackEntries = cfg.ZsetMaxListpackEntries
+	sortedset.MaxListpackValue = cfg.ZsetMaxListpackValue
+}
+
+// helpReply is the lines of the HELP subcommands
+func helpReply(lines []string) redis.Reply {
+	replies := make([]redis.Reply, 0, len(lines))
+	for _, line := range lines {
+		replies = append(replies, protocol.NewStatusReply(line))
+	}
+	return protocol.NewMultiRawReply(replies)
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObject(t *testing.T) {
+	server := newEvictServer(POLICY_NO_EVICTION)
+	conn := newClientConn()
+	replyOf(server, conn, "SET", "int", "12345")
+	replyOf(server, conn, "SET", "embstr", "hello")
+	replyOf(server, conn, "SET", "raw", strings.Repeat("a", EMBSTR_SIZE_LIMIT+1))
+	replyOf(server, conn, "RPUSH", "list", "a")
+	replyOf(server, conn, "HSET", "hash", "f", "v")
+	replyOf(server, conn, "ZADD", "zset", "1", "m")
+	encodings := map[string]string{"int": "int", "embstr": "embstr", "raw": "raw", "list": "listpack",
+		"hash": "hashtable", "zset": "listpack"}
+	for key, encoding := range encodings {
+		if reply := replyOf(server, conn, "OBJECT", "ENCODING", key); reply != "$"+strconv.Itoa(len(encoding))+"\r\n"+encoding+"\r\n" {
+			t.Error("object encoding err: ", key, reply)
+		}
+	}
+	if reply := replyOf(server, conn, "OBJECT", "ENCODING", "missing"); reply != "$-1\r\n" {
+		t.Error("object encoding of missing key err: ", reply)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	// OBJECT never touches the key
+	replyOf(server, conn, "OBJECT", "IDLETIME", "int")
+	if reply := replyOf(server, conn, "OBJECT", "IDLETIME", "int"); reply != ":1\r\n" {
+		t.Error("object idletime err: ", reply)
+	}
+	replyOf(server, conn, "GET", "int")
+	if reply := replyOf(server, conn, "OBJECT", "IDLETIME", "int"); reply != ":0\r\n" {
+		t.Error("object idletime after access err: ", reply)
+	}
+	if reply := replyOf(server, conn, "OBJECT", "FREQ", "int"); reply != "-"+OBJECT_FREQ_ERR+"\r\n" {
+		t.Error("object freq without lfu err: ", reply)
+	}
+
+	server.evictor.policy = POLICY_ALLKEYS_LFU
+	if reply := replyOf(server, conn, "OBJECT", "FREQ", "embstr"); reply != ":"+strconv.Itoa(LFU_INIT_VAL)+"\r\n" {
+		t.Error("object freq of the new key err: ", reply)
+	}
+	replyOf(server, conn, "GET", "embstr")
+	if reply := replyOf(server, conn, "OBJECT", "FREQ", "embstr"); reply != ":"+strconv.Itoa(LFU_INIT_VAL+1)+"\r\n" {
+		t.Error("object freq after access err: ", reply)
+	}
+	if reply := replyOf(server, conn, "OBJECT", "IDLETIME", "embstr"); reply != "-"+OBJECT_IDLETIME_ERR+"\r\n" {
+		t.Error("object idletime with lfu err: ", reply)
+	}
+	if reply := replyOf(server, conn, "OBJECT", "REFCOUNT", "embstr"); reply != ":1\r\n" {
+		t.Error("object refcount err: ", reply)
+	}
+	if reply := replyOf(server, conn, "OBJECT", "FOO", "embstr"); reply != "-"+OBJECT_UNKNOWN_SUBCMD+"\r\n" {
+		t.Error("object unknown subcommand err: ", reply)
+	}
+	if reply := replyOf(server, conn, "OBJECT", "HELP"); !strings.HasPrefix(reply, "*"+strconv.Itoa(len(objectHelp))+"\r\n") {
+		t.Error("object help err: ", reply)
+	}
+}
+
+func TestObjectEncodingConversion(t *testing.T) {
+	server := newEvictServer(POLICY_NO_EVICTION)
+	conn := newClientConn()
+	encodingOf := func(key string) string {
+		return replyOf(server, conn, "OBJECT", "ENCODING", key)
+	}
+
+	replyOf(server, conn, "RPUSH", "list", "a", "b")
+	if reply := encodingOf("list"); reply != "$8\r\nlistpack\r\n" {
+		t.Error("small list encoding err: ", reply)
+	}
+	// -2 limits the listpack to 8kb
+	replyOf(server, conn, "RPUSH", "list", strings.Repeat("v", 8192))
+	if reply := encodingOf("list"); reply != "$9\r\nquicklist\r\n" {
+		t.Error("large list encoding err: ", reply)
+	}
+	if reply := replyOf(server, conn, "LINDEX", "list", "1"); reply != "$1\r\nb\r\n" {
+		t.Error("converted list err: ", reply)
+	}
+
+	for i := 0; i < 128; i++ {
+		replyOf(server, conn, "ZADD", "zset", strconv.Itoa(i), "m"+strconv.Itoa(i))
+	}
+	if reply := encodingOf("zset"); reply != "$8\r\nlistpack\r\n" {
+		t.Error("small zset encoding err: ", reply)
+	}
+	replyOf(server, conn, "ZADD", "zset", "128", "m128")
+	if reply := encodingOf("zset"); reply != "$8\r\nskiplist\r\n" {
+		t.Error("zset encoding over the entries err: ", reply)
+	}
+	if reply := replyOf(server, conn, "ZCARD", "zset"); reply != ":129\r\n" {
+		t.Error("converted zset err: ", reply)
+	}
+
+	replyOf(server, conn, "ZADD", "long", "1", strings.Repeat("m", 65))
+	if reply := encodingOf("long"); reply != "$8\r\nskiplist\r\n" {
+		t.Error("zset encoding over the value err: ", reply)
+	}
+}
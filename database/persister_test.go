@@ -2,13 +2,32 @@ package database
 
 import (
 	"github.com/xzwsloser/Go-redis/aof"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/lib/utils"
 	"github.com/xzwsloser/Go-redis/resp/connection"
 	"log"
+	"os"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
 
+// TestMain run the tests in a temporary directory, the aof, rdb and cluster files written by them are removed after
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "database-test")
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestPersister(t *testing.T) {
 	persister := aof.NewPersister()
 	db := NewDatabase(0)
@@ -80,3 +99,70 @@ func TestBgWriteAof(t *testing.T) {
 	server.Exec(connection.NewFakeConnection(), commands)
 	time.Sleep(time.Second)
 }
+
+func testRewrite(t *testing.T, useRdbPreamble bool) {
+	t.Chdir(t.TempDir())
+	persister := aof.NewPersister()
+	persister.UseRdbPreamble = useRdbPreamble
+	persister.SetTmpDBMaker(func() database.DBEngine {
+		return NewPureServer()
+	})
+	server := NewPureServer()
+	persister.BindRedisServer(server)
+	server.bindPersister(persister)
+
+	conn := connection.NewFakeConnection()
+	server.Exec(conn, utils.CmdLine1("SET", "k1", "v1"))
+	server.Exec(conn, utils.CmdLine1("SET", "k1", "v2"))
+	server.Exec(conn, utils.CmdLine1("SELECT", "3"))
+	server.Exec(conn, utils.CmdLine1("HSET", "h", "f", "v"))
+	server.Exec(conn, utils.CmdLine1("EXPIRE", "h", "100"))
+	if err := persister.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	// the commands after rewrite are appended to the snapshot
+	server.Exec(conn, utils.CmdLine1("SADD", "s", "m"))
+	server.Close()
+	// closing twice does nothing
+	server.Close()
+
+	content, err := os.ReadFile(config.GetAofConfig().AppendFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasPrefix(string(content), "REDIS") != useRdbPreamble {
+		t.Error("the preamble of the rewritten aof err")
+	}
+
+	loaded := NewPureServer()
+	loader := aof.NewPersister()
+	loader.BindRedisServer(loaded)
+	loader.LoadAof()
+	loader.Close()
+	check := connection.NewFakeConnection()
+	reply := loaded.Exec(check, utils.CmdLine1("GET", "k1"))
+	if string(reply.ToByte()) != "$2\r\nv2\r\n" {
+		t.Error("the string err: ", string(reply.ToByte()))
+	}
+	loaded.Exec(check, utils.CmdLine1("SELECT", "3"))
+	reply = loaded.Exec(check, utils.CmdLine1("HGET", "h", "f"))
+	if string(reply.ToByte()) != "$1\r\nv\r\n" {
+		t.Error("the hash err: ", string(reply.ToByte()))
+	}
+	reply = loaded.Exec(check, utils.CmdLine1("TTL", "h"))
+	if ttl, _ := strconv.Atoi(strings.Trim(string(reply.ToByte()), ":\r\n")); ttl < 90 || ttl > 100 {
+		t.Error("the ttl err: ", string(reply.ToByte()))
+	}
+	reply = loaded.Exec(check, utils.CmdLine1("SISMEMBER", "s", "m"))
+	if string(reply.ToByte()) != ":1\r\n" {
+		t.Error("the command after rewrite err: ", string(reply.ToByte()))
+	}
+}
+
+func TestRewriteWithRdbPreamble(t *testing.T) {
+	testRewrite(t, true)
+}
+
+func TestRewriteWithCommands(t *testing.T) {
+	testRewrite(t, false)
+}
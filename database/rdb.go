@@ -0,0 +1,283 @@
+package database
+
+import (
+	"bufio"
+	"github.com/xzwsloser/Go-redis/aof"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/rdb"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	SAVE
+	BGSAVE
+	LASTSAVE
+*/
+
+const (
+	DEFAULT_RDB_FILE_NAME  = "dump.rdb"
+	SAVE_CRON_INTERVAL     = time.Second
+	BGSAVE_IN_PROGRESS_ERR = "ERR Background save already in progress"
+	BGSAVE_STARTED         = "Background saving started"
+	RDB_SAVE_ERR           = "ERR failed to save the snapshot"
+)
+
+// saveRule is the rule of `save <seconds> <changes>`
+type saveRule struct {
+	seconds int64
+	changes int64
+}
+
+func parseSaveRules(rules []string) []saveRule {
+	result := make([]saveRule, 0, len(rules))
+	for _, rule := range rules {
+		fields := strings.Fields(rule)
+		if len(fields) != 2 {
+			logger.Warn("invalid save rule: %s", rule)
+			continue
+		}
+		seconds, err1 := strconv.ParseInt(fields[0], 10, 64)
+		changes, err2 := strconv.ParseInt(fields[1], 10, 64)
+		if err1 != nil || err2 != nil || seconds <= 0 || changes <= 0 {
+			logger.Warn("invalid save rule: %s", rule)
+			continue
+		}
+		result = append(result, saveRule{seconds: seconds, changes: changes})
+	}
+	return result
+}
+
+// initRdb read the config of rdb and start the goroutine to check the save rules
+func (server *RedisServer) initRdb() {
+	server.rdbFileName = config.GetRdbConfig().DBFileName
+	if server.rdbFileName == "" {
+		server.rdbFileName = DEFAULT_RDB_FILE_NAME
+	}
+	server.saveRules = parseSaveRules(config.GetRdbConfig().Save)
+	server.lastSave = time.Now().Unix()
+	server.closeChan = make(chan struct{})
+	if len(server.saveRules) > 0 {
+		go server.saveCron()
+	}
+}
+
+// bindDirtyCounter count the changes since the last save by the commands written into aof
+func (server *RedisServer) bindDirtyCounter() {
+	for i := 0; i < len(server.dbSet); i++ {
+		db := server.dbSet[i].Load().(*Database)
+		addAof := db.addAof
+		db.addAof = func(cmdLine [][]byte) {
+			atomic.AddInt64(&server.dirty, 1)
+			addAof(cmdLine)
+		}
+	}
+}
+
+func (server *RedisServer) saveCron() {
+	ticker := time.NewTicker(SAVE_CRON_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			dirty := atomic.LoadInt64(&server.dirty)
+			elapsed := time.Now().Unix() - atomic.LoadInt64(&server.lastSave)
+			for _, rule := range server.saveRules {
+				if dirty >= rule.changes && elapsed >= rule.seconds {
+					logger.Info("%d changes in %d seconds. Saving...", rule.changes, rule.seconds)
+					server.bgSave()
+					break
+				}
+			}
+		case <-server.closeChan:
+			return
+		}
+	}
+}
+
+// dumpRdb write the snapshot of all the databases into the writer, the shards are locked together only to
+// mark the beginning of the snapshot and onLocked is invoked at that moment when no command is executing
+func (server *RedisServer) dumpRdb(writer io.Writer, onLocked func()) (err error) {
+	// the databases keep one snapshot at a time
+	server.dumpMu.Lock()
+	defer server.dumpMu.Unlock()
+
+	dbs := make([]*Database, 0, len(server.dbSet))
+	for i := range server.dbSet {
+		db := server.mustSelectDB(i)
+		db.data.RLockAll()
+		dbs = append(dbs, db)
+	}
+	start := time.Now()
+	snapshots := make([]*dbSnapshot, len(dbs))
+	for i, db := range dbs {
+		// the empty database is not dumped, so nothing needs to be captured
+		if db.data.Len() > 0 {
+			snapshots[i] = newDBSnapshot(db, start)
+			db.snapshot.Store(snapshots[i])
+		}
+	}
+	if onLocked != nil {
+		onLocked()
+	}
+	for i := len(dbs) - 1; i >= 0; i-- {
+		dbs[i].data.RUnLockAll()
+	}
+	defer func() {
+		for _, db := range dbs {
+			db.snapshot.Store(nil)
+		}
+	}()
+
+	enc := rdb.NewEncoder(writer)
+	err = enc.WriteHeader(map[string]string{
+		"redis-ver":  "6.2.0",
+		"redis-bits": strconv.Itoa(strconv.IntSize),
+		"ctime":      strconv.FormatInt(start.Unix(), 10),
+	})
+	if err != nil {
+		return err
+	}
+	for i, db := range dbs {
+		if snapshots[i] == nil {
+			continue
+		}
+		if err = snapshots[i].dump(db, enc); err != nil {
+			return err
+		}
+	}
+	return enc.WriteEnd()
+}
+
+// saveRdb write the snapshot into the temp file and rename it to replace the old one
+func (server *RedisServer) saveRdb() (err error) {
+	start := time.Now()
+	atomic.StoreInt64(&server.stats.rdbSaveStart, start.UnixNano())
+	defer func() {
+		atomic.StoreInt64(&server.stats.rdbLastSaveNanos, int64(time.Since(start)))
+		if err != nil {
+			atomic.StoreInt32(&server.stats.rdbSaveFailed, 1)
+			return
+		}
+		atomic.StoreInt32(&server.stats.rdbSaveFailed, 0)
+		atomic.AddInt64(&server.stats.rdbSaves, 1)
+	}()
+
+	tmpFileName := server.rdbFileName + ".tmp"
+	file, err := os.OpenFile(tmpFileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	var dirty int64
+	writer := bufio.NewWriter(file)
+	err = server.dumpRdb(writer, func() {
+		dirty = atomic.LoadInt64(&server.dirty)
+	})
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpFileName)
+		return err
+	}
+	err = os.Rename(tmpFileName, server.rdbFileName)
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&server.dirty, -dirty)
+	atomic.StoreInt64(&server.lastSave, time.Now().Unix())
+	logger.Info("DB saved on disk")
+	return nil
+}
+
+// bgSave save the snapshot in another goroutine, return false if a save is in progress
+func (server *RedisServer) bgSave() bool {
+	if !atomic.CompareAndSwapInt32(&server.saving, 0, 1) {
+		return false
+	}
+	go func() {
+		defer atomic.StoreInt32(&server.saving, 0)
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error("err: %v", err)
+			}
+		}()
+		err := server.saveRdb()
+		if err != nil {
+			logger.Error("background saving err: %v", err)
+		}
+	}()
+	return true
+}
+
+// SAVE
+func (server *RedisServer) execSave() redis.Reply {
+	if !atomic.CompareAndSwapInt32(&server.saving, 0, 1) {
+		return protocol.NewErrReply(BGSAVE_IN_PROGRESS_ERR)
+	}
+	defer atomic.StoreInt32(&server.saving, 0)
+	err := server.saveRdb()
+	if err != nil {
+		logger.Error("saving err: %v", err)
+		return protocol.NewErrReply(RDB_SAVE_ERR)
+	}
+	return protocol.NewOkReply()
+}
+
+// BGSAVE
+func (server *RedisServer) execBgSave() redis.Reply {
+	if !server.bgSave() {
+		return protocol.NewErrReply(BGSAVE_IN_PROGRESS_ERR)
+	}
+	return protocol.NewStatusReply(BGSAVE_STARTED)
+}
+
+// LASTSAVE
+func (server *RedisServer) execLastSave() redis.Reply {
+	return protocol.NewIntReply(atomic.LoadInt64(&server.lastSave))
+}
+
+// loadRdb load the snapshot into the databases, the expired keys are skipped
+func (server *RedisServer) loadRdb() error {
+	file, err := os.Open(server.rdbFileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	dec := rdb.NewDecoder(bufio.NewReader(file))
+	return dec.Parse(func(dbIndex int, key string, entity *database.DataEntity, expireAt time.Time) bool {
+		server.LoadEntity(dbIndex, key, entity, expireAt)
+		return true
+	})
+}
+
+// syncAof write the data loaded from the snapshot into the empty aof file,
+// or the data will be lost when the aof file is loaded next time
+func (server *RedisServer) syncAof(persister *aof.Persister) {
+	for i := range server.dbSet {
+		db := server.mustSelectDB(i)
+		db.ForEach(func(key string, value *database.DataEntity) bool {
+			persister.SaveCmdLine(i, aof.EntityToCmd(key, value))
+			if ttlCmd := db.TTLCmd(key); ttlCmd != nil {
+				persister.SaveCmdLine(i, ttlCmd)
+			}
+			return true
+		})
+	}
+}
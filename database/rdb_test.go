@@ -0,0 +1,187 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/rdb"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseSaveRules(t *testing.T) {
+	rules := parseSaveRules([]string{"900 1", "300 10", "bad", "0 5", "60 x"})
+	if len(rules) != 2 || rules[0].seconds != 900 || rules[1].changes != 10 {
+		t.Error("parse save rules err: ", rules)
+	}
+}
+
+func TestSaveAndLoadRdb(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "dump.rdb")
+	server := NewPureServer()
+	server.rdbFileName = fileName
+	server.bindDirtyCounter()
+	conn := connection.NewFakeConnection()
+	server.Exec(conn, utils.CmdLine1("SET", "str", "v"))
+	server.Exec(conn, utils.CmdLine1("RPUSH", "list", "a", "b", "c"))
+	server.Exec(conn, utils.CmdLine1("HSET", "hash", "f", "v"))
+	server.Exec(conn, utils.CmdLine1("SADD", "set", "m1", "m2"))
+	server.Exec(conn, utils.CmdLine1("ZADD", "zset", "1.5", "m"))
+	server.Exec(conn, utils.CmdLine1("SET", "ttl", "v"))
+	server.Exec(conn, utils.CmdLine1("EXPIRE", "ttl", "100"))
+	server.Exec(conn, utils.CmdLine1("SET", "gone", "v"))
+	server.Exec(conn, utils.CmdLine1("PEXPIRE", "gone", "1"))
+	server.Exec(conn, utils.CmdLine1("SELECT", "2"))
+	server.Exec(conn, utils.CmdLine1("SET", "db2", "v"))
+	time.Sleep(10 * time.Millisecond)
+	// remove the expired key before saving
+	server.Exec(conn, utils.CmdLine1("SELECT", "0"))
+	server.Exec(conn, utils.CmdLine1("EXISTS", "gone"))
+
+	reply := server.Exec(conn, utils.CmdLine1("SAVE"))
+	if !protocol.IsOkReply(reply) {
+		t.Fatal("save err: ", string(reply.ToByte()))
+	}
+	if dirty := atomic.LoadInt64(&server.dirty); dirty != 0 {
+		t.Error("the dirty should be reset after save: ", dirty)
+	}
+	reply = server.Exec(conn, utils.CmdLine1("LASTSAVE"))
+	expected := ":" + strconv.FormatInt(time.Now().Unix(), 10) + "\r\n"
+	if string(reply.ToByte()) != expected {
+		t.Error("lastsave err: ", string(reply.ToByte()))
+	}
+
+	loaded := NewPureServer()
+	loaded.rdbFileName = fileName
+	if err := loaded.loadRdb(); err != nil {
+		t.Fatal(err)
+	}
+	check := connection.NewFakeConnection()
+	cases := []struct {
+		cmdLine  [][]byte
+		expected string
+	}{
+		{utils.CmdLine1("GET", "str"), "$1\r\nv\r\n"},
+		{utils.CmdLine1("LLEN", "list"), ":3\r\n"},
+		{utils.CmdLine1("LINDEX", "list", "2"), "$1\r\nc\r\n"},
+		{utils.CmdLine1("HGET", "hash", "f"), "$1\r\nv\r\n"},
+		{utils.CmdLine1("SCARD", "set"), ":2\r\n"},
+		{utils.CmdLine1("ZSCORE", "zset", "m"), "$3\r\n1.5\r\n"},
+		{utils.CmdLine1("EXISTS", "gone"), ":0\r\n"},
+		{utils.CmdLine1("TYPE", "db2"), "+none\r\n"},
+	}
+	for _, c := range cases {
+		reply := loaded.Exec(check, c.cmdLine)
+		if string(reply.ToByte()) != c.expected {
+			t.Error(string(c.cmdLine[0]), " err: ", string(reply.ToByte()))
+		}
+	}
+	ttl, _ := strconv.Atoi(strings.Trim(string(loaded.Exec(check, utils.CmdLine1("TTL", "ttl")).ToByte()), ":\r\n"))
+	if ttl < 90 || ttl > 100 {
+		t.Error("the ttl should be kept: ", ttl)
+	}
+	loaded.Exec(check, utils.CmdLine1("SELECT", "2"))
+	reply = loaded.Exec(check, utils.CmdLine1("GET", "db2"))
+	if string(reply.ToByte()) != "$1\r\nv\r\n" {
+		t.Error("the key of db 2 err: ", string(reply.ToByte()))
+	}
+}
+
+func TestBgSave(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "dump.rdb")
+	server := NewPureServer()
+	server.rdbFileName = fileName
+	conn := connection.NewFakeConnection()
+	for i := 0; i < 1000; i++ {
+		server.Exec(conn, utils.CmdLine1("SET", "k"+strconv.Itoa(i), strconv.Itoa(i)))
+	}
+
+	reply := server.Exec(conn, utils.CmdLine1("BGSAVE"))
+	if string(reply.ToByte()) != "+"+BGSAVE_STARTED+"\r\n" {
+		t.Fatal("bgsave err: ", string(reply.ToByte()))
+	}
+	// the writes during the background saving should not block forever
+	server.Exec(conn, utils.CmdLine1("SET", "k0", "new"))
+	for i := 0; i < 100 && atomic.LoadInt32(&server.saving) == 1; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	loaded := NewPureServer()
+	loaded.rdbFileName = fileName
+	if err := loaded.loadRdb(); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.mustSelectDB(0).data.Len() != 1000 {
+		t.Error("the keys of the snapshot err: ", loaded.mustSelectDB(0).data.Len())
+	}
+}
+
+func TestSnapshotCapture(t *testing.T) {
+	server := NewPureServer()
+	conn := connection.NewFakeConnection()
+	server.Exec(conn, utils.CmdLine1("SET", "counter", "1"))
+	server.Exec(conn, utils.CmdLine1("SET", "deleted", "v"))
+	server.Exec(conn, utils.CmdLine1("RPUSH", "list", "a", "b"))
+	server.Exec(conn, utils.CmdLine1("SET", "ttl", "v"))
+	server.Exec(conn, utils.CmdLine1("SET", "loaded", "old"))
+
+	// the writes after the snapshot begins are captured and not seen by the dump
+	db := server.mustSelectDB(0)
+	snap := newDBSnapshot(db, time.Now())
+	db.snapshot.Store(snap)
+	server.Exec(conn, utils.CmdLine1("INCR", "counter"))
+	server.Exec(conn, utils.CmdLine1("DEL", "deleted"))
+	server.Exec(conn, utils.CmdLine1("RPUSH", "list", "c"))
+	server.Exec(conn, utils.CmdLine1("SET", "created", "v"))
+	server.Exec(conn, utils.CmdLine1("EXPIRE", "ttl", "100"))
+	server.LoadEntity(0, "loaded", &database.DataEntity{Data: []byte("new")}, time.Time{})
+
+	buf := &bytes.Buffer{}
+	enc := rdb.NewEncoder(buf)
+	if err := enc.WriteHeader(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.dump(db, enc); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+	db.snapshot.Store(nil)
+
+	loaded := NewPureServer()
+	err := rdb.NewDecoder(bufio.NewReader(buf)).Parse(func(dbIndex int, key string, entity *database.DataEntity, expireAt time.Time) bool {
+		loaded.LoadEntity(dbIndex, key, entity, expireAt)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := connection.NewFakeConnection()
+	cases := []struct {
+		cmdLine  [][]byte
+		expected string
+	}{
+		{utils.CmdLine1("GET", "counter"), "$1\r\n1\r\n"},
+		{utils.CmdLine1("EXISTS", "deleted"), ":1\r\n"},
+		{utils.CmdLine1("LLEN", "list"), ":2\r\n"},
+		{utils.CmdLine1("EXISTS", "created"), ":0\r\n"},
+		{utils.CmdLine1("TTL", "ttl"), ":-1\r\n"},
+		{utils.CmdLine1("GET", "loaded"), "$3\r\nold\r\n"},
+	}
+	for _, c := range cases {
+		if reply := string(loaded.Exec(check, c.cmdLine).ToByte()); reply != c.expected {
+			t.Error(string(c.cmdLine[0]), " of the snapshot err: ", reply)
+		}
+	}
+	if reply := string(server.Exec(conn, utils.CmdLine1("GET", "counter")).ToByte()); reply != "$1\r\n2\r\n" {
+		t.Error("the write should be applied to the database: ", reply)
+	}
+}
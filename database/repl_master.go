@@ -0,0 +1,275 @@
+package database
+
+import (
+	"bufio"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	REPLICA_HANDSHAKE = iota
+	REPLICA_WAIT_BGSAVE
+	REPLICA_ONLINE
+)
+
+const (
+	REPLICA_SEND_QUEUE_SIZE = 1 << 12
+	PSYNC_IN_REPLICA_ERR    = "ERR PSYNC is not supported by the replica"
+	REPLCONF_OPTION_ERR     = "ERR Unrecognized REPLCONF option"
+)
+
+// replicaInfo is the replica connected to the master
+type replicaInfo struct {
+	conn          redis.Conn
+	state         int
+	listeningPort int
+	ackOffset     int64
+	// pending is the write stream during the full sync
+	pending  []byte
+	sendChan chan []byte
+	closed   bool
+}
+
+// send the data to the replica, repl.mu must be locked
+func (replica *replicaInfo) send(data []byte) {
+	if replica.closed {
+		return
+	}
+	switch replica.state {
+	case REPLICA_WAIT_BGSAVE:
+		replica.pending = append(replica.pending, data...)
+	case REPLICA_ONLINE:
+		select {
+		case replica.sendChan <- data:
+		default:
+			// the replica is too slow, it will resync after reconnecting
+			logger.Warn("the send queue of replica %s is full, close it", replica.conn.RemoteAddr())
+			replica.close()
+		}
+	}
+}
+
+// online start the goroutine to write the stream to the replica, repl.mu must be locked
+func (replica *replicaInfo) online() {
+	replica.state = REPLICA_ONLINE
+	replica.sendChan = make(chan []byte, REPLICA_SEND_QUEUE_SIZE)
+	go func(ch <-chan []byte) {
+		for data := range ch {
+			_, err := replica.conn.Write(data)
+			if err != nil {
+				logger.Error("write to replica err: %v", err)
+				_ = replica.conn.Close()
+				for range ch {
+				}
+				return
+			}
+		}
+	}(replica.sendChan)
+}
+
+// close the connection of the replica, repl.mu must be locked
+func (replica *replicaInfo) close() {
+	if replica.closed {
+		return
+	}
+	replica.closed = true
+	if replica.sendChan != nil {
+		close(replica.sendChan)
+	}
+	go func() {
+		_ = replica.conn.Close()
+	}()
+}
+
+func (repl *replication) getOrAddReplica(conn redis.Conn) *replicaInfo {
+	replica, ok := repl.replicas[conn]
+	if !ok {
+		replica = &replicaInfo{
+			conn:  conn,
+			state: REPLICA_HANDSHAKE,
+		}
+		repl.replicas[conn] = replica
+	}
+	return replica
+}
+
+// hasReplica judge whether the connection is a replica attached to the master
+func (repl *replication) hasReplica(conn redis.Conn) bool {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	_, ok := repl.replicas[conn]
+	return ok
+}
+
+func (repl *replication) removeReplica(conn redis.Conn) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	replica, ok := repl.replicas[conn]
+	if !ok {
+		return
+	}
+	replica.close()
+	delete(repl.replicas, conn)
+}
+
+// canPartialSync judge whether the stream after the offset is in the backlog, repl.mu must be locked
+func (repl *replication) canPartialSync(replID string, psyncOffset int64) bool {
+	if repl.backlog == nil {
+		return false
+	}
+	if replID != repl.replID && (replID != repl.replID2 || psyncOffset > repl.secondOffset) {
+		return false
+	}
+	_, ok := repl.backlog.readFrom(psyncOffset - 1)
+	return ok
+}
+
+// PSYNC replicationid offset, the offset is the next byte the replica wants
+func (server *RedisServer) execPSync(conn redis.Conn, args [][]byte) redis.Reply {
+	repl := server.repl
+	if repl == nil {
+		return protocol.NewErrReply(REPL_DISABLED_ERR)
+	}
+	if len(args) != 2 {
+		return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+	}
+	replID := string(args[0])
+	psyncOffset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		psyncOffset = -1
+	}
+
+	repl.mu.Lock()
+	if repl.role != ROLE_MASTER {
+		repl.mu.Unlock()
+		return protocol.NewErrReply(PSYNC_IN_REPLICA_ERR)
+	}
+	if repl.backlog == nil {
+		repl.backlog = newReplBacklog(repl.backlogSize, repl.offset)
+		atomic.StoreInt32(&repl.streaming, 1)
+	}
+	if repl.canPartialSync(replID, psyncOffset) {
+		data, _ := repl.backlog.readFrom(psyncOffset - 1)
+		replica := repl.getOrAddReplica(conn)
+		replica.online()
+		replica.send([]byte("+CONTINUE " + repl.replID + protocol.CRLF))
+		replica.send(data)
+		repl.mu.Unlock()
+		logger.Info("partial resync with replica %s from offset %d", conn.RemoteAddr(), psyncOffset)
+		return protocol.NewNoReply()
+	}
+	repl.mu.Unlock()
+
+	server.fullSync(conn)
+	return protocol.NewNoReply()
+}
+
+// fullSync send the snapshot and the offset of it, then the stream after the snapshot. the snapshot is
+// written into a temp file first like the disk-based sync of redis, the stream is kept in the pending
+// of the replica until the snapshot is sent
+func (server *RedisServer) fullSync(conn redis.Conn) {
+	repl := server.repl
+	var replica *replicaInfo
+	var replID string
+	var offset int64
+	file, err := os.CreateTemp(filepath.Dir(server.rdbFileName), "temp-repl-*.rdb")
+	if err == nil {
+		defer func() {
+			_ = file.Close()
+			_ = os.Remove(file.Name())
+		}()
+		writer := bufio.NewWriter(file)
+		err = server.dumpRdb(writer, func() {
+			repl.mu.Lock()
+			defer repl.mu.Unlock()
+			replica = repl.getOrAddReplica(conn)
+			replica.state = REPLICA_WAIT_BGSAVE
+			replica.pending = nil
+			replID = repl.replID
+			offset = repl.offset
+			// the replica starts in db 0, so the stream after the snapshot should begin with SELECT
+			repl.streamDB = -1
+		})
+		if err == nil {
+			err = writer.Flush()
+		}
+	}
+	var size int64
+	if err == nil {
+		size, err = file.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err == nil {
+		header := "+FULLRESYNC " + replID + " " + strconv.FormatInt(offset, 10) + protocol.CRLF +
+			"$" + strconv.FormatInt(size, 10) + protocol.CRLF
+		_, err = conn.Write([]byte(header))
+	}
+	if err == nil {
+		_, err = io.Copy(conn, file)
+	}
+
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if replica == nil {
+		replica = repl.getOrAddReplica(conn)
+	}
+	if err != nil {
+		logger.Error("full resync err: %v", err)
+		replica.close()
+		return
+	}
+	// the replica may be disconnected while the snapshot is sent
+	if replica.closed {
+		return
+	}
+	pending := replica.pending
+	replica.pending = nil
+	replica.online()
+	if len(pending) > 0 {
+		replica.send(pending)
+	}
+	logger.Info("full resync with replica %s at offset %d", conn.RemoteAddr(), offset)
+}
+
+// REPLCONF option value [option value ...]
+func (server *RedisServer) execReplConf(conn redis.Conn, args [][]byte) redis.Reply {
+	repl := server.repl
+	if repl == nil {
+		return protocol.NewErrReply(REPL_DISABLED_ERR)
+	}
+	if len(args)%2 != 0 {
+		return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+	}
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+			}
+			repl.getOrAddReplica(conn).listeningPort = port
+		case "ack":
+			// no reply for the ack of the replica
+			if replica, ok := repl.replicas[conn]; ok {
+				replica.ackOffset, _ = strconv.ParseInt(value, 10, 64)
+			}
+			return protocol.NewNoReply()
+		case "capa", "ip-address", "getack":
+		default:
+			return protocol.NewErrReply(REPLCONF_OPTION_ERR)
+		}
+	}
+	return protocol.NewOkReply()
+}
@@ -0,0 +1,355 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"github.com/xzwsloser/Go-redis/aof"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/rdb"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/parse"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	LINK_CONNECT    = "connect"
+	LINK_CONNECTING = "connecting"
+	LINK_SYNC       = "sync"
+	LINK_CONNECTED  = "connected"
+)
+
+const (
+	REPL_DIAL_TIMEOUT   = 5 * time.Second
+	REPL_RETRY_INTERVAL = time.Second
+	REPL_ACK_INTERVAL   = time.Second
+	INVALID_MASTER_PORT = "ERR Invalid master port"
+)
+
+var errLostMaster = errors.New("lost the connection with master")
+
+// REPLICAOF host port | NO ONE
+func (server *RedisServer) execReplicaOf(args [][]byte) redis.Reply {
+	if server.repl == nil {
+		return protocol.NewErrReply(REPL_DISABLED_ERR)
+	}
+	if len(args) != 2 {
+		return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+	}
+	if strings.EqualFold(string(args[0]), "no") && strings.EqualFold(string(args[1]), "one") {
+		server.repl.promote()
+		return protocol.NewOkReply()
+	}
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.NewErrReply(INVALID_MASTER_PORT)
+	}
+	server.replicaOf(string(args[0]), port)
+	return protocol.NewOkReply()
+}
+
+// replicaOf stop the current link and start to replicate the new master
+func (server *RedisServer) replicaOf(host string, port int) {
+	repl := server.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role == ROLE_REPLICA && repl.masterHost == host && repl.masterPort == port {
+		return
+	}
+	if repl.cancelLink != nil {
+		repl.cancelLink()
+	}
+	// the replicas of this server should sync again
+	for _, replica := range repl.replicas {
+		replica.close()
+	}
+	repl.role = ROLE_REPLICA
+	atomic.StoreInt32(&repl.readOnly, 1)
+	atomic.StoreInt32(&repl.streaming, 0)
+	repl.masterHost = host
+	repl.masterPort = port
+	repl.linkState = LINK_CONNECT
+	ctx, cancel := context.WithCancel(context.Background())
+	repl.cancelLink = cancel
+	go server.replicaLoop(ctx, net.JoinHostPort(host, strconv.Itoa(port)))
+	logger.Info("start to replicate the master %s:%d", host, port)
+}
+
+// promote stop replicating and turn into a master, the old replication id is kept as replID2
+// so that the other replicas of the old master could continue with partial resync
+func (repl *replication) promote() {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role == ROLE_MASTER {
+		return
+	}
+	if repl.cancelLink != nil {
+		repl.cancelLink()
+		repl.cancelLink = nil
+	}
+	repl.role = ROLE_MASTER
+	atomic.StoreInt32(&repl.readOnly, 0)
+	if repl.backlog != nil {
+		atomic.StoreInt32(&repl.streaming, 1)
+	}
+	repl.masterHost = ""
+	repl.masterPort = 0
+	repl.replID2 = repl.replID
+	repl.secondOffset = repl.offset + 1
+	repl.replID = newReplID()
+	repl.streamDB = -1
+	logger.Info("turn into master, the new replication id: %s", repl.replID)
+}
+
+func (repl *replication) setLinkState(state string) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	repl.linkState = state
+}
+
+func (server *RedisServer) stopReplication() {
+	repl := server.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.cancelLink != nil {
+		repl.cancelLink()
+		repl.cancelLink = nil
+	}
+}
+
+// replicaLoop keep the link with master until the context is canceled
+func (server *RedisServer) replicaLoop(ctx context.Context, addr string) {
+	for {
+		err := server.syncWithMaster(ctx, addr)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("replicate master %s err: %v", addr, err)
+		server.repl.setLinkState(LINK_CONNECT)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(REPL_RETRY_INTERVAL):
+		}
+	}
+}
+
+// sendCommand send the command and read one line of reply
+func sendCommand(conn net.Conn, reader *bufio.Reader, args ...string) (string, error) {
+	_, err := conn.Write(protocol.NewMultiReply(utils.CmdLine1(args[0], args[1:]...)).ToByte())
+	if err != nil {
+		return "", err
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, protocol.CRLF)
+	if strings.HasPrefix(line, "-") {
+		return "", errors.New(line[1:])
+	}
+	return line, nil
+}
+
+// masterAuthCmd get the AUTH command to the master by MasterUser and MasterAuth, nil if no password
+func masterAuthCmd() [][]byte {
+	replConfig := config.GetReplicationConfig()
+	if replConfig.MasterAuth == "" {
+		return nil
+	}
+	if replConfig.MasterUser == "" {
+		return utils.CmdLine1("AUTH", replConfig.MasterAuth)
+	}
+	return utils.CmdLine1("AUTH", replConfig.MasterUser, replConfig.MasterAuth)
+}
+
+// syncWithMaster do the handshake and the psync, then apply the write stream of master
+func (server *RedisServer) syncWithMaster(ctx context.Context, addr string) error {
+	repl := server.repl
+	dialer := net.Dialer{Timeout: REPL_DIAL_TIMEOUT}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer stop()
+	repl.setLinkState(LINK_CONNECTING)
+
+	reader := bufio.NewReader(conn)
+	if auth := masterAuthCmd(); auth != nil {
+		if _, err = sendCommand(conn, reader, bytesToString(auth)...); err != nil {
+			return err
+		}
+	}
+	if _, err = sendCommand(conn, reader, "PING"); err != nil {
+		return err
+	}
+	port := strconv.Itoa(config.GetRedisServerConfig().Port)
+	if _, err = sendCommand(conn, reader, "REPLCONF", "listening-port", port); err != nil {
+		return err
+	}
+	if _, err = sendCommand(conn, reader, "REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+
+	repl.mu.Lock()
+	replID, psyncOffset := "?", "-1"
+	if repl.backlog != nil {
+		replID, psyncOffset = repl.replID, strconv.FormatInt(repl.offset+1, 10)
+	}
+	repl.mu.Unlock()
+	line, err := sendCommand(conn, reader, "PSYNC", replID, psyncOffset)
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return errors.New("empty reply of psync")
+	}
+	switch {
+	case fields[0] == "+FULLRESYNC" && len(fields) == 3:
+		repl.setLinkState(LINK_SYNC)
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return err
+		}
+		err = server.readSnapshot(reader)
+		if err != nil {
+			return err
+		}
+		repl.mu.Lock()
+		repl.replID = fields[1]
+		repl.offset = offset
+		repl.backlog = newReplBacklog(repl.backlogSize, offset)
+		repl.mu.Unlock()
+		logger.Info("full resync with master %s at offset %d", addr, offset)
+	case fields[0] == "+CONTINUE":
+		repl.mu.Lock()
+		if len(fields) == 2 && fields[1] != repl.replID {
+			repl.replID2 = repl.replID
+			repl.secondOffset = repl.offset + 1
+			repl.replID = fields[1]
+		}
+		repl.mu.Unlock()
+		logger.Info("partial resync with master %s", addr)
+	default:
+		return errors.New("unexpected reply of psync: " + line)
+	}
+	repl.setLinkState(LINK_CONNECTED)
+
+	go server.sendAck(ctx, conn)
+	return server.applyStream(reader)
+}
+
+// readSnapshot read the snapshot of $<length>\r\n<payload> and replace all the data
+func (server *RedisServer) readSnapshot(reader *bufio.Reader) error {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return errors.New("unexpected snapshot header: " + line)
+	}
+	length, err := strconv.Atoi(strings.TrimSuffix(line[1:], protocol.CRLF))
+	if err != nil {
+		return err
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return err
+	}
+
+	for i := range server.dbSet {
+		server.mustSelectDB(i).flush()
+	}
+	dec := rdb.NewDecoder(bytes.NewReader(payload))
+	return dec.Parse(func(dbIndex int, key string, entity *database.DataEntity, expireAt time.Time) bool {
+		server.LoadEntity(dbIndex, key, entity, expireAt)
+		if db, err := server.selectDB(dbIndex); err == nil {
+			db.addAof(aof.EntityToCmd(key, entity))
+			if !expireAt.IsZero() {
+				db.addAof(utils.ExpireCmd(key, expireAt))
+			}
+		}
+		return true
+	})
+}
+
+// applyStream execute the commands from master and record the offset
+func (server *RedisServer) applyStream(reader *bufio.Reader) error {
+	repl := server.repl
+	fake := connection.NewFakeConnection()
+	for payLoad := range parse.ParseStream(reader) {
+		if payLoad.Error != nil {
+			logger.Error("parse the stream of master err: %v", payLoad.Error)
+			continue
+		}
+		request, ok := payLoad.Data.(*protocol.MulitBulkReply)
+		if !ok {
+			continue
+		}
+		server.execFromMaster(fake, request.Args)
+		repl.mu.Lock()
+		repl.feedRaw(request.ToByte())
+		repl.mu.Unlock()
+	}
+	return errLostMaster
+}
+
+func (server *RedisServer) execFromMaster(fake *connection.FakeConnection, cmdLine [][]byte) {
+	if strings.ToLower(string(cmdLine[0])) == "select" {
+		if len(cmdLine) == 2 {
+			index, err := strconv.Atoi(string(cmdLine[1]))
+			if err == nil {
+				fake.SelectDB(index)
+			}
+		}
+		return
+	}
+	db, err := server.selectDB(fake.GetDBIndex())
+	if err != nil {
+		logger.Error("exec the command of master err: %v", err)
+		return
+	}
+	reply := db.Exec(fake, cmdLine)
+	if protocol.IsErrReply(reply) {
+		logger.Warn("exec the command of master err: %s", string(reply.ToByte()))
+	}
+}
+
+// sendAck report the offset to master every second
+func (server *RedisServer) sendAck(ctx context.Context, conn net.Conn) {
+	ticker := time.NewTicker(REPL_ACK_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			server.repl.mu.Lock()
+			offset := server.repl.offset
+			server.repl.mu.Unlock()
+			ack := utils.CmdLine1("REPLCONF", "ACK", strconv.FormatInt(offset, 10))
+			_, err := conn.Write(protocol.NewMultiReply(ack).ToByte())
+			if err != nil {
+				return
+			}
+		}
+	}
+}
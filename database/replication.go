@@ -0,0 +1,215 @@
+package database
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	REPLICAOF host port | NO ONE
+	SLAVEOF host port | NO ONE
+	PSYNC replicationid offset
+	REPLCONF option value [option value ...]
+	ROLE
+*/
+
+const (
+	ROLE_MASTER  = "master"
+	ROLE_REPLICA = "slave"
+)
+
+const (
+	DEFAULT_BACKLOG_SIZE = 1 << 20
+	REPL_ID_LEN          = 40
+	READONLY_ERR         = "READONLY You can't write against a read only replica."
+	REPL_DISABLED_ERR    = "ERR replication is not enabled"
+)
+
+// replBacklog is the ring buffer of the latest write stream for the partial resync
+type replBacklog struct {
+	buf []byte
+	// histLen is the length of the valid data in buf
+	histLen int
+	// idx is the position in buf to write next
+	idx int
+	// endOffset is the replication offset after the last byte in buf
+	endOffset int64
+}
+
+func newReplBacklog(size int, offset int64) *replBacklog {
+	if size <= 0 {
+		size = DEFAULT_BACKLOG_SIZE
+	}
+	return &replBacklog{
+		buf:       make([]byte, size),
+		endOffset: offset,
+	}
+}
+
+func (b *replBacklog) write(p []byte) {
+	b.endOffset += int64(len(p))
+	// only the tail of the data can be kept
+	if len(p) > len(b.buf) {
+		p = p[len(p)-len(b.buf):]
+	}
+	for len(p) > 0 {
+		n := copy(b.buf[b.idx:], p)
+		p = p[n:]
+		b.idx = (b.idx + n) % len(b.buf)
+		b.histLen = min(b.histLen+n, len(b.buf))
+	}
+}
+
+// readFrom read the data after the offset, return false if the data is not in the backlog
+func (b *replBacklog) readFrom(offset int64) ([]byte, bool) {
+	if offset < b.endOffset-int64(b.histLen) || offset > b.endOffset {
+		return nil, false
+	}
+	n := int(b.endOffset - offset)
+	start := (b.idx - n + len(b.buf)) % len(b.buf)
+	result := make([]byte, 0, n)
+	if start+n <= len(b.buf) {
+		return append(result, b.buf[start:start+n]...), true
+	}
+	result = append(result, b.buf[start:]...)
+	return append(result, b.buf[:n-(len(b.buf)-start)]...), true
+}
+
+// replication is the replication state of the server, the server is a master or a replica
+type replication struct {
+	mu   sync.Mutex
+	role string
+	// replID is the id of the write stream, replID2 and secondOffset is
+	// the id of the former master and the offset the stream switched
+	replID       string
+	replID2      string
+	secondOffset int64
+	// offset is the total bytes of the write stream, which is also the offset processed by the replica
+	offset      int64
+	backlog     *replBacklog
+	backlogSize int
+	// streamDB is the db index of the last command in the write stream
+	streamDB int
+	// readOnly is 1 when the server is a replica, streaming is 1 when
+	// the master has created the backlog, they are read without the lock
+	readOnly  int32
+	streaming int32
+	replicas  map[redis.Conn]*replicaInfo
+
+	// the state of the replica
+	masterHost string
+	masterPort int
+	linkState  string
+	cancelLink func()
+}
+
+func newReplication() *replication {
+	backlogSize := config.GetReplicationConfig().BacklogSize
+	if backlogSize <= 0 {
+		backlogSize = DEFAULT_BACKLOG_SIZE
+	}
+	return &replication{
+		role:        ROLE_MASTER,
+		replID:      newReplID(),
+		backlogSize: backlogSize,
+		streamDB:    -1,
+		replicas:    make(map[redis.Conn]*replicaInfo),
+	}
+}
+
+func newReplID() string {
+	buf := make([]byte, REPL_ID_LEN/2)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func (repl *replication) isReplica() bool {
+	return atomic.LoadInt32(&repl.readOnly) == 1
+}
+
+// bindReplication feed the commands written into aof to the replicas
+func (server *RedisServer) bindReplication() {
+	for i := 0; i < len(server.dbSet); i++ {
+		db := server.dbSet[i].Load().(*Database)
+		addAof := db.addAof
+		db.addAof = func(cmdLine [][]byte) {
+			server.repl.feed(db.index, cmdLine)
+			addAof(cmdLine)
+		}
+	}
+}
+
+// feed append the command of master into the write stream
+func (repl *replication) feed(dbIndex int, cmdLine [][]byte) {
+	if atomic.LoadInt32(&repl.streaming) == 0 {
+		return
+	}
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	// the stream is not needed until the first replica connects
+	if repl.role != ROLE_MASTER || repl.backlog == nil {
+		return
+	}
+	if dbIndex != repl.streamDB {
+		selectCmd := utils.CmdLine1("SELECT", strconv.Itoa(dbIndex))
+		repl.feedRaw(protocol.NewMultiReply(selectCmd).ToByte())
+		repl.streamDB = dbIndex
+	}
+	repl.feedRaw(protocol.NewMultiReply(cmdLine).ToByte())
+}
+
+// feedRaw write the data into the backlog and send it to the replicas, repl.mu must be locked
+func (repl *replication) feedRaw(data []byte) {
+	repl.offset += int64(len(data))
+	if repl.backlog != nil {
+		repl.backlog.write(data)
+	}
+	for _, replica := range repl.replicas {
+		replica.send(data)
+	}
+}
+
+// ROLE
+func (server *RedisServer) execRole() redis.Reply {
+	repl := server.repl
+	if repl == nil {
+		return protocol.NewErrReply(REPL_DISABLED_ERR)
+	}
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role == ROLE_REPLICA {
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(ROLE_REPLICA)),
+			protocol.NewBulkReply([]byte(repl.masterHost)),
+			protocol.NewIntReply(int64(repl.masterPort)),
+			protocol.NewBulkReply([]byte(repl.linkState)),
+			protocol.NewIntReply(repl.offset),
+		})
+	}
+
+	replicas := make([]redis.Reply, 0, len(repl.replicas))
+	for _, replica := range repl.replicas {
+		if replica.state != REPLICA_ONLINE {
+			continue
+		}
+		host, _, _ := net.SplitHostPort(replica.conn.RemoteAddr())
+		replicas = append(replicas, protocol.NewMultiReply([][]byte{
+			[]byte(host),
+			[]byte(strconv.Itoa(replica.listeningPort)),
+			[]byte(strconv.FormatInt(replica.ackOffset, 10)),
+		}))
+	}
+	return protocol.NewMultiRawReply([]redis.Reply{
+		protocol.NewBulkReply([]byte(ROLE_MASTER)),
+		protocol.NewIntReply(repl.offset),
+		protocol.NewMultiRawReply(replicas),
+	})
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"context"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/pub"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/parse"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplBacklog(t *testing.T) {
+	backlog := newReplBacklog(8, 100)
+	backlog.write([]byte("abcde"))
+	data, ok := backlog.readFrom(101)
+	if !ok || string(data) != "bcde" {
+		t.Error("read backlog err: ", string(data))
+	}
+	// wrap around and drop the oldest data
+	backlog.write([]byte("fghij"))
+	if _, ok = backlog.readFrom(101); ok {
+		t.Error("the dropped data should not be read")
+	}
+	data, ok = backlog.readFrom(102)
+	if !ok || string(data) != "cdefghij" {
+		t.Error("read backlog after wrap err: ", string(data))
+	}
+	data, ok = backlog.readFrom(110)
+	if !ok || len(data) != 0 {
+		t.Error("read backlog at the end err: ", string(data))
+	}
+	if _, ok = backlog.readFrom(111); ok {
+		t.Error("the future offset should not be read")
+	}
+}
+
+// newReplServer create the server with replication and serve it on a random port
+func newReplServer(t *testing.T) (*RedisServer, string, int) {
+	server := NewPureServer()
+	server.hub = pub.NewHub()
+	server.repl = newReplication()
+	server.bindReplication()
+	listener, host, port := newTestListener(t)
+	serveListener(t, server, listener)
+	return server, host, port
+}
+
+func newTestListener(t *testing.T) (net.Listener, string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	return listener, addr.IP.String(), addr.Port
+}
+
+// serveListener serve the server on the listener until the test finishes
+func serveListener(t *testing.T, server *RedisServer, listener net.Listener) {
+	t.Cleanup(func() {
+		_ = listener.Close()
+		server.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				client := connection.NewConnection(conn)
+				server.AfterClientConnect(client)
+				for payLoad := range parse.ParseStream(conn) {
+					request, ok := payLoad.Data.(*protocol.MulitBulkReply)
+					if payLoad.Error != nil || !ok {
+						continue
+					}
+					reply := server.Exec(client, request.Args)
+					_, _ = client.Write(protocol.Marshal(reply, client.GetProtocol()))
+				}
+				_ = client.Close()
+				server.AfterClientClose(client)
+			}()
+		}
+	}()
+}
+
+func waitFor(t *testing.T, msg string, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("timeout: ", msg)
+}
+
+func linkStateOf(server *RedisServer) string {
+	server.repl.mu.Lock()
+	defer server.repl.mu.Unlock()
+	return server.repl.linkState
+}
+
+func replyOf(server *RedisServer, conn *connection.FakeConnection, args ...string) string {
+	reply := server.Exec(conn, utils.CmdLine1(args[0], args[1:]...))
+	return string(protocol.Marshal(reply, conn.GetProtocol()))
+}
+
+func TestReplication(t *testing.T) {
+	master, host, port := newReplServer(t)
+	replica, _, _ := newReplServer(t)
+	mc := connection.NewFakeConnection()
+	rc := connection.NewFakeConnection()
+
+	// the data before the replica connects is sent by the snapshot
+	replyOf(master, mc, "SET", "k1", "v1")
+	replyOf(master, mc, "SELECT", "2")
+	replyOf(master, mc, "HSET", "h", "f", "v")
+	replyOf(replica, rc, "SET", "stale", "v")
+
+	reply := replyOf(replica, rc, "REPLICAOF", host, strconv.Itoa(port))
+	if reply != "+OK\r\n" {
+		t.Fatal("replicaof err: ", reply)
+	}
+	waitFor(t, "full sync", func() bool {
+		return linkStateOf(replica) == LINK_CONNECTED
+	})
+	if replyOf(replica, rc, "EXISTS", "stale") != ":0\r\n" {
+		t.Error("the stale data should be removed by the full sync")
+	}
+	replyOf(replica, rc, "SELECT", "2")
+	if reply = replyOf(replica, rc, "HGET", "h", "f"); reply != "$1\r\nv\r\n" {
+		t.Error("the snapshot of db 2 err: ", reply)
+	}
+
+	// the write stream after the snapshot
+	replyOf(master, mc, "SADD", "s", "m")
+	replyOf(master, mc, "SELECT", "0")
+	replyOf(master, mc, "SET", "k2", "v2")
+	waitFor(t, "stream", func() bool {
+		return replyOf(replica, rc, "SISMEMBER", "s", "m") == ":1\r\n"
+	})
+	replyOf(replica, rc, "SELECT", "0")
+	waitFor(t, "stream of db 0", func() bool {
+		return replyOf(replica, rc, "GET", "k2") == "$2\r\nv2\r\n"
+	})
+	if reply = replyOf(replica, rc, "SET", "k3", "v3"); reply != "-"+READONLY_ERR+"\r\n" {
+		t.Error("the replica should be read only: ", reply)
+	}
+	replica.repl.mu.Lock()
+	offset := replica.repl.offset
+	replica.repl.mu.Unlock()
+	if reply = replyOf(replica, rc, "ROLE"); reply != "*5\r\n$5\r\nslave\r\n$9\r\n127.0.0.1\r\n:"+
+		strconv.Itoa(port)+"\r\n$9\r\nconnected\r\n:"+strconv.FormatInt(offset, 10)+"\r\n" {
+		t.Error("role of replica err: ", reply)
+	}
+	waitFor(t, "ack", func() bool {
+		master.repl.mu.Lock()
+		defer master.repl.mu.Unlock()
+		for _, info := range master.repl.replicas {
+			return info.ackOffset == master.repl.offset
+		}
+		return false
+	})
+
+	// the replica continues from the backlog after the short disconnect
+	replica.mustSelectDB(0).PutEntity("local", &database.DataEntity{Data: []byte("v")})
+	master.repl.mu.Lock()
+	for _, info := range master.repl.replicas {
+		info.close()
+	}
+	master.repl.mu.Unlock()
+	replyOf(master, mc, "SET", "k3", "v3")
+	waitFor(t, "partial resync", func() bool {
+		return replyOf(replica, rc, "GET", "k3") == "$2\r\nv3\r\n"
+	})
+	if _, exists := replica.mustSelectDB(0).data.Get("local"); !exists {
+		t.Error("the partial resync should not flush the data")
+	}
+
+	// promote the replica
+	if reply = replyOf(replica, rc, "REPLICAOF", "NO", "ONE"); reply != "+OK\r\n" {
+		t.Fatal("replicaof no one err: ", reply)
+	}
+	if reply = replyOf(replica, rc, "SET", "k4", "v4"); reply != "+OK\r\n" {
+		t.Error("the promoted replica should be writable: ", reply)
+	}
+	master.repl.mu.Lock()
+	replID := master.repl.replID
+	master.repl.mu.Unlock()
+	replica.repl.mu.Lock()
+	defer replica.repl.mu.Unlock()
+	if replica.repl.replID2 != replID {
+		t.Error("the old replication id should be kept")
+	}
+}
+
+func TestEmptyPSyncReply(t *testing.T) {
+	replica, _, _ := newReplServer(t)
+	listener, host, port := newTestListener(t)
+	defer listener.Close()
+	// the fake master replies the blank line to PSYNC
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for payLoad := range parse.ParseStream(conn) {
+			request, ok := payLoad.Data.(*protocol.MulitBulkReply)
+			if payLoad.Error != nil || !ok {
+				continue
+			}
+			if string(request.Args[0]) == "PSYNC" {
+				_, _ = conn.Write([]byte(" \r\n"))
+				continue
+			}
+			_, _ = conn.Write([]byte("+OK\r\n"))
+		}
+	}()
+	addr := net.JoinHostPort(host, strconv.Itoa(port))
+	if err := replica.syncWithMaster(context.Background(), addr); err == nil {
+		t.Error("the empty reply of psync should be an error")
+	}
+}
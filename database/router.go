@@ -25,3 +25,16 @@ func RegisterCommand(name string, exector ExecFunc, prepare PreFunc, undo UndoFu
 	}
 	commandTable[name] = c
 }
+
+// isWriteCommand judge whether the command writes any key by the prepare function
+func isWriteCommand(cmdLine [][]byte) bool {
+	if validCommand(cmdLine) != nil {
+		return false
+	}
+	cmd := commandTable[strings.ToLower(string(cmdLine[0]))]
+	if cmd.prepare == nil {
+		return false
+	}
+	wks, _ := cmd.prepare(cmdLine[1:])
+	return len(wks) > 0
+}
@@ -0,0 +1,187 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/wildcard"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"strconv"
+	"strings"
+)
+
+/*
+	SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+	HSCAN key cursor [MATCH pattern] [COUNT count]
+	SSCAN key cursor [MATCH pattern] [COUNT count]
+	ZSCAN key cursor [MATCH pattern] [COUNT count]
+*/
+
+const (
+	DEFAULT_SCAN_COUNT = 10
+	INVALID_CURSOR_ERR = "ERR invalid cursor"
+	INVALID_PATTERN    = "ERR invalid pattern"
+)
+
+func init() {
+	RegisterCommand("SCAN", execScan, nil, nil, -2)
+	RegisterCommand("HSCAN", execHScan, readFirstKey, nil, -3)
+	RegisterCommand("SSCAN", execSScan, readFirstKey, nil, -3)
+	RegisterCommand("ZSCAN", execZScan, readFirstKey, nil, -3)
+}
+
+type scanArgs struct {
+	cursor   int
+	count    int
+	pattern  string
+	typeName string
+}
+
+// parseScanArgs parse: cursor [MATCH pattern] [COUNT count] [TYPE type], TYPE only allowed by SCAN
+func parseScanArgs(args [][]byte, allowType bool) (*scanArgs, redis.Reply) {
+	cursor, err := strconv.Atoi(string(args[0]))
+	if err != nil || cursor < 0 {
+		return nil, protocol.NewErrReply(INVALID_CURSOR_ERR)
+	}
+	sa := &scanArgs{
+		cursor:  cursor,
+		count:   DEFAULT_SCAN_COUNT,
+		pattern: "*",
+	}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+		}
+		option := strings.ToUpper(string(args[i]))
+		value := string(args[i+1])
+		switch {
+		case option == "MATCH":
+			sa.pattern = value
+		case option == "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, protocol.NewErrReply(INT_RANGE_ERR)
+			}
+			// redis replies the syntax error for the count less than 1
+			if count < 1 {
+				return nil, protocol.NewErrReply(SYNTAX_ERR)
+			}
+			sa.count = count
+		case option == "TYPE" && allowType:
+			sa.typeName = strings.ToLower(value)
+		default:
+			return nil, protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
+		}
+	}
+	return sa, nil
+}
+
+func makeScanReply(cursor int, result [][]byte) redis.Reply {
+	return protocol.NewMultiRawReply([]redis.Reply{
+		protocol.NewBulkReply([]byte(strconv.Itoa(cursor))),
+		protocol.NewMultiReply(result),
+	})
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func execScan(db *Database, cmdLine [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(cmdLine, true)
+	if errReply != nil {
+		return errReply
+	}
+	keys, next := db.data.DictScan(sa.cursor, sa.count, sa.pattern)
+	if next < 0 {
+		return protocol.NewErrReply(INVALID_PATTERN)
+	}
+
+	// skip the expired keys and the keys not match the type
+	result := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		entity, exists := db.GetEntity(string(key))
+		if !exists {
+			continue
+		}
+		if sa.typeName != "" && typeOf(entity) != sa.typeName {
+			continue
+		}
+		result = append(result, key)
+	}
+	return makeScanReply(next, result)
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count], the fields are returned in one batch
+func execHScan(db *Database, cmdLine [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(cmdLine[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	h, errReply := db.getAsHash(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	pattern, err := wildcard.CompilePattern(sa.pattern)
+	if err != nil {
+		return protocol.NewErrReply(INVALID_PATTERN)
+	}
+	result := make([][]byte, 0)
+	if h != nil {
+		h.ForEach(func(field string, value []byte) bool {
+			if pattern.IsMatch(field) {
+				result = append(result, []byte(field), value)
+			}
+			return true
+		})
+	}
+	return makeScanReply(0, result)
+}
+
+// SSCAN key cursor [MATCH pattern] [COUNT count], the members are returned in one batch
+func execSScan(db *Database, cmdLine [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(cmdLine[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	s, errReply := db.getAsSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	pattern, err := wildcard.CompilePattern(sa.pattern)
+	if err != nil {
+		return protocol.NewErrReply(INVALID_PATTERN)
+	}
+	result := make([][]byte, 0)
+	if s != nil {
+		s.ForEach(func(member string) bool {
+			if pattern.IsMatch(member) {
+				result = append(result, []byte(member))
+			}
+			return true
+		})
+	}
+	return makeScanReply(0, result)
+}
+
+// ZSCAN key cursor [MATCH pattern] [COUNT count], the members are returned in one batch
+func execZScan(db *Database, cmdLine [][]byte) redis.Reply {
+	sa, errReply := parseScanArgs(cmdLine[1:], false)
+	if errReply != nil {
+		return errReply
+	}
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	pattern, err := wildcard.CompilePattern(sa.pattern)
+	if err != nil {
+		return protocol.NewErrReply(INVALID_PATTERN)
+	}
+	result := make([][]byte, 0)
+	if ss != nil {
+		ss.ForEach(func(score float64, member string) bool {
+			if pattern.IsMatch(member) {
+				result = append(result, []byte(member),
+					[]byte(strconv.FormatFloat(score, 'f', -1, 64)))
+			}
+			return true
+		})
+	}
+	return makeScanReply(0, result)
+}
@@ -0,0 +1,76 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	for i := 0; i < 100; i++ {
+		db.Exec(conn, utils.CmdLine1("SET", "str_"+strconv.Itoa(i), "v"))
+		db.Exec(conn, utils.CmdLine1("SADD", "set_"+strconv.Itoa(i), "m"))
+	}
+
+	found := make(map[string]struct{})
+	cursor := "0"
+	for {
+		reply := db.Exec(conn, utils.CmdLine1("SCAN", cursor, "MATCH", "*_1*", "COUNT", "20", "TYPE", "set"))
+		if protocol.IsErrReply(reply) {
+			t.Fatal("scan err: ", string(reply.ToByte()))
+		}
+		// *2\r\n$n\r\ncursor\r\n*n\r\n$n\r\nkey\r\n...
+		lines := strings.Split(string(reply.ToByte()), "\r\n")
+		cursor = lines[2]
+		for i := 5; i < len(lines); i += 2 {
+			found[lines[i]] = struct{}{}
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	// set_1 and set_10 ~ set_19
+	if len(found) != 11 {
+		t.Error("scan err: ", found)
+	}
+}
+
+func TestZScan(t *testing.T) {
+	db := NewDatabase(0)
+	execZAdd(db, [][]byte{[]byte("zset"), []byte("1"), []byte("a1"), []byte("2.5"), []byte("b1"), []byte("3"), []byte("a2")})
+	reply := execZScan(db, [][]byte{[]byte("zset"), []byte("0"), []byte("MATCH"), []byte("a*")})
+	if string(reply.ToByte()) != "*2\r\n$1\r\n0\r\n*4\r\n$2\r\na1\r\n$1\r\n1\r\n$2\r\na2\r\n$1\r\n3\r\n" {
+		t.Error("zscan err: ", string(reply.ToByte()))
+	}
+
+	execHSet(db, [][]byte{[]byte("hash"), []byte("f1"), []byte("v1")})
+	reply = execHScan(db, [][]byte{[]byte("hash"), []byte("0")})
+	log.Print(string(reply.ToByte()))
+}
+
+func TestScanCount(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	cmdLines := [][]string{
+		{"SCAN", "0", "COUNT", "0"},
+		{"HSCAN", "k", "0", "COUNT", "0"},
+		{"SSCAN", "k", "0", "COUNT", "-1"},
+		{"ZSCAN", "k", "0", "COUNT", "0"},
+	}
+	for _, cmdLine := range cmdLines {
+		reply := db.Exec(conn, utils.CmdLine1(cmdLine[0], cmdLine[1:]...))
+		if string(reply.ToByte()) != "-"+SYNTAX_ERR+"\r\n" {
+			t.Error(cmdLine[0], " with the count less than 1 err: ", string(reply.ToByte()))
+		}
+	}
+	reply := db.Exec(conn, utils.CmdLine1("SCAN", "0", "COUNT", "x"))
+	if string(reply.ToByte()) != "-"+INT_RANGE_ERR+"\r\n" {
+		t.Error("scan with the invalid count err: ", string(reply.ToByte()))
+	}
+}
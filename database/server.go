@@ -9,9 +9,12 @@ import (
 	"github.com/xzwsloser/Go-redis/lib/logger"
 	"github.com/xzwsloser/Go-redis/pub"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
@@ -20,6 +23,7 @@ const (
 	DB_NOT_FIND         = "database not find"
 	DB_INDEX_ERR        = "database index is not valid"
 	EMPTY_REPLY         = "the reply is empty"
+	WRONG_TYPE_ERR      = "WRONGTYPE Operation against a key holding the wrong kind of value"
 )
 
 // RedisServer is the inner server to exec command  like the httpServer
@@ -27,6 +31,36 @@ type RedisServer struct {
 	dbSet     []*atomic.Value
 	persister *aof.Persister
 	hub       *pub.Hub
+	// rdbFileName is the name of the snapshot file
+	rdbFileName string
+	saveRules   []saveRule
+	// dirty is the number of changes since the last save
+	dirty int64
+	// lastSave is the unix time of the last successful save
+	lastSave int64
+	// saving is 1 when SAVE or BGSAVE is in progress
+	saving int32
+	// dumpMu let the saving and the full sync of the replicas take the snapshot one by one
+	dumpMu    sync.Mutex
+	closeChan chan struct{}
+	// closeOnce let Close be called more than once
+	closeOnce sync.Once
+	repl      *replication
+	// cluster is nil when the cluster mode is disabled
+	cluster *cluster
+	acl     *acl
+	// clients: id -> redis.Conn, the connected clients shown by CLIENT LIST
+	clients sync.Map
+	// pause is set by CLIENT PAUSE, pauseMu serializes the changes of it
+	pause   atomic.Pointer[clientPause]
+	pauseMu sync.Mutex
+	stats   *serverStats
+	slowlog *slowlog
+	// monitors: id -> *monitor, monitorCount is the number of them read without the map
+	monitors     sync.Map
+	monitorCount int32
+	evictor      *evictor
+	blocking     *blockingKeys
 }
 
 func init() {
@@ -38,6 +72,7 @@ func NewRedisServer() *RedisServer {
 	if dbNumber <= 0 {
 		dbNumber = 16
 	}
+	applyEncodingConfig()
 
 	dbSet := make([]*atomic.Value, dbNumber)
 	for i := 0; i < dbNumber; i++ {
@@ -46,21 +81,55 @@ func NewRedisServer() *RedisServer {
 	}
 
 	server := &RedisServer{
-		dbSet: dbSet,
+		dbSet:    dbSet,
+		acl:      newAcl(),
+		stats:    newServerStats(),
+		slowlog:  newSlowlogByConfig(),
+		evictor:  newEvictorByConfig(),
+		blocking: newBlockingKeys(),
 	}
+	server.bindStats()
+	server.initAcl()
 
+	server.initRdb()
 	persister := aof.NewPersister()
-	persister.SetTmpDBMaker(func() database.DBEngine {
-		return NewPureServer()
-	})
 	if persister != nil {
+		persister.SetTmpDBMaker(func() database.DBEngine {
+			return NewPureServer()
+		})
 		persister.BindRedisServer(server)
-		if persister.Load {
-			persister.LoadAof()
+	}
+	// the aof file is the newer data, so the snapshot is loaded only when the aof file is empty
+	if persister != nil && persister.Load && persister.HasAofData() {
+		persister.LoadAof()
+	} else if config.GetRdbConfig().Load == "on" {
+		err := server.loadRdb()
+		if err != nil && !os.IsNotExist(err) {
+			logger.Error("load rdb file err: %v", err)
 		}
+		if err == nil && persister != nil && persister.AppendOnly {
+			server.syncAof(persister)
+		}
+	}
+	if persister != nil {
 		server.bindPersister(persister)
 	}
+	server.bindDirtyCounter()
+	server.repl = newReplication()
+	server.bindReplication()
+	if replicaOf := strings.Fields(config.GetReplicationConfig().ReplicaOf); len(replicaOf) == 2 {
+		port, err := strconv.Atoi(replicaOf[1])
+		if err != nil {
+			logger.Error("invalid master port: %s", replicaOf[1])
+		} else {
+			server.replicaOf(replicaOf[0], port)
+		}
+	}
+	if config.GetClusterConfig().Enabled == "on" {
+		server.initCluster()
+	}
 	server.hub = pub.NewHub()
+	go server.statsCron()
 	return server
 }
 
@@ -70,26 +139,111 @@ func execPing(db *Database, cmdLine [][]byte) redis.Reply {
 
 func (r *RedisServer) Exec(conn redis.Conn, cmdLine [][]byte) redis.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0]))
+	conn.SetLastCmd(fullCmdName(cmdLine))
+	atomic.AddInt64(&r.stats.totalCommands, 1)
+	if errReply := r.checkAcl(conn, cmdLine); errReply != nil {
+		r.stats.rejectCommand(cmdName)
+		if conn.InitMulti() {
+			conn.AddTxErrors(errReply)
+		}
+		return errReply
+	}
+	r.waitPause(conn, cmdLine)
+	r.feedMonitors(conn, cmdLine)
+
+	// the time waiting for the pause is not counted by the slowlog
+	start := time.Now()
+	reply := r.execCommand(conn, cmdName, cmdLine)
+	r.slowlog.record(conn, cmdLine, time.Since(start))
+	// the client waits when the blocking command gets nothing, the time blocked is not counted either
+	if _, ok := blockingCommands[cmdName]; ok && isBlockedReply(reply) {
+		reply = r.blockClient(conn, cmdName, cmdLine, reply)
+	}
+	return reply
+}
+
+// execCommand exec the command after the acl check and the pause
+func (r *RedisServer) execCommand(conn redis.Conn, cmdName string, cmdLine [][]byte) redis.Reply {
+	if r.repl != nil && r.repl.isReplica() && isWriteCommand(cmdLine) {
+		return protocol.NewErrReply(READONLY_ERR)
+	}
+	if r.cluster != nil && cmdName != "asking" {
+		if errReply := r.clusterRoute(conn, cmdLine); errReply != nil {
+			if conn.InitMulti() {
+				conn.AddTxErrors(errReply)
+			}
+			return errReply
+		}
+	}
+	if errReply := r.freeMemoryIfNeeded(conn, cmdName, cmdLine); errReply != nil {
+		return errReply
+	}
 	if cmdName == "select" {
 		if len(cmdLine) != 2 {
 			return protocol.NewErrReply(ARGS_OF_COMMAND_ERR)
 		}
+		if r.cluster != nil && string(cmdLine[1]) != "0" {
+			return protocol.NewErrReply(SELECT_IN_CLUSTER_ERR)
+		}
 
 		indexStr := string(cmdLine[1])
 		index, err := strconv.ParseInt(indexStr, 10, 32)
-		if err != nil || index < 0 || index > int64(len(r.dbSet)) {
+		if err != nil || index < 0 || index >= int64(len(r.dbSet)) {
 			return protocol.NewErrReply(DB_INDEX_ERR)
 		}
 		conn.SelectDB(int(index))
+		return protocol.NewOkReply()
 	} else if cmdName == "bgwriteaof" {
 		r.execBgReWrite()
 		return protocol.NewOkReply()
+	} else if cmdName == "save" {
+		return r.execSave()
+	} else if cmdName == "bgsave" {
+		return r.execBgSave()
+	} else if cmdName == "lastsave" {
+		return r.execLastSave()
+	} else if cmdName == "replicaof" || cmdName == "slaveof" {
+		return r.execReplicaOf(cmdLine[1:])
+	} else if cmdName == "psync" {
+		return r.execPSync(conn, cmdLine[1:])
+	} else if cmdName == "replconf" {
+		return r.execReplConf(conn, cmdLine[1:])
+	} else if cmdName == "auth" {
+		return r.execAuth(conn, cmdLine[1:])
+	} else if cmdName == "acl" {
+		return r.execAcl(conn, cmdLine[1:])
+	} else if cmdName == "hello" {
+		return r.execHello(conn, cmdLine[1:])
+	} else if cmdName == "client" {
+		return r.execClient(conn, cmdLine[1:])
+	} else if cmdName == "monitor" {
+		return r.execMonitor(conn)
+	} else if cmdName == "slowlog" {
+		return r.execSlowlog(cmdLine[1:])
+	} else if cmdName == "memory" && !isMemoryUsage(cmdLine[1:]) {
+		return r.execMemory(cmdLine[1:])
+	} else if cmdName == "info" {
+		return r.execInfo(cmdLine[1:])
+	} else if cmdName == "role" {
+		return r.execRole()
+	} else if cmdName == "cluster" {
+		return r.execCluster(conn, cmdLine[1:])
+	} else if cmdName == "asking" {
+		return r.execAsking(conn)
 	} else if cmdName == "subscribe" {
 		return r.hub.Subscribe(conn, cmdLine[1:])
 	} else if cmdName == "unsubscribe" {
 		return r.hub.Unsubscribe(conn, cmdLine[1:])
 	} else if cmdName == "publish" {
 		return r.hub.Publish(cmdLine[1:])
+	} else if cmdName == "copy" && len(cmdLine) >= 3 {
+		dbIndex, _, errReply := parseCopyArgs(cmdLine[1:])
+		if errReply != nil {
+			return errReply
+		}
+		if dbIndex != -1 && dbIndex != conn.GetDBIndex() {
+			return r.execCopy(conn, cmdLine[1:])
+		}
 	}
 
 	selectDB, err := r.selectDB(conn.GetDBIndex())
@@ -100,13 +254,42 @@ func (r *RedisServer) Exec(conn redis.Conn, cmdLine [][]byte) redis.Reply {
 }
 
 func (r *RedisServer) Close() {
+	r.closeOnce.Do(r.close)
+}
+
+func (r *RedisServer) close() {
+	if r.repl != nil {
+		r.stopReplication()
+	}
+	if r.cluster != nil {
+		r.stopCluster()
+	}
+	if r.closeChan != nil {
+		close(r.closeChan)
+		// save the changes before shutdown like redis when the save rules are set
+		if len(r.saveRules) > 0 && atomic.LoadInt64(&r.dirty) > 0 {
+			if err := r.saveRdb(); err != nil {
+				logger.Error("save before shutdown err: %v", err)
+			}
+		}
+	}
+	// the expiring keys write DEL into aof, so the time heaps are stopped before the aof is closed
+	for i := range r.dbSet {
+		r.mustSelectDB(i).close()
+	}
 	if r.persister != nil {
 		r.persister.Close()
 	}
 }
 
 func (r *RedisServer) AfterClientClose(conn redis.Conn) {
+	r.clients.Delete(conn.GetID())
+	r.removeMonitor(conn)
 	r.hub.UnSubscribeAll(conn)
+	r.blocking.unblock(conn)
+	if r.repl != nil {
+		r.repl.removeReplica(conn)
+	}
 }
 
 func (s *RedisServer) selectDB(index int) (*Database, error) {
@@ -133,8 +316,39 @@ func (s *RedisServer) mustSelectDB(index int) *Database {
 }
 
 // ForEach Scan all the k-v in database
-func (s *RedisServer) ForEach(dbIndex int, consumer func(key string, value *database.DataEntity) bool) {
-	s.mustSelectDB(dbIndex).ForEach(consumer)
+func (s *RedisServer) ForEach(dbIndex int, consumer func(key string, value *database.DataEntity, expireAt time.Time) bool) {
+	db := s.mustSelectDB(dbIndex)
+	db.ForEach(func(key string, value *database.DataEntity) bool {
+		expireAt, _ := db.GetExpireTime(key)
+		return consumer(key, value, expireAt)
+	})
+}
+
+func (s *RedisServer) DBNumber() int {
+	return len(s.dbSet)
+}
+
+// LoadEntity put the entity into the database, the expired key is skipped
+func (s *RedisServer) LoadEntity(dbIndex int, key string, value *database.DataEntity, expireAt time.Time) {
+	db, err := s.selectDB(dbIndex)
+	if err != nil {
+		logger.Warn("skip the key %s of the invalid db %d", key, dbIndex)
+		return
+	}
+	if !expireAt.IsZero() && time.Now().After(expireAt) {
+		return
+	}
+	value.Size = estimateSize(key, value, DEFAULT_MAXMEMORY_SAMPLES)
+	touchEntity(value, time.Now())
+	// the key is locked like the writers, so it is captured by the dump in progress
+	keys := []string{key}
+	db.RWLocks(keys, nil)
+	defer db.RWUnlocks(keys, nil)
+	db.PutEntityWithLock(key, value)
+	atomic.AddInt64(&db.usedMemory, value.Size)
+	if !expireAt.IsZero() {
+		db.Expire(key, expireAt)
+	}
 }
 
 func (s *RedisServer) ReadAOF() {
@@ -155,16 +369,65 @@ func (s *RedisServer) execBgReWrite() {
 	}()
 }
 
+// execCopy copy the key into another database: COPY source destination DB destination-db [REPLACE]
+func (r *RedisServer) execCopy(conn redis.Conn, args [][]byte) redis.Reply {
+	if conn.InitMulti() {
+		errReply := protocol.NewErrReply(COPY_IN_MULTI_ERR)
+		conn.AddTxErrors(errReply)
+		return errReply
+	}
+	dbIndex, replace, errReply := parseCopyArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	srcDB, err := r.selectDB(conn.GetDBIndex())
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+	destDB, err := r.selectDB(dbIndex)
+	if err != nil {
+		return protocol.NewErrReply(err.Error())
+	}
+
+	src := string(args[0])
+	dest := string(args[1])
+	// lock the databases in the order of the index to avoid dead lock
+	if srcDB.index < destDB.index {
+		srcDB.RWLocks(nil, []string{src})
+		destDB.RWLocks([]string{dest}, nil)
+	} else {
+		destDB.RWLocks([]string{dest}, nil)
+		srcDB.RWLocks(nil, []string{src})
+	}
+	defer func() {
+		srcDB.RWUnlocks(nil, []string{src})
+		destDB.RWUnlocks([]string{dest}, nil)
+	}()
+	destDB.AddVersion(dest)
+	sizes := destDB.sizesOf([]string{dest})
+	reply := copyEntity(srcDB, destDB, src, dest, replace)
+	destDB.afterWrite(sizes, nil)
+	return reply
+}
+
 func NewPureServer() *RedisServer {
 	dbNum := config.GetDBConfig().Number
 	if dbNum <= 0 {
 		dbNum = 16
 	}
-	server := &RedisServer{}
+	applyEncodingConfig()
+	server := &RedisServer{
+		acl:      newAcl(),
+		stats:    newServerStats(),
+		slowlog:  newSlowlogByConfig(),
+		evictor:  newEvictorByConfig(),
+		blocking: newBlockingKeys(),
+	}
 	server.dbSet = make([]*atomic.Value, dbNum)
 	for i := 0; i < dbNum; i++ {
 		server.dbSet[i] = &atomic.Value{}
 		server.dbSet[i].Store(NewDatabase(i))
 	}
+	server.bindStats()
 	return server
 }
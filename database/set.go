@@ -0,0 +1,436 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+	SADD
+	SREM
+	SISMEMBER
+	SMISMEMBER
+	SMEMBERS
+	SCARD
+	SPOP
+	SRANDMEMBER
+	SMOVE
+	SINTER SINTERSTORE
+	SUNION SUNIONSTORE
+	SDIFF  SDIFFSTORE
+*/
+
+const (
+	SET_COUNT_ERR = "ERR value is out of range, must be positive"
+	// COUNT_RANGE_ERR: the count of the random members is limited to MaxInt64/2 like redis, and the negative
+	// count is limited to -RANDOM_MAX_COUNT since the repeated members are built in memory before replying
+	COUNT_RANGE_ERR  = "ERR value is out of range"
+	RANDOM_MAX_COUNT = 1 << 20
+)
+
+func init() {
+	RegisterCommand("SADD", execSAdd, writeFirstKey, undoSetMembers, -3)
+	RegisterCommand("SREM", execSRem, writeFirstKey, undoSetMembers, -3)
+	RegisterCommand("SISMEMBER", execSIsMember, readFirstKey, nil, 3)
+	RegisterCommand("SMISMEMBER", execSMIsMember, readFirstKey, nil, -3)
+	RegisterCommand("SMEMBERS", execSMembers, readFirstKey, nil, 2)
+	RegisterCommand("SCARD", execSCard, readFirstKey, nil, 2)
+	RegisterCommand("SPOP", execSPop, writeFirstKey, rollbackFirstKey, -2)
+	RegisterCommand("SRANDMEMBER", execSRandMember, readFirstKey, nil, -2)
+	RegisterCommand("SMOVE", execSMove, prepareSMove, undoSMove, 4)
+	RegisterCommand("SINTER", execSInter, readKeys, nil, -2)
+	RegisterCommand("SUNION", execSUnion, readKeys, nil, -2)
+	RegisterCommand("SDIFF", execSDiff, readKeys, nil, -2)
+	RegisterCommand("SINTERSTORE", execSInterStore, prepareSetStore, rollbackFirstKey, -3)
+	RegisterCommand("SUNIONSTORE", execSUnionStore, prepareSetStore, rollbackFirstKey, -3)
+	RegisterCommand("SDIFFSTORE", execSDiffStore, prepareSetStore, rollbackFirstKey, -3)
+}
+
+// getAsSet get the set of the key, return err reply if the key is not a set
+func (db *Database) getAsSet(key string) (*set.Set, redis.Reply) {
+	entity, exists := db.GetEntityWithLock(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, protocol.NewErrReply(WRONG_TYPE_ERR)
+	}
+	return s, nil
+}
+
+func (db *Database) getOrInitSet(key string) (*set.Set, redis.Reply) {
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if s == nil {
+		s = set.NewSet()
+		db.PutEntityWithLock(key, &database.DataEntity{
+			Data: s,
+		})
+	}
+	return s, nil
+}
+
+// prepareSMove: SMOVE source destination member
+func prepareSMove(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// prepareSetStore: SINTERSTORE destination key [key ...]
+func prepareSetStore(args [][]byte) ([]string, []string) {
+	dest := string(args[0])
+	rks := bytesToString(args[1:])
+	return []string{dest}, rks
+}
+
+// rollbackSetMembers restore the given members of the set to the current state
+func rollbackSetMembers(db *Database, key string, members ...string) []CmdLine {
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return rollbackGivenKeys(db, key)
+	}
+	if s == nil {
+		return []CmdLine{utils.CmdLine1("DEL", key)}
+	}
+	undoCmdLines := make([]CmdLine, 0, len(members))
+	for _, member := range members {
+		if s.Has(member) {
+			undoCmdLines = append(undoCmdLines, utils.CmdLine1("SADD", key, member))
+		} else {
+			undoCmdLines = append(undoCmdLines, utils.CmdLine1("SREM", key, member))
+		}
+	}
+	return undoCmdLines
+}
+
+// undoSetMembers: SADD/SREM key member [member ...]
+func undoSetMembers(db *Database, args [][]byte) []CmdLine {
+	return rollbackSetMembers(db, string(args[0]), bytesToString(args[1:])...)
+}
+
+// undoSMove: SMOVE source destination member
+func undoSMove(db *Database, args [][]byte) []CmdLine {
+	member := string(args[2])
+	undoCmdLines := rollbackSetMembers(db, string(args[0]), member)
+	return append(undoCmdLines, rollbackSetMembers(db, string(args[1]), member)...)
+}
+
+// SADD key member [member ...]
+func execSAdd(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	s, errReply := db.getOrInitSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	var result int
+	for _, member := range cmdLine[1:] {
+		result += s.Add(string(member))
+	}
+	db.addAof(utils.CmdLine2("SADD", cmdLine))
+	return protocol.NewIntReply(int64(result))
+}
+
+// SREM key member [member ...]
+func execSRem(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	var result int
+	for _, member := range cmdLine[1:] {
+		result += s.Remove(string(member))
+	}
+	if s.Len() == 0 {
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+	}
+	if result > 0 {
+		db.addAof(utils.CmdLine2("SREM", cmdLine))
+	}
+	return protocol.NewIntReply(int64(result))
+}
+
+// SISMEMBER key member
+func execSIsMember(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || !s.Has(string(cmdLine[1])) {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(1)
+}
+
+// SMISMEMBER key member [member ...]
+func execSMIsMember(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	replies := make([]redis.Reply, len(cmdLine)-1)
+	for i, member := range cmdLine[1:] {
+		if s != nil && s.Has(string(member)) {
+			replies[i] = protocol.NewIntReply(1)
+		} else {
+			replies[i] = protocol.NewIntReply(0)
+		}
+	}
+	return protocol.NewMultiRawReply(replies)
+}
+
+// SMEMBERS key
+func execSMembers(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewSetReply(nil)
+	}
+	return protocol.NewSetReply(protocol.BulkStrings(stringsToBytes(s.Members())))
+}
+
+// SCARD key
+func execSCard(db *Database, cmdLine [][]byte) redis.Reply {
+	key := string(cmdLine[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return protocol.NewIntReply(0)
+	}
+	return protocol.NewIntReply(int64(s.Len()))
+}
+
+// SPOP key [count]
+func execSPop(db *Database, cmdLine [][]byte) redis.Reply {
+	if len(cmdLine) > 2 {
+		return protocol.NewErrReply(ARGS_NUMBER_ERR_WARN)
+	}
+	key := string(cmdLine[0])
+	count := 1
+	withCount := len(cmdLine) == 2
+	if withCount {
+		c, err := strconv.Atoi(string(cmdLine[1]))
+		if err != nil || c < 0 {
+			return protocol.NewErrReply(SET_COUNT_ERR)
+		}
+		count = c
+	}
+
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if withCount {
+			return protocol.NewEmptyReply()
+		}
+		return protocol.NewNullBulkReply()
+	}
+
+	members := s.RandomDistinctMembers(count)
+	for _, member := range members {
+		s.Remove(member)
+	}
+	if s.Len() == 0 {
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+	}
+	// the popped members is random, so write SREM into aof
+	if len(members) > 0 {
+		db.addAof(utils.CmdLine1("SREM", append([]string{key}, members...)...))
+	}
+
+	if !withCount {
+		if len(members) == 0 {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewBulkReply([]byte(members[0]))
+	}
+	if len(members) == 0 {
+		return protocol.NewEmptyReply()
+	}
+	return protocol.NewMultiReply(stringsToBytes(members))
+}
+
+// SRANDMEMBER key [count], negative count allow the same member returned many times
+func execSRandMember(db *Database, cmdLine [][]byte) redis.Reply {
+	if len(cmdLine) > 2 {
+		return protocol.NewErrReply(ARGS_NUMBER_ERR_WARN)
+	}
+	key := string(cmdLine[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	if len(cmdLine) == 1 {
+		if s == nil {
+			return protocol.NewNullBulkReply()
+		}
+		members := s.RandomDistinctMembers(1)
+		return protocol.NewBulkReply([]byte(members[0]))
+	}
+
+	count, err := strconv.ParseInt(string(cmdLine[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply(KEY_TYPE_CANNOT_TRANS)
+	}
+	if count < -RANDOM_MAX_COUNT || count > math.MaxInt64/2 {
+		return protocol.NewErrReply(COUNT_RANGE_ERR)
+	}
+	if s == nil || count == 0 {
+		return protocol.NewEmptyReply()
+	}
+	var members []string
+	if count > 0 {
+		members = s.RandomDistinctMembers(int(count))
+	} else {
+		members = s.RandomMembers(int(-count))
+	}
+	return protocol.NewMultiReply(stringsToBytes(members))
+}
+
+// SMOVE source destination member
+func execSMove(db *Database, cmdLine [][]byte) redis.Reply {
+	src := string(cmdLine[0])
+	dest := string(cmdLine[1])
+	member := string(cmdLine[2])
+	srcSet, errReply := db.getAsSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	destSet, errReply := db.getAsSet(dest)
+	if errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return protocol.NewIntReply(0)
+	}
+	// moving the member into the same set changes nothing
+	if src == dest {
+		return protocol.NewIntReply(1)
+	}
+
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.RemoveEntityWithLock(src)
+		db.Persister(src)
+	}
+	if destSet == nil {
+		destSet, _ = db.getOrInitSet(dest)
+	}
+	destSet.Add(member)
+	db.addAof(utils.CmdLine2("SMOVE", cmdLine))
+	return protocol.NewIntReply(1)
+}
+
+// getSets get all the sets of the keys, the key not exists is seen as an empty set
+func (db *Database) getSets(keys [][]byte) ([]*set.Set, redis.Reply) {
+	sets := make([]*set.Set, len(keys))
+	for i, key := range keys {
+		s, errReply := db.getAsSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if s == nil {
+			s = set.NewSet()
+		}
+		sets[i] = s
+	}
+	return sets, nil
+}
+
+// setAlgebra compute the result set of SINTER/SUNION/SDIFF
+func (db *Database) setAlgebra(op string, keys [][]byte) (*set.Set, redis.Reply) {
+	sets, errReply := db.getSets(keys)
+	if errReply != nil {
+		return nil, errReply
+	}
+	switch op {
+	case "inter":
+		return set.Intersect(sets...), nil
+	case "union":
+		return set.Union(sets...), nil
+	default:
+		return set.Diff(sets...), nil
+	}
+}
+
+func (db *Database) execSetAlgebra(op string, cmdLine [][]byte) redis.Reply {
+	result, errReply := db.setAlgebra(op, cmdLine)
+	if errReply != nil {
+		return errReply
+	}
+	if result.Len() == 0 {
+		return protocol.NewSetReply(nil)
+	}
+	return protocol.NewSetReply(protocol.BulkStrings(stringsToBytes(result.Members())))
+}
+
+func (db *Database) execSetAlgebraStore(op string, cmdLine [][]byte) redis.Reply {
+	dest := string(cmdLine[0])
+	result, errReply := db.setAlgebra(op, cmdLine[1:])
+	if errReply != nil {
+		return errReply
+	}
+	db.RemoveEntityWithLock(dest)
+	if result.Len() > 0 {
+		db.PutEntityWithLock(dest, &database.DataEntity{
+			Data: result,
+		})
+	}
+	if db.IsTTLKey(dest) {
+		db.Persister(dest)
+	}
+	db.addAof(utils.CmdLine2("S"+strings.ToUpper(op)+"STORE", cmdLine))
+	return protocol.NewIntReply(int64(result.Len()))
+}
+
+// SINTER key [key ...]
+func execSInter(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execSetAlgebra("inter", cmdLine)
+}
+
+// SUNION key [key ...]
+func execSUnion(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execSetAlgebra("union", cmdLine)
+}
+
+// SDIFF key [key ...]
+func execSDiff(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execSetAlgebra("diff", cmdLine)
+}
+
+// SINTERSTORE destination key [key ...]
+func execSInterStore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execSetAlgebraStore("inter", cmdLine)
+}
+
+// SUNIONSTORE destination key [key ...]
+func execSUnionStore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execSetAlgebraStore("union", cmdLine)
+}
+
+// SDIFFSTORE destination key [key ...]
+func execSDiffStore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execSetAlgebraStore("diff", cmdLine)
+}
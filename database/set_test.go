@@ -0,0 +1,137 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSAdd(t *testing.T) {
+	db := NewDatabase(0)
+	cmdLine := [][]byte{
+		[]byte("set"),
+		[]byte("a"),
+		[]byte("b"),
+		[]byte("a"),
+	}
+	reply := execSAdd(db, cmdLine)
+	if string(reply.ToByte()) != ":2\r\n" {
+		t.Error("sadd err: ", string(reply.ToByte()))
+	}
+
+	reply = execSMIsMember(db, [][]byte{[]byte("set"), []byte("a"), []byte("c")})
+	if string(reply.ToByte()) != "*2\r\n:1\r\n:0\r\n" {
+		t.Error("smismember err: ", string(reply.ToByte()))
+	}
+
+	reply = execSPop(db, [][]byte{[]byte("set"), []byte("5")})
+	log.Print(string(reply.ToByte()))
+	if _, exists := db.GetEntity("set"); exists {
+		t.Error("empty set should be removed")
+	}
+}
+
+func TestSetStore(t *testing.T) {
+	db := NewDatabase(0)
+	execSAdd(db, [][]byte{[]byte("s1"), []byte("a"), []byte("b"), []byte("c")})
+	execSAdd(db, [][]byte{[]byte("s2"), []byte("b"), []byte("c"), []byte("d")})
+
+	reply := execSInterStore(db, [][]byte{[]byte("dest"), []byte("s1"), []byte("s2")})
+	if string(reply.ToByte()) != ":2\r\n" {
+		t.Error("sinterstore err: ", string(reply.ToByte()))
+	}
+	reply = execSUnionStore(db, [][]byte{[]byte("dest"), []byte("s1"), []byte("s2"), []byte("none")})
+	if string(reply.ToByte()) != ":4\r\n" {
+		t.Error("sunionstore err: ", string(reply.ToByte()))
+	}
+	reply = execSDiff(db, [][]byte{[]byte("s1"), []byte("s2")})
+	if string(reply.ToByte()) != "*1\r\n$1\r\na\r\n" {
+		t.Error("sdiff err: ", string(reply.ToByte()))
+	}
+
+	execSet(db, [][]byte{[]byte("str"), []byte("v")})
+	reply = execSInter(db, [][]byte{[]byte("s1"), []byte("str")})
+	if !protocol.IsErrReply(reply) {
+		t.Error("sinter with string key should be err")
+	}
+}
+
+func TestSMoveUndo(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewConnection(nil)
+	db.Exec(conn, [][]byte{[]byte("SADD"), []byte("src"), []byte("a"), []byte("b")})
+	db.Exec(conn, [][]byte{[]byte("SET"), []byte("str"), []byte("v")})
+
+	db.Exec(conn, [][]byte{[]byte("MULTI")})
+	db.Exec(conn, [][]byte{[]byte("SMOVE"), []byte("src"), []byte("dest"), []byte("a")})
+	db.Exec(conn, [][]byte{[]byte("SADD"), []byte("str"), []byte("a")})
+	reply := db.Exec(conn, [][]byte{[]byte("EXEC")})
+	if !protocol.IsErrReply(reply) {
+		t.Error("exec should be aborted: ", string(reply.ToByte()))
+	}
+
+	reply = db.Exec(conn, [][]byte{[]byte("SCARD"), []byte("src")})
+	if string(reply.ToByte()) != ":2\r\n" {
+		t.Error("undo smove err: ", string(reply.ToByte()))
+	}
+	if _, exists := db.GetEntity("dest"); exists {
+		t.Error("undo smove should remove the dest")
+	}
+}
+
+func TestSMoveSameSet(t *testing.T) {
+	db := NewDatabase(0)
+	execSAdd(db, [][]byte{[]byte("s"), []byte("m")})
+	reply := execSMove(db, [][]byte{[]byte("s"), []byte("s"), []byte("m")})
+	if string(reply.ToByte()) != ":1\r\n" {
+		t.Error("smove into the same set err: ", string(reply.ToByte()))
+	}
+	reply = execSIsMember(db, [][]byte{[]byte("s"), []byte("m")})
+	if string(reply.ToByte()) != ":1\r\n" {
+		t.Error("the member should be kept: ", string(reply.ToByte()))
+	}
+	reply = execSMove(db, [][]byte{[]byte("s"), []byte("s"), []byte("x")})
+	if string(reply.ToByte()) != ":0\r\n" {
+		t.Error("smove of the missing member err: ", string(reply.ToByte()))
+	}
+}
+
+func TestSRandMemberRange(t *testing.T) {
+	db := NewDatabase(0)
+	execSAdd(db, [][]byte{[]byte("s"), []byte("a"), []byte("b")})
+	for _, count := range []string{"-9223372036854775807", "-9223372036854775808", "9223372036854775807",
+		"-4000000000000000000", strconv.Itoa(-RANDOM_MAX_COUNT - 1)} {
+		reply := execSRandMember(db, [][]byte{[]byte("s"), []byte(count)})
+		if string(reply.ToByte()) != "-"+COUNT_RANGE_ERR+"\r\n" {
+			t.Error("srandmember out of range err: ", count, string(reply.ToByte()))
+		}
+	}
+	reply := execSRandMember(db, [][]byte{[]byte("s"), []byte("-5")})
+	if !strings.HasPrefix(string(reply.ToByte()), "*5\r\n") {
+		t.Error("srandmember with negative count err: ", string(reply.ToByte()))
+	}
+	reply = execSPop(db, [][]byte{[]byte("s"), []byte("-1")})
+	if string(reply.ToByte()) != "-ERR value is out of range, must be positive\r\n" {
+		t.Error("spop with negative count err: ", string(reply.ToByte()))
+	}
+}
+
+func TestSetRemoveTTL(t *testing.T) {
+	db := NewDatabase(0)
+	conn := connection.NewFakeConnection()
+	// the emptied set is removed with its ttl, the set created again does not inherit it
+	for _, remove := range [][]string{{"SREM", "s", "m"}, {"SPOP", "s"}, {"SMOVE", "s", "dest", "m"}} {
+		db.Exec(conn, utils.CmdLine1("SADD", "s", "m"))
+		db.Exec(conn, utils.CmdLine1("EXPIRE", "s", "100"))
+		db.Exec(conn, utils.CmdLine1(remove[0], remove[1:]...))
+		db.Exec(conn, utils.CmdLine1("SADD", "s", "m"))
+		if reply := db.Exec(conn, utils.CmdLine1("TTL", "s")); string(reply.ToByte()) != ":-1\r\n" {
+			t.Error("the ttl of the set emptied by ", remove[0], " should be removed: ", string(reply.ToByte()))
+		}
+		db.Exec(conn, utils.CmdLine1("DEL", "s"))
+	}
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"github.com/xzwsloser/Go-redis/resp/connection"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+SLOWLOG GET [count]
+SLOWLOG LEN
+SLOWLOG RESET
+the entry is [id, timestamp, duration in microseconds, args, client address, client name]
+*/
+
+const (
+	// SLOWLOG_MAX_ARGC and SLOWLOG_MAX_STRING limit the args kept by an entry like redis
+	SLOWLOG_MAX_ARGC          = 32
+	SLOWLOG_MAX_STRING        = 128
+	SLOWLOG_DEFAULT_GET_COUNT = 10
+	SLOWLOG_UNKNOWN_SUBCMD    = "ERR unknown subcommand or wrong number of arguments for 'SLOWLOG'"
+	SLOWLOG_COUNT_ERR         = "ERR count should be greater than or equal to -1"
+	REDACTED_ARG              = "(redacted)"
+)
+
+type slowlogEntry struct {
+	id        int64
+	timestamp int64
+	duration  int64
+	args      [][]byte
+	addr      string
+	name      string
+}
+
+// slowlog keeps the latest slow commands in the ring buffer
+type slowlog struct {
+	mu     sync.Mutex
+	nextID int64
+	// logSlowerThan is the threshold in microseconds, negative means disabled
+	logSlowerThan int64
+	entries       []*slowlogEntry
+	// head is the index of the newest entry, size is the number of the entries
+	head int
+	size int
+}
+
+func newSlowlog(logSlowerThan int64, maxLen int) *slowlog {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	return &slowlog{
+		logSlowerThan: logSlowerThan,
+		entries:       make([]*slowlogEntry, maxLen),
+		head:          -1,
+	}
+}
+
+func newSlowlogByConfig() *slowlog {
+	cfg := config.GetSlowlogConfig()
+	return newSlowlog(cfg.LogSlowerThan, cfg.MaxLen)
+}
+
+// record add the command into the slowlog if it is slower than the threshold,
+// the commands of the internal connections and the commands carrying the password are skipped
+func (log *slowlog) record(conn redis.Conn, cmdLine [][]byte, duration time.Duration) {
+	if log.logSlowerThan < 0 || len(log.entries) == 0 || duration.Microseconds() < log.logSlowerThan {
+		return
+	}
+	if conn.GetUser() == connection.INTERNAL_USER || hiddenCommand(string(cmdLine[0])) {
+		return
+	}
+
+	entry := &slowlogEntry{
+		timestamp: time.Now().Unix(),
+		duration:  duration.Microseconds(),
+		args:      slowlogArgs(cmdLine),
+		addr:      conn.RemoteAddr(),
+		name:      conn.GetName(),
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	entry.id = log.nextID
+	log.nextID++
+	log.head = (log.head + 1) % len(log.entries)
+	log.entries[log.head] = entry
+	log.size = min(log.size+1, len(log.entries))
+}
+
+// latest return the newest entries, count -1 means all of them
+func (log *slowlog) latest(count int) []*slowlogEntry {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if count < 0 || count > log.size {
+		count = log.size
+	}
+	result := make([]*slowlogEntry, 0, count)
+	for i := 0; i < count; i++ {
+		idx := (log.head - i + len(log.entries)) % len(log.entries)
+		result = append(result, log.entries[idx])
+	}
+	return result
+}
+
+func (log *slowlog) len() int {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return log.size
+}
+
+// reset remove all the entries, the id keeps increasing
+func (log *slowlog) reset() {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	clear(log.entries)
+	log.head = -1
+	log.size = 0
+}
+
+// hiddenCommand judge whether the command is hidden from the slowlog and the monitors,
+// they are the commands carrying the password and the replication handshake
+func hiddenCommand(cmdName string) bool {
+	switch strings.ToLower(cmdName) {
+	case "auth", "hello", "psync", "replconf":
+		return true
+	}
+	return false
+}
+
+// slowlogArgs copy the args with the truncation and hide the passwords
+func slowlogArgs(cmdLine [][]byte) [][]byte {
+	argc := min(len(cmdLine), SLOWLOG_MAX_ARGC)
+	args := make([][]byte, 0, argc)
+	for i := 0; i < argc; i++ {
+		// the last slot tells how many args are left
+		if i == SLOWLOG_MAX_ARGC-1 && len(cmdLine) > SLOWLOG_MAX_ARGC {
+			args = append(args, []byte("... ("+strconv.Itoa(len(cmdLine)-i)+" more arguments)"))
+			break
+		}
+		arg := cmdLine[i]
+		if len(arg) > SLOWLOG_MAX_STRING {
+			truncated := make([]byte, 0, SLOWLOG_MAX_STRING+32)
+			truncated = append(truncated, arg[:SLOWLOG_MAX_STRING]...)
+			truncated = append(truncated, "... ("+strconv.Itoa(len(arg)-SLOWLOG_MAX_STRING)+" more bytes)"...)
+			arg = truncated
+		} else {
+			arg = append([]byte(nil), arg...)
+		}
+		args = append(args, arg)
+	}
+	redactArgs(cmdLine, args)
+	return args
+}
+
+// redactArgs hide the passwords of MIGRATE AUTH/AUTH2 and ACL SETUSER
+func redactArgs(cmdLine [][]byte, args [][]byte) {
+	switch strings.ToLower(string(cmdLine[0])) {
+	case "migrate":
+		for i := 1; i < len(args); i++ {
+			option := strings.ToLower(string(cmdLine[i]))
+			if option == "auth" && i+1 < len(args) {
+				args[i+1] = []byte(REDACTED_ARG)
+			} else if option == "auth2" && i+2 < len(args) {
+				args[i+2] = []byte(REDACTED_ARG)
+			}
+		}
+	case "acl":
+		if len(cmdLine) < 2 || !strings.EqualFold(string(cmdLine[1]), "setuser") {
+			return
+		}
+		for i := 3; i < len(args); i++ {
+			if len(cmdLine[i]) > 0 && strings.ContainsRune("><#!", rune(cmdLine[i][0])) {
+				args[i] = []byte(REDACTED_ARG)
+			}
+		}
+	}
+}
+
+func (r *RedisServer) execSlowlog(args [][]byte) redis.Reply {
+	if len(args) == 0 {
+		return protocol.NewErrReply(SLOWLOG_UNKNOWN_SUBCMD)
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch {
+	case subCmd == "get" && len(args) <= 2:
+		count := SLOWLOG_DEFAULT_GET_COUNT
+		if len(args) == 2 {
+			n, err := strconv.Atoi(string(args[1]))
+			if err != nil || n < -1 {
+				return protocol.NewErrReply(SLOWLOG_COUNT_ERR)
+			}
+			count = n
+		}
+		entries := r.slowlog.latest(count)
+		replies := make([]redis.Reply, 0, len(entries))
+		for _, entry := range entries {
+			replies = append(replies, protocol.NewMultiRawReply([]redis.Reply{
+				protocol.NewIntReply(entry.id),
+				protocol.NewIntReply(entry.timestamp),
+				protocol.NewIntReply(entry.duration),
+				protocol.NewMultiReply(entry.args),
+				protocol.NewBulkReply([]byte(entry.addr)),
+				protocol.NewBulkReply([]byte(entry.name)),
+			}))
+		}
+		return protocol.NewMultiRawReply(replies)
+	case subCmd == "len" && len(args) == 1:
+		return protocol.NewIntReply(int64(r.slowlog.len()))
+	case subCmd == "reset" && len(args) == 1:
+		r.slowlog.reset()
+		return protocol.NewOkReply()
+	}
+	return protocol.NewErrReply(SLOWLOG_UNKNOWN_SUBCMD)
+}
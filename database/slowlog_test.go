@@ -0,0 +1,69 @@
+package database
+
+import (
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestSlowlog(t *testing.T) {
+	server := NewPureServer()
+	server.slowlog = newSlowlog(0, 3)
+	conn := newClientConn()
+
+	replyOf(server, conn, "CLIENT", "SETNAME", "app")
+	replyOf(server, conn, "SET", "k", "v")
+	replyOf(server, conn, "AUTH", "secret")
+	replyOf(server, conn, "GET", "k")
+	if reply := replyOf(server, conn, "SLOWLOG", "LEN"); reply != ":3\r\n" {
+		t.Error("the slowlog should be bounded: ", reply)
+	}
+	// SLOWLOG LEN itself is the newest entry
+	reply := replyOf(server, conn, "SLOWLOG", "GET", "2")
+	if !strings.HasPrefix(reply, "*2\r\n*6\r\n:3\r\n") || !strings.Contains(reply, "*6\r\n:2\r\n") ||
+		!strings.Contains(reply, "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n$0\r\n\r\n$3\r\napp\r\n") {
+		t.Error("slowlog get err: ", reply)
+	}
+	if strings.Contains(replyOf(server, conn, "SLOWLOG", "GET", "-1"), "secret") {
+		t.Error("auth should not be logged")
+	}
+	replyOf(server, conn, "SLOWLOG", "RESET")
+	// SLOWLOG RESET is logged after the reset
+	if reply = replyOf(server, conn, "SLOWLOG", "LEN"); reply != ":1\r\n" {
+		t.Error("slowlog reset err: ", reply)
+	}
+
+	server.slowlog = newSlowlog(-1, 3)
+	replyOf(server, conn, "GET", "k")
+	if reply = replyOf(server, conn, "SLOWLOG", "LEN"); reply != ":0\r\n" {
+		t.Error("the slowlog is disabled: ", reply)
+	}
+}
+
+func TestSlowlogArgs(t *testing.T) {
+	args := make([]string, 40)
+	for i := range args {
+		args[i] = strconv.Itoa(i)
+	}
+	args[1] = strings.Repeat("a", SLOWLOG_MAX_STRING+10)
+	result := slowlogArgs(utils.CmdLine1("RPUSH", args...))
+	if len(result) != SLOWLOG_MAX_ARGC {
+		t.Fatal("args count err: ", len(result))
+	}
+	if string(result[SLOWLOG_MAX_ARGC-1]) != "... (10 more arguments)" {
+		t.Error("args truncation err: ", string(result[SLOWLOG_MAX_ARGC-1]))
+	}
+	if string(result[2]) != strings.Repeat("a", SLOWLOG_MAX_STRING)+"... (10 more bytes)" {
+		t.Error("string truncation err: ", string(result[2]))
+	}
+
+	result = slowlogArgs(utils.CmdLine1("MIGRATE", "host", "6379", "k", "0", "1000", "AUTH2", "user", "pass"))
+	if string(result[8]) != REDACTED_ARG || string(result[7]) != "user" {
+		t.Error("migrate redaction err: ", string(result[8]))
+	}
+	result = slowlogArgs(utils.CmdLine1("ACL", "SETUSER", "alice", "on", ">pass", "~*"))
+	if string(result[4]) != REDACTED_ARG || string(result[5]) != "~*" {
+		t.Error("acl setuser redaction err: ", string(result[4]))
+	}
+}
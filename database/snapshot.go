@@ -0,0 +1,132 @@
+package database
+
+import (
+	"bytes"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"github.com/xzwsloser/Go-redis/lib/logger"
+	"github.com/xzwsloser/Go-redis/rdb"
+	"sync"
+	"time"
+)
+
+// dbSnapshot is the rdb dump of the database in progress. the shards are encoded one by one under their
+// own lock, the key written before the dumper reaches its shard is encoded by the writer first, so the
+// dump is still the view of the moment it began like the copy-on-write of redis
+type dbSnapshot struct {
+	start time.Time
+	// size and expires are the hints of RESIZEDB taken when the dump began
+	size    int
+	expires int
+	// dumped[i] is true after the shard i is encoded, it is accessed when the shard is locked
+	dumped []bool
+	mu     sync.Mutex
+	// captured is the entries encoded by the writers, nil means the key did not exist when the dump began
+	captured map[string][]byte
+}
+
+// newDBSnapshot begin the dump of the database, all the shards should be locked
+func newDBSnapshot(db *Database, start time.Time) *dbSnapshot {
+	return &dbSnapshot{
+		start:    start,
+		size:     db.data.Len(),
+		expires:  db.ttlMap.Len(),
+		dumped:   make([]bool, db.data.ShardCount()),
+		captured: make(map[string][]byte),
+	}
+}
+
+// capture encode the keys before they are written, the keys should be locked for writing
+func (snap *dbSnapshot) capture(db *Database, keys []string) {
+	for _, key := range keys {
+		if snap.dumped[db.data.ShardIndex(key)] {
+			continue
+		}
+		snap.mu.Lock()
+		_, captured := snap.captured[key]
+		snap.mu.Unlock()
+		if captured {
+			continue
+		}
+		encoded := snap.encode(db, key)
+		snap.mu.Lock()
+		snap.captured[key] = encoded
+		snap.mu.Unlock()
+	}
+}
+
+func (snap *dbSnapshot) isCaptured(key string) bool {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	_, captured := snap.captured[key]
+	return captured
+}
+
+// entryOf get the entity and the expire time of the key when the dump began, the key should be locked
+func (snap *dbSnapshot) entryOf(db *Database, key string, value any) (*database.DataEntity, time.Time, bool) {
+	entity, ok := value.(*database.DataEntity)
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	expireAt, _ := db.GetExpireTime(key)
+	if !expireAt.IsZero() && snap.start.After(expireAt) {
+		return nil, time.Time{}, false
+	}
+	return entity, expireAt, true
+}
+
+// encode the entry of the key, nil if the key does not exist
+func (snap *dbSnapshot) encode(db *Database, key string) []byte {
+	value, exists := db.data.GetWithLock(key)
+	if !exists {
+		return nil
+	}
+	entity, expireAt, ok := snap.entryOf(db, key, value)
+	if !ok {
+		return nil
+	}
+	buf := &bytes.Buffer{}
+	if err := rdb.NewEncoder(buf).WriteEntry(key, entity, expireAt); err != nil {
+		logger.Error("encode the key %s err: %v", key, err)
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// dump encode the database shard by shard, then the entries captured by the writers
+func (snap *dbSnapshot) dump(db *Database, enc *rdb.Encoder) (err error) {
+	err = enc.WriteDBHeader(db.index, snap.size, snap.expires)
+	if err != nil {
+		return err
+	}
+	for i := range snap.dumped {
+		db.data.RLockShard(i)
+		db.data.ForEachInShardWithLock(i, func(key string, value any) bool {
+			if snap.isCaptured(key) {
+				return true
+			}
+			entity, expireAt, ok := snap.entryOf(db, key, value)
+			if !ok {
+				return true
+			}
+			err = enc.WriteEntry(key, entity, expireAt)
+			return err == nil
+		})
+		snap.dumped[i] = true
+		db.data.RUnLockShard(i)
+		if err != nil {
+			return err
+		}
+	}
+	// all the shards are dumped, so no more keys are captured
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+	for _, encoded := range snap.captured {
+		if encoded == nil {
+			continue
+		}
+		if err = enc.WriteEncoded(encoded); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,12 +1,17 @@
 package database
 
 import (
+	"github.com/xzwsloser/Go-redis/datastruct/set"
 	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
 	"github.com/xzwsloser/Go-redis/interface/database"
 	"github.com/xzwsloser/Go-redis/interface/redis"
 	"github.com/xzwsloser/Go-redis/lib/utils"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
+	"math"
+	"math/rand"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 /**
@@ -14,163 +19,332 @@ import (
 @Dscription: 实现 ZSET 中的命令
 */
 
+const (
+	ZSET_FLOAT_ERR      = "ERR min or max is not a float"
+	ZSET_LEX_ERR        = "ERR min or max not valid string range item"
+	ZSET_LIMIT_ERR      = "ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"
+	ZSET_WITHSCORES_ERR = "ERR syntax error, WITHSCORES not supported in combination with BYLEX"
+	ZSET_SCORE_ERR      = "ERR value is not a valid float"
+	ZSET_NAN_ERR        = "ERR resulting score is not a number (NaN)"
+	ZADD_NX_XX_ERR      = "ERR XX and NX options at the same time are not compatible"
+	ZADD_GT_LT_NX_ERR   = "ERR GT, LT, and/or NX options at the same time are not compatible"
+	ZADD_INCR_ERR       = "ERR INCR option supports a single increment-element pair"
+	ZSET_NUMKEYS_ERR    = "ERR at least 1 input key is needed for this command"
+	ZSET_WEIGHT_ERR     = "ERR weight value is not a float"
+	ZSET_CARD_LIMIT_ERR = "ERR LIMIT can't be negative"
+)
+
 func init() {
 	RegisterCommand("ZADD", execZAdd, writeFirstKey, rollbackFirstKey, -4)
 	RegisterCommand("ZCARD", execZCard, readFirstKey, nil, 2)
 	RegisterCommand("ZCOUNT", execZCount, readFirstKey, nil, 4)
+	RegisterCommand("ZLEXCOUNT", execZLexCount, readFirstKey, nil, 4)
 	RegisterCommand("ZINCRBY", execZIncrBy, writeFirstKey, rollbackFirstKey, 4)
 	RegisterCommand("ZRANK", execZRank, readFirstKey, nil, 3)
+	RegisterCommand("ZREVRANK", execZRevRank, readFirstKey, nil, 3)
 	RegisterCommand("ZSCORE", execZScore, readFirstKey, nil, 3)
-	RegisterCommand("ZRANGE", execZRange, readFirstKey, nil, 4)
+	RegisterCommand("ZMSCORE", execZMScore, readFirstKey, nil, -3)
+	RegisterCommand("ZRANGE", execZRange, readFirstKey, nil, -4)
+	RegisterCommand("ZREVRANGE", execZRevRange, readFirstKey, nil, -4)
+	RegisterCommand("ZRANGEBYSCORE", execZRangeByScore, readFirstKey, nil, -4)
+	RegisterCommand("ZREVRANGEBYSCORE", execZRevRangeByScore, readFirstKey, nil, -4)
+	RegisterCommand("ZRANGEBYLEX", execZRangeByLex, readFirstKey, nil, -4)
+	RegisterCommand("ZREVRANGEBYLEX", execZRevRangeByLex, readFirstKey, nil, -4)
 	RegisterCommand("ZREM", execZRem, writeFirstKey, rollbackFirstKey, -3)
-	RegisterCommand("ZRANGEBYSCORE", execZRangeByScore, readFirstKey, nil, 4)
 	RegisterCommand("ZREMRANGEBYRANK", execZRemRangeByRank, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("ZREMRANGEBYSCORE", execZRemRangeByScore, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("ZREMRANGEBYLEX", execZRemRangeByLex, writeFirstKey, rollbackFirstKey, 4)
+	RegisterCommand("ZPOPMIN", execZPopMin, writeFirstKey, rollbackFirstKey, -2)
+	RegisterCommand("ZPOPMAX", execZPopMax, writeFirstKey, rollbackFirstKey, -2)
+	RegisterCommand("BZPOPMIN", execBZPopMin, prepareBlockingPop, rollbackBlockingPop, -3)
+	RegisterCommand("BZPOPMAX", execBZPopMax, prepareBlockingPop, rollbackBlockingPop, -3)
+	RegisterCommand("ZRANDMEMBER", execZRandMember, readFirstKey, nil, -2)
+	RegisterCommand("ZUNION", execZUnion, prepareZAlgebra, nil, -3)
+	RegisterCommand("ZINTER", execZInter, prepareZAlgebra, nil, -3)
+	RegisterCommand("ZDIFF", execZDiff, prepareZAlgebra, nil, -3)
+	RegisterCommand("ZINTERCARD", execZInterCard, prepareZAlgebra, nil, -3)
+	RegisterCommand("ZUNIONSTORE", execZUnionStore, prepareZAlgebraStore, rollbackFirstKey, -4)
+	RegisterCommand("ZINTERSTORE", execZInterStore, prepareZAlgebraStore, rollbackFirstKey, -4)
+	RegisterCommand("ZDIFFSTORE", execZDiffStore, prepareZAlgebraStore, rollbackFirstKey, -4)
+	RegisterCommand("ZRANGESTORE", execZRangeStore, prepareZRangeStore, rollbackFirstKey, -5)
 }
 
-func (db *Database) getOrInitSortedSet(key string) *sortedset.SortedSet {
+// getAsSortedSet get the sorted set of the key, return err reply if the key is not a sorted set
+func (db *Database) getAsSortedSet(key string) (*sortedset.SortedSet, redis.Reply) {
 	entity, exists := db.GetEntityWithLock(key)
 	if !exists {
-		ns := sortedset.NewSortedSet()
-		db.PutEntityWithLock(key, &database.DataEntity{
-			Data: ns,
-		})
-		return ns
+		return nil, nil
 	}
 	ss, ok := entity.Data.(*sortedset.SortedSet)
 	if !ok {
-		ns := sortedset.NewSortedSet()
-		db.PutEntityWithLock(key, &database.DataEntity{
-			Data: ns,
-		})
-		return ns
+		return nil, protocol.NewErrReply(WRONG_TYPE_ERR)
+	}
+	return ss, nil
+}
+
+// getOrCreateSortedSet get the sorted set of the key, an empty sorted set is created if the key does not exist
+func (db *Database) getOrCreateSortedSet(key string) (*sortedset.SortedSet, redis.Reply) {
+	ss, errReply := db.getAsSortedSet(key)
+	if errReply != nil || ss != nil {
+		return ss, errReply
 	}
-	return ss
+	ss = sortedset.NewSortedSet()
+	db.PutEntityWithLock(key, &database.DataEntity{
+		Data: ss,
+	})
+	return ss, nil
 }
 
-// ZADD  e.g ZADD key score member ...
+// zaddFlags are the options of ZADD
+type zaddFlags struct {
+	nx   bool
+	xx   bool
+	gt   bool
+	lt   bool
+	ch   bool
+	incr bool
+}
+
+// ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...]
 func execZAdd(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	pairLens := len(cmdLine) - 1
-	if pairLens%2 == 1 {
-		return protocol.NewErrReply("the args of command Err")
-	}
-	elements := make([]*sortedset.Element, pairLens/2)
-	j := 0
-	for i := 1; i < len(cmdLine); i += 2 {
-		score, err := strconv.ParseFloat(string(cmdLine[i]), 64)
-		if err != nil {
-			return protocol.NewErrReply("the args of command Err")
+	flags := zaddFlags{}
+	i := 1
+options:
+	for ; i < len(cmdLine); i++ {
+		switch strings.ToLower(string(cmdLine[i])) {
+		case "nx":
+			flags.nx = true
+		case "xx":
+			flags.xx = true
+		case "gt":
+			flags.gt = true
+		case "lt":
+			flags.lt = true
+		case "ch":
+			flags.ch = true
+		case "incr":
+			flags.incr = true
+		default:
+			break options
+		}
+	}
+	pairs := cmdLine[i:]
+	if len(pairs) == 0 || len(pairs)%2 == 1 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	if flags.nx && flags.xx {
+		return protocol.NewErrReply(ZADD_NX_XX_ERR)
+	}
+	if (flags.gt && flags.lt) || (flags.nx && (flags.gt || flags.lt)) {
+		return protocol.NewErrReply(ZADD_GT_LT_NX_ERR)
+	}
+	if flags.incr && len(pairs) > 2 {
+		return protocol.NewErrReply(ZADD_INCR_ERR)
+	}
+	elements := make([]*sortedset.Element, len(pairs)/2)
+	for j := range elements {
+		score, err := strconv.ParseFloat(string(pairs[j*2]), 64)
+		if err != nil || math.IsNaN(score) {
+			return protocol.NewErrReply(ZSET_SCORE_ERR)
 		}
 		elements[j] = &sortedset.Element{
-			Member: string(cmdLine[i+1]),
+			Member: string(pairs[j*2+1]),
 			Score:  score,
 		}
-		j++
 	}
 
-	ss := db.getOrInitSortedSet(key)
+	key := string(cmdLine[0])
+	ss, errReply := db.getOrCreateSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	defer db.removeIfEmpty(key, ss)
+	var added, changed int64
+	var score float64
 	var result int
 	for _, element := range elements {
-		result += ss.Put(element.Member, element.Score)
+		score, result, errReply = zaddElement(ss, element.Member, element.Score, flags)
+		if errReply != nil {
+			return errReply
+		}
+		switch result {
+		case zaddAdded:
+			added++
+		case zaddChanged:
+			changed++
+		}
+	}
+	if added+changed > 0 {
+		db.signalBlocked(key)
+		db.addAof(utils.CmdLine2("ZADD", cmdLine))
+	}
+	if flags.incr {
+		if result == zaddSkipped {
+			return protocol.NewNullBulkReply()
+		}
+		return protocol.NewDoubleReply(score)
 	}
+	if flags.ch {
+		return protocol.NewIntReply(added + changed)
+	}
+	return protocol.NewIntReply(added)
+}
+
+const (
+	zaddAdded = iota
+	zaddChanged
+	zaddUnchanged
+	zaddSkipped
+)
 
-	db.addAof(utils.CmdLine2("ZADD", cmdLine))
-	return protocol.NewIntReply(int64(result))
+// zaddElement put the member by the flags of ZADD, return the score of the member after the put
+func zaddElement(ss *sortedset.SortedSet, member string, score float64, flags zaddFlags) (float64, int, redis.Reply) {
+	old := ss.Get(member)
+	if old == nil {
+		if flags.xx {
+			return 0, zaddSkipped, nil
+		}
+		ss.Put(member, score)
+		return score, zaddAdded, nil
+	}
+	oldScore := old.Score
+	if flags.nx {
+		return oldScore, zaddSkipped, nil
+	}
+	if flags.incr {
+		score += oldScore
+		if math.IsNaN(score) {
+			return 0, zaddSkipped, protocol.NewErrReply(ZSET_NAN_ERR)
+		}
+	}
+	if (flags.gt && score <= oldScore) || (flags.lt && score >= oldScore) {
+		return oldScore, zaddSkipped, nil
+	}
+	if score == oldScore {
+		return score, zaddUnchanged, nil
+	}
+	ss.Put(member, score)
+	return score, zaddChanged, nil
 }
 
 // ZCARD key
 func execZCard(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	ss := db.getOrInitSortedSet(key)
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if ss == nil {
+		return protocol.NewIntReply(0)
+	}
 	return protocol.NewIntReply(ss.Len())
 }
 
-// ZCOUNT e.g ZCOUNT key min max
+// ZCOUNT key min max
 func execZCount(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	minValue, err := strconv.ParseFloat(string(cmdLine[1]), 64)
-	maxValue, err := strconv.ParseFloat(string(cmdLine[2]), 64)
-	if err != nil {
-		return protocol.NewErrReply("args of request Err")
+	return db.execCountInRange(cmdLine, parseScoreBorders)
+}
+
+// ZLEXCOUNT key min max
+func execZLexCount(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execCountInRange(cmdLine, parseLexBorders)
+}
+
+func (db *Database) execCountInRange(cmdLine [][]byte, parse bordersParser) redis.Reply {
+	min, max, errReply := parse(cmdLine[1], cmdLine[2])
+	if errReply != nil {
+		return errReply
 	}
-	minBorder := &sortedset.ScoreBorder{
-		Value: minValue,
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
 	}
-
-	maxBorder := &sortedset.ScoreBorder{
-		Value: maxValue,
+	if ss == nil {
+		return protocol.NewIntReply(0)
 	}
-
-	ss := db.getOrInitSortedSet(key)
-	result := ss.CountInRange(minBorder, maxBorder)
-	return protocol.NewIntReply(result)
+	return protocol.NewIntReply(ss.CountInRange(min, max))
 }
 
 // ZINCRBY key increment member
 func execZIncrBy(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
 	increment, err := strconv.ParseFloat(string(cmdLine[1]), 64)
-	if err != nil {
-		return protocol.NewErrReply("invalid increment args")
+	if err != nil || math.IsNaN(increment) {
+		return protocol.NewErrReply(ZSET_SCORE_ERR)
 	}
-	member := string(cmdLine[2])
-	ss := db.getOrInitSortedSet(key)
-	element := ss.Get(member)
-	if element == nil {
-		return protocol.NewErrReply("no such a member")
+	ss, errReply := db.getOrCreateSortedSet(key)
+	if errReply != nil {
+		return errReply
 	}
-	element.Score += increment
-	result := ss.Put(element.Member, element.Score)
+	defer db.removeIfEmpty(key, ss)
+	score, _, errReply := zaddElement(ss, string(cmdLine[2]), increment, zaddFlags{incr: true})
+	if errReply != nil {
+		return errReply
+	}
+	db.signalBlocked(key)
 	db.addAof(utils.CmdLine2("ZINCRBY", cmdLine))
-	return protocol.NewIntReply(int64(result))
+	return protocol.NewDoubleReply(score)
 }
 
-// ZRank key member
+// ZRANK key member
 func execZRank(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	member := string(cmdLine[1])
-	ss := db.getOrInitSortedSet(key)
-	rank, err := ss.GetRank(member, true)
+	return db.execRank(cmdLine, false)
+}
+
+// ZREVRANK key member
+func execZRevRank(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execRank(cmdLine, true)
+}
+
+func (db *Database) execRank(cmdLine [][]byte, desc bool) redis.Reply {
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if ss == nil {
+		return protocol.NewNullBulkReply()
+	}
+	rank, err := ss.GetRank(string(cmdLine[1]), desc)
 	if err != nil {
-		return protocol.NewErrReply("no such a member")
+		return protocol.NewNullBulkReply()
 	}
 	return protocol.NewIntReply(rank)
 }
 
 // ZSCORE key member
 func execZScore(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	member := string(cmdLine[1])
-	ss := db.getOrInitSortedSet(key)
-	element := ss.Get(member)
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if ss == nil {
+		return protocol.NewNullBulkReply()
+	}
+	element := ss.Get(string(cmdLine[1]))
 	if element == nil {
-		return protocol.NewErrReply("no such a member")
+		return protocol.NewNullBulkReply()
 	}
-	result := strconv.FormatFloat(element.Score, 'f', 2, 64)
-	return protocol.NewBulkReply([]byte(result))
+	return protocol.NewDoubleReply(element.Score)
 }
 
-// ZRange key start stop
-func execZRange(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	start, err := strconv.ParseInt(string(cmdLine[1]), 10, 64)
-	stop, err := strconv.ParseInt(string(cmdLine[2]), 10, 64)
-	if err != nil {
-		return protocol.NewErrReply("no such a member")
-	}
-
-	ss := db.getOrInitSortedSet(key)
-	elements := ss.GetByRankRange(start, stop)
-	if elements == nil {
-		return protocol.NewErrReply("invalid rank range")
+// ZMSCORE key member [member ...]
+func execZMScore(db *Database, cmdLine [][]byte) redis.Reply {
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
 	}
-	args := make([][]byte, len(elements))
-	for i, element := range elements {
-		member := element.Member
-		score := strconv.FormatFloat(element.Score, 'f', 2, 64)
-		args[i] = []byte(member + ":" + score)
+	result := make([]redis.Reply, len(cmdLine)-1)
+	for i, member := range cmdLine[1:] {
+		var element *sortedset.Element
+		if ss != nil {
+			element = ss.Get(string(member))
+		}
+		if element == nil {
+			result[i] = protocol.NewNullBulkReply()
+		} else {
+			result[i] = protocol.NewDoubleReply(element.Score)
+		}
 	}
-	return protocol.NewMultiReply(args)
+	return protocol.NewMultiRawReply(result)
 }
 
 // execZRem: ZREM key member [member ...]
@@ -180,54 +354,804 @@ func execZRem(db *Database, cmdLine [][]byte) redis.Reply {
 	for i := 1; i < len(cmdLine); i++ {
 		members[i-1] = string(cmdLine[i])
 	}
-	ss := db.getOrInitSortedSet(key)
+	ss, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ss == nil {
+		return protocol.NewIntReply(0)
+	}
 	var result int64 = 0
 	for _, member := range members {
 		result += ss.Remove(member)
 	}
-	db.addAof(utils.CmdLine2("ZREM", cmdLine))
+	db.removeIfEmpty(key, ss)
+	if result > 0 {
+		db.addAof(utils.CmdLine2("ZREM", cmdLine))
+	}
 	return protocol.NewIntReply(result)
 }
 
-// ZRangeByScore key min max
-func execZRangeByScore(db *Database, cmdLine [][]byte) redis.Reply {
-	key := string(cmdLine[0])
-	minValue, err := strconv.ParseFloat(string(cmdLine[1]), 64)
-	maxValue, err := strconv.ParseFloat(string(cmdLine[2]), 64)
-	if err != nil {
-		return protocol.NewErrReply("in valid args")
+// removeIfEmpty remove the key when the last member of the sorted set is removed
+func (db *Database) removeIfEmpty(key string, ss *sortedset.SortedSet) {
+	if ss.Len() == 0 {
+		db.RemoveEntityWithLock(key)
+		db.Persister(key)
+	}
+}
+
+type bordersParser func(min []byte, max []byte) (sortedset.Border, sortedset.Border, redis.Reply)
+
+// parseScoreBorder parse the score border, e.g 1.5 (1.5 -inf +inf
+func parseScoreBorder(arg []byte) (*sortedset.ScoreBorder, bool) {
+	value := string(arg)
+	switch strings.ToLower(value) {
+	case "-inf":
+		return &sortedset.ScoreBorder{Inf: sortedset.ScoreInfLow}, true
+	case "+inf", "inf":
+		return &sortedset.ScoreBorder{Inf: sortedset.ScoreInfHigh}, true
 	}
-	ss := db.getOrInitSortedSet(key)
-	min := &sortedset.ScoreBorder{
-		Value: minValue,
+	border := &sortedset.ScoreBorder{}
+	if strings.HasPrefix(value, "(") {
+		border.Exclude = true
+		value = value[1:]
 	}
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(score) {
+		return nil, false
+	}
+	border.Value = score
+	return border, true
+}
 
-	max := &sortedset.ScoreBorder{
-		Value: maxValue,
+func parseScoreBorders(minArg []byte, maxArg []byte) (sortedset.Border, sortedset.Border, redis.Reply) {
+	min, ok1 := parseScoreBorder(minArg)
+	max, ok2 := parseScoreBorder(maxArg)
+	if !ok1 || !ok2 {
+		return nil, nil, protocol.NewErrReply(ZSET_FLOAT_ERR)
 	}
+	return min, max, nil
+}
 
-	elements := ss.GetByRange(min, max, true)
-	if elements == nil {
-		return protocol.NewErrReply("invalid rank range")
+// parseLexBorder parse the member border, e.g [a (a - +
+func parseLexBorder(arg []byte) (*sortedset.MemberBorder, bool) {
+	value := string(arg)
+	switch {
+	case value == "-":
+		return &sortedset.MemberBorder{Inf: sortedset.MemInfLow}, true
+	case value == "+":
+		return &sortedset.MemberBorder{Inf: sortedset.MemInfHigh}, true
+	case strings.HasPrefix(value, "["):
+		return &sortedset.MemberBorder{Value: value[1:]}, true
+	case strings.HasPrefix(value, "("):
+		return &sortedset.MemberBorder{Value: value[1:], Exclude: true}, true
 	}
-	args := make([][]byte, len(elements))
-	for i, element := range elements {
-		member := element.Member
-		score := strconv.FormatFloat(element.Score, 'f', 2, 64)
-		args[i] = []byte(member + ":" + score)
+	return nil, false
+}
+
+func parseLexBorders(minArg []byte, maxArg []byte) (sortedset.Border, sortedset.Border, redis.Reply) {
+	min, ok1 := parseLexBorder(minArg)
+	max, ok2 := parseLexBorder(maxArg)
+	if !ok1 || !ok2 {
+		return nil, nil, protocol.NewErrReply(ZSET_LEX_ERR)
+	}
+	return min, max, nil
+}
+
+const (
+	zrangeByRank = iota
+	zrangeByScore
+	zrangeByLex
+)
+
+// zrangeSpec is the range of ZRANGE and the commands like ZRANGEBYSCORE
+type zrangeSpec struct {
+	by  int
+	rev bool
+	// start and stop are the ranks, or the min and the max of BYSCORE and BYLEX which are swapped by REV
+	start []byte
+	stop  []byte
+	// limited is true if LIMIT is given, the negative count means all the elements after the offset
+	limited    bool
+	offset     int64
+	count      int64
+	withScores bool
+}
+
+// parseZRangeOptions parse the options after the range, only the allowed options are accepted
+func parseZRangeOptions(spec *zrangeSpec, args [][]byte, allowed ...string) redis.Reply {
+	for i := 0; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		if !slices.Contains(allowed, option) {
+			return protocol.NewErrReply(SYNTAX_ERR)
+		}
+		switch option {
+		case "byscore":
+			spec.by = zrangeByScore
+		case "bylex":
+			spec.by = zrangeByLex
+		case "rev":
+			spec.rev = true
+		case "withscores":
+			spec.withScores = true
+		case "limit":
+			if i+2 >= len(args) {
+				return protocol.NewErrReply(SYNTAX_ERR)
+			}
+			offset, err1 := strconv.ParseInt(string(args[i+1]), 10, 64)
+			count, err2 := strconv.ParseInt(string(args[i+2]), 10, 64)
+			if err1 != nil || err2 != nil {
+				return protocol.NewErrReply(INT_RANGE_ERR)
+			}
+			spec.limited, spec.offset, spec.count = true, offset, count
+			i += 2
+		}
+	}
+	if spec.limited && spec.by == zrangeByRank {
+		return protocol.NewErrReply(ZSET_LIMIT_ERR)
+	}
+	if spec.withScores && spec.by == zrangeByLex {
+		return protocol.NewErrReply(ZSET_WITHSCORES_ERR)
+	}
+	return nil
+}
+
+// normalizeRanks convert the ranks which may be negative to the ranks from 0, ok is false if the range is empty
+func normalizeRanks(start int64, stop int64, size int64) (int64, int64, bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	start = max(start, 0)
+	stop = min(stop, size-1)
+	return start, stop, start <= stop
+}
+
+// rankRange get the elements between the ranks from 0, the ranks count from the highest score if rev
+func rankRange(ss *sortedset.SortedSet, start int64, stop int64, rev bool) []*sortedset.Element {
+	size := ss.Len()
+	start, stop, ok := normalizeRanks(start, stop, size)
+	if !ok {
+		return nil
+	}
+	if rev {
+		start, stop = size-1-stop, size-1-start
+	}
+	elements := ss.GetByRankRange(start+1, stop+1)
+	if rev {
+		slices.Reverse(elements)
+	}
+	return elements
+}
+
+// zrange get the elements of the range, ss may be nil if the key does not exist
+func zrange(ss *sortedset.SortedSet, spec *zrangeSpec) ([]*sortedset.Element, redis.Reply) {
+	if spec.by == zrangeByRank {
+		start, err1 := strconv.ParseInt(string(spec.start), 10, 64)
+		stop, err2 := strconv.ParseInt(string(spec.stop), 10, 64)
+		if err1 != nil || err2 != nil {
+			return nil, protocol.NewErrReply(INT_RANGE_ERR)
+		}
+		if ss == nil {
+			return nil, nil
+		}
+		return rankRange(ss, start, stop, spec.rev), nil
+	}
+
+	minArg, maxArg := spec.start, spec.stop
+	if spec.rev {
+		minArg, maxArg = maxArg, minArg
+	}
+	parse := parseScoreBorders
+	if spec.by == zrangeByLex {
+		parse = parseLexBorders
+	}
+	min, max, errReply := parse(minArg, maxArg)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if ss == nil {
+		return nil, nil
+	}
+	elements := ss.GetByRange(min, max, spec.rev)
+	if spec.limited {
+		if spec.offset < 0 || spec.offset >= int64(len(elements)) {
+			return nil, nil
+		}
+		elements = elements[spec.offset:]
+		if spec.count >= 0 && spec.count < int64(len(elements)) {
+			elements = elements[:spec.count]
+		}
+	}
+	return elements, nil
+}
+
+// elementsReply reply the members, the scores follow the members if withScores
+func elementsReply(elements []*sortedset.Element, withScores bool) redis.Reply {
+	if !withScores {
+		members := make([][]byte, len(elements))
+		for i, element := range elements {
+			members[i] = []byte(element.Member)
+		}
+		return protocol.NewMultiReply(members)
+	}
+	result := make([]redis.Reply, 0, len(elements)*2)
+	for _, element := range elements {
+		result = append(result, protocol.NewBulkReply([]byte(element.Member)), protocol.NewDoubleReply(element.Score))
+	}
+	return protocol.NewMultiRawReply(result)
+}
+
+func (db *Database) execZRangeSpec(cmdLine [][]byte, spec *zrangeSpec, allowed ...string) redis.Reply {
+	spec.start, spec.stop = cmdLine[1], cmdLine[2]
+	if errReply := parseZRangeOptions(spec, cmdLine[3:], allowed...); errReply != nil {
+		return errReply
 	}
-	return protocol.NewMultiReply(args)
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := zrange(ss, spec)
+	if errReply != nil {
+		return errReply
+	}
+	return elementsReply(elements, spec.withScores)
+}
+
+// ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZRangeSpec(cmdLine, &zrangeSpec{}, "byscore", "bylex", "rev", "limit", "withscores")
+}
+
+// ZREVRANGE key start stop [WITHSCORES]
+func execZRevRange(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZRangeSpec(cmdLine, &zrangeSpec{rev: true}, "withscores")
+}
+
+// ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZRangeSpec(cmdLine, &zrangeSpec{by: zrangeByScore}, "withscores", "limit")
+}
+
+// ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZRangeSpec(cmdLine, &zrangeSpec{by: zrangeByScore, rev: true}, "withscores", "limit")
+}
+
+// ZRANGEBYLEX key min max [LIMIT offset count]
+func execZRangeByLex(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZRangeSpec(cmdLine, &zrangeSpec{by: zrangeByLex}, "limit")
 }
 
+// ZREVRANGEBYLEX key max min [LIMIT offset count]
+func execZRevRangeByLex(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZRangeSpec(cmdLine, &zrangeSpec{by: zrangeByLex, rev: true}, "limit")
+}
+
+// ZREMRANGEBYRANK key start stop
 func execZRemRangeByRank(db *Database, cmdLine [][]byte) redis.Reply {
 	key := string(cmdLine[0])
-	start, err := strconv.ParseInt(string(cmdLine[1]), 10, 64)
-	stop, err := strconv.ParseInt(string(cmdLine[2]), 10, 64)
-	if err != nil {
-		return protocol.NewErrReply("in valid args")
+	start, err1 := strconv.ParseInt(string(cmdLine[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(cmdLine[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return protocol.NewErrReply(INT_RANGE_ERR)
+	}
+	ss, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
 	}
-	ss := db.getOrInitSortedSet(key)
-	result := ss.RemByRankRange(start, stop)
+	if ss == nil {
+		return protocol.NewIntReply(0)
+	}
+	start, stop, ok := normalizeRanks(start, stop, ss.Len())
+	if !ok {
+		return protocol.NewIntReply(0)
+	}
+	result := ss.RemByRankRange(start+1, stop+1)
+	db.removeIfEmpty(key, ss)
 	db.addAof(utils.CmdLine2("ZREMRANGEBYRANK", cmdLine))
 	return protocol.NewIntReply(result)
 }
+
+// ZREMRANGEBYSCORE key min max
+func execZRemRangeByScore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execRemoveByRange("ZREMRANGEBYSCORE", cmdLine, parseScoreBorders)
+}
+
+// ZREMRANGEBYLEX key min max
+func execZRemRangeByLex(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execRemoveByRange("ZREMRANGEBYLEX", cmdLine, parseLexBorders)
+}
+
+func (db *Database) execRemoveByRange(cmdName string, cmdLine [][]byte, parse bordersParser) redis.Reply {
+	key := string(cmdLine[0])
+	min, max, errReply := parse(cmdLine[1], cmdLine[2])
+	if errReply != nil {
+		return errReply
+	}
+	ss, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ss == nil {
+		return protocol.NewIntReply(0)
+	}
+	result := ss.RemoveByRange(min, max)
+	if result > 0 {
+		db.removeIfEmpty(key, ss)
+		db.addAof(utils.CmdLine2(cmdName, cmdLine))
+	}
+	return protocol.NewIntReply(result)
+}
+
+// zpop pop count elements with the lowest scores, or the highest scores if max
+func (db *Database) zpop(key string, ss *sortedset.SortedSet, count int64, max bool) []*sortedset.Element {
+	elements := rankRange(ss, 0, count-1, max)
+	popped := make([]*sortedset.Element, len(elements))
+	for i, element := range elements {
+		popped[i] = &sortedset.Element{
+			Member: element.Member,
+			Score:  element.Score,
+		}
+	}
+	for _, element := range popped {
+		ss.Remove(element.Member)
+	}
+	db.removeIfEmpty(key, ss)
+	return popped
+}
+
+// ZPOPMIN key [count]
+func execZPopMin(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZPop("ZPOPMIN", cmdLine, false)
+}
+
+// ZPOPMAX key [count]
+func execZPopMax(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZPop("ZPOPMAX", cmdLine, true)
+}
+
+func (db *Database) execZPop(cmdName string, cmdLine [][]byte, max bool) redis.Reply {
+	if len(cmdLine) > 2 {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	key := string(cmdLine[0])
+	var count int64 = 1
+	if len(cmdLine) == 2 {
+		n, err := strconv.ParseInt(string(cmdLine[1]), 10, 64)
+		if err != nil || n < 0 {
+			return protocol.NewErrReply(POSITIVE_COUNT_ERR)
+		}
+		count = n
+	}
+	ss, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if ss == nil || count == 0 {
+		return protocol.NewMultiReply([][]byte{})
+	}
+	elements := db.zpop(key, ss, count, max)
+	db.addAof(utils.CmdLine1(cmdName, key, strconv.Itoa(len(elements))))
+	return elementsReply(elements, true)
+}
+
+// blockingZPop pop from the first non-empty sorted set of the keys, return the null array if all of them are empty
+func blockingZPop(db *Database, args [][]byte, max bool, ready func(key string) bool) redis.Reply {
+	if _, errReply := parseTimeout(args[len(args)-1]); errReply != nil {
+		return errReply
+	}
+	for _, key := range blockingPopKeys(args) {
+		if !ready(key) {
+			continue
+		}
+		ss, errReply := db.getAsSortedSet(key)
+		if errReply != nil {
+			return errReply
+		}
+		if ss == nil || ss.Len() == 0 {
+			continue
+		}
+		element := db.zpop(key, ss, 1, max)[0]
+		if max {
+			db.addAof(utils.CmdLine1("ZPOPMAX", key, "1"))
+		} else {
+			db.addAof(utils.CmdLine1("ZPOPMIN", key, "1"))
+		}
+		return protocol.NewMultiRawReply([]redis.Reply{
+			protocol.NewBulkReply([]byte(key)),
+			protocol.NewBulkReply([]byte(element.Member)),
+			protocol.NewDoubleReply(element.Score),
+		})
+	}
+	return protocol.NewNullArrayReply()
+}
+
+// BZPOPMIN key [key ...] timeout
+func execBZPopMin(db *Database, args [][]byte) redis.Reply {
+	return blockingZPop(db, args, false, db.noWaiters)
+}
+
+// BZPOPMAX key [key ...] timeout
+func execBZPopMax(db *Database, args [][]byte) redis.Reply {
+	return blockingZPop(db, args, true, db.noWaiters)
+}
+
+// ZRANDMEMBER key [count [WITHSCORES]]
+func execZRandMember(db *Database, cmdLine [][]byte) redis.Reply {
+	if len(cmdLine) > 3 || (len(cmdLine) == 3 && strings.ToLower(string(cmdLine[2])) != "withscores") {
+		return protocol.NewErrReply(SYNTAX_ERR)
+	}
+	ss, errReply := db.getAsSortedSet(string(cmdLine[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if len(cmdLine) == 1 {
+		if ss == nil || ss.Len() == 0 {
+			return protocol.NewNullBulkReply()
+		}
+		rank := rand.Int63n(ss.Len()) + 1
+		element := ss.GetByRankRange(rank, rank)[0]
+		return protocol.NewBulkReply([]byte(element.Member))
+	}
+	count, err := strconv.ParseInt(string(cmdLine[1]), 10, 64)
+	if err != nil {
+		return protocol.NewErrReply(INT_RANGE_ERR)
+	}
+	if count < -RANDOM_MAX_COUNT || count > math.MaxInt64/2 {
+		return protocol.NewErrReply(COUNT_RANGE_ERR)
+	}
+	withScores := len(cmdLine) == 3
+	if ss == nil || ss.Len() == 0 || count == 0 {
+		return elementsReply(nil, withScores)
+	}
+	all := ss.GetByRankRange(1, ss.Len())
+	var elements []*sortedset.Element
+	if count > 0 {
+		// the members are distinct when the count is positive
+		if count >= int64(len(all)) {
+			elements = all
+		} else {
+			elements = make([]*sortedset.Element, count)
+			for i, idx := range rand.Perm(len(all))[:count] {
+				elements[i] = all[idx]
+			}
+		}
+	} else {
+		// the members may be repeated, the count is bounded by RANDOM_MAX_COUNT
+		elements = make([]*sortedset.Element, 0, -count)
+		for i := int64(0); i < -count; i++ {
+			elements = append(elements, all[rand.Intn(len(all))])
+		}
+	}
+	return elementsReply(elements, withScores)
+}
+
+/**
+ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+ZDIFF numkeys key [key ...] [WITHSCORES]
+the STORE variants take the destination before numkeys and never accept WITHSCORES,
+the sets are accepted as the inputs and the score of their members is 1
+*/
+
+// zsetKeys get the input keys after numkeys, nil if numkeys is invalid
+func zsetKeys(args [][]byte) []string {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys <= 0 || numKeys > len(args)-1 {
+		return nil
+	}
+	return bytesToString(args[1 : numKeys+1])
+}
+
+// prepareZAlgebra: ZUNION numkeys key [key ...]
+func prepareZAlgebra(args [][]byte) ([]string, []string) {
+	return nil, zsetKeys(args)
+}
+
+// prepareZAlgebraStore: ZUNIONSTORE destination numkeys key [key ...]
+func prepareZAlgebraStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, zsetKeys(args[1:])
+}
+
+// prepareZRangeStore: ZRANGESTORE dst src min max
+func prepareZRangeStore(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, []string{string(args[1])}
+}
+
+// zsetAlgebraSpec is the inputs and the options of ZUNION, ZINTER and ZDIFF
+type zsetAlgebraSpec struct {
+	keys       []string
+	weights    []float64
+	aggregate  string
+	withScores bool
+}
+
+// parseZAlgebra parse numkeys, the keys and the options, only the allowed options are accepted
+func parseZAlgebra(args [][]byte, allowed ...string) (*zsetAlgebraSpec, redis.Reply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, protocol.NewErrReply(INT_RANGE_ERR)
+	}
+	if numKeys <= 0 {
+		return nil, protocol.NewErrReply(ZSET_NUMKEYS_ERR)
+	}
+	if numKeys > len(args)-1 {
+		return nil, protocol.NewErrReply(SYNTAX_ERR)
+	}
+	spec := &zsetAlgebraSpec{
+		keys:      bytesToString(args[1 : numKeys+1]),
+		aggregate: "sum",
+	}
+	options := args[numKeys+1:]
+	for i := 0; i < len(options); i++ {
+		option := strings.ToLower(string(options[i]))
+		if !slices.Contains(allowed, option) {
+			return nil, protocol.NewErrReply(SYNTAX_ERR)
+		}
+		switch option {
+		case "weights":
+			if i+numKeys >= len(options) {
+				return nil, protocol.NewErrReply(SYNTAX_ERR)
+			}
+			spec.weights = make([]float64, numKeys)
+			for j := range spec.weights {
+				weight, err := strconv.ParseFloat(string(options[i+1+j]), 64)
+				if err != nil || math.IsNaN(weight) {
+					return nil, protocol.NewErrReply(ZSET_WEIGHT_ERR)
+				}
+				spec.weights[j] = weight
+			}
+			i += numKeys
+		case "aggregate":
+			if i+1 >= len(options) {
+				return nil, protocol.NewErrReply(SYNTAX_ERR)
+			}
+			spec.aggregate = strings.ToLower(string(options[i+1]))
+			if spec.aggregate != "sum" && spec.aggregate != "min" && spec.aggregate != "max" {
+				return nil, protocol.NewErrReply(SYNTAX_ERR)
+			}
+			i++
+		case "withscores":
+			spec.withScores = true
+		}
+	}
+	return spec, nil
+}
+
+// getZSetOperands get the members and the scores of the keys, the key not exists is seen as an empty set
+func (db *Database) getZSetOperands(keys []string) ([]map[string]float64, redis.Reply) {
+	operands := make([]map[string]float64, len(keys))
+	for i, key := range keys {
+		operand := make(map[string]float64)
+		entity, exists := db.GetEntityWithLock(key)
+		if exists {
+			switch value := entity.Data.(type) {
+			case *sortedset.SortedSet:
+				value.ForEach(func(score float64, member string) bool {
+					operand[member] = score
+					return true
+				})
+			case *set.Set:
+				value.ForEach(func(member string) bool {
+					operand[member] = 1
+					return true
+				})
+			default:
+				return nil, protocol.NewErrReply(WRONG_TYPE_ERR)
+			}
+		}
+		operands[i] = operand
+	}
+	return operands, nil
+}
+
+// aggregateScore combine the scores like redis, the NaN of inf + -inf is 0
+func aggregateScore(aggregate string, a float64, b float64) float64 {
+	var score float64
+	switch aggregate {
+	case "min":
+		score = min(a, b)
+	case "max":
+		score = max(a, b)
+	default:
+		score = a + b
+	}
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// weightedScore is the score multiplied by the weight of the input, the NaN of inf * 0 is 0
+func (spec *zsetAlgebraSpec) weightedScore(i int, score float64) float64 {
+	if spec.weights == nil {
+		return score
+	}
+	score *= spec.weights[i]
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// zsetAlgebra compute the result of ZUNION, ZINTER or ZDIFF
+func (db *Database) zsetAlgebra(op string, spec *zsetAlgebraSpec) (*sortedset.SortedSet, redis.Reply) {
+	operands, errReply := db.getZSetOperands(spec.keys)
+	if errReply != nil {
+		return nil, errReply
+	}
+	scores := make(map[string]float64)
+	switch op {
+	case "union":
+		for i, operand := range operands {
+			for member, score := range operand {
+				score = spec.weightedScore(i, score)
+				if old, ok := scores[member]; ok {
+					score = aggregateScore(spec.aggregate, old, score)
+				}
+				scores[member] = score
+			}
+		}
+	case "inter":
+	members:
+		for member, score := range operands[0] {
+			score = spec.weightedScore(0, score)
+			for i, operand := range operands[1:] {
+				other, ok := operand[member]
+				if !ok {
+					continue members
+				}
+				score = aggregateScore(spec.aggregate, score, spec.weightedScore(i+1, other))
+			}
+			scores[member] = score
+		}
+	default:
+		for member, score := range operands[0] {
+			found := false
+			for _, operand := range operands[1:] {
+				if _, found = operand[member]; found {
+					break
+				}
+			}
+			if !found {
+				scores[member] = score
+			}
+		}
+	}
+	result := sortedset.NewSortedSet()
+	for member, score := range scores {
+		result.Put(member, score)
+	}
+	return result, nil
+}
+
+func (db *Database) execZSetAlgebra(op string, cmdLine [][]byte, allowed ...string) redis.Reply {
+	spec, errReply := parseZAlgebra(cmdLine, allowed...)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := db.zsetAlgebra(op, spec)
+	if errReply != nil {
+		return errReply
+	}
+	return elementsReply(rankRange(result, 0, -1, false), spec.withScores)
+}
+
+// storeSortedSet replace the destination by the sorted set, the destination is removed if the set is empty
+func (db *Database) storeSortedSet(dest string, ss *sortedset.SortedSet) {
+	db.RemoveEntityWithLock(dest)
+	if ss.Len() > 0 {
+		db.PutEntityWithLock(dest, &database.DataEntity{
+			Data: ss,
+		})
+		db.signalBlocked(dest)
+	}
+	if db.IsTTLKey(dest) {
+		db.Persister(dest)
+	}
+}
+
+func (db *Database) execZSetAlgebraStore(op string, cmdLine [][]byte, allowed ...string) redis.Reply {
+	dest := string(cmdLine[0])
+	spec, errReply := parseZAlgebra(cmdLine[1:], allowed...)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := db.zsetAlgebra(op, spec)
+	if errReply != nil {
+		return errReply
+	}
+	db.storeSortedSet(dest, result)
+	db.addAof(utils.CmdLine2("Z"+strings.ToUpper(op)+"STORE", cmdLine))
+	return protocol.NewIntReply(result.Len())
+}
+
+// ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+func execZUnion(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZSetAlgebra("union", cmdLine, "weights", "aggregate", "withscores")
+}
+
+// ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES]
+func execZInter(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZSetAlgebra("inter", cmdLine, "weights", "aggregate", "withscores")
+}
+
+// ZDIFF numkeys key [key ...] [WITHSCORES]
+func execZDiff(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZSetAlgebra("diff", cmdLine, "withscores")
+}
+
+// ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+func execZUnionStore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZSetAlgebraStore("union", cmdLine, "weights", "aggregate")
+}
+
+// ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX]
+func execZInterStore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZSetAlgebraStore("inter", cmdLine, "weights", "aggregate")
+}
+
+// ZDIFFSTORE destination numkeys key [key ...]
+func execZDiffStore(db *Database, cmdLine [][]byte) redis.Reply {
+	return db.execZSetAlgebraStore("diff", cmdLine)
+}
+
+// ZINTERCARD numkeys key [key ...] [LIMIT limit]
+func execZInterCard(db *Database, cmdLine [][]byte) redis.Reply {
+	var limit int64
+	args := cmdLine
+	if n := len(cmdLine); n >= 3 && strings.ToLower(string(cmdLine[n-2])) == "limit" {
+		var err error
+		limit, err = strconv.ParseInt(string(cmdLine[n-1]), 10, 64)
+		if err != nil {
+			return protocol.NewErrReply(INT_RANGE_ERR)
+		}
+		if limit < 0 {
+			return protocol.NewErrReply(ZSET_CARD_LIMIT_ERR)
+		}
+		args = cmdLine[:n-2]
+	}
+	spec, errReply := parseZAlgebra(args)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := db.zsetAlgebra("inter", spec)
+	if errReply != nil {
+		return errReply
+	}
+	card := result.Len()
+	if limit > 0 {
+		card = min(card, limit)
+	}
+	return protocol.NewIntReply(card)
+}
+
+// ZRANGESTORE dst src min max [BYSCORE | BYLEX] [REV] [LIMIT offset count]
+func execZRangeStore(db *Database, cmdLine [][]byte) redis.Reply {
+	dest := string(cmdLine[0])
+	spec := &zrangeSpec{
+		start: cmdLine[2],
+		stop:  cmdLine[3],
+	}
+	if errReply := parseZRangeOptions(spec, cmdLine[4:], "byscore", "bylex", "rev", "limit"); errReply != nil {
+		return errReply
+	}
+	ss, errReply := db.getAsSortedSet(string(cmdLine[1]))
+	if errReply != nil {
+		return errReply
+	}
+	elements, errReply := zrange(ss, spec)
+	if errReply != nil {
+		return errReply
+	}
+	result := sortedset.NewSortedSet()
+	for _, element := range elements {
+		result.Put(element.Member, element.Score)
+	}
+	db.storeSortedSet(dest, result)
+	db.addAof(utils.CmdLine2("ZRANGESTORE", cmdLine))
+	return protocol.NewIntReply(result.Len())
+}
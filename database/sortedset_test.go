@@ -1,8 +1,14 @@
 package database
 
 import (
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
+	"github.com/xzwsloser/Go-redis/lib/utils"
+	"github.com/xzwsloser/Go-redis/resp/connection"
 	"log"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestZRangeByRank(t *testing.T) {
@@ -54,3 +60,265 @@ func TestZRemByRankRange(t *testing.T) {
 	reply = execZRemRangeByRank(db, cmdLine)
 	log.Print(string(reply.ToByte()))
 }
+
+// forEachZSetEncoding run the test with the listpack and the skiplist
+func forEachZSetEncoding(t *testing.T, test func(t *testing.T, check func(expected string, args ...string))) {
+	defer func(entries int) {
+		sortedset.MaxListpackEntries = entries
+	}(sortedset.MaxListpackEntries)
+	for _, entries := range []int{128, 0} {
+		sortedset.MaxListpackEntries = entries
+		server := NewPureServer()
+		conn := newClientConn()
+		test(t, func(expected string, args ...string) {
+			t.Helper()
+			if reply := replyOf(server, conn, args...); reply != expected {
+				t.Errorf("%d %v err: %q", entries, args, reply)
+			}
+		})
+	}
+}
+
+// bulks format the strings as the array of the bulk strings
+func bulks(values ...string) string {
+	var sb strings.Builder
+	sb.WriteString("*" + strconv.Itoa(len(values)) + "\r\n")
+	for _, value := range values {
+		sb.WriteString("$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n")
+	}
+	return sb.String()
+}
+
+func TestZSetRange(t *testing.T) {
+	forEachZSetEncoding(t, func(t *testing.T, check func(expected string, args ...string)) {
+		check(":5\r\n", "ZADD", "zset", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+		check(bulks("a", "b", "c"), "ZRANGE", "zset", "0", "2")
+		check(bulks("d", "e"), "ZRANGE", "zset", "-2", "-1")
+		check(bulks("e", "d"), "ZREVRANGE", "zset", "0", "1")
+		check(bulks("a", "1", "b", "2"), "ZRANGE", "zset", "0", "1", "WITHSCORES")
+		check(bulks("e", "5"), "ZREVRANGE", "zset", "0", "0", "WITHSCORES")
+		check(bulks(), "ZRANGE", "zset", "3", "1")
+		check(bulks(), "ZRANGE", "missing", "0", "-1")
+
+		check(bulks("b", "c", "d"), "ZRANGEBYSCORE", "zset", "(1", "4")
+		check(bulks("c", "d"), "ZRANGEBYSCORE", "zset", "-inf", "+inf", "LIMIT", "2", "2")
+		check(bulks("d", "c", "b"), "ZREVRANGEBYSCORE", "zset", "4", "(1")
+		check(bulks("e", "5"), "ZREVRANGEBYSCORE", "zset", "+inf", "-inf", "WITHSCORES", "LIMIT", "0", "1")
+		check(bulks("c", "b"), "ZRANGE", "zset", "(4", "2", "BYSCORE", "REV")
+		check(bulks("b", "c"), "ZRANGE", "zset", "1", "5", "BYSCORE", "LIMIT", "1", "2")
+		check(":3\r\n", "ZCOUNT", "zset", "2", "(5")
+		check(":0\r\n", "ZCOUNT", "zset", "6", "7")
+		check("-"+ZSET_FLOAT_ERR+"\r\n", "ZRANGEBYSCORE", "zset", "a", "1")
+		check("-"+ZSET_LIMIT_ERR+"\r\n", "ZRANGE", "zset", "0", "1", "LIMIT", "0", "1")
+		check("-"+SYNTAX_ERR+"\r\n", "ZREVRANGE", "zset", "0", "1", "BYSCORE")
+
+		check(":4\r\n", "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+		check(bulks("b", "c"), "ZRANGEBYLEX", "lex", "(a", "[c")
+		check(bulks("d", "c", "b"), "ZREVRANGEBYLEX", "lex", "+", "[b")
+		check(bulks("b"), "ZRANGE", "lex", "-", "+", "BYLEX", "LIMIT", "1", "1")
+		check(":2\r\n", "ZLEXCOUNT", "lex", "[b", "(d")
+		check("-"+ZSET_LEX_ERR+"\r\n", "ZRANGEBYLEX", "lex", "a", "+")
+		check("-"+ZSET_WITHSCORES_ERR+"\r\n", "ZRANGE", "lex", "-", "+", "BYLEX", "WITHSCORES")
+
+		check(":0\r\n", "ZRANK", "zset", "a")
+		check(":4\r\n", "ZREVRANK", "zset", "a")
+		check("$-1\r\n", "ZREVRANK", "zset", "x")
+		check("*3\r\n$1\r\n1\r\n$-1\r\n$1\r\n5\r\n", "ZMSCORE", "zset", "a", "x", "e")
+		check("$1\r\n1\r\n", "ZSCORE", "zset", "a")
+		check("$-1\r\n", "ZSCORE", "zset", "x")
+		check("$-1\r\n", "ZSCORE", "missing", "a")
+		check(":0\r\n", "EXISTS", "missing")
+		check("+OK\r\n", "SET", "str", "v")
+		check("-"+WRONG_TYPE_ERR+"\r\n", "ZSCORE", "str", "a")
+		check("$1\r\nv\r\n", "GET", "str")
+	})
+}
+
+func TestZSetRemove(t *testing.T) {
+	forEachZSetEncoding(t, func(t *testing.T, check func(expected string, args ...string)) {
+		check(":6\r\n", "ZADD", "zset", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e", "6", "f")
+		check(":2\r\n", "ZREMRANGEBYSCORE", "zset", "(1", "3")
+		check(":1\r\n", "ZREMRANGEBYRANK", "zset", "-1", "-1")
+		check(bulks("a", "d", "e"), "ZRANGE", "zset", "0", "-1")
+		check(bulks("a", "1", "d", "4"), "ZPOPMIN", "zset", "2")
+		check(bulks("e", "5"), "ZPOPMAX", "zset")
+		check(":0\r\n", "EXISTS", "zset")
+		check(bulks(), "ZPOPMIN", "zset")
+		check("-"+POSITIVE_COUNT_ERR+"\r\n", "ZPOPMIN", "zset", "-1")
+
+		check(":3\r\n", "ZADD", "lex", "0", "a", "0", "b", "0", "c")
+		check(":2\r\n", "ZREMRANGEBYLEX", "lex", "-", "(c")
+		check(bulks("c"), "ZRANGE", "lex", "0", "-1")
+
+		check(":1\r\n", "ZCARD", "lex")
+		check(":0\r\n", "ZCARD", "missing")
+		check(":0\r\n", "ZREM", "missing", "a")
+		check(":0\r\n", "EXISTS", "missing")
+		check("+OK\r\n", "SET", "str", "v")
+		check("-"+WRONG_TYPE_ERR+"\r\n", "ZCARD", "str")
+		check("-"+WRONG_TYPE_ERR+"\r\n", "ZREM", "str", "a")
+		check("$1\r\nv\r\n", "GET", "str")
+	})
+}
+
+func TestZRandMember(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	if reply := replyOf(server, conn, "ZRANDMEMBER", "zset"); reply != "$-1\r\n" {
+		t.Error("zrandmember of the missing key err: ", reply)
+	}
+	replyOf(server, conn, "ZADD", "zset", "1", "a", "2", "b", "3", "c")
+	if reply := replyOf(server, conn, "ZRANDMEMBER", "zset"); len(reply) != 7 {
+		t.Error("zrandmember err: ", reply)
+	}
+	reply := replyOf(server, conn, "ZRANDMEMBER", "zset", "5")
+	if reply != bulks("a", "b", "c") {
+		t.Error("zrandmember with the count over the size err: ", reply)
+	}
+	reply = replyOf(server, conn, "ZRANDMEMBER", "zset", "2", "WITHSCORES")
+	if !strings.HasPrefix(reply, "*4\r\n") {
+		t.Error("zrandmember with scores err: ", reply)
+	}
+	reply = replyOf(server, conn, "ZRANDMEMBER", "zset", "-6")
+	if !strings.HasPrefix(reply, "*6\r\n") {
+		t.Error("zrandmember with the negative count err: ", reply)
+	}
+	for _, count := range []string{"-9223372036854775808", "-9223372036854775807", "9223372036854775807",
+		"-4000000000000000000", strconv.Itoa(-RANDOM_MAX_COUNT - 1)} {
+		if reply = replyOf(server, conn, "ZRANDMEMBER", "zset", count); reply != "-"+COUNT_RANGE_ERR+"\r\n" {
+			t.Error("zrandmember out of range err: ", count, reply)
+		}
+	}
+}
+
+func TestBlockingZPop(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	replyOf(server, conn, "ZADD", "zset", "1", "a", "2", "b")
+	if reply := replyOf(server, conn, "BZPOPMAX", "empty", "zset", "0"); reply != bulks("zset", "b", "2") {
+		t.Error("bzpopmax of the non-empty set err: ", reply)
+	}
+
+	popped := blockingReply(server, "BZPOPMIN", "queue", "0")
+	waitBlocked(t, server, 1)
+	replyOf(server, conn, "ZADD", "queue", "3", "x")
+	if reply := <-popped; reply != bulks("queue", "x", "3") {
+		t.Error("bzpopmin after zadd err: ", reply)
+	}
+	waitBlocked(t, server, 0)
+
+	start := time.Now()
+	if reply := replyOf(server, conn, "BZPOPMIN", "queue", "0.05"); reply != "*-1\r\n" || time.Since(start) < 50*time.Millisecond {
+		t.Error("bzpopmin timeout err: ", reply)
+	}
+}
+
+func TestZAddFlags(t *testing.T) {
+	forEachZSetEncoding(t, func(t *testing.T, check func(expected string, args ...string)) {
+		check(":2\r\n", "ZADD", "zset", "1", "a", "2", "b")
+		check(":0\r\n", "ZADD", "zset", "XX", "5", "a", "5", "c")
+		check(":1\r\n", "ZADD", "zset", "NX", "9", "a", "3", "c")
+		check(bulks("b", "2", "c", "3", "a", "5"), "ZRANGE", "zset", "0", "-1", "WITHSCORES")
+		check(":1\r\n", "ZADD", "zset", "GT", "CH", "4", "a", "6", "b", "3", "c")
+		check(":0\r\n", "ZADD", "zset", "LT", "7", "b")
+		check(bulks("c", "3", "a", "5", "b", "6"), "ZRANGE", "zset", "0", "-1", "WITHSCORES")
+		check("$1\r\n8\r\n", "ZADD", "zset", "INCR", "3", "a")
+		check("$-1\r\n", "ZADD", "zset", "NX", "INCR", "1", "a")
+		check("$2\r\n10\r\n", "ZINCRBY", "zset", "4", "b")
+		check("$1\r\n1\r\n", "ZINCRBY", "zset", "1", "d")
+		check(bulks("d", "c", "a", "b"), "ZRANGE", "zset", "0", "-1")
+
+		check("-"+ZADD_NX_XX_ERR+"\r\n", "ZADD", "zset", "NX", "XX", "1", "a")
+		check("-"+ZADD_GT_LT_NX_ERR+"\r\n", "ZADD", "zset", "GT", "NX", "1", "a")
+		check("-"+ZADD_INCR_ERR+"\r\n", "ZADD", "zset", "INCR", "1", "a", "2", "b")
+		check("-"+ZSET_SCORE_ERR+"\r\n", "ZADD", "zset", "x", "a")
+		check("-"+SYNTAX_ERR+"\r\n", "ZADD", "zset", "1", "a", "2")
+		check(":1\r\n", "ZADD", "inf", "+inf", "a")
+		check("-"+ZSET_NAN_ERR+"\r\n", "ZADD", "inf", "INCR", "-inf", "a")
+		check(":0\r\n", "ZADD", "missing", "XX", "1", "a")
+		check(":0\r\n", "EXISTS", "missing")
+	})
+}
+
+func TestZSetAlgebra(t *testing.T) {
+	forEachZSetEncoding(t, func(t *testing.T, check func(expected string, args ...string)) {
+		check(":3\r\n", "ZADD", "z1", "1", "a", "2", "b", "3", "c")
+		check(":3\r\n", "ZADD", "z2", "10", "b", "20", "c", "30", "d")
+		check(":2\r\n", "SADD", "s", "c", "e")
+
+		check(bulks("a", "b", "c", "d"), "ZUNION", "2", "z1", "z2")
+		check(bulks("a", "1", "b", "12", "c", "23", "d", "30"), "ZUNION", "2", "z1", "z2", "WITHSCORES")
+		check(bulks("a", "2", "b", "14", "c", "26", "d", "30"),
+			"ZUNION", "2", "z1", "z2", "WEIGHTS", "2", "1", "WITHSCORES")
+		check(bulks("b", "2", "c", "3"), "ZINTER", "2", "z1", "z2", "AGGREGATE", "MIN", "WITHSCORES")
+		check(bulks("c", "20"), "ZINTER", "3", "z1", "z2", "s", "AGGREGATE", "MAX", "WITHSCORES")
+		check(bulks("e", "1"), "ZDIFF", "2", "s", "z2", "WITHSCORES")
+		check(bulks("a"), "ZDIFF", "3", "z1", "z2", "missing")
+		check(bulks(), "ZINTER", "2", "z1", "missing")
+
+		check(":2\r\n", "ZINTERCARD", "2", "z1", "z2")
+		check(":1\r\n", "ZINTERCARD", "2", "z1", "z2", "LIMIT", "1")
+		check(":2\r\n", "ZINTERCARD", "2", "z1", "z2", "LIMIT", "0")
+
+		check(":4\r\n", "ZUNIONSTORE", "dest", "2", "z1", "z2", "AGGREGATE", "MAX")
+		check(bulks("a", "1", "b", "10", "c", "20", "d", "30"), "ZRANGE", "dest", "0", "-1", "WITHSCORES")
+		check(":2\r\n", "ZINTERSTORE", "dest", "2", "z1", "z2", "WEIGHTS", "1", "0")
+		check(bulks("b", "2", "c", "3"), "ZRANGE", "dest", "0", "-1", "WITHSCORES")
+		check(":0\r\n", "ZDIFFSTORE", "dest", "2", "z1", "z1")
+		check(":0\r\n", "EXISTS", "dest")
+
+		check(":2\r\n", "ZRANGESTORE", "dest", "z2", "15", "+inf", "BYSCORE")
+		check(bulks("c", "d"), "ZRANGE", "dest", "0", "-1")
+		check(":2\r\n", "ZRANGESTORE", "dest", "z1", "0", "1", "REV")
+		check(bulks("b", "c"), "ZRANGE", "dest", "0", "-1")
+		check(":0\r\n", "ZRANGESTORE", "dest", "missing", "0", "-1")
+		check(":0\r\n", "EXISTS", "dest")
+
+		check("-"+ZSET_NUMKEYS_ERR+"\r\n", "ZUNION", "0", "z1")
+		check("-"+SYNTAX_ERR+"\r\n", "ZUNION", "3", "z1", "z2")
+		check("-"+SYNTAX_ERR+"\r\n", "ZDIFF", "2", "z1", "z2", "WEIGHTS", "1", "1")
+		check("-"+SYNTAX_ERR+"\r\n", "ZUNIONSTORE", "dest", "2", "z1", "z2", "WITHSCORES")
+		check("-"+SYNTAX_ERR+"\r\n", "ZINTER", "2", "z1", "z2", "AGGREGATE", "AVG")
+		check("-"+ZSET_WEIGHT_ERR+"\r\n", "ZUNION", "2", "z1", "z2", "WEIGHTS", "1", "x")
+		check("-"+ZSET_CARD_LIMIT_ERR+"\r\n", "ZINTERCARD", "1", "z1", "LIMIT", "-1")
+		check("+OK\r\n", "SET", "str", "v")
+		check("-"+WRONG_TYPE_ERR+"\r\n", "ZUNION", "2", "z1", "str")
+	})
+}
+
+func TestZSetStoreUndo(t *testing.T) {
+	server := NewPureServer()
+	conn := newClientConn()
+	replyOf(server, conn, "ZADD", "z1", "1", "a", "2", "b")
+	replyOf(server, conn, "ZADD", "dest", "5", "x")
+	replyOf(server, conn, "MULTI")
+	replyOf(server, conn, "ZADD", "z1", "GT", "9", "a", "3", "c")
+	replyOf(server, conn, "ZUNIONSTORE", "dest", "1", "z1")
+	replyOf(server, conn, "ZRANGESTORE", "other", "z1", "0", "0")
+	replyOf(server, conn, "GET", "missing")
+	replyOf(server, conn, "EXEC")
+	if reply := replyOf(server, conn, "ZRANGE", "z1", "0", "-1", "WITHSCORES"); reply != bulks("a", "1", "b", "2") {
+		t.Error("the sorted set after the rollback err: ", reply)
+	}
+	if reply := replyOf(server, conn, "ZRANGE", "dest", "0", "-1", "WITHSCORES"); reply != bulks("x", "5") {
+		t.Error("the destination after the rollback err: ", reply)
+	}
+	if reply := replyOf(server, conn, "EXISTS", "other"); reply != ":0\r\n" {
+		t.Error("the new destination after the rollback err: ", reply)
+	}
+}
+
+func TestZRemAof(t *testing.T) {
+	db := NewDatabase(0)
+	cmdLines := make([]CmdLine, 0)
+	db.addAof = func(cmdLine [][]byte) {
+		cmdLines = append(cmdLines, cmdLine)
+	}
+	conn := connection.NewFakeConnection()
+	db.Exec(conn, utils.CmdLine1("ZADD", "zset", "1", "a"))
+	db.Exec(conn, utils.CmdLine1("ZREM", "zset", "x"))
+	db.Exec(conn, utils.CmdLine1("ZREM", "missing", "a"))
+	if len(cmdLines) != 1 {
+		t.Error("zrem removing nothing should not be written into aof: ", len(cmdLines))
+	}
+}
@@ -161,7 +161,7 @@ func execIncr(db *Database, cmdLine [][]byte) redis.Reply {
 	}
 	value++
 	valueStr := strconv.FormatInt(value, 10)
-	_ = db.PutEntity(key, &database.DataEntity{
+	_ = db.PutEntityWithLock(key, &database.DataEntity{
 		Data: []byte(valueStr),
 	})
 	db.addAof(utils.CmdLine2("Incr", cmdLine))
@@ -181,7 +181,7 @@ func execDecr(db *Database, cmdLine [][]byte) redis.Reply {
 	}
 	value--
 	valueStr := strconv.Itoa(value)
-	_ = db.PutEntity(key, &database.DataEntity{
+	_ = db.PutEntityWithLock(key, &database.DataEntity{
 		Data: []byte(valueStr),
 	})
 	db.addAof(utils.CmdLine2("Decr", cmdLine))
@@ -115,12 +115,16 @@ func execMulti(db *Database, conn redis.Conn) redis.Reply {
 		watchKeys = append(watchKeys, watch)
 	}
 	rks = append(rks, watchKeys...)
+	wks = append(wks, db.expiredKeys(rks)...)
 	// 1.3 lock the keys
 	db.RWLocks(wks, rks)
 	defer db.RWUnlocks(wks, rks)
+	db.expireIfNeeded(wks...)
 	if isWatchingChanged(db, watching) {
 		return protocol.NewEmptyReply()
 	}
+	sizes := db.sizesOf(wks)
+	defer db.afterWrite(sizes, rks)
 
 	// 2. exec the commands and get the undo logs
 	result := make([]redis.Reply, 0, len(commands))
@@ -50,8 +50,10 @@ func rollbackGivenKeys(db *Database, keys ...string) []CmdLine {
 		} else {
 			undoCmdLine = append(undoCmdLine,
 				utils.CmdLine1("DEL", key),
-				aof.EntityToCmd(key, entity),
-				db.TTLCmd(key))
+				aof.EntityToCmd(key, entity))
+			if ttlCmd := db.TTLCmd(key); ttlCmd != nil {
+				undoCmdLine = append(undoCmdLine, ttlCmd)
+			}
 		}
 	}
 	return undoCmdLine
@@ -4,6 +4,7 @@ import (
 	"github.com/xzwsloser/Go-redis/lib/logger"
 	"github.com/xzwsloser/Go-redis/lib/wildcard"
 	"math"
+	"math/bits"
 	"math/rand"
 	"sort"
 	"sync"
@@ -115,17 +116,18 @@ func (d *ConcurrentDict) decreaseCount() {
 	atomic.AddInt32(&d.count, -1)
 }
 
-func (s *shard) RandomKey() string {
+// RandomKey return false when the shard is empty, the empty string is a valid key
+func (s *shard) RandomKey() (string, bool) {
 	if s == nil {
 		logger.Error("shard is empty!")
-		return ""
+		return "", false
 	}
 
 	for key := range s.m {
-		return key
+		return key, true
 	}
 
-	return ""
+	return "", false
 }
 
 func (d *ConcurrentDict) getShard(key string) *shard {
@@ -184,8 +186,10 @@ func (d *ConcurrentDict) Put(key string, value any) (result int) {
 	if s != nil {
 		s.lock.Lock()
 		defer s.lock.Unlock()
+		if _, exists := s.m[key]; !exists {
+			d.addCount()
+		}
 		s.m[key] = value
-		d.addCount()
 		return 1
 	}
 	return 0
@@ -198,8 +202,10 @@ func (d *ConcurrentDict) PutWithLock(key string, value any) (result int) {
 
 	s := d.getShard(key)
 	if s != nil {
+		if _, exists := s.m[key]; !exists {
+			d.addCount()
+		}
 		s.m[key] = value
-		d.addCount()
 		return 1
 	}
 	return 0
@@ -252,7 +258,6 @@ func (d *ConcurrentDict) PutIfExists(key string, value any) (result int) {
 			return 0
 		}
 		s.m[key] = value
-		d.addCount()
 		return 1
 	}
 	return 0
@@ -269,7 +274,6 @@ func (d *ConcurrentDict) PutIfExistsWithLock(key string, value any) (result int)
 			return 0
 		}
 		s.m[key] = value
-		d.addCount()
 		return 1
 	}
 	return 0
@@ -336,76 +340,127 @@ func (d *ConcurrentDict) ForEach(consumer Consumer) {
 	}
 }
 
+// ShardCount is the number of the shards, the shard of the key is given by ShardIndex
+func (d *ConcurrentDict) ShardCount() int {
+	return len(d.table)
+}
+
+func (d *ConcurrentDict) ShardIndex(key string) int {
+	return int(d.spread(key))
+}
+
+// RLockShard read locks one shard, so the dict can be scanned shard by shard without locking all of them
+func (d *ConcurrentDict) RLockShard(index int) {
+	d.table[index].lock.RLock()
+}
+
+func (d *ConcurrentDict) RUnLockShard(index int) {
+	d.table[index].lock.RUnlock()
+}
+
+// ForEachInShardWithLock scan the k-v of the shard locked by RLockShard
+func (d *ConcurrentDict) ForEachInShardWithLock(index int, consumer Consumer) {
+	for key, value := range d.table[index].m {
+		if !consumer(key, value) {
+			return
+		}
+	}
+}
+
+// RLockAll read locks all the shards in order to get a point-in-time view of the dict
+func (d *ConcurrentDict) RLockAll() {
+	for _, s := range d.table {
+		s.lock.RLock()
+	}
+}
+
+// RUnLockAll unlocks the shards locked by RLockAll
+func (d *ConcurrentDict) RUnLockAll() {
+	for i := len(d.table) - 1; i >= 0; i-- {
+		d.table[i].lock.RUnlock()
+	}
+}
+
 func (d *ConcurrentDict) Keys() []string {
 	if d == nil {
 		panic("dict is nil")
 	}
-	keys := make([]string, d.Len())
-	i := 0
+	keys := make([]string, 0, d.Len())
 	for _, s := range d.table {
 		s.lock.RLock()
 		for key, _ := range s.m {
-			keys[i] = key
-			i++
+			keys = append(keys, key)
 		}
-		s.lock.Unlock()
+		s.lock.RUnlock()
 	}
 	return keys
 }
 
+// RandomKeys return the keys may be repeated, it returns less keys only when the dict is empty
 func (d *ConcurrentDict) RandomKeys(limit int) []string {
 	if d == nil {
 		panic("dict is nil")
 	}
 
 	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
-	result := make([]string, limit)
-	for i := 0; i < limit; {
-		index := nR.Intn(d.shardCount)
-		s := d.table[index]
-		if s != nil {
-			s.lock.RLock()
-			key := s.RandomKey()
-			if key != "" {
-				result[i] = key
-				i++
-			}
-			s.lock.RUnlock()
+	result := make([]string, 0, min(limit, d.Len()))
+	for len(result) < limit {
+		key, ok := d.randomKeyFrom(nR.Intn(d.shardCount))
+		if !ok {
+			// the dict is empty, the keys may be removed concurrently
+			break
 		}
+		result = append(result, key)
 	}
 	return result
 }
 
+// randomKeyFrom pass the shards once from the offset and get a key from the first non-empty one
+func (d *ConcurrentDict) randomKeyFrom(offset int) (string, bool) {
+	for i := 0; i < d.shardCount; i++ {
+		s := d.table[(offset+i)%d.shardCount]
+		if s == nil {
+			continue
+		}
+		s.lock.RLock()
+		key, ok := s.RandomKey()
+		s.lock.RUnlock()
+		if ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
 func (d *ConcurrentDict) RandomDistinctKeys(limit int) []string {
 	if d == nil {
 		panic("dict is nil")
 	}
 
-	if limit > d.Len() {
+	if limit >= d.Len() {
 		return d.Keys()
 	}
 	memo := make(map[string]struct{})
 	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
-	for len(memo) < limit {
+	// the keys may be removed concurrently, so the dict is checked again to avoid looping forever
+	for len(memo) < limit && len(memo) < d.Len() {
 		index := nR.Intn(d.shardCount)
 		s := d.table[index]
 		if s != nil {
 			s.lock.RLock()
-			key := s.RandomKey()
-			if key != "" {
+			key, ok := s.RandomKey()
+			if ok {
 				if _, exists := memo[key]; !exists {
 					memo[key] = struct{}{}
 				}
 			}
-			s.lock.Unlock()
+			s.lock.RUnlock()
 		}
 	}
 
-	arr := make([]string, limit)
-	i := 0
+	arr := make([]string, 0, len(memo))
 	for key, _ := range memo {
-		arr[i] = key
-		i++
+		arr = append(arr, key)
 	}
 	return arr
 }
@@ -422,16 +477,17 @@ func stringsToBytes(keys []string) [][]byte {
 	return result
 }
 
-// DictScan is scan the k-v pairs from the position of cursor
+// DictScan is scan the keys from the position of cursor, return the keys and the next cursor.
+// The cursor is the shard index in reverse binary order like redis, so the keys exist during
+// the whole scan will be returned at least once even if the dict has changed between calls.
+// The next cursor is 0 when the scan is finished, and -1 if the pattern is invalid.
 func (d *ConcurrentDict) DictScan(cursor int, count int, pattern string) ([][]byte, int) {
 	if d == nil {
 		panic("dict is nil")
 	}
 
-	size := d.Len()
 	result := make([][]byte, 0)
-
-	if pattern == "*" && count >= size {
+	if cursor == 0 && pattern == "*" && count >= d.Len() {
 		return stringsToBytes(d.Keys()), 0
 	}
 
@@ -440,27 +496,29 @@ func (d *ConcurrentDict) DictScan(cursor int, count int, pattern string) ([][]by
 		return result, -1
 	}
 
-	shardCount := len(d.table)
-	shardIndex := cursor
-
-	for shardIndex < shardCount {
-		shard := d.table[shardIndex]
+	mask := uint32(len(d.table) - 1)
+	v := uint32(cursor)
+	for {
+		shard := d.table[v&mask]
 		shard.lock.RLock()
-		if len(result)+len(shard.m) > count && shardIndex > cursor {
-			shard.lock.RUnlock()
-			return result, shardIndex
-		}
-
 		for key := range shard.m {
 			if pattern == "*" || matchKey.IsMatch(key) {
 				result = append(result, []byte(key))
 			}
 		}
 		shard.lock.RUnlock()
-		shardIndex++
+
+		// increase the reversed cursor
+		v |= ^mask
+		v = bits.Reverse32(v)
+		v++
+		v = bits.Reverse32(v)
+		if v == 0 || len(result) >= count {
+			break
+		}
 	}
 
-	return result, 0
+	return result, int(v)
 }
 
 func (dict *ConcurrentDict) toLockIndices(keys []string, reverse bool) []uint32 {
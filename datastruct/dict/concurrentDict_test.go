@@ -52,3 +52,118 @@ func TestGet(t *testing.T) {
 	wg.Wait()
 	log.Println(time.Since(t1).Milliseconds())
 }
+
+func TestLen(t *testing.T) {
+	dict := NewConcurrentDict(16)
+	dict.Put("k1", 1)
+	dict.Put("k1", 2)
+	dict.PutIfExists("k1", 3)
+	dict.PutIfAbsent("k2", 1)
+	if dict.Len() != 2 {
+		t.Error("the len of dict err: ", dict.Len())
+	}
+	dict.Remove("k1")
+	if dict.Len() != 1 {
+		t.Error("the len of dict err: ", dict.Len())
+	}
+}
+
+func TestDictScan(t *testing.T) {
+	dict := NewConcurrentDict(1024)
+	for i := 0; i < 1000; i++ {
+		dict.Put("key_"+strconv.Itoa(i), i)
+	}
+
+	found := make(map[string]struct{})
+	cursor := 0
+	round := 0
+	for {
+		keys, next := dict.DictScan(cursor, 10, "key_*")
+		for _, key := range keys {
+			found[string(key)] = struct{}{}
+		}
+		// change the dict between the calls
+		dict.Put("new_"+strconv.Itoa(round), round)
+		dict.Remove("key_" + strconv.Itoa(1000+round))
+		round++
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	for i := 0; i < 1000; i++ {
+		if _, ok := found["key_"+strconv.Itoa(i)]; !ok {
+			t.Error("key not scanned: key_", i)
+		}
+	}
+	log.Println("rounds: ", round)
+}
+
+func TestRLockAll(t *testing.T) {
+	dict := NewConcurrentDict(16)
+	for i := 0; i < 100; i++ {
+		dict.Put("key_"+strconv.Itoa(i), i)
+	}
+
+	dict.RLockAll()
+	done := make(chan struct{})
+	go func() {
+		dict.Put("key_100", 100)
+		close(done)
+	}()
+	count := 0
+	for i := 0; i < dict.ShardCount(); i++ {
+		dict.ForEachInShardWithLock(i, func(key string, value any) bool {
+			if dict.ShardIndex(key) != i {
+				t.Error("the key is scanned in the wrong shard: ", key)
+			}
+			count++
+			return true
+		})
+	}
+	if count != 100 {
+		t.Error("the writer should be blocked by RLockAll, count: ", count)
+	}
+	dict.RUnLockAll()
+	<-done
+	if dict.Len() != 101 {
+		t.Error("the len of dict err: ", dict.Len())
+	}
+}
+
+func TestRandomDistinctKeys(t *testing.T) {
+	dict := NewConcurrentDict(16)
+	if keys := dict.RandomDistinctKeys(5); len(keys) != 0 {
+		t.Error("random keys of the empty dict err: ", keys)
+	}
+	for i := 0; i < 100; i++ {
+		dict.Put("key_"+strconv.Itoa(i), i)
+	}
+	keys := dict.RandomDistinctKeys(5)
+	memo := make(map[string]struct{})
+	for _, key := range keys {
+		if _, ok := dict.Get(key); !ok {
+			t.Error("random key not exists: ", key)
+		}
+		memo[key] = struct{}{}
+	}
+	if len(memo) != 5 {
+		t.Error("random distinct keys err: ", keys)
+	}
+	// the shards are unlocked after sampling
+	dict.Put("key_0", 0)
+}
+
+func TestRandomKeys(t *testing.T) {
+	dict := NewConcurrentDict(16)
+	// the empty dict returns nothing instead of looping forever
+	if keys := dict.RandomKeys(1); len(keys) != 0 {
+		t.Error("random keys of the empty dict err: ", keys)
+	}
+	dict.Put("", 0)
+	keys := dict.RandomKeys(3)
+	if len(keys) != 3 || keys[0] != "" {
+		t.Error("the empty string should be returned as a key: ", keys)
+	}
+}
@@ -0,0 +1,77 @@
+package hash
+
+// Hash is the data structure of the redis hash type, field -> value
+type Hash struct {
+	dict map[string][]byte
+}
+
+func NewHash() *Hash {
+	return &Hash{
+		dict: make(map[string][]byte),
+	}
+}
+
+// Put set the value of the field, return 1 if the field is new
+func (h *Hash) Put(field string, value []byte) (result int) {
+	_, exists := h.dict[field]
+	h.dict[field] = value
+	if exists {
+		return 0
+	}
+	return 1
+}
+
+// PutIfAbsent set the value only when the field not exists
+func (h *Hash) PutIfAbsent(field string, value []byte) (result int) {
+	if _, exists := h.dict[field]; exists {
+		return 0
+	}
+	h.dict[field] = value
+	return 1
+}
+
+func (h *Hash) Get(field string) (value []byte, exists bool) {
+	value, exists = h.dict[field]
+	return
+}
+
+func (h *Hash) Exists(field string) bool {
+	_, exists := h.dict[field]
+	return exists
+}
+
+func (h *Hash) Remove(field string) (result int) {
+	if _, exists := h.dict[field]; !exists {
+		return 0
+	}
+	delete(h.dict, field)
+	return 1
+}
+
+func (h *Hash) Len() int {
+	return len(h.dict)
+}
+
+func (h *Hash) ForEach(consumer func(field string, value []byte) bool) {
+	for field, value := range h.dict {
+		if !consumer(field, value) {
+			break
+		}
+	}
+}
+
+func (h *Hash) Fields() []string {
+	fields := make([]string, 0, len(h.dict))
+	for field := range h.dict {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func (h *Hash) Values() [][]byte {
+	values := make([][]byte, 0, len(h.dict))
+	for _, value := range h.dict {
+		values = append(values, value)
+	}
+	return values
+}
@@ -0,0 +1,39 @@
+package hash
+
+import (
+	"log"
+	"testing"
+)
+
+func TestHashPut(t *testing.T) {
+	h := NewHash()
+	if h.Put("f1", []byte("v1")) != 1 {
+		t.Error("put a new field should return 1")
+	}
+	if h.Put("f1", []byte("v2")) != 0 {
+		t.Error("put an old field should return 0")
+	}
+	if h.PutIfAbsent("f1", []byte("v3")) != 0 {
+		t.Error("put if absent an old field should return 0")
+	}
+	value, _ := h.Get("f1")
+	if string(value) != "v2" {
+		t.Error("get the err value: ", string(value))
+	}
+	h.ForEach(func(field string, value []byte) bool {
+		log.Println(field, ":", string(value))
+		return true
+	})
+}
+
+func TestHashRemove(t *testing.T) {
+	h := NewHash()
+	h.Put("f1", []byte("v1"))
+	h.Put("f2", []byte("v2"))
+	if h.Remove("f1") != 1 || h.Remove("f1") != 0 {
+		t.Error("remove field err")
+	}
+	if h.Len() != 1 || h.Exists("f1") {
+		t.Error("the len of hash err")
+	}
+}
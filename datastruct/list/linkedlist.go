@@ -103,6 +103,28 @@ func (list *LinkedList) InsertTail(value any) (l int) {
 	return
 }
 
+// Insert the value before the element idx, idx == Len() appends it
+func (list *LinkedList) Insert(idx int, value any) {
+	if idx == 0 {
+		list.InsertHead(value)
+		return
+	}
+	if idx == list.size {
+		list.InsertTail(value)
+		return
+	}
+	node := list.findNode(idx)
+	if node == nil {
+		return
+	}
+	pnew := newListNode(value)
+	pnew.prev = node.prev
+	pnew.next = node
+	node.prev.next = pnew
+	node.prev = pnew
+	list.size++
+}
+
 func (list *LinkedList) RemoveHead() (value any) {
 	if list.Empty() {
 		return nil
@@ -158,10 +180,7 @@ func (list *LinkedList) RemoveByValue(value any, reversed bool) (result int) {
 
 	for i := 0; i < list.size; i++ {
 		if ptr.data == value {
-			ptr.prev.next = ptr.next
-			ptr.next.prev = ptr.prev
-			ptr = nil
-			list.size--
+			list.removeNode(ptr)
 			return 1
 		} else {
 			if reversed {
@@ -181,9 +200,7 @@ func (list *LinkedList) RemoveByCond(condition func(int, any) bool) (result int)
 	ptr := list.head
 	for i := 0; i < list.size; i++ {
 		if condition(i, ptr.data) {
-			ptr.prev.next = ptr.next
-			ptr.next.prev = ptr.prev
-			list.size--
+			list.removeNode(ptr)
 			return 1
 		}
 		ptr = ptr.next
@@ -191,6 +208,25 @@ func (list *LinkedList) RemoveByCond(condition func(int, any) bool) (result int)
 	return 0
 }
 
+// removeNode unlink the node and keep the head and the tail
+func (list *LinkedList) removeNode(node *listNode) {
+	if list.size == 1 {
+		list.head = nil
+		list.tail = nil
+		list.size--
+		return
+	}
+	node.prev.next = node.next
+	node.next.prev = node.prev
+	if node == list.head {
+		list.head = node.next
+	}
+	if node == list.tail {
+		list.tail = node.prev
+	}
+	list.size--
+}
+
 func (list *LinkedList) Len() int {
 	return list.size
 }
@@ -0,0 +1,246 @@
+package list
+
+import (
+	"fmt"
+	"github.com/xzwsloser/Go-redis/datastruct/listpack"
+)
+
+const (
+	EncodingListpack  = "listpack"
+	EncodingQuickList = "quicklist"
+
+	// sizeSafetyLimit is the max bytes of the listpack when it is limited by the number of the entries
+	sizeSafetyLimit = 8192
+)
+
+// ListpackSize is list-max-listpack-size of redis, the positive value limits the number of the entries
+// of the listpack and -1 ~ -5 limits its bytes to 4kb ~ 64kb
+var ListpackSize = -2
+
+// List is the value of the redis list type, the small list is kept in a listpack and it is
+// converted to the quicklist once it grows over ListpackSize, the elements are strings
+type List struct {
+	pack  *listpack.ListPack
+	quick *QuickList
+}
+
+func NewList() *List {
+	return &List{
+		pack: listpack.NewListPack(),
+	}
+}
+
+// Encoding is the name of the internal representation shown by OBJECT ENCODING
+func (l *List) Encoding() string {
+	if l.pack != nil {
+		return EncodingListpack
+	}
+	return EncodingQuickList
+}
+
+// ListpackBytes is the size of the listpack, it is 0 after the list is converted
+func (l *List) ListpackBytes() int {
+	if l.pack == nil {
+		return 0
+	}
+	return l.pack.Bytes()
+}
+
+// listpackLimit get the max bytes of the listpack
+func listpackLimit() int {
+	if ListpackSize >= 0 {
+		return sizeSafetyLimit
+	}
+	shift := min(-ListpackSize, 5) - 1
+	return 4096 << shift
+}
+
+// convertIfNeeded convert the listpack to the quicklist before adding the value if it will be too large,
+// the listpack becomes the first node of the quicklist
+func (l *List) convertIfNeeded(value string, adding bool) {
+	if l.pack == nil {
+		return
+	}
+	entries := l.pack.Len()
+	if adding {
+		entries++
+	}
+	if (ListpackSize > 0 && entries > ListpackSize) ||
+		l.pack.Bytes()+listpack.EntrySize([]byte(value)) > listpackLimit() {
+		l.quick = newQuickListFromPack(l.pack)
+		l.pack = nil
+	}
+}
+
+func toString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (l *List) Len() int {
+	if l.pack != nil {
+		return l.pack.Len()
+	}
+	return l.quick.Len()
+}
+
+func (l *List) Empty() bool {
+	return l.Len() == 0
+}
+
+func (l *List) Get(idx int) (value any) {
+	if l.pack != nil {
+		if idx < 0 || idx >= l.pack.Len() {
+			return nil
+		}
+		return string(l.pack.Get(idx))
+	}
+	return l.quick.Get(idx)
+}
+
+func (l *List) InsertHead(value any) int {
+	v := toString(value)
+	l.convertIfNeeded(v, true)
+	if l.pack != nil {
+		l.pack.Insert(0, []byte(v))
+		return l.pack.Len()
+	}
+	l.quick.InsertHead(v)
+	return l.quick.Len()
+}
+
+func (l *List) InsertTail(value any) int {
+	v := toString(value)
+	l.convertIfNeeded(v, true)
+	if l.pack != nil {
+		l.pack.Append([]byte(v))
+		return l.pack.Len()
+	}
+	l.quick.InsertTail(v)
+	return l.quick.Len()
+}
+
+// Insert the value before the element idx, idx == Len() appends it
+func (l *List) Insert(idx int, value any) {
+	if idx < 0 || idx > l.Len() {
+		return
+	}
+	v := toString(value)
+	l.convertIfNeeded(v, true)
+	if l.pack != nil {
+		l.pack.Insert(idx, []byte(v))
+		return
+	}
+	l.quick.Insert(idx, v)
+}
+
+func (l *List) RemoveHead() (value any) {
+	if l.pack != nil {
+		if l.pack.Len() == 0 {
+			return nil
+		}
+		value = string(l.pack.Get(0))
+		l.pack.Delete(0, 1)
+		return value
+	}
+	return l.quick.RemoveHead()
+}
+
+func (l *List) RemoveTail() (value any) {
+	if l.pack != nil {
+		if l.pack.Len() == 0 {
+			return nil
+		}
+		last := l.pack.Len() - 1
+		value = string(l.pack.Get(last))
+		l.pack.Delete(last, 1)
+		return value
+	}
+	return l.quick.RemoveTail()
+}
+
+// RemoveByValue remove the first element equal to the value from the head, or from the tail if reversed
+func (l *List) RemoveByValue(value any, reversed bool) (result int) {
+	if l.pack == nil {
+		return l.quick.RemoveByValue(toString(value), reversed)
+	}
+	target := toString(value)
+	found := -1
+	l.pack.ForEach(func(idx int, v []byte) bool {
+		if string(v) == target {
+			found = idx
+			return reversed
+		}
+		return true
+	})
+	if found < 0 {
+		return 0
+	}
+	l.pack.Delete(found, 1)
+	return 1
+}
+
+// RemoveByCond remove the first element matching the condition
+func (l *List) RemoveByCond(condition func(int, any) bool) (result int) {
+	if l.pack == nil {
+		return l.quick.RemoveByCond(condition)
+	}
+	found := -1
+	l.pack.ForEach(func(idx int, v []byte) bool {
+		if condition(idx, string(v)) {
+			found = idx
+			return false
+		}
+		return true
+	})
+	if found < 0 {
+		return 0
+	}
+	l.pack.Delete(found, 1)
+	return 1
+}
+
+func (l *List) Set(idx int, value any) {
+	v := toString(value)
+	l.convertIfNeeded(v, false)
+	if l.pack != nil {
+		l.pack.Set(idx, []byte(v))
+		return
+	}
+	l.quick.Set(idx, v)
+}
+
+func (l *List) ForEach(consumer func(value any) bool) {
+	if l.pack != nil {
+		l.pack.ForEach(func(idx int, v []byte) bool {
+			return consumer(string(v))
+		})
+		return
+	}
+	l.quick.ForEach(consumer)
+}
+
+func (l *List) FindRangeValue(start int, stop int) (values []any) {
+	if l.pack == nil {
+		return l.quick.FindRangeValue(start, stop)
+	}
+	start = max(start, 0)
+	stop = min(stop, l.pack.Len()-1)
+	if start > stop {
+		return nil
+	}
+	values = make([]any, 0, stop-start+1)
+	l.pack.ForEach(func(idx int, v []byte) bool {
+		if idx >= start {
+			values = append(values, string(v))
+		}
+		return idx < stop
+	})
+	return values
+}
@@ -0,0 +1,78 @@
+package list
+
+import (
+	"strings"
+	"testing"
+)
+
+func rangeOf(l *List) string {
+	values := make([]string, 0, l.Len())
+	for _, value := range l.FindRangeValue(0, l.Len()-1) {
+		values = append(values, value.(string))
+	}
+	return strings.Join(values, ",")
+}
+
+func TestList(t *testing.T) {
+	defer func(size int) {
+		ListpackSize = size
+	}(ListpackSize)
+	for _, size := range []int{-2, 1} {
+		ListpackSize = size
+		l := NewList()
+		l.InsertTail("b")
+		l.InsertHead("a")
+		l.InsertTail("c")
+		l.InsertTail("b")
+		if got := rangeOf(l); got != "a,b,c,b" {
+			t.Error("insert err: ", size, got)
+		}
+		if l.RemoveByValue("b", true) != 1 || rangeOf(l) != "a,b,c" {
+			t.Error("remove by value err: ", size, rangeOf(l))
+		}
+		l.Set(1, "x")
+		if l.Get(1) != "x" || l.Get(3) != nil {
+			t.Error("set err: ", size, rangeOf(l))
+		}
+		if l.RemoveHead() != "a" || l.RemoveTail() != "c" || rangeOf(l) != "x" {
+			t.Error("remove err: ", size, rangeOf(l))
+		}
+		if got := l.FindRangeValue(-1, 5); len(got) != 1 {
+			t.Error("range should be clamped: ", size, got)
+		}
+		l.Insert(0, "h")
+		l.Insert(2, "t")
+		l.Insert(1, "m")
+		if got := rangeOf(l); got != "h,m,x,t" {
+			t.Error("insert by index err: ", size, got)
+		}
+	}
+}
+
+func TestListConversion(t *testing.T) {
+	defer func(size int) {
+		ListpackSize = size
+	}(ListpackSize)
+
+	ListpackSize = 3
+	l := NewList()
+	for _, value := range []string{"a", "b", "c"} {
+		l.InsertTail(value)
+	}
+	if l.Encoding() != EncodingListpack {
+		t.Error("list should be a listpack: ", l.Encoding())
+	}
+	l.InsertHead("z")
+	if l.Encoding() != EncodingQuickList || rangeOf(l) != "z,a,b,c" {
+		t.Error("list should be converted by the entries: ", l.Encoding(), rangeOf(l))
+	}
+
+	// -1 limits the listpack to 4kb
+	ListpackSize = -1
+	l = NewList()
+	l.InsertTail("a")
+	l.Set(0, strings.Repeat("v", 4096))
+	if l.Encoding() != EncodingQuickList || l.Len() != 1 || l.ListpackBytes() != 0 {
+		t.Error("list should be converted by the bytes: ", l.Encoding(), l.Len())
+	}
+}
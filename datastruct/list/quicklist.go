@@ -0,0 +1,434 @@
+package list
+
+import (
+	"bytes"
+	"compress/flate"
+	"github.com/xzwsloser/Go-redis/datastruct/listpack"
+	"io"
+	"sync"
+)
+
+/**
+QuickList is the quicklist of redis, a doubly linked list of listpack nodes. every node is bounded by
+ListpackSize like the small list, so the list is walked node by node instead of element by element and
+the elements of a node share one allocation. the interior nodes can be compressed by CompressDepth
+*/
+
+const (
+	// minCompressBytes is the smallest node to compress
+	minCompressBytes = 48
+	// minCompressImprove is the least bytes the compression should save
+	minCompressImprove = 8
+)
+
+// CompressDepth is list-compress-depth of redis, the number of the nodes kept uncompressed at both ends
+// of the quicklist, 0 disables the compression
+var CompressDepth = 0
+
+var flateWriters = sync.Pool{
+	New: func() any {
+		w, _ := flate.NewWriter(nil, flate.BestSpeed)
+		return w
+	},
+}
+
+type quickListNode struct {
+	prev *quickListNode
+	next *quickListNode
+	// pack is nil when the node is compressed
+	pack       *listpack.ListPack
+	compressed []byte
+	count      int
+}
+
+type QuickList struct {
+	head  *quickListNode
+	tail  *quickListNode
+	size  int
+	nodes int
+}
+
+func NewQuickList() *QuickList {
+	return &QuickList{}
+}
+
+// newQuickListFromPack make the listpack the first node of the quicklist
+func newQuickListFromPack(pack *listpack.ListPack) *QuickList {
+	q := NewQuickList()
+	if pack.Len() > 0 {
+		node := &quickListNode{pack: pack, count: pack.Len()}
+		q.head, q.tail = node, node
+		q.size, q.nodes = pack.Len(), 1
+	}
+	return q
+}
+
+// packAllows check whether the value can be added into the listpack without going over ListpackSize
+func packAllows(pack *listpack.ListPack, value string) bool {
+	if pack.Len() == 0 {
+		return true
+	}
+	if ListpackSize > 0 && pack.Len()+1 > ListpackSize {
+		return false
+	}
+	return pack.Bytes()+listpack.EntrySize([]byte(value)) <= listpackLimit()
+}
+
+// view get the listpack of the node for reading, a compressed node is decompressed into a copy
+func (node *quickListNode) view() *listpack.ListPack {
+	if node.pack != nil {
+		return node.pack
+	}
+	reader := flate.NewReader(bytes.NewReader(node.compressed))
+	defer reader.Close()
+	buf, _ := io.ReadAll(reader)
+	return listpack.Load(buf, node.count)
+}
+
+// load decompress the node for writing
+func (node *quickListNode) load() *listpack.ListPack {
+	if node.pack == nil {
+		node.pack = node.view()
+		node.compressed = nil
+	}
+	return node.pack
+}
+
+// compress the node, it is kept as it is if the compression saves little
+func (node *quickListNode) compress() {
+	if node.pack == nil || node.pack.Bytes() < minCompressBytes {
+		return
+	}
+	var buf bytes.Buffer
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	_, _ = w.Write(node.pack.Encoded())
+	_ = w.Close()
+	flateWriters.Put(w)
+	if buf.Len()+minCompressImprove > node.pack.Bytes() {
+		return
+	}
+	node.compressed = buf.Bytes()
+	node.pack = nil
+}
+
+// nearEnds check whether the node is one of the CompressDepth nodes at the ends
+func (q *QuickList) nearEnds(node *quickListNode) bool {
+	head, tail := q.head, q.tail
+	for i := 0; i < CompressDepth && head != nil; i++ {
+		if head == node || tail == node {
+			return true
+		}
+		head, tail = head.next, tail.prev
+	}
+	return false
+}
+
+// recompress keep the nodes at the ends uncompressed and compress the touched interior nodes
+func (q *QuickList) recompress(touched ...*quickListNode) {
+	if CompressDepth <= 0 {
+		return
+	}
+	head, tail := q.head, q.tail
+	for i := 0; i < CompressDepth && head != nil; i++ {
+		head.load()
+		tail.load()
+		head, tail = head.next, tail.prev
+	}
+	// the nodes next to the ends may be pushed into the interior
+	if head != nil && !q.nearEnds(head) {
+		head.compress()
+	}
+	if tail != nil && !q.nearEnds(tail) {
+		tail.compress()
+	}
+	for _, node := range touched {
+		if node != nil && !q.nearEnds(node) {
+			node.compress()
+		}
+	}
+}
+
+// linkAfter link the node after the prev, or as the head if the prev is nil
+func (q *QuickList) linkAfter(prev *quickListNode, node *quickListNode) {
+	node.prev = prev
+	if prev == nil {
+		node.next = q.head
+		q.head = node
+	} else {
+		node.next = prev.next
+		prev.next = node
+	}
+	if node.next != nil {
+		node.next.prev = node
+	} else {
+		q.tail = node
+	}
+	q.nodes++
+}
+
+func (q *QuickList) unlink(node *quickListNode) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		q.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		q.tail = node.prev
+	}
+	node.prev, node.next = nil, nil
+	q.nodes--
+}
+
+func newQuickListNode(value string) *quickListNode {
+	pack := listpack.NewListPack()
+	pack.Append([]byte(value))
+	return &quickListNode{pack: pack, count: 1}
+}
+
+// findNode get the node of the element idx and the offset of the element in the node
+func (q *QuickList) findNode(idx int) (*quickListNode, int) {
+	if idx < 0 || idx >= q.size {
+		return nil, 0
+	}
+	if idx < q.size/2 {
+		node := q.head
+		for idx >= node.count {
+			idx -= node.count
+			node = node.next
+		}
+		return node, idx
+	}
+	idx = q.size - 1 - idx
+	node := q.tail
+	for idx >= node.count {
+		idx -= node.count
+		node = node.prev
+	}
+	return node, node.count - 1 - idx
+}
+
+func (q *QuickList) Len() int {
+	return q.size
+}
+
+func (q *QuickList) Empty() bool {
+	return q.size == 0
+}
+
+// Nodes is the number of the listpack nodes
+func (q *QuickList) Nodes() int {
+	return q.nodes
+}
+
+func (q *QuickList) Get(idx int) (value any) {
+	node, offset := q.findNode(idx)
+	if node == nil {
+		return nil
+	}
+	return string(node.view().Get(offset))
+}
+
+func (q *QuickList) InsertHead(value any) (l int) {
+	v := toString(value)
+	if q.head != nil && packAllows(q.head.load(), v) {
+		q.head.pack.Insert(0, []byte(v))
+		q.head.count++
+	} else {
+		q.linkAfter(nil, newQuickListNode(v))
+	}
+	q.size++
+	q.recompress()
+	return q.size
+}
+
+func (q *QuickList) InsertTail(value any) (l int) {
+	v := toString(value)
+	if q.tail != nil && packAllows(q.tail.load(), v) {
+		q.tail.pack.Append([]byte(v))
+		q.tail.count++
+	} else {
+		q.linkAfter(q.tail, newQuickListNode(v))
+	}
+	q.size++
+	q.recompress()
+	return q.size
+}
+
+// Insert the value before the element idx, idx == Len() appends it
+func (q *QuickList) Insert(idx int, value any) {
+	if idx == 0 {
+		q.InsertHead(value)
+		return
+	}
+	if idx == q.size {
+		q.InsertTail(value)
+		return
+	}
+	node, offset := q.findNode(idx)
+	if node == nil {
+		return
+	}
+	v := toString(value)
+	pack := node.load()
+	q.size++
+	if packAllows(pack, v) {
+		pack.Insert(offset, []byte(v))
+		node.count++
+		q.recompress(node)
+		return
+	}
+	// the node is full, the value gets a new node and the node is split around it
+	inserted := newQuickListNode(v)
+	if offset == 0 {
+		q.linkAfter(node.prev, inserted)
+		q.recompress(node, inserted)
+		return
+	}
+	rest := listpack.NewListPack()
+	pack.ForEach(func(i int, value []byte) bool {
+		if i >= offset {
+			rest.Append(value)
+		}
+		return true
+	})
+	pack.Delete(offset, pack.Len()-offset)
+	node.count = pack.Len()
+	restNode := &quickListNode{pack: rest, count: rest.Len()}
+	q.linkAfter(node, restNode)
+	q.linkAfter(node, inserted)
+	q.recompress(node, inserted, restNode)
+}
+
+// removeAt remove the element of the node, the empty node is unlinked
+func (q *QuickList) removeAt(node *quickListNode, offset int) (value any) {
+	pack := node.load()
+	value = string(pack.Get(offset))
+	pack.Delete(offset, 1)
+	node.count--
+	q.size--
+	if node.count == 0 {
+		q.unlink(node)
+		q.recompress()
+	} else {
+		q.recompress(node)
+	}
+	return value
+}
+
+func (q *QuickList) RemoveHead() (value any) {
+	if q.Empty() {
+		return nil
+	}
+	return q.removeAt(q.head, 0)
+}
+
+func (q *QuickList) RemoveTail() (value any) {
+	if q.Empty() {
+		return nil
+	}
+	return q.removeAt(q.tail, q.tail.count-1)
+}
+
+// RemoveByValue remove the first element equal to the value from the head, or from the tail if reversed
+func (q *QuickList) RemoveByValue(value any, reversed bool) (result int) {
+	target := toString(value)
+	node := q.head
+	if reversed {
+		node = q.tail
+	}
+	for node != nil {
+		found := -1
+		node.view().ForEach(func(idx int, v []byte) bool {
+			if string(v) == target {
+				found = idx
+				return reversed
+			}
+			return true
+		})
+		if found >= 0 {
+			q.removeAt(node, found)
+			return 1
+		}
+		if reversed {
+			node = node.prev
+		} else {
+			node = node.next
+		}
+	}
+	return 0
+}
+
+// RemoveByCond remove the first element matching the condition
+func (q *QuickList) RemoveByCond(condition func(int, any) bool) (result int) {
+	start := 0
+	for node := q.head; node != nil; node = node.next {
+		found := -1
+		node.view().ForEach(func(idx int, v []byte) bool {
+			if condition(start+idx, string(v)) {
+				found = idx
+				return false
+			}
+			return true
+		})
+		if found >= 0 {
+			q.removeAt(node, found)
+			return 1
+		}
+		start += node.count
+	}
+	return 0
+}
+
+func (q *QuickList) Set(idx int, value any) {
+	node, offset := q.findNode(idx)
+	if node == nil {
+		return
+	}
+	v := toString(value)
+	pack := node.load()
+	old := pack.Get(offset)
+	if node.count == 1 || pack.Bytes()-listpack.EntrySize(old)+listpack.EntrySize([]byte(v)) <= listpackLimit() {
+		pack.Set(offset, []byte(v))
+		q.recompress(node)
+		return
+	}
+	// the value makes the node too large, it is moved into a node of its own
+	q.removeAt(node, offset)
+	q.Insert(idx, v)
+}
+
+func (q *QuickList) ForEach(consumer func(value any) bool) {
+	for node := q.head; node != nil; node = node.next {
+		goOn := true
+		node.view().ForEach(func(idx int, v []byte) bool {
+			goOn = consumer(string(v))
+			return goOn
+		})
+		if !goOn {
+			return
+		}
+	}
+}
+
+func (q *QuickList) FindRangeValue(start int, stop int) (values []any) {
+	start = max(start, 0)
+	stop = min(stop, q.size-1)
+	if start > stop {
+		return nil
+	}
+	values = make([]any, 0, stop-start+1)
+	node, offset := q.findNode(start)
+	for ; node != nil && len(values) < stop-start+1; node = node.next {
+		node.view().ForEach(func(idx int, v []byte) bool {
+			if idx >= offset {
+				values = append(values, string(v))
+			}
+			return len(values) < stop-start+1
+		})
+		offset = 0
+	}
+	return values
+}
@@ -0,0 +1,202 @@
+package list
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func quickValues(q *QuickList) []string {
+	values := make([]string, 0, q.Len())
+	q.ForEach(func(value any) bool {
+		values = append(values, value.(string))
+		return true
+	})
+	return values
+}
+
+// checkNodes check the counts and the links of the nodes and the compression of the interior nodes
+func checkNodes(t *testing.T, q *QuickList) {
+	t.Helper()
+	size, nodes := 0, 0
+	var prev *quickListNode
+	for node := q.head; node != nil; node = node.next {
+		if node.prev != prev || node.count == 0 || node.view().Len() != node.count {
+			t.Fatal("node err: ", nodes, node.count)
+		}
+		if node.pack == nil && q.nearEnds(node) {
+			t.Fatal("the node at the ends should not be compressed: ", nodes)
+		}
+		size += node.count
+		nodes++
+		prev = node
+	}
+	if prev != q.tail || size != q.size || nodes != q.nodes {
+		t.Fatal("quicklist err: ", size, q.size, nodes, q.nodes)
+	}
+}
+
+func TestQuickList(t *testing.T) {
+	defer func(size int, depth int) {
+		ListpackSize, CompressDepth = size, depth
+	}(ListpackSize, CompressDepth)
+
+	for _, setting := range [][2]int{{4, 0}, {-1, 0}, {4, 1}, {3, 2}} {
+		ListpackSize, CompressDepth = setting[0], setting[1]
+		r := rand.New(rand.NewSource(1))
+		q := NewQuickList()
+		expected := make([]string, 0)
+		for i := 0; i < 2000; i++ {
+			value := strconv.Itoa(r.Intn(50)) + strings.Repeat("v", r.Intn(40))
+			switch op := r.Intn(8); {
+			case op < 2:
+				q.InsertHead(value)
+				expected = append([]string{value}, expected...)
+			case op < 4:
+				q.InsertTail(value)
+				expected = append(expected, value)
+			case op == 4:
+				idx := r.Intn(len(expected) + 1)
+				q.Insert(idx, value)
+				expected = append(expected[:idx], append([]string{value}, expected[idx:]...)...)
+			case op == 5 && len(expected) > 0:
+				idx := r.Intn(len(expected))
+				q.Set(idx, value)
+				expected[idx] = value
+			case op == 6 && len(expected) > 0:
+				if r.Intn(2) == 0 {
+					if q.RemoveHead() != expected[0] {
+						t.Fatal("remove head err: ", setting, i)
+					}
+					expected = expected[1:]
+				} else {
+					if q.RemoveTail() != expected[len(expected)-1] {
+						t.Fatal("remove tail err: ", setting, i)
+					}
+					expected = expected[:len(expected)-1]
+				}
+			case op == 7 && len(expected) > 0:
+				target := expected[r.Intn(len(expected))]
+				q.RemoveByValue(target, true)
+				for j := len(expected) - 1; j >= 0; j-- {
+					if expected[j] == target {
+						expected = append(expected[:j], expected[j+1:]...)
+						break
+					}
+				}
+			}
+			checkNodes(t, q)
+		}
+		if got := strings.Join(quickValues(q), ","); got != strings.Join(expected, ",") {
+			t.Fatal("quicklist elements err: ", setting)
+		}
+		for i := range expected {
+			if q.Get(i) != expected[i] {
+				t.Fatal("get err: ", setting, i)
+			}
+		}
+		if got := q.FindRangeValue(10, 20); len(got) != 11 || got[0] != expected[10] || got[10] != expected[20] {
+			t.Error("range err: ", setting, got)
+		}
+	}
+}
+
+func TestQuickListCompression(t *testing.T) {
+	defer func(size int, depth int) {
+		ListpackSize, CompressDepth = size, depth
+	}(ListpackSize, CompressDepth)
+
+	ListpackSize, CompressDepth = 16, 1
+	q := NewQuickList()
+	for i := 0; i < 160; i++ {
+		q.InsertTail("element-" + strconv.Itoa(i%4))
+	}
+	if q.Nodes() != 10 {
+		t.Fatal("nodes err: ", q.Nodes())
+	}
+	compressed := 0
+	for node := q.head; node != nil; node = node.next {
+		if node.pack == nil {
+			compressed++
+		}
+	}
+	if compressed != 8 || q.head.pack == nil || q.tail.pack == nil {
+		t.Error("only the interior nodes should be compressed: ", compressed)
+	}
+	if q.Get(80) != "element-0" || q.Get(159) != "element-3" {
+		t.Error("get from the compressed node err: ", q.Get(80))
+	}
+	q.Set(81, "x")
+	if q.Get(81) != "x" || q.findNodeOf(81).pack != nil {
+		t.Error("the modified interior node should be compressed again")
+	}
+}
+
+func (q *QuickList) findNodeOf(idx int) *quickListNode {
+	node, _ := q.findNode(idx)
+	return node
+}
+
+const benchmarkSize = 1000000
+
+type benchmarkList interface {
+	Get(idx int) any
+	InsertTail(value any) int
+	FindRangeValue(start int, stop int) []any
+}
+
+func fillList(l benchmarkList) benchmarkList {
+	for i := 0; i < benchmarkSize; i++ {
+		l.InsertTail("element-" + strconv.Itoa(i))
+	}
+	return l
+}
+
+func benchmarkIndex(b *testing.B, l benchmarkList) {
+	r := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Get(r.Intn(benchmarkSize))
+	}
+}
+
+func benchmarkRange(b *testing.B, l benchmarkList) {
+	r := rand.New(rand.NewSource(1))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		start := r.Intn(benchmarkSize - 100)
+		l.FindRangeValue(start, start+99)
+	}
+}
+
+func benchmarkPush(b *testing.B, newList func() benchmarkList) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		fillList(newList())
+	}
+}
+
+func BenchmarkLinkedListIndex(b *testing.B) {
+	benchmarkIndex(b, fillList(NewLinkedList()))
+}
+
+func BenchmarkQuickListIndex(b *testing.B) {
+	benchmarkIndex(b, fillList(NewQuickList()))
+}
+
+func BenchmarkLinkedListRange(b *testing.B) {
+	benchmarkRange(b, fillList(NewLinkedList()))
+}
+
+func BenchmarkQuickListRange(b *testing.B) {
+	benchmarkRange(b, fillList(NewQuickList()))
+}
+
+func BenchmarkLinkedListPush(b *testing.B) {
+	benchmarkPush(b, func() benchmarkList { return NewLinkedList() })
+}
+
+func BenchmarkQuickListPush(b *testing.B) {
+	benchmarkPush(b, func() benchmarkList { return NewQuickList() })
+}
@@ -0,0 +1,131 @@
+package listpack
+
+import "encoding/binary"
+
+/**
+ListPack is a compact list of strings stored in one contiguous byte slice like the listpack of redis,
+every entry is the uvarint length followed by the bytes, so there is no pointer or header per entry.
+the entries are found by walking from the head, it is only suitable for the small collections
+*/
+
+type ListPack struct {
+	buf  []byte
+	size int
+}
+
+func NewListPack() *ListPack {
+	return &ListPack{}
+}
+
+// Load build the listpack from the encoded entries, it takes the ownership of the buf
+func Load(buf []byte, size int) *ListPack {
+	return &ListPack{
+		buf:  buf,
+		size: size,
+	}
+}
+
+// Len is the number of the entries
+func (lp *ListPack) Len() int {
+	return lp.size
+}
+
+// Bytes is the size of the encoded entries
+func (lp *ListPack) Bytes() int {
+	return len(lp.buf)
+}
+
+// Encoded is the encoded entries, it shares the memory of the listpack
+func (lp *ListPack) Encoded() []byte {
+	return lp.buf
+}
+
+// EntrySize is the encoded size of the value
+func EntrySize(value []byte) int {
+	var head [binary.MaxVarintLen64]byte
+	return binary.PutUvarint(head[:], uint64(len(value))) + len(value)
+}
+
+// offset get the position of the entry idx, idx == Len() is the end of the buf
+func (lp *ListPack) offset(idx int) int {
+	off := 0
+	for i := 0; i < idx; i++ {
+		_, off = lp.entryAt(off)
+	}
+	return off
+}
+
+// entryAt decode the entry at the position, return the value and the position of the next entry
+func (lp *ListPack) entryAt(off int) (value []byte, next int) {
+	length, n := binary.Uvarint(lp.buf[off:])
+	start := off + n
+	end := start + int(length)
+	return lp.buf[start:end:end], end
+}
+
+// Get the value of the entry, the value shares the memory of the listpack
+func (lp *ListPack) Get(idx int) []byte {
+	if idx < 0 || idx >= lp.size {
+		return nil
+	}
+	value, _ := lp.entryAt(lp.offset(idx))
+	return value
+}
+
+// Insert the value before the entry idx, idx == Len() appends it
+func (lp *ListPack) Insert(idx int, value []byte) {
+	if idx < 0 || idx > lp.size {
+		return
+	}
+	off := lp.offset(idx)
+	var head [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(head[:], uint64(len(value)))
+	grow := n + len(value)
+	lp.buf = append(lp.buf, make([]byte, grow)...)
+	copy(lp.buf[off+grow:], lp.buf[off:len(lp.buf)-grow])
+	copy(lp.buf[off:], head[:n])
+	copy(lp.buf[off+n:], value)
+	lp.size++
+}
+
+func (lp *ListPack) Append(value []byte) {
+	lp.buf = binary.AppendUvarint(lp.buf, uint64(len(value)))
+	lp.buf = append(lp.buf, value...)
+	lp.size++
+}
+
+// Delete remove count entries from idx
+func (lp *ListPack) Delete(idx int, count int) {
+	if idx < 0 || idx >= lp.size || count <= 0 {
+		return
+	}
+	count = min(count, lp.size-idx)
+	start := lp.offset(idx)
+	end := start
+	for i := 0; i < count; i++ {
+		_, end = lp.entryAt(end)
+	}
+	lp.buf = append(lp.buf[:start], lp.buf[end:]...)
+	lp.size -= count
+}
+
+// Set replace the value of the entry idx
+func (lp *ListPack) Set(idx int, value []byte) {
+	if idx < 0 || idx >= lp.size {
+		return
+	}
+	lp.Delete(idx, 1)
+	lp.Insert(idx, value)
+}
+
+// ForEach visit the entries from the head until the consumer returns false
+func (lp *ListPack) ForEach(consumer func(idx int, value []byte) bool) {
+	off := 0
+	for i := 0; i < lp.size; i++ {
+		var value []byte
+		value, off = lp.entryAt(off)
+		if !consumer(i, value) {
+			return
+		}
+	}
+}
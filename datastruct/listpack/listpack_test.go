@@ -0,0 +1,58 @@
+package listpack
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func values(lp *ListPack) []string {
+	result := make([]string, 0, lp.Len())
+	lp.ForEach(func(idx int, value []byte) bool {
+		result = append(result, string(value))
+		return true
+	})
+	return result
+}
+
+func TestListPack(t *testing.T) {
+	lp := NewListPack()
+	lp.Append([]byte("b"))
+	lp.Insert(0, []byte("a"))
+	lp.Insert(2, []byte(strings.Repeat("c", 200)))
+	lp.Insert(1, []byte(""))
+	if got := strings.Join(values(lp), ","); got != "a,,b,"+strings.Repeat("c", 200) {
+		t.Error("insert err: ", got)
+	}
+	if lp.Len() != 4 || lp.Bytes() != 2+1+2+202 {
+		t.Error("size err: ", lp.Len(), lp.Bytes())
+	}
+	if string(lp.Get(2)) != "b" || lp.Get(4) != nil || lp.Get(-1) != nil {
+		t.Error("get err")
+	}
+
+	lp.Set(1, []byte("x"))
+	lp.Delete(2, 5)
+	if got := strings.Join(values(lp), ","); got != "a,x" || lp.Len() != 2 {
+		t.Error("set and delete err: ", got)
+	}
+	lp.Delete(0, 2)
+	if lp.Len() != 0 || lp.Bytes() != 0 {
+		t.Error("delete all err: ", lp.Len(), lp.Bytes())
+	}
+}
+
+func TestListPackForEach(t *testing.T) {
+	lp := NewListPack()
+	for i := 0; i < 10; i++ {
+		lp.Append([]byte(strconv.Itoa(i)))
+	}
+	visited := 0
+	lp.ForEach(func(idx int, value []byte) bool {
+		visited++
+		return idx < 4
+	})
+	if visited != 5 {
+		t.Error("foreach should stop: ", visited)
+	}
+}
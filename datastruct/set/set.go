@@ -0,0 +1,142 @@
+package set
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Set is the data structure of the redis set type
+type Set struct {
+	dict map[string]struct{}
+}
+
+func NewSet(members ...string) *Set {
+	s := &Set{
+		dict: make(map[string]struct{}, len(members)),
+	}
+	for _, member := range members {
+		s.dict[member] = struct{}{}
+	}
+	return s
+}
+
+// Add add the member into set, return 1 if the member is new
+func (s *Set) Add(member string) (result int) {
+	if _, exists := s.dict[member]; exists {
+		return 0
+	}
+	s.dict[member] = struct{}{}
+	return 1
+}
+
+func (s *Set) Remove(member string) (result int) {
+	if _, exists := s.dict[member]; !exists {
+		return 0
+	}
+	delete(s.dict, member)
+	return 1
+}
+
+func (s *Set) Has(member string) bool {
+	_, exists := s.dict[member]
+	return exists
+}
+
+func (s *Set) Len() int {
+	return len(s.dict)
+}
+
+func (s *Set) ForEach(consumer func(member string) bool) {
+	for member := range s.dict {
+		if !consumer(member) {
+			break
+		}
+	}
+}
+
+func (s *Set) Members() []string {
+	members := make([]string, 0, len(s.dict))
+	for member := range s.dict {
+		members = append(members, member)
+	}
+	return members
+}
+
+// RandomMembers return limit members from the set, the members may be repeated so the limit
+// given by the client should be bounded by the caller
+func (s *Set) RandomMembers(limit int) []string {
+	if s.Len() == 0 || limit <= 0 {
+		return nil
+	}
+	members := s.Members()
+	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
+	result := make([]string, 0, limit)
+	for i := 0; i < limit; i++ {
+		result = append(result, members[nR.Intn(len(members))])
+	}
+	return result
+}
+
+// RandomDistinctMembers return at most limit different members from the set
+func (s *Set) RandomDistinctMembers(limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+	members := s.Members()
+	if limit >= len(members) {
+		return members
+	}
+	nR := rand.New(rand.NewSource(time.Now().UnixNano()))
+	nR.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	return members[:limit]
+}
+
+// Intersect return the members exist in all the sets
+func Intersect(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+	sets[0].ForEach(func(member string) bool {
+		for _, s := range sets[1:] {
+			if !s.Has(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// Union return the members exist in any of the sets
+func Union(sets ...*Set) *Set {
+	result := NewSet()
+	for _, s := range sets {
+		s.ForEach(func(member string) bool {
+			result.Add(member)
+			return true
+		})
+	}
+	return result
+}
+
+// Diff return the members of the first set which not exist in the other sets
+func Diff(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+	sets[0].ForEach(func(member string) bool {
+		for _, s := range sets[1:] {
+			if s.Has(member) {
+				return true
+			}
+		}
+		result.Add(member)
+		return true
+	})
+	return result
+}
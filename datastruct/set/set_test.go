@@ -0,0 +1,57 @@
+package set
+
+import (
+	"testing"
+)
+
+func TestSetAdd(t *testing.T) {
+	s := NewSet()
+	if s.Add("a") != 1 || s.Add("a") != 0 {
+		t.Error("add member err")
+	}
+	s.Add("b")
+	if s.Remove("a") != 1 || s.Has("a") || s.Len() != 1 {
+		t.Error("remove member err")
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	s1 := NewSet("a", "b", "c", "d")
+	s2 := NewSet("c", "d", "e")
+	s3 := NewSet("d", "f")
+
+	inter := Intersect(s1, s2, s3)
+	if inter.Len() != 1 || !inter.Has("d") {
+		t.Error("intersect err: ", inter.Members())
+	}
+
+	union := Union(s1, s2, s3)
+	if union.Len() != 6 {
+		t.Error("union err: ", union.Members())
+	}
+
+	diff := Diff(s1, s2)
+	if diff.Len() != 2 || !diff.Has("a") || !diff.Has("b") {
+		t.Error("diff err: ", diff.Members())
+	}
+}
+
+func TestRandomMembers(t *testing.T) {
+	s := NewSet("a", "b", "c")
+	members := s.RandomMembers(5)
+	if len(members) != 5 {
+		t.Error("random members err: ", members)
+	}
+	for _, member := range members {
+		if !s.Has(member) {
+			t.Error("random member not in the set: ", member)
+		}
+	}
+	members = s.RandomDistinctMembers(2)
+	if len(members) != 2 || members[0] == members[1] {
+		t.Error("random distinct members err: ", members)
+	}
+	if len(s.RandomDistinctMembers(10)) != 3 {
+		t.Error("random distinct members should not more than the set")
+	}
+}
@@ -68,8 +68,15 @@ func (s *ScoreBorder) getExclude() bool {
 }
 
 func (s *ScoreBorder) IsIntersected(max Border) bool {
+	maxBorder := max.(*ScoreBorder)
+	if s.Inf == ScoreInfHigh || maxBorder.Inf == ScoreInfLow {
+		return false
+	}
+	if s.Inf == ScoreInfLow || maxBorder.Inf == ScoreInfHigh {
+		return true
+	}
 	minValue := s.Value
-	maxValue := max.(*ScoreBorder).Value
+	maxValue := maxBorder.Value
 	return minValue < maxValue || (minValue == maxValue && !max.getExclude() && !s.getExclude())
 }
 
@@ -120,7 +127,14 @@ func (m *MemberBorder) getExclude() bool {
 }
 
 func (m *MemberBorder) IsIntersected(max Border) bool {
+	maxBorder := max.(*MemberBorder)
+	if m.Inf == MemInfHigh || maxBorder.Inf == MemInfLow {
+		return false
+	}
+	if m.Inf == MemInfLow || maxBorder.Inf == MemInfHigh {
+		return true
+	}
 	minValue := m.Value
-	maxValue := max.(*MemberBorder).Value
+	maxValue := maxBorder.Value
 	return minValue < maxValue || (minValue == maxValue && !max.getExclude() && !m.getExclude())
 }
@@ -0,0 +1,113 @@
+package sortedset
+
+import (
+	"strconv"
+)
+
+/**
+@Description: the listpack encoding of the small sorted set, every member is followed by its score
+and the pairs are ordered by the score and then the member like the skiplist
+*/
+
+var (
+	// MaxListpackEntries is zset-max-listpack-entries of redis
+	MaxListpackEntries = 128
+	// MaxListpackValue is zset-max-listpack-value of redis
+	MaxListpackValue = 64
+)
+
+func formatScore(score float64) []byte {
+	return strconv.AppendFloat(nil, score, 'g', -1, 64)
+}
+
+// packElements decode the elements of the listpack in order
+func (s *SortedSet) packElements() []*Element {
+	elements := make([]*Element, 0, s.pack.Len()/2)
+	var member string
+	s.pack.ForEach(func(idx int, value []byte) bool {
+		if idx%2 == 0 {
+			member = string(value)
+			return true
+		}
+		score, _ := strconv.ParseFloat(string(value), 64)
+		elements = append(elements, &Element{
+			Member: member,
+			Score:  score,
+		})
+		return true
+	})
+	return elements
+}
+
+// packFind get the position and the element of the member, the position is -1 if it is not found
+func (s *SortedSet) packFind(member string) (int, *Element) {
+	for i, element := range s.packElements() {
+		if element.Member == member {
+			return i, element
+		}
+	}
+	return -1, nil
+}
+
+// packRange get the elements between min and max in order
+func (s *SortedSet) packRange(min Border, max Border) []*Element {
+	if !min.IsIntersected(max) {
+		return nil
+	}
+	elements := make([]*Element, 0)
+	for _, element := range s.packElements() {
+		if min.less(element) && max.greater(element) {
+			elements = append(elements, element)
+		}
+	}
+	return elements
+}
+
+// packPut put the member into the listpack, it converts the set to the skiplist if the listpack is too large
+func (s *SortedSet) packPut(member string, score float64) int {
+	elements := s.packElements()
+	pos := -1
+	for i, element := range elements {
+		if element.Member == member {
+			pos = i
+			break
+		}
+	}
+	if pos >= 0 {
+		if elements[pos].Score == score {
+			return 0
+		}
+		s.pack.Delete(pos*2, 2)
+		elements = append(elements[:pos], elements[pos+1:]...)
+	}
+	if len(elements)+1 > MaxListpackEntries || len(member) > MaxListpackValue {
+		s.convert(elements)
+		s.dict[member] = &Element{
+			Member: member,
+			Score:  score,
+		}
+		s.skiplist.insertNode(member, score)
+		return 1
+	}
+
+	rank := 0
+	for _, element := range elements {
+		if element.Score < score || (element.Score == score && element.Member < member) {
+			rank++
+		}
+	}
+	s.pack.Insert(rank*2, []byte(member))
+	s.pack.Insert(rank*2+1, formatScore(score))
+	return 1
+}
+
+// convert move the elements of the listpack to the dict and the skiplist
+func (s *SortedSet) convert(elements []*Element) {
+	s.dict = make(map[string]*Element, max(len(elements), DefaultDictSize))
+	s.skiplist = newSkipList()
+	for _, element := range elements {
+		s.dict[element.Member] = element
+		s.skiplist.insertNode(element.Member, element.Score)
+	}
+	s.pack = nil
+}
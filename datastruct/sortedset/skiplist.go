@@ -261,7 +261,7 @@ func (skiplist *skipList) getLastNodeInRange(min Border, max Border) *Node {
 	node := skiplist.header
 	for i := skiplist.level - 1; i >= 0; i-- {
 		for node.level[i].next != nil &&
-			!max.less(&node.level[i].next.Element) {
+			max.greater(&node.level[i].next.Element) {
 			node = node.level[i].next
 		}
 	}
@@ -2,27 +2,53 @@ package sortedset
 
 import (
 	"errors"
+	"github.com/xzwsloser/Go-redis/datastruct/listpack"
+	"math"
 	"slices"
 )
 
 const (
 	DefaultDictSize = 16
+
+	EncodingListpack = "listpack"
+	EncodingSkipList = "skiplist"
 )
 
+// SortedSet keeps the small set in a listpack and converts it to the dict and the skiplist
+// once it has more than MaxListpackEntries members or a member longer than MaxListpackValue
 type SortedSet struct {
 	dict     map[string]*Element
 	skiplist *skipList
+	pack     *listpack.ListPack
 }
 
 func NewSortedSet() *SortedSet {
 	return &SortedSet{
-		dict:     make(map[string]*Element),
-		skiplist: newSkipList(),
+		pack: listpack.NewListPack(),
+	}
+}
+
+// Encoding is the name of the internal representation shown by OBJECT ENCODING
+func (s *SortedSet) Encoding() string {
+	if s.pack != nil {
+		return EncodingListpack
 	}
+	return EncodingSkipList
+}
+
+// ListpackBytes is the size of the listpack, it is 0 after the set is converted
+func (s *SortedSet) ListpackBytes() int {
+	if s.pack == nil {
+		return 0
+	}
+	return s.pack.Bytes()
 }
 
 // @brief: Put: 向 SortedSet 中加入元素
 func (s *SortedSet) Put(member string, score float64) (result int) {
+	if s.pack != nil {
+		return s.packPut(member, score)
+	}
 	element, ok := s.dict[member]
 	s.dict[member] = &Element{
 		Member: member,
@@ -43,6 +69,10 @@ func (s *SortedSet) Put(member string, score float64) (result int) {
 }
 
 func (s *SortedSet) Get(member string) *Element {
+	if s.pack != nil {
+		_, element := s.packFind(member)
+		return element
+	}
 	element, ok := s.dict[member]
 	if ok {
 		return element
@@ -51,14 +81,26 @@ func (s *SortedSet) Get(member string) *Element {
 }
 
 func (s *SortedSet) Len() int64 {
+	if s.pack != nil {
+		return int64(s.pack.Len() / 2)
+	}
 	return int64(len(s.dict))
 }
 
 func (s *SortedSet) Remove(member string) int64 {
+	if s.pack != nil {
+		pos, _ := s.packFind(member)
+		if pos < 0 {
+			return 0
+		}
+		s.pack.Delete(pos*2, 2)
+		return 1
+	}
 	element, ok := s.dict[member]
 	if !ok {
 		return 0
 	}
+	delete(s.dict, member)
 	result := s.skiplist.remove(element.Member, element.Score)
 	if result {
 		return 1
@@ -67,13 +109,16 @@ func (s *SortedSet) Remove(member string) int64 {
 }
 
 func (s *SortedSet) CountInRange(min Border, max Border) int64 {
+	if s.pack != nil {
+		return int64(len(s.packRange(min, max)))
+	}
 	firstNode := s.skiplist.getFirstNodeInRange(min, max)
 	if firstNode == nil {
-		return -1
+		return 0
 	}
 	lastNode := s.skiplist.getLastNodeInRange(min, max)
 	if lastNode == nil {
-		return -1
+		return 0
 	}
 	rl := s.skiplist.getRank(firstNode.Member, firstNode.Score)
 	rr := s.skiplist.getRank(lastNode.Member, lastNode.Score)
@@ -88,7 +133,12 @@ func (s *SortedSet) GetRank(member string, desc bool) (rank int64, err error) {
 	// 1 2 3 4 5
 	// 0 1 2 3 4
 	// 4 3 2 1 0
-	rank = s.skiplist.getRank(element.Member, element.Score)
+	if s.pack != nil {
+		pos, _ := s.packFind(member)
+		rank = int64(pos + 1)
+	} else {
+		rank = s.skiplist.getRank(element.Member, element.Score)
+	}
 	if desc {
 		rank = s.Len() - rank
 	} else {
@@ -97,7 +147,18 @@ func (s *SortedSet) GetRank(member string, desc bool) (rank int64, err error) {
 	return
 }
 
+// GetByRange get the elements between min and max in order, or in the reversed order if desc
 func (s *SortedSet) GetByRange(min Border, max Border, desc bool) []*Element {
+	if s.pack != nil {
+		elements := s.packRange(min, max)
+		if len(elements) == 0 {
+			return nil
+		}
+		if desc {
+			slices.Reverse(elements)
+		}
+		return elements
+	}
 	firstNode := s.skiplist.getFirstNodeInRange(min, max)
 	lastNode := s.skiplist.getLastNodeInRange(min, max)
 	if firstNode == nil || lastNode == nil {
@@ -111,13 +172,21 @@ func (s *SortedSet) GetByRange(min Border, max Border, desc bool) []*Element {
 		elements[i-rl] = &s.skiplist.getByRank(i).Element
 	}
 
-	if !desc {
+	if desc {
 		slices.Reverse(elements)
 	}
 	return elements
 }
 
 func (s *SortedSet) GetByRankRange(start int64, stop int64) []*Element {
+	if s.pack != nil {
+		all := s.packElements()
+		elements := make([]*Element, 0, max(stop-start+1, 0))
+		for i := max(start, 1); i <= min(stop, int64(len(all))); i++ {
+			elements = append(elements, all[i-1])
+		}
+		return elements
+	}
 	elements := make([]*Element, 0, stop-start+1)
 	for i := start; i <= stop; i++ {
 		if i >= 1 && i <= s.Len() {
@@ -128,12 +197,51 @@ func (s *SortedSet) GetByRankRange(start int64, stop int64) []*Element {
 }
 
 func (s *SortedSet) RemByRankRange(start int64, stop int64) (result int64) {
+	if s.pack != nil {
+		start = max(start, 1)
+		stop = min(stop, s.Len())
+		if start > stop {
+			return 0
+		}
+		s.pack.Delete(int(start-1)*2, int(stop-start+1)*2)
+		return stop - start + 1
+	}
 	elements := s.skiplist.removeByRank(start, stop)
+	for _, element := range elements {
+		delete(s.dict, element.Member)
+	}
 	result = int64(len(elements))
 	return result
 }
 
+// RemoveByRange remove the elements between min and max, return the number of the removed elements
+func (s *SortedSet) RemoveByRange(min Border, max Border) int64 {
+	if s.pack != nil {
+		elements := s.packRange(min, max)
+		for _, element := range elements {
+			s.Remove(element.Member)
+		}
+		return int64(len(elements))
+	}
+	if s.skiplist.getFirstNodeInRange(min, max) == nil {
+		return 0
+	}
+	elements := s.skiplist.removeByRange(min, max, math.MaxInt)
+	for _, element := range elements {
+		delete(s.dict, element.Member)
+	}
+	return int64(len(elements))
+}
+
 func (s *SortedSet) ForEach(consumer func(score float64, member string) bool) {
+	if s.pack != nil {
+		for _, element := range s.packElements() {
+			if !consumer(element.Score, element.Member) {
+				break
+			}
+		}
+		return
+	}
 	if s.Len() == 0 {
 		return
 	}
@@ -24,3 +24,86 @@ func TestCountInRange(t *testing.T) {
 	inRange := ss.CountInRange(min, max)
 	log.Println("数量: ", inRange)
 }
+
+func TestSortedSetEncodings(t *testing.T) {
+	defer func(entries int) {
+		MaxListpackEntries = entries
+	}(MaxListpackEntries)
+	for _, entries := range []int{128, 0} {
+		MaxListpackEntries = entries
+		ss := NewSortedSet()
+		ss.Put("c", 3)
+		ss.Put("a", 1)
+		ss.Put("b", 2)
+		ss.Put("d", 4)
+		if ss.Put("b", 2) != 0 || ss.Put("b", 2.5) != 1 || ss.Len() != 4 {
+			t.Error("put err: ", entries, ss.Len())
+		}
+		if rank, _ := ss.GetRank("b", false); rank != 1 {
+			t.Error("rank err: ", entries, rank)
+		}
+		if e := ss.Get("b"); e == nil || e.Score != 2.5 {
+			t.Error("get err: ", entries, e)
+		}
+		elements := ss.GetByRange(&ScoreBorder{Value: 2}, &ScoreBorder{Inf: ScoreInfHigh}, false)
+		if len(elements) != 3 || elements[0].Member != "b" || elements[2].Member != "d" {
+			t.Error("range by score err: ", entries, elements)
+		}
+		elements = ss.GetByRange(&ScoreBorder{Value: 2}, &ScoreBorder{Inf: ScoreInfHigh}, true)
+		if len(elements) != 3 || elements[0].Member != "d" || elements[2].Member != "b" {
+			t.Error("reversed range by score err: ", entries, elements)
+		}
+		if n := ss.CountInRange(&ScoreBorder{Value: 1, Exclude: true}, &ScoreBorder{Value: 3}); n != 2 {
+			t.Error("count err: ", entries, n)
+		}
+		if ss.Remove("a") != 1 || ss.Remove("a") != 0 || ss.Len() != 3 {
+			t.Error("remove err: ", entries, ss.Len())
+		}
+		if n := ss.RemByRankRange(0, 1); n != 1 || ss.Len() != 2 || ss.Get("b") != nil {
+			t.Error("remove by rank err: ", entries, n, ss.Len())
+		}
+		if elements := ss.GetByRankRange(1, 5); len(elements) != 2 || elements[0].Member != "c" {
+			t.Error("range by rank err: ", entries, elements)
+		}
+		if n := ss.CountInRange(&ScoreBorder{Value: 10}, &ScoreBorder{Value: 20}); n != 0 {
+			t.Error("count of the empty range err: ", entries, n)
+		}
+		ss.Put("e", 5)
+		ss.Put("f", 6)
+		if n := ss.RemoveByRange(&ScoreBorder{Value: 4}, &ScoreBorder{Value: 5}); n != 2 || ss.Len() != 2 {
+			t.Error("remove by range err: ", entries, n, ss.Len())
+		}
+		if n := ss.RemoveByRange(&ScoreBorder{Value: 7}, &ScoreBorder{Inf: ScoreInfHigh}); n != 0 || ss.Len() != 2 {
+			t.Error("remove by the empty range err: ", entries, n, ss.Len())
+		}
+	}
+}
+
+func TestSortedSetConversion(t *testing.T) {
+	defer func(entries int, value int) {
+		MaxListpackEntries = entries
+		MaxListpackValue = value
+	}(MaxListpackEntries, MaxListpackValue)
+	MaxListpackEntries = 2
+	MaxListpackValue = 4
+
+	ss := NewSortedSet()
+	ss.Put("a", 1)
+	ss.Put("b", 2)
+	if ss.Encoding() != EncodingListpack {
+		t.Error("zset should be a listpack: ", ss.Encoding())
+	}
+	ss.Put("c", 0)
+	if ss.Encoding() != EncodingSkipList || ss.Len() != 3 {
+		t.Error("zset should be converted by the entries: ", ss.Encoding(), ss.Len())
+	}
+	if rank, _ := ss.GetRank("c", false); rank != 0 {
+		t.Error("converted zset rank err: ", rank)
+	}
+
+	ss = NewSortedSet()
+	ss.Put("long-member", 1)
+	if ss.Encoding() != EncodingSkipList || ss.Get("long-member") == nil {
+		t.Error("zset should be converted by the value: ", ss.Encoding())
+	}
+}
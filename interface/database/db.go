@@ -1,20 +1,34 @@
 package database
 
-import "github.com/xzwsloser/Go-redis/interface/redis"
+import (
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"time"
+)
 
 type CmdLine = [][]byte
 
 type DB interface {
 	Exec(conn redis.Conn, cmdLine [][]byte) redis.Reply
 	Close()
+	AfterClientConnect(conn redis.Conn)
 	AfterClientClose(conn redis.Conn)
 }
 
 type DataEntity struct {
 	Data any
+	// Size is the estimated memory of the key and the value kept by the database for the maxmemory
+	Size int64
+	// LRU is the access clock in milliseconds and LFU is the logarithmic access counter with
+	// the last decrement time like the lru field of the redis object, they are accessed atomically
+	LRU uint32
+	LFU uint32
 }
 
 type DBEngine interface {
 	DB
-	ForEach(dbIndex int, consumer func(key string, value *DataEntity) bool)
+	// ForEach scan the k-v of the database, the zero expireAt means the key never expires
+	ForEach(dbIndex int, consumer func(key string, value *DataEntity, expireAt time.Time) bool)
+	DBNumber() int
+	// LoadEntity put the entity loaded from the snapshot into the database directly
+	LoadEntity(dbIndex int, key string, value *DataEntity, expireAt time.Time)
 }
@@ -1,10 +1,25 @@
 package redis
 
+import "time"
+
 // Conn is the connection between client and redis server
 type Conn interface {
 	Write([]byte) (int, error)
 	Close() error
 	RemoteAddr() string
+	GetID() int64
+	GetProtocol() int
+	SetProtocol(int)
+	GetUser() string
+	SetUser(string)
+	GetName() string
+	SetName(string)
+	GetCreatedAt() time.Time
+	GetLastInteraction() time.Time
+	GetLastCmd() string
+	SetLastCmd(string)
+	IsNoEvict() bool
+	SetNoEvict(bool)
 	GetDBIndex() int
 	SelectDB(int)
 	Subscribe(channel string) bool
@@ -14,6 +29,8 @@ type Conn interface {
 	GetWatching() map[string]uint32
 	InitMulti() bool
 	SetMulti(bool)
+	IsAsking() bool
+	SetAsking(bool)
 	EnqueueCmd([][]byte)
 	GetCmdLineInQueue() [][][]byte
 	ClearCmdQueue()
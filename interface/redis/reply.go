@@ -3,3 +3,9 @@ package redis
 type Reply interface {
 	ToByte() []byte
 }
+
+// Resp3Reply is the reply which has a native format in resp3
+type Resp3Reply interface {
+	Reply
+	ToResp3() []byte
+}
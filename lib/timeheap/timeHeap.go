@@ -23,6 +23,9 @@ type TimeHeap struct {
 	addTaskChan chan *timeNode       // 添加任务的管道
 	removeChan  chan string          // 删除任务管道
 	stopChan    chan struct{}        // 停止管道
+	stopOnce    sync.Once            // 保证只停止一次
+	done        chan struct{}        // 心搏协程退出后关闭
+	jobs        sync.WaitGroup       // 正在执行的任务
 }
 
 func NewTimeHeap(duration time.Duration) *TimeHeap {
@@ -51,17 +54,25 @@ func (th *TimeHeap) AddTask(expireTime time.Time, key string, job func()) {
 		job:        job,
 		valid:      true,
 	}
-	th.addTaskChan <- tn
+	select {
+	case th.addTaskChan <- tn:
+	case <-th.stopChan:
+	}
 }
 
 // @brief: RemoveTask 提供给外界的函数,用于删除任务
 func (th *TimeHeap) RemoveTask(key string) {
-	th.removeChan <- key
+	select {
+	case th.removeChan <- key:
+	case <-th.stopChan:
+	}
 }
 
 func (th *TimeHeap) Start() {
 	th.ticker = time.NewTicker(th.interval)
+	th.done = make(chan struct{})
 	go func() {
+		defer close(th.done)
 		for {
 			select {
 			case task := <-th.addTaskChan:
@@ -70,13 +81,24 @@ func (th *TimeHeap) Start() {
 				th.remove(key)
 			case <-th.ticker.C:
 				th.tick()
+			case <-th.stopChan:
+				th.ticker.Stop()
+				return
 			}
 		}
 	}()
 }
 
+// @brief: Stop 停止心搏并等待正在执行的任务结束, 之后不再执行任务, 添加和删除任务也不会阻塞, 可以重复调用
 func (th *TimeHeap) Stop() {
-	th.stopChan <- struct{}{}
+	th.stopOnce.Do(func() {
+		close(th.stopChan)
+		// 心搏协程退出后不会再派发任务
+		if th.done != nil {
+			<-th.done
+		}
+		th.jobs.Wait()
+	})
 }
 
 func (th *TimeHeap) add(tn *timeNode) {
@@ -116,7 +138,11 @@ func (th *TimeHeap) tick() {
 		if curNode.valid {
 			keys = append(keys, curNode.key)
 			task := curNode.job
-			go task()
+			th.jobs.Add(1)
+			go func() {
+				defer th.jobs.Done()
+				task()
+			}()
 		}
 		if th.heap.Len() > 0 {
 			curNode = th.heap.Top().(*timeNode)
@@ -124,7 +150,7 @@ func (th *TimeHeap) tick() {
 	}
 	go func() {
 		for _, key := range keys {
-			th.removeChan <- key
+			th.RemoveTask(key)
 		}
 	}()
 }
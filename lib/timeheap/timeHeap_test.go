@@ -1,6 +1,7 @@
 package timeheap
 
 import (
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -30,3 +31,27 @@ func TestTimeHeap(t *testing.T) {
 	//})
 	time.Sleep(10 * time.Second)
 }
+
+func TestTimeHeapStop(t *testing.T) {
+	th := NewTimeHeap(time.Millisecond * 10)
+	th.Start()
+	started := make(chan struct{})
+	var finished atomic.Bool
+	th.AddTask(time.Now(), "k1", func() {
+		close(started)
+		time.Sleep(time.Millisecond * 100)
+		finished.Store(true)
+	})
+	<-started
+	// Stop waits for the running job and can be called again
+	th.Stop()
+	if !finished.Load() {
+		t.Error("the running job should be finished after stop")
+	}
+	th.Stop()
+	th.AddTask(time.Now(), "k2", func() {
+		t.Error("the job should not be run after stop")
+	})
+	th.RemoveTask("k2")
+	time.Sleep(time.Millisecond * 50)
+}
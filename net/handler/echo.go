@@ -49,7 +49,7 @@ func (e *EchoHandler) Handle(ctx context.Context, conn net.Conn) {
 			if err == io.EOF {
 				e.activeConn.Delete(client)
 				_ = client.Close()
-				continue
+				return
 			}
 
 			logger.Error("echo handler err: ", err.Error())
@@ -17,11 +17,13 @@ import (
 )
 
 type TcpServer struct {
-	ip          string
-	handler     handlerInterface.Handler
-	closeCh     chan struct{}
-	sigCh       chan os.Signal
-	listener    net.Listener
+	ip      string
+	handler handlerInterface.Handler
+	closeCh chan struct{}
+	sigCh   chan os.Signal
+	// listeners are the tcp listener, the tls listener and the unix socket listener,
+	// all of them feed the same handler
+	listeners   []net.Listener
 	wait        sync.WaitGroup
 	clientCount int32
 	ctx         context.Context
@@ -60,14 +62,54 @@ func NewTcpServer() *TcpServer {
 		logger.Fatal("error: ", err.Error())
 	}
 
-	server.listener = listener
+	server.listeners = append(server.listeners, listener)
+
+	if tlsConfig := config.GetTlsConfig(); tlsConfig.Port > 0 {
+		tlsListener, err := listenTLS(address+":"+strconv.Itoa(tlsConfig.Port), tlsConfig)
+		if err != nil {
+			logger.Fatal("tls error: %v", err)
+		}
+		logger.Info("redis server listen on tls port: %d", tlsConfig.Port)
+		server.listeners = append(server.listeners, tlsListener)
+	}
+
+	if unixSocket := config.GetRedisServerConfig().UnixSocket; unixSocket != "" {
+		unixListener, err := listenUnix(unixSocket, config.GetRedisServerConfig().UnixSocketPerm)
+		if err != nil {
+			logger.Fatal("unix socket error: %v", err)
+		}
+		logger.Info("redis server listen on unix socket: %s", unixSocket)
+		server.listeners = append(server.listeners, unixListener)
+	}
 	return server
 }
 
+// listenUnix listen on the unix socket, the stale socket file is removed before listening
+func listenUnix(path string, perm string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != "" {
+		mode, err := strconv.ParseUint(perm, 8, 32)
+		if err == nil {
+			err = os.Chmod(path, os.FileMode(mode))
+		}
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
 func (s *TcpServer) Run() {
 	s.isClosed = false
-	errCh := make(chan error, 1)
-	defer close(errCh)
+	// each listener sends at most one error
+	errCh := make(chan error, len(s.listeners))
 	go func() {
 		select {
 		case <-s.closeCh:
@@ -76,12 +118,30 @@ func (s *TcpServer) Run() {
 			logger.Error("tcp server error: ", err.Error())
 		}
 
-		_ = s.listener.Close()
+		for _, listener := range s.listeners {
+			_ = listener.Close()
+		}
 		_ = s.handler.Close()
 	}()
 
+	var serving sync.WaitGroup
+	for _, listener := range s.listeners {
+		serving.Add(1)
+		go func() {
+			defer serving.Done()
+			s.serve(listener, errCh)
+		}()
+	}
+	serving.Wait()
+
+	// wait all the task to end when the error exists
+	s.wait.Wait()
+}
+
+// serve accept the connections of the listener until it is closed
+func (s *TcpServer) serve(listener net.Listener, errCh chan<- error) {
 	for {
-		conn, err := s.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			// timeout try again
 			if ne, ok := err.(net.Error); ok && ne.Timeout() {
@@ -103,9 +163,6 @@ func (s *TcpServer) Run() {
 			s.handler.Handle(s.ctx, conn)
 		}()
 	}
-
-	// wait all the task to end when the error exists
-	s.wait.Wait()
 }
 
 func (s *TcpServer) Stop() {
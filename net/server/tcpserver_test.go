@@ -6,11 +6,26 @@ import (
 	"io"
 	"log"
 	"net"
+	"os"
 	"sync"
 	"testing"
 	"time"
 )
 
+// TestMain run the tests in a temporary directory, the aof, rdb and cluster files written by them are removed after
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "server-test")
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestTcpServer(t *testing.T) {
 	server := NewTcpServer()
 	go server.Run()
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/xzwsloser/Go-redis/config"
+	"net"
+	"os"
+	"strings"
+)
+
+// NewTLSConfig build the tls config of the server by the certificate, the key and the CA of the clients
+func NewTLSConfig(cfg *config.TlsConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, errors.New("unsupported tls min version: " + cfg.MinVersion)
+	}
+
+	switch strings.ToLower(cfg.AuthClients) {
+	case "", "yes":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "no":
+		tlsConfig.ClientAuth = tls.NoClientCert
+		return tlsConfig, nil
+	default:
+		return nil, errors.New("invalid value of AuthClients: " + cfg.AuthClients)
+	}
+
+	if cfg.CaCertFile == "" {
+		return nil, errors.New("CaCertFile is required to verify the client certificates")
+	}
+	caCert, err := os.ReadFile(cfg.CaCertFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caCert) {
+		return nil, errors.New("no certificate in " + cfg.CaCertFile)
+	}
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
+
+// listenTLS listen on the address and serve the connections by tls
+func listenTLS(address string, cfg *config.TlsConfig) (net.Listener, error) {
+	tlsConfig, err := NewTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return tls.Listen("tcp", address, tlsConfig)
+}
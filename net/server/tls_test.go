@@ -0,0 +1,190 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/xzwsloser/Go-redis/config"
+	"github.com/xzwsloser/Go-redis/net/handler"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// newTestCert create a certificate signed by the parent, it is self-signed if parent is nil
+func newTestCert(t *testing.T, parent *testCert, isCA bool, serial int64) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "go-redis-test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if isCA {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key, der: der}
+}
+
+// writeFiles write the certificate and the key in pem format
+func (c *testCert) writeFiles(t *testing.T, name string) (string, string) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	keyDer, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.der}), 0600)
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.der}, PrivateKey: c.key}
+}
+
+func TestTLS(t *testing.T) {
+	ca := newTestCert(t, nil, true, 1)
+	serverCert := newTestCert(t, ca, false, 2)
+	clientCert := newTestCert(t, ca, false, 3)
+	caFile, _ := ca.writeFiles(t, "ca")
+	certFile, keyFile := serverCert.writeFiles(t, "server")
+
+	cfg := &config.TlsConfig{
+		CertFile:    certFile,
+		KeyFile:     keyFile,
+		CaCertFile:  caFile,
+		AuthClients: "yes",
+		MinVersion:  "1.3",
+	}
+	tlsListener, err := listenTLS("127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &TcpServer{
+		handler:   handler.NewEchoHandler(),
+		closeCh:   make(chan struct{}),
+		listeners: []net.Listener{listener, tlsListener},
+		ctx:       context.Background(),
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Run()
+		close(done)
+	}()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	clientConfig := &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert.tlsCertificate()},
+	}
+	echo := func(conn net.Conn) (string, error) {
+		defer conn.Close()
+		if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+			return "", err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return bufio.NewReader(conn).ReadString('\n')
+	}
+
+	conn, err := tls.Dial("tcp", tlsListener.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal("tls dial err: ", err)
+	}
+	if line, err := echo(conn); err != nil || line != "PING\r\n" {
+		t.Error("echo over tls err: ", line, err)
+	}
+
+	// the client without certificate is rejected
+	conn, err = tls.Dial("tcp", tlsListener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		if _, err = echo(conn); err == nil {
+			t.Error("the client without certificate should be rejected")
+		}
+	}
+
+	// the client does not support tls 1.3
+	_, err = tls.Dial("tcp", tlsListener.Addr().String(), &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert.tlsCertificate()},
+		MaxVersion:   tls.VersionTLS12,
+	})
+	if err == nil {
+		t.Error("the tls version lower than the min version should be rejected")
+	}
+
+	// the plaintext port still works
+	plain, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line, err := echo(plain); err != nil || line != "PING\r\n" {
+		t.Error("echo over plaintext err: ", line, err)
+	}
+
+	server.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("the server should stop")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	cert := newTestCert(t, nil, true, 1)
+	certFile, keyFile := cert.writeFiles(t, "server")
+	cases := []struct {
+		cfg config.TlsConfig
+		ok  bool
+	}{
+		{config.TlsConfig{CertFile: certFile, KeyFile: keyFile, AuthClients: "no"}, true},
+		{config.TlsConfig{CertFile: certFile, KeyFile: keyFile, AuthClients: "optional", CaCertFile: certFile}, true},
+		// the CA is required to verify the clients
+		{config.TlsConfig{CertFile: certFile, KeyFile: keyFile, AuthClients: "yes"}, false},
+		{config.TlsConfig{CertFile: certFile, KeyFile: keyFile, AuthClients: "no", MinVersion: "1.0"}, false},
+		{config.TlsConfig{CertFile: keyFile, KeyFile: keyFile, AuthClients: "no"}, false},
+	}
+	for i, c := range cases {
+		if _, err := NewTLSConfig(&c.cfg); (err == nil) != c.ok {
+			t.Errorf("case %d err: %v", i, err)
+		}
+	}
+}
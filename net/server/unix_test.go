@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"github.com/xzwsloser/Go-redis/net/handler"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	// the stale socket file left by the last run is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+
+	unixListener, err := listenUnix(path, "600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Error("the permission of the socket file err: ", info.Mode().Perm(), err)
+	}
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &TcpServer{
+		handler:   handler.NewEchoHandler(),
+		closeCh:   make(chan struct{}),
+		listeners: []net.Listener{tcpListener, unixListener},
+		ctx:       context.Background(),
+	}
+	done := make(chan struct{})
+	go func() {
+		server.Run()
+		close(done)
+	}()
+
+	for _, addr := range []net.Addr{unixListener.Addr(), tcpListener.Addr()} {
+		conn, err := net.Dial(addr.Network(), addr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = conn.Write([]byte("PING\r\n"))
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "PING\r\n" {
+			t.Errorf("echo over %s err: %q %v", addr.Network(), line, err)
+		}
+		_ = conn.Close()
+	}
+
+	server.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server should stop")
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Error("the socket file should be removed after closing")
+	}
+}
@@ -18,3 +18,8 @@ func NewHub() *Hub {
 		lockers: lock.NewLocks(16),
 	}
 }
+
+// ChannelCount return the number of the channels with at least one subscriber
+func (hub *Hub) ChannelCount() int {
+	return hub.subs.Len()
+}
@@ -5,21 +5,33 @@ import (
 	"github.com/xzwsloser/Go-redis/interface/redis"
 	"github.com/xzwsloser/Go-redis/lib/utils"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
-	"strconv"
 )
 
 var (
-	_subscribe         = "subscribe"
-	_unsubscribe       = "unsubscribe"
-	messageBytes       = []byte("message")
-	unSubscribeNothing = []byte("*3\r\n$11\r\nunsubscribe\r\n$-1\n:0\r\n")
+	_subscribe   = "subscribe"
+	_unsubscribe = "unsubscribe"
+	messageBytes = []byte("message")
 )
 
-// makeMsg: make the message send to the clients subscribed the channel
-func makeMsg(t string, channel string, code int64) []byte {
-	return []byte("*3\r\n$" + strconv.FormatInt(int64(len(t)), 10) + protocol.CRLF + t + protocol.CRLF +
-		"$" + strconv.FormatInt(int64(len(channel)), 10) + protocol.CRLF + channel + protocol.CRLF +
-		":" + strconv.FormatInt(code, 10) + protocol.CRLF)
+// makeMsg: make the message send to the clients subscribed the channel,
+// it is a push frame if the client speaks resp3
+func makeMsg(c redis.Conn, t string, channel string, code int64) []byte {
+	reply := protocol.NewPushReply([]redis.Reply{
+		protocol.NewBulkReply([]byte(t)),
+		protocol.NewBulkReply([]byte(channel)),
+		protocol.NewIntReply(code),
+	})
+	return protocol.Marshal(reply, c.GetProtocol())
+}
+
+// unSubscribeNothing: the reply of UNSUBSCRIBE without any channel subscribed
+func unSubscribeNothing(c redis.Conn) []byte {
+	reply := protocol.NewPushReply([]redis.Reply{
+		protocol.NewBulkReply([]byte(_unsubscribe)),
+		protocol.NewNullBulkReply(),
+		protocol.NewIntReply(0),
+	})
+	return protocol.Marshal(reply, c.GetProtocol())
 }
 
 func (hub *Hub) subscribe0(channel string, c redis.Conn) {
@@ -67,7 +79,7 @@ func (hub *Hub) Unsubscribe(c redis.Conn, args [][]byte) redis.Reply {
 	defer hub.lockers.Unlocks(channels)
 	for _, channel := range channels {
 		hub.unsubscribe0(channel, c)
-		_, _ = c.Write(makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
+		_, _ = c.Write(makeMsg(c, _unsubscribe, channel, int64(c.SubsCount())))
 	}
 	return protocol.NewNoReply()
 }
@@ -81,7 +93,7 @@ func (hub *Hub) Subscribe(c redis.Conn, args [][]byte) redis.Reply {
 	defer hub.lockers.Unlocks(channels)
 	for _, channel := range channels {
 		hub.subscribe0(channel, c)
-		_, _ = c.Write(makeMsg(_subscribe, channel, int64(c.SubsCount())))
+		_, _ = c.Write(makeMsg(c, _subscribe, channel, int64(c.SubsCount())))
 	}
 	return protocol.NewNoReply()
 }
@@ -89,14 +101,14 @@ func (hub *Hub) Subscribe(c redis.Conn, args [][]byte) redis.Reply {
 func (hub *Hub) UnSubscribeAll(c redis.Conn) redis.Reply {
 	channels := c.GetChannel()
 	if len(channels) == 0 {
-		_, _ = c.Write(unSubscribeNothing)
+		_, _ = c.Write(unSubscribeNothing(c))
 		return protocol.NewNoReply()
 	}
 	hub.lockers.Locks(channels)
 	defer hub.lockers.Unlocks(channels)
 	for _, channel := range channels {
 		hub.unsubscribe0(channel, c)
-		_, _ = c.Write(makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
+		_, _ = c.Write(makeMsg(c, _unsubscribe, channel, int64(c.SubsCount())))
 	}
 	return protocol.NewNoReply()
 }
@@ -120,7 +132,8 @@ func (hub *Hub) Publish(args [][]byte) redis.Reply {
 		replyArgs[0] = messageBytes
 		replyArgs[1] = []byte(channel)
 		replyArgs[2] = message
-		_, _ = c.Write(protocol.NewMultiReply(replyArgs).ToByte())
+		reply := protocol.NewPushReply(protocol.BulkStrings(replyArgs))
+		_, _ = c.Write(protocol.Marshal(reply, c.GetProtocol()))
 		return true
 	})
 	return protocol.NewIntReply(int64(linkedlist.Len()))
@@ -0,0 +1,30 @@
+package rdb
+
+// crc64 is the CRC-64-Jones used by redis to checksum the rdb file,
+// reflected input and output, init value 0 and no final xor
+const crc64JonesPoly = 0x95ac9329ac4bc9b5
+
+var crc64Table = makeCrc64Table()
+
+func makeCrc64Table() *[256]uint64 {
+	table := new([256]uint64)
+	for i := 0; i < 256; i++ {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ crc64JonesPoly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
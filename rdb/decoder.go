@@ -0,0 +1,499 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	errBadMagic    = errors.New("rdb: bad magic number")
+	errBadChecksum = errors.New("rdb: checksum mismatch")
+	errBadLength   = errors.New("rdb: the length is out of range")
+)
+
+// Consumer receive the entries of the snapshot, return false to stop decoding
+type Consumer func(dbIndex int, key string, entity *database.DataEntity, expireAt time.Time) bool
+
+// Decoder read the snapshot of rdb version 9 or lower,
+// the ziplist, intset and quicklist written by upstream redis are also supported
+type Decoder struct {
+	reader *bufio.Reader
+	crc    uint64
+	buf    []byte
+	aux    map[string]string
+	// remaining is the bytes left in the payload, -1 means the size of the stream is unknown
+	remaining int64
+}
+
+// NewDecoder create the decoder, the bufio.Reader is used directly so that
+// the content after the snapshot is left in the reader
+func NewDecoder(reader io.Reader) *Decoder {
+	br, ok := reader.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(reader)
+	}
+	return &Decoder{
+		reader:    br,
+		buf:       make([]byte, 8),
+		aux:       make(map[string]string),
+		remaining: -1,
+	}
+}
+
+// newPayloadDecoder create the decoder of the payload in memory, the lengths read from it
+// are bounded by the bytes left in the payload
+func newPayloadDecoder(payload []byte) *Decoder {
+	dec := NewDecoder(bytes.NewReader(payload))
+	dec.remaining = int64(len(payload))
+	return dec
+}
+
+// Aux get the aux fields of the snapshot after parsing
+func (dec *Decoder) Aux() map[string]string {
+	return dec.aux
+}
+
+func (dec *Decoder) readFull(p []byte) error {
+	_, err := io.ReadFull(dec.reader, p)
+	if err != nil {
+		return err
+	}
+	dec.crc = crc64Update(dec.crc, p)
+	if dec.remaining >= 0 {
+		dec.remaining -= int64(len(p))
+	}
+	return nil
+}
+
+// checkLength check the length read from the stream before allocating by it, inPayload means the
+// content follows in the stream, so it can not be longer than the bytes left in the payload
+func (dec *Decoder) checkLength(length uint64, inPayload bool) (int, error) {
+	if length > MAX_STRING_LEN || (inPayload && dec.remaining >= 0 && length > uint64(dec.remaining)) {
+		return 0, errBadLength
+	}
+	return int(length), nil
+}
+
+func (dec *Decoder) readByte() (byte, error) {
+	err := dec.readFull(dec.buf[:1])
+	if err != nil {
+		return 0, err
+	}
+	return dec.buf[0], nil
+}
+
+// readLength read the length, isEncoded means the value is one of the special string encodings
+func (dec *Decoder) readLength() (length uint64, isEncoded bool, err error) {
+	first, err := dec.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case LEN_6BIT:
+		return uint64(first & 0x3f), false, nil
+	case LEN_14BIT:
+		next, err := dec.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case LEN_ENCVAL:
+		return uint64(first & 0x3f), true, nil
+	}
+	switch first {
+	case LEN_32BIT:
+		err = dec.readFull(dec.buf[:4])
+		return uint64(binary.BigEndian.Uint32(dec.buf)), false, err
+	case LEN_64BIT:
+		err = dec.readFull(dec.buf[:8])
+		return binary.BigEndian.Uint64(dec.buf), false, err
+	}
+	return 0, false, fmt.Errorf("rdb: unknown length encoding %#x", first)
+}
+
+func (dec *Decoder) readPlainLength() (int, error) {
+	length, isEncoded, err := dec.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if isEncoded {
+		return 0, errors.New("rdb: unexpected string encoding of length")
+	}
+	return int(length), nil
+}
+
+// readContentLength read the plain length of the content and check it by checkLength
+func (dec *Decoder) readContentLength(inPayload bool) (int, error) {
+	length, isEncoded, err := dec.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if isEncoded {
+		return 0, errors.New("rdb: unexpected string encoding of length")
+	}
+	return dec.checkLength(length, inPayload)
+}
+
+func (dec *Decoder) readString() ([]byte, error) {
+	length, isEncoded, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !isEncoded {
+		size, err := dec.checkLength(length, true)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, size)
+		err = dec.readFull(value)
+		return value, err
+	}
+
+	switch length {
+	case ENC_INT8:
+		b, err := dec.readByte()
+		return []byte(strconv.Itoa(int(int8(b)))), err
+	case ENC_INT16:
+		err = dec.readFull(dec.buf[:2])
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(dec.buf))))), err
+	case ENC_INT32:
+		err = dec.readFull(dec.buf[:4])
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(dec.buf))))), err
+	case ENC_LZF:
+		compressedLen, err := dec.readContentLength(true)
+		if err != nil {
+			return nil, err
+		}
+		// the decompressed content is longer than the payload, it is only bounded by MAX_STRING_LEN
+		rawLen, err := dec.readContentLength(false)
+		if err != nil {
+			return nil, err
+		}
+		compressed := make([]byte, compressedLen)
+		err = dec.readFull(compressed)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, rawLen)
+	}
+	return nil, fmt.Errorf("rdb: unknown string encoding %d", length)
+}
+
+// readFloat read the score of the old zset, which is stored as the string
+func (dec *Decoder) readFloat() (float64, error) {
+	length, err := dec.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	value := make([]byte, length)
+	err = dec.readFull(value)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(value), 64)
+}
+
+func (dec *Decoder) readBinaryFloat() (float64, error) {
+	err := dec.readFull(dec.buf[:8])
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(dec.buf)), nil
+}
+
+func (dec *Decoder) readHeader() error {
+	header := make([]byte, 9)
+	err := dec.readFull(header)
+	if err != nil {
+		return err
+	}
+	if string(header[:5]) != RDB_MAGIC {
+		return errBadMagic
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 || version > RDB_VERSION {
+		return fmt.Errorf("rdb: unsupported version %s", header[5:])
+	}
+	return nil
+}
+
+// Parse decode the whole snapshot and check the checksum
+func (dec *Decoder) Parse(consumer Consumer) error {
+	err := dec.readHeader()
+	if err != nil {
+		return err
+	}
+
+	dbIndex := 0
+	var expireAt time.Time
+	for {
+		opcode, err := dec.readByte()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case OPCODE_EOF:
+			return dec.checkSum()
+		case OPCODE_SELECTDB:
+			dbIndex, err = dec.readPlainLength()
+		case OPCODE_RESIZEDB:
+			_, err = dec.readPlainLength()
+			if err == nil {
+				_, err = dec.readPlainLength()
+			}
+		case OPCODE_AUX:
+			var key, value []byte
+			key, err = dec.readString()
+			if err == nil {
+				value, err = dec.readString()
+				dec.aux[string(key)] = string(value)
+			}
+		case OPCODE_EXPIRETIME_MS:
+			err = dec.readFull(dec.buf[:8])
+			expireAt = time.UnixMilli(int64(binary.LittleEndian.Uint64(dec.buf)))
+		case OPCODE_EXPIRETIME:
+			err = dec.readFull(dec.buf[:4])
+			expireAt = time.Unix(int64(binary.LittleEndian.Uint32(dec.buf)), 0)
+		case OPCODE_IDLE:
+			_, err = dec.readPlainLength()
+		case OPCODE_FREQ:
+			_, err = dec.readByte()
+		case OPCODE_MODULE_AUX:
+			return errors.New("rdb: module aux is not supported")
+		default:
+			var key []byte
+			var entity *database.DataEntity
+			key, err = dec.readString()
+			if err != nil {
+				return err
+			}
+			entity, err = dec.readObject(opcode)
+			if err != nil {
+				return err
+			}
+			if !consumer(dbIndex, string(key), entity, expireAt) {
+				return nil
+			}
+			expireAt = time.Time{}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (dec *Decoder) checkSum() error {
+	expected := dec.crc
+	_, err := io.ReadFull(dec.reader, dec.buf[:8])
+	if err != nil {
+		return err
+	}
+	checksum := binary.LittleEndian.Uint64(dec.buf)
+	// the checksum is disabled when it is zero
+	if checksum != 0 && checksum != expected {
+		return errBadChecksum
+	}
+	return nil
+}
+
+func (dec *Decoder) readObject(valueType byte) (*database.DataEntity, error) {
+	switch valueType {
+	case TYPE_STRING:
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		return &database.DataEntity{Data: value}, nil
+	case TYPE_LIST:
+		return dec.readList()
+	case TYPE_SET:
+		return dec.readSet()
+	case TYPE_ZSET, TYPE_ZSET_2:
+		return dec.readZSet(valueType == TYPE_ZSET_2)
+	case TYPE_HASH:
+		return dec.readHash()
+	case TYPE_LIST_ZIPLIST:
+		return dec.readZipListObject(valueType)
+	case TYPE_SET_INTSET:
+		return dec.readIntSet()
+	case TYPE_ZSET_ZIPLIST:
+		return dec.readZipListObject(valueType)
+	case TYPE_HASH_ZIPLIST:
+		return dec.readZipListObject(valueType)
+	case TYPE_LIST_QUICKLIST:
+		return dec.readQuickList()
+	}
+	return nil, fmt.Errorf("rdb: unsupported value type %d", valueType)
+}
+
+func (dec *Decoder) readList() (*database.DataEntity, error) {
+	size, err := dec.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+	ll := list.NewList()
+	for i := 0; i < size; i++ {
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		ll.InsertTail(string(value))
+	}
+	return &database.DataEntity{Data: ll}, nil
+}
+
+func (dec *Decoder) readSet() (*database.DataEntity, error) {
+	size, err := dec.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+	s := set.NewSet()
+	for i := 0; i < size; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		s.Add(string(member))
+	}
+	return &database.DataEntity{Data: s}, nil
+}
+
+func (dec *Decoder) readZSet(binaryScore bool) (*database.DataEntity, error) {
+	size, err := dec.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+	ss := sortedset.NewSortedSet()
+	for i := 0; i < size; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			score, err = dec.readBinaryFloat()
+		} else {
+			score, err = dec.readFloat()
+		}
+		if err != nil {
+			return nil, err
+		}
+		ss.Put(string(member), score)
+	}
+	return &database.DataEntity{Data: ss}, nil
+}
+
+func (dec *Decoder) readHash() (*database.DataEntity, error) {
+	size, err := dec.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+	h := hash.NewHash()
+	for i := 0; i < size; i++ {
+		field, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		h.Put(string(field), value)
+	}
+	return &database.DataEntity{Data: h}, nil
+}
+
+func (dec *Decoder) readIntSet() (*database.DataEntity, error) {
+	raw, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	members, err := parseIntSet(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &database.DataEntity{Data: set.NewSet(members...)}, nil
+}
+
+// readZipListObject read the list, zset or hash encoded as one ziplist
+func (dec *Decoder) readZipListObject(valueType byte) (*database.DataEntity, error) {
+	raw, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := parseZipList(raw)
+	if err != nil {
+		return nil, err
+	}
+	if valueType != TYPE_LIST_ZIPLIST && len(entries)%2 == 1 {
+		return nil, errZipListCorrupt
+	}
+
+	switch valueType {
+	case TYPE_LIST_ZIPLIST:
+		ll := list.NewList()
+		for _, entry := range entries {
+			ll.InsertTail(string(entry))
+		}
+		return &database.DataEntity{Data: ll}, nil
+	case TYPE_ZSET_ZIPLIST:
+		ss := sortedset.NewSortedSet()
+		for i := 0; i < len(entries); i += 2 {
+			score, err := strconv.ParseFloat(string(entries[i+1]), 64)
+			if err != nil {
+				return nil, err
+			}
+			ss.Put(string(entries[i]), score)
+		}
+		return &database.DataEntity{Data: ss}, nil
+	default:
+		h := hash.NewHash()
+		for i := 0; i < len(entries); i += 2 {
+			h.Put(string(entries[i]), entries[i+1])
+		}
+		return &database.DataEntity{Data: h}, nil
+	}
+}
+
+// readQuickList read the list encoded as a list of ziplist
+func (dec *Decoder) readQuickList() (*database.DataEntity, error) {
+	size, err := dec.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+	ll := list.NewList()
+	for i := 0; i < size; i++ {
+		raw, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		entries, err := parseZipList(raw)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			ll.InsertTail(string(entry))
+		}
+	}
+	return &database.DataEntity{Data: ll}, nil
+}
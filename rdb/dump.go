@@ -0,0 +1,67 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"github.com/xzwsloser/Go-redis/interface/database"
+)
+
+/*
+	the payload of DUMP and RESTORE:
+	<type> <value> <rdb version: 2 bytes little endian> <crc64: 8 bytes little endian>
+*/
+
+const DUMP_FOOTER_SIZE = 10
+
+var (
+	errBadPayload = errors.New("rdb: DUMP payload version or checksum are wrong")
+)
+
+// DumpValue serialize the value in the format of the DUMP command
+func DumpValue(entity *database.DataEntity) ([]byte, error) {
+	valueType, err := objectType(entity)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	err = enc.writeByte(valueType)
+	if err != nil {
+		return nil, err
+	}
+	err = enc.writeObject(entity)
+	if err != nil {
+		return nil, err
+	}
+	footer := make([]byte, DUMP_FOOTER_SIZE)
+	binary.LittleEndian.PutUint16(footer, RDB_VERSION)
+	_ = enc.write(footer[:2])
+	binary.LittleEndian.PutUint64(footer[2:], enc.crc)
+	buf.Write(footer[2:])
+	return buf.Bytes(), nil
+}
+
+// RestoreValue deserialize the payload created by DumpValue or the DUMP command of redis
+func RestoreValue(payload []byte) (*database.DataEntity, error) {
+	if len(payload) < DUMP_FOOTER_SIZE+1 {
+		return nil, errBadPayload
+	}
+	body := payload[:len(payload)-8]
+	version := binary.LittleEndian.Uint16(body[len(body)-2:])
+	if version > RDB_VERSION {
+		return nil, errBadPayload
+	}
+	checksum := binary.LittleEndian.Uint64(payload[len(payload)-8:])
+	// the checksum is always verified since the payload is given by the client
+	if checksum != crc64Update(0, body) {
+		return nil, errBadPayload
+	}
+
+	dec := newPayloadDecoder(body[:len(body)-2])
+	valueType, err := dec.readByte()
+	if err != nil {
+		return nil, err
+	}
+	return dec.readObject(valueType)
+}
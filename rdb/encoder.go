@@ -0,0 +1,293 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+var errUnknownEntity = errors.New("rdb: unknown type of entity")
+
+// Encoder write the snapshot into the writer and compute the checksum at the same time
+type Encoder struct {
+	writer io.Writer
+	crc    uint64
+	buf    []byte
+}
+
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{
+		writer: writer,
+		buf:    make([]byte, 9),
+	}
+}
+
+func (enc *Encoder) write(p []byte) error {
+	_, err := enc.writer.Write(p)
+	if err != nil {
+		return err
+	}
+	enc.crc = crc64Update(enc.crc, p)
+	return nil
+}
+
+func (enc *Encoder) writeByte(b byte) error {
+	enc.buf[0] = b
+	return enc.write(enc.buf[:1])
+}
+
+func (enc *Encoder) writeLength(length uint64) error {
+	switch {
+	case length < 1<<6:
+		return enc.writeByte(byte(length))
+	case length < 1<<14:
+		enc.buf[0] = byte(LEN_14BIT<<6 | length>>8)
+		enc.buf[1] = byte(length)
+		return enc.write(enc.buf[:2])
+	case length <= math.MaxUint32:
+		enc.buf[0] = LEN_32BIT
+		binary.BigEndian.PutUint32(enc.buf[1:], uint32(length))
+		return enc.write(enc.buf[:5])
+	default:
+		enc.buf[0] = LEN_64BIT
+		binary.BigEndian.PutUint64(enc.buf[1:], length)
+		return enc.write(enc.buf[:9])
+	}
+}
+
+// writeString write the string, the string of a small integer is encoded as the integer
+func (enc *Encoder) writeString(s []byte) error {
+	if len(s) > 0 && len(s) <= 11 {
+		value, err := strconv.ParseInt(string(s), 10, 32)
+		if err == nil && strconv.FormatInt(value, 10) == string(s) {
+			return enc.writeInt(value)
+		}
+	}
+	err := enc.writeLength(uint64(len(s)))
+	if err != nil {
+		return err
+	}
+	return enc.write(s)
+}
+
+func (enc *Encoder) writeInt(value int64) error {
+	switch {
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		enc.buf[0] = LEN_ENCVAL<<6 | ENC_INT8
+		enc.buf[1] = byte(int8(value))
+		return enc.write(enc.buf[:2])
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		enc.buf[0] = LEN_ENCVAL<<6 | ENC_INT16
+		binary.LittleEndian.PutUint16(enc.buf[1:], uint16(int16(value)))
+		return enc.write(enc.buf[:3])
+	default:
+		enc.buf[0] = LEN_ENCVAL<<6 | ENC_INT32
+		binary.LittleEndian.PutUint32(enc.buf[1:], uint32(int32(value)))
+		return enc.write(enc.buf[:5])
+	}
+}
+
+// WriteHeader write the magic number, the version and the aux fields
+func (enc *Encoder) WriteHeader(aux map[string]string) error {
+	err := enc.write([]byte(RDB_MAGIC + "000" + strconv.Itoa(RDB_VERSION)))
+	if err != nil {
+		return err
+	}
+	for key, value := range aux {
+		err = enc.WriteAux(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (enc *Encoder) WriteAux(key string, value string) error {
+	err := enc.writeByte(OPCODE_AUX)
+	if err != nil {
+		return err
+	}
+	err = enc.writeString([]byte(key))
+	if err != nil {
+		return err
+	}
+	return enc.writeString([]byte(value))
+}
+
+// WriteDBHeader write SELECTDB and RESIZEDB before the entries of the database
+func (enc *Encoder) WriteDBHeader(dbIndex int, size int, expires int) error {
+	err := enc.writeByte(OPCODE_SELECTDB)
+	if err != nil {
+		return err
+	}
+	err = enc.writeLength(uint64(dbIndex))
+	if err != nil {
+		return err
+	}
+	err = enc.writeByte(OPCODE_RESIZEDB)
+	if err != nil {
+		return err
+	}
+	err = enc.writeLength(uint64(size))
+	if err != nil {
+		return err
+	}
+	return enc.writeLength(uint64(expires))
+}
+
+// WriteEntry write the key and the value, the zero expireAt means the key never expires
+func (enc *Encoder) WriteEntry(key string, entity *database.DataEntity, expireAt time.Time) error {
+	if !expireAt.IsZero() {
+		err := enc.writeByte(OPCODE_EXPIRETIME_MS)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(enc.buf, uint64(expireAt.UnixMilli()))
+		err = enc.write(enc.buf[:8])
+		if err != nil {
+			return err
+		}
+	}
+
+	valueType, err := objectType(entity)
+	if err != nil {
+		return err
+	}
+	err = enc.writeEntryHead(valueType, key)
+	if err != nil {
+		return err
+	}
+	return enc.writeObject(entity)
+}
+
+// objectType get the value type written by the encoder
+func objectType(entity *database.DataEntity) (byte, error) {
+	switch entity.Data.(type) {
+	case []byte:
+		return TYPE_STRING, nil
+	case *list.List:
+		return TYPE_LIST, nil
+	case *set.Set:
+		return TYPE_SET, nil
+	case *sortedset.SortedSet:
+		return TYPE_ZSET_2, nil
+	case *hash.Hash:
+		return TYPE_HASH, nil
+	default:
+		return 0, errUnknownEntity
+	}
+}
+
+func (enc *Encoder) writeEntryHead(valueType byte, key string) error {
+	err := enc.writeByte(valueType)
+	if err != nil {
+		return err
+	}
+	return enc.writeString([]byte(key))
+}
+
+// writeObject write the value without the type
+func (enc *Encoder) writeObject(entity *database.DataEntity) error {
+	switch value := entity.Data.(type) {
+	case []byte:
+		return enc.writeString(value)
+	case *list.List:
+		return enc.writeList(value)
+	case *set.Set:
+		return enc.writeSet(value)
+	case *sortedset.SortedSet:
+		return enc.writeZSet(value)
+	case *hash.Hash:
+		return enc.writeHash(value)
+	default:
+		return errUnknownEntity
+	}
+}
+
+func (enc *Encoder) writeList(value *list.List) error {
+	err := enc.writeLength(uint64(value.Len()))
+	if err != nil {
+		return err
+	}
+	value.ForEach(func(element any) bool {
+		switch v := element.(type) {
+		case string:
+			err = enc.writeString([]byte(v))
+		case []byte:
+			err = enc.writeString(v)
+		default:
+			err = errUnknownEntity
+		}
+		return err == nil
+	})
+	return err
+}
+
+func (enc *Encoder) writeSet(value *set.Set) error {
+	err := enc.writeLength(uint64(value.Len()))
+	if err != nil {
+		return err
+	}
+	value.ForEach(func(member string) bool {
+		err = enc.writeString([]byte(member))
+		return err == nil
+	})
+	return err
+}
+
+func (enc *Encoder) writeZSet(value *sortedset.SortedSet) error {
+	err := enc.writeLength(uint64(value.Len()))
+	if err != nil {
+		return err
+	}
+	value.ForEach(func(score float64, member string) bool {
+		err = enc.writeString([]byte(member))
+		if err != nil {
+			return false
+		}
+		binary.LittleEndian.PutUint64(enc.buf, math.Float64bits(score))
+		err = enc.write(enc.buf[:8])
+		return err == nil
+	})
+	return err
+}
+
+func (enc *Encoder) writeHash(value *hash.Hash) error {
+	err := enc.writeLength(uint64(value.Len()))
+	if err != nil {
+		return err
+	}
+	value.ForEach(func(field string, v []byte) bool {
+		err = enc.writeString([]byte(field))
+		if err != nil {
+			return false
+		}
+		err = enc.writeString(v)
+		return err == nil
+	})
+	return err
+}
+
+// WriteEncoded write the entries encoded by another encoder, they are counted into the checksum
+func (enc *Encoder) WriteEncoded(p []byte) error {
+	return enc.write(p)
+}
+
+// WriteEnd write the EOF and the checksum of the whole file
+func (enc *Encoder) WriteEnd() error {
+	err := enc.writeByte(OPCODE_EOF)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(enc.buf, enc.crc)
+	_, err = enc.writer.Write(enc.buf[:8])
+	return err
+}
@@ -0,0 +1,54 @@
+package rdb
+
+import "errors"
+
+var errLzfCorrupt = errors.New("lzf: corrupt compressed data")
+
+// lzfDecompress decompress the lzf data of redis into a buffer with the length of outLen
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	// outLen is read from the data, so the buffer grows with the output instead of being allocated by it
+	out := make([]byte, 0, min(outLen, len(in)))
+	i := 0
+	for i < len(in) {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// literal run of ctrl + 1 bytes
+			ctrl++
+			if i+ctrl > len(in) || len(out)+ctrl > outLen {
+				return nil, errLzfCorrupt
+			}
+			out = append(out, in[i:i+ctrl]...)
+			i += ctrl
+			continue
+		}
+
+		// back reference
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errLzfCorrupt
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errLzfCorrupt
+		}
+		ref := len(out) - ((ctrl & 0x1f) << 8) - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errLzfCorrupt
+		}
+		if len(out)+length+2 > outLen {
+			return nil, errLzfCorrupt
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLzfCorrupt
+	}
+	return out, nil
+}
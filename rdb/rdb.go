@@ -0,0 +1,60 @@
+package rdb
+
+/*
+	the snapshot file follows the format of redis rdb version 9:
+	"REDIS0009" [AUX ...] { SELECTDB db RESIZEDB size expires { [EXPIRETIME_MS ms] type key value } } EOF checksum
+*/
+
+const (
+	RDB_MAGIC   = "REDIS"
+	RDB_VERSION = 9
+	// MAX_STRING_LEN is the max length of the decoded string like proto-max-bulk-len of redis
+	MAX_STRING_LEN = 512 << 20
+)
+
+// value types
+const (
+	TYPE_STRING           = 0
+	TYPE_LIST             = 1
+	TYPE_SET              = 2
+	TYPE_ZSET             = 3
+	TYPE_HASH             = 4
+	TYPE_ZSET_2           = 5
+	TYPE_HASH_ZIPMAP      = 9
+	TYPE_LIST_ZIPLIST     = 10
+	TYPE_SET_INTSET       = 11
+	TYPE_ZSET_ZIPLIST     = 12
+	TYPE_HASH_ZIPLIST     = 13
+	TYPE_LIST_QUICKLIST   = 14
+	TYPE_STREAM_LISTPACKS = 15
+)
+
+// special op codes
+const (
+	OPCODE_MODULE_AUX    = 247
+	OPCODE_IDLE          = 248
+	OPCODE_FREQ          = 249
+	OPCODE_AUX           = 250
+	OPCODE_RESIZEDB      = 251
+	OPCODE_EXPIRETIME_MS = 252
+	OPCODE_EXPIRETIME    = 253
+	OPCODE_SELECTDB      = 254
+	OPCODE_EOF           = 255
+)
+
+// the first two bits of the length encoding
+const (
+	LEN_6BIT   = 0
+	LEN_14BIT  = 1
+	LEN_32BIT  = 0x80
+	LEN_64BIT  = 0x81
+	LEN_ENCVAL = 3
+)
+
+// the special encodings of the string when the length type is LEN_ENCVAL
+const (
+	ENC_INT8  = 0
+	ENC_INT16 = 1
+	ENC_INT32 = 2
+	ENC_LZF   = 3
+)
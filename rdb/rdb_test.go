@@ -0,0 +1,239 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/xzwsloser/Go-redis/datastruct/hash"
+	"github.com/xzwsloser/Go-redis/datastruct/list"
+	"github.com/xzwsloser/Go-redis/datastruct/set"
+	"github.com/xzwsloser/Go-redis/datastruct/sortedset"
+	"github.com/xzwsloser/Go-redis/interface/database"
+	"testing"
+	"time"
+)
+
+func TestCrc64(t *testing.T) {
+	// the check value of crc-64-jones in redis
+	if crc64Update(0, []byte("123456789")) != 0xe9c6d914c4b8d9ca {
+		t.Error("crc64 of 123456789 err")
+	}
+}
+
+func TestLzfDecompress(t *testing.T) {
+	// literal "a" and a back reference of 9 bytes with the offset 1
+	out, err := lzfDecompress([]byte{0x00, 'a', 0xe0, 0x00, 0x00}, 10)
+	if err != nil || string(out) != "aaaaaaaaaa" {
+		t.Error("lzf decompress err: ", string(out), err)
+	}
+	_, err = lzfDecompress([]byte{0x00, 'a', 0xe0, 0x00, 0x05}, 10)
+	if err == nil {
+		t.Error("the corrupt data should be rejected")
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	ll := list.NewList()
+	ll.InsertTail("a")
+	ll.InsertTail("100")
+	ll.InsertTail("b")
+	ss := sortedset.NewSortedSet()
+	ss.Put("m1", 1.5)
+	ss.Put("m2", -3)
+	h := hash.NewHash()
+	h.Put("f1", []byte("v1"))
+	h.Put("f2", []byte("70000"))
+	expireAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	entities := map[string]*database.DataEntity{
+		"str":  {Data: []byte("hello")},
+		"int":  {Data: []byte("-12345")},
+		"big":  {Data: bytes.Repeat([]byte("x"), 20000)},
+		"list": {Data: ll},
+		"set":  {Data: set.NewSet("s1", "s2", "7")},
+		"zset": {Data: ss},
+		"hash": {Data: h},
+	}
+
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.WriteHeader(map[string]string{"redis-bits": "64"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.WriteDBHeader(3, len(entities), 1); err != nil {
+		t.Fatal(err)
+	}
+	for key, entity := range entities {
+		var ttl time.Time
+		if key == "str" {
+			ttl = expireAt
+		}
+		if err := enc.WriteEntry(key, entity, ttl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	count := 0
+	err := dec.Parse(func(dbIndex int, key string, entity *database.DataEntity, ttl time.Time) bool {
+		count++
+		if dbIndex != 3 {
+			t.Error("the db index err: ", dbIndex)
+		}
+		if key == "str" && !ttl.Equal(expireAt) {
+			t.Error("the expire time err: ", ttl)
+		}
+		if key != "str" && !ttl.IsZero() {
+			t.Error("the key should not have the expire time: ", key)
+		}
+		switch key {
+		case "str", "int", "big":
+			if !bytes.Equal(entity.Data.([]byte), entities[key].Data.([]byte)) {
+				t.Error("the string err: ", key)
+			}
+		case "list":
+			values := entity.Data.(*list.List).FindRangeValue(0, 3)
+			if len(values) != 3 || values[0] != "a" || values[1] != "100" || values[2] != "b" {
+				t.Error("the list err: ", values)
+			}
+		case "set":
+			s := entity.Data.(*set.Set)
+			if s.Len() != 3 || !s.Has("7") {
+				t.Error("the set err: ", s.Members())
+			}
+		case "zset":
+			z := entity.Data.(*sortedset.SortedSet)
+			if z.Len() != 2 || z.Get("m1").Score != 1.5 || z.Get("m2").Score != -3 {
+				t.Error("the zset err")
+			}
+		case "hash":
+			value, _ := entity.Data.(*hash.Hash).Get("f2")
+			if string(value) != "70000" {
+				t.Error("the hash err: ", string(value))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(entities) {
+		t.Error("the count of entries err: ", count)
+	}
+	if dec.Aux()["redis-bits"] != "64" {
+		t.Error("the aux field err")
+	}
+
+	// flip one byte of the value and the checksum should fail
+	corrupt := bytes.Clone(buf.Bytes())
+	corrupt[len(corrupt)-20] ^= 0xff
+	err = NewDecoder(bytes.NewReader(corrupt)).Parse(func(int, string, *database.DataEntity, time.Time) bool {
+		return true
+	})
+	if err == nil {
+		t.Error("the corrupt snapshot should be rejected")
+	}
+}
+
+func TestDecodeZipList(t *testing.T) {
+	// ziplist of the hash {f1: 1, f2: "v2"} written by upstream redis
+	entries := []byte{
+		0x00, 0x02, 'f', '1', // prevlen 0, string of 2 bytes
+		0x04, 0xf2, // immediate integer 1
+		0x02, 0x02, 'f', '2',
+		0x04, 0x02, 'v', '2',
+		0xff,
+	}
+	zl := make([]byte, ZIPLIST_HEADER_SIZE, ZIPLIST_HEADER_SIZE+len(entries))
+	zl[0] = byte(ZIPLIST_HEADER_SIZE + len(entries))
+	zl[8] = 4
+	zl = append(zl, entries...)
+
+	intset := []byte{2, 0, 0, 0, 2, 0, 0, 0, 0xff, 0xff, 5, 0}
+
+	file := []byte("REDIS0009")
+	file = append(file, OPCODE_SELECTDB, 0)
+	file = append(file, TYPE_HASH_ZIPLIST, 1, 'h', byte(len(zl)))
+	file = append(file, zl...)
+	file = append(file, TYPE_SET_INTSET, 1, 's', byte(len(intset)))
+	file = append(file, intset...)
+	// the checksum is disabled
+	file = append(file, OPCODE_EOF, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	result := make(map[string]*database.DataEntity)
+	err := NewDecoder(bytes.NewReader(file)).Parse(func(dbIndex int, key string, entity *database.DataEntity, _ time.Time) bool {
+		result[key] = entity
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := result["h"].Data.(*hash.Hash)
+	f1, _ := h.Get("f1")
+	f2, _ := h.Get("f2")
+	if h.Len() != 2 || string(f1) != "1" || string(f2) != "v2" {
+		t.Error("the ziplist hash err")
+	}
+	s := result["s"].Data.(*set.Set)
+	if s.Len() != 2 || !s.Has("-1") || !s.Has("5") {
+		t.Error("the intset err: ", s.Members())
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	h := hash.NewHash()
+	h.Put("f1", []byte("v1"))
+	payload, err := DumpValue(&database.DataEntity{Data: h})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if payload[0] != TYPE_HASH {
+		t.Error("the type of payload err: ", payload[0])
+	}
+	entity, err := RestoreValue(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, ok := entity.Data.(*hash.Hash).Get("f1")
+	if !ok || string(value) != "v1" {
+		t.Error("restore hash err: ", string(value))
+	}
+
+	payload, _ = DumpValue(&database.DataEntity{Data: []byte("hello")})
+	payload[1] ^= 0xff
+	if _, err = RestoreValue(payload); err != errBadPayload {
+		t.Error("the corrupt payload should be rejected: ", err)
+	}
+}
+
+// withFooter append the version and the checksum to the body like DumpValue
+func withFooter(body []byte) []byte {
+	payload := binary.LittleEndian.AppendUint16(body, RDB_VERSION)
+	return binary.LittleEndian.AppendUint64(payload, crc64Update(0, payload))
+}
+
+func TestRestoreBadLength(t *testing.T) {
+	huge := binary.BigEndian.AppendUint64([]byte{LEN_64BIT}, 1<<63)
+	lzf := byte(LEN_ENCVAL<<6 | ENC_LZF)
+	bodies := map[string][]byte{
+		"string":           append([]byte{TYPE_STRING}, huge...),
+		"longer":           {TYPE_STRING, 10, 'a'},
+		"compressed":       append([]byte{TYPE_STRING, lzf}, huge...),
+		"decompressed":     append(append([]byte{TYPE_STRING, lzf, 2}, huge...), 0, 'a'),
+		"wrong raw length": {TYPE_STRING, lzf, 2, 10, 0, 'a'},
+	}
+	for name, body := range bodies {
+		if _, err := RestoreValue(withFooter(body)); err == nil {
+			t.Error("the payload with the bad length should be rejected: ", name)
+		}
+	}
+
+	// the zero checksum is verified too
+	payload, _ := DumpValue(&database.DataEntity{Data: []byte("hello")})
+	payload[len(payload)-9] ^= 0xff
+	binary.LittleEndian.PutUint64(payload[len(payload)-8:], 0)
+	if _, err := RestoreValue(payload); err != errBadPayload {
+		t.Error("the payload with the zero checksum should be rejected: ", err)
+	}
+}
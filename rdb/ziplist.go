@@ -0,0 +1,149 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var (
+	errZipListCorrupt = errors.New("rdb: corrupt ziplist")
+	errIntSetCorrupt  = errors.New("rdb: corrupt intset")
+)
+
+const (
+	ZIPLIST_HEADER_SIZE = 10
+	ZIPLIST_END         = 0xff
+	ZIPLIST_BIG_PREVLEN = 0xfe
+)
+
+// parseZipList parse <zlbytes><zltail><zllen><entry>...<zlend> into the entries
+func parseZipList(raw []byte) ([][]byte, error) {
+	if len(raw) < ZIPLIST_HEADER_SIZE+1 {
+		return nil, errZipListCorrupt
+	}
+	size := int(binary.LittleEndian.Uint16(raw[8:]))
+	entries := make([][]byte, 0, size)
+	pos := ZIPLIST_HEADER_SIZE
+	for {
+		if pos >= len(raw) {
+			return nil, errZipListCorrupt
+		}
+		if raw[pos] == ZIPLIST_END {
+			return entries, nil
+		}
+		// skip the length of the previous entry
+		if raw[pos] == ZIPLIST_BIG_PREVLEN {
+			pos += 5
+		} else {
+			pos++
+		}
+		entry, next, err := parseZipListEntry(raw, pos)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		pos = next
+	}
+}
+
+// parseZipListEntry parse the encoding and the content of the entry at pos, return the next position
+func parseZipListEntry(raw []byte, pos int) ([]byte, int, error) {
+	if pos >= len(raw) {
+		return nil, 0, errZipListCorrupt
+	}
+	header := raw[pos]
+	var length, start int
+	switch header >> 6 {
+	case 0:
+		length, start = int(header&0x3f), pos+1
+	case 1:
+		if pos+2 > len(raw) {
+			return nil, 0, errZipListCorrupt
+		}
+		length, start = int(header&0x3f)<<8|int(raw[pos+1]), pos+2
+	case 2:
+		if pos+5 > len(raw) {
+			return nil, 0, errZipListCorrupt
+		}
+		length, start = int(binary.BigEndian.Uint32(raw[pos+1:])), pos+5
+	default:
+		return parseZipListInt(raw, pos)
+	}
+	if start+length > len(raw) {
+		return nil, 0, errZipListCorrupt
+	}
+	return raw[start : start+length], start + length, nil
+}
+
+func parseZipListInt(raw []byte, pos int) ([]byte, int, error) {
+	header := raw[pos]
+	pos++
+	var size int
+	switch header {
+	case 0xc0:
+		size = 2
+	case 0xd0:
+		size = 4
+	case 0xe0:
+		size = 8
+	case 0xf0:
+		size = 3
+	case 0xfe:
+		size = 1
+	default:
+		// the immediate value between 0 and 12
+		if header >= 0xf1 && header <= 0xfd {
+			return []byte(strconv.Itoa(int(header&0x0f) - 1)), pos, nil
+		}
+		return nil, 0, errZipListCorrupt
+	}
+	if pos+size > len(raw) {
+		return nil, 0, errZipListCorrupt
+	}
+	var value int64
+	switch size {
+	case 1:
+		value = int64(int8(raw[pos]))
+	case 2:
+		value = int64(int16(binary.LittleEndian.Uint16(raw[pos:])))
+	case 3:
+		// sign extend the 24 bits integer
+		value = int64(int32(uint32(raw[pos])<<8|uint32(raw[pos+1])<<16|uint32(raw[pos+2])<<24) >> 8)
+	case 4:
+		value = int64(int32(binary.LittleEndian.Uint32(raw[pos:])))
+	case 8:
+		value = int64(binary.LittleEndian.Uint64(raw[pos:]))
+	}
+	return []byte(strconv.FormatInt(value, 10)), pos + size, nil
+}
+
+// parseIntSet parse <encoding><length><contents> into the members
+func parseIntSet(raw []byte) ([]string, error) {
+	if len(raw) < 8 {
+		return nil, errIntSetCorrupt
+	}
+	encoding := int(binary.LittleEndian.Uint32(raw))
+	length := int(binary.LittleEndian.Uint32(raw[4:]))
+	if encoding != 2 && encoding != 4 && encoding != 8 {
+		return nil, errIntSetCorrupt
+	}
+	if 8+encoding*length > len(raw) {
+		return nil, errIntSetCorrupt
+	}
+	members := make([]string, 0, length)
+	for i := 0; i < length; i++ {
+		p := raw[8+encoding*i:]
+		var value int64
+		switch encoding {
+		case 2:
+			value = int64(int16(binary.LittleEndian.Uint16(p)))
+		case 4:
+			value = int64(int32(binary.LittleEndian.Uint32(p)))
+		case 8:
+			value = int64(binary.LittleEndian.Uint64(p))
+		}
+		members = append(members, strconv.FormatInt(value, 10))
+	}
+	return members, nil
+}
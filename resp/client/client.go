@@ -1,6 +1,7 @@
 package client
 
 import (
+	"crypto/tls"
 	"errors"
 	"github.com/xzwsloser/Go-redis/interface/redis"
 	"github.com/xzwsloser/Go-redis/lib/logger"
@@ -33,6 +34,8 @@ const (
 	MaxWaitTimeOut   = 3 * time.Second
 	MaxHeartBeatTime = 5 * time.Second
 	MaxChanSize      = 1 << 8
+	// UnixPrefix is the prefix of the address of unix socket e.g unix:///tmp/redis.sock
+	UnixPrefix = "unix://"
 )
 
 type RedisClient struct {
@@ -43,6 +46,8 @@ type RedisClient struct {
 	waiting    *wait.Wait    // 使用 waitGroup 优雅关闭连接
 	ticker     *time.Ticker
 	addr       string
+	// tlsConfig is nil if the client connects without tls
+	tlsConfig *tls.Config
 }
 
 type Request struct {
@@ -54,22 +59,44 @@ type Request struct {
 }
 
 func NewRedisClient(addr string) (*RedisClient, error) {
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return nil, err
-	}
+	return NewTLSRedisClient(addr, nil)
+}
 
+// NewTLSRedisClient create the client which connects by tls, tlsConfig carries the CA of the server
+// and the certificate of the client if the server requires it
+func NewTLSRedisClient(addr string, tlsConfig *tls.Config) (*RedisClient, error) {
 	client := &RedisClient{
 		status:     closing,
 		reqToSend:  make(chan *Request, MaxChanSize),
 		reqToReply: make(chan *Request, MaxChanSize),
 		waiting:    &wait.Wait{},
 		addr:       addr,
-		conn:       conn,
+		tlsConfig:  tlsConfig,
 	}
+	conn, err := client.dial()
+	if err != nil {
+		return nil, err
+	}
+	client.conn = conn
 	return client, nil
 }
 
+// @brief: 建立连接, unix:// 开头的地址使用 unix socket, 配置了 tls 时完成 tls 握手
+func (client *RedisClient) dial() (net.Conn, error) {
+	network, address := "tcp", client.addr
+	if strings.HasPrefix(address, UnixPrefix) {
+		network, address = "unix", strings.TrimPrefix(address, UnixPrefix)
+	}
+	if client.tlsConfig == nil {
+		return net.Dial(network, address)
+	}
+	conn, err := tls.Dial(network, address, client.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
 func (client *RedisClient) Start() {
 	client.ticker = time.NewTicker(MaxHeartBeatTime)
 	atomic.StoreUint32(&client.status, running)
@@ -207,7 +234,7 @@ func (client *RedisClient) reconnect() {
 	var conn net.Conn
 	var err error
 	for i := 0; i < 3; i++ {
-		conn, err = net.Dial("tcp", client.addr)
+		conn, err = client.dial()
 		if err != nil {
 			time.Sleep(time.Second)
 			continue
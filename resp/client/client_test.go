@@ -1,9 +1,19 @@
 package client
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
 	"log"
+	"math/big"
+	"net"
+	"path/filepath"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestRedisClient(t *testing.T) {
@@ -37,3 +47,93 @@ func TestMultiCommand(t *testing.T) {
 		log.Print(reply)
 	}
 }
+
+// newSelfSignedCert create a throwaway certificate for 127.0.0.1
+func newSelfSignedCert(t *testing.T) (tls.Certificate, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, cert
+}
+
+func TestTLSRedisClient(t *testing.T) {
+	serverCert, cert := newSelfSignedCert(t)
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{serverCert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// the server echoes the request, so the reply is the same as the request
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	if _, err = NewTLSRedisClient(listener.Addr().String(), &tls.Config{}); err == nil {
+		t.Error("the unknown certificate should not be trusted")
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	client, err := NewTLSRedisClient(listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+	reply := client.Send([][]byte{[]byte("GET"), []byte("key")})
+	if string(reply.ToByte()) != "*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n" {
+		t.Error("send over tls err: ", string(reply.ToByte()))
+	}
+}
+
+func TestUnixRedisClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	}()
+
+	client, err := NewRedisClient(UnixPrefix + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+	reply := client.Send([][]byte{[]byte("PING")})
+	if string(reply.ToByte()) != "*1\r\n$4\r\nPING\r\n" {
+		t.Error("send over unix socket err: ", string(reply.ToByte()))
+	}
+}
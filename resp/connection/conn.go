@@ -4,18 +4,32 @@ import (
 	"github.com/xzwsloser/Go-redis/lib/sync/wait"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
 	MaxTimeOut = time.Second * 10
+	// nextID: the id of the connection is increasing and never reused
+	nextID int64
+)
+
+const (
+	// INTERNAL_USER is the user of the connections created by the server itself,
+	// e.g. loading the aof file and applying the replication stream, it is not checked by the acl
+	INTERNAL_USER = "@internal"
 )
 
 const (
 	flagMulti uint64 = 1 << iota
+	// flagAsking: the next command is allowed in the importing slot of cluster
+	flagAsking
+	// flagNoEvict: the client is excluded from the client eviction, set by CLIENT NO-EVICT
+	flagNoEvict
 )
 
 type Connection struct {
+	id            int64
 	mu            *sync.Mutex
 	conn          net.Conn
 	sendDataWait  wait.Wait
@@ -24,11 +38,22 @@ type Connection struct {
 	channels map[string]bool
 	// key -> versionCode
 	watching map[string]uint32
-	// flags: the flags of the current state of the client
+	// flags: the flags of the current state of the client, it is accessed atomically because CLIENT LIST
+	// and CLIENT KILL of other connections read it
 	flags uint64
 	// queue: the queue of the command send in the state of the transcation
 	queue  [][][]byte
 	txErrs []error
+	// protocol: the version of resp negotiated by HELLO, zero means resp2,
+	// it is accessed atomically because the publisher reads it from its own goroutine
+	protocol int32
+	// the fields below are shown by CLIENT LIST, they are read by other connections so they are guarded by mu
+	// user: the acl user authenticated by the connection, empty means not authenticated
+	user            string
+	name            string
+	createdAt       time.Time
+	lastInteraction time.Time
+	lastCmd         string
 }
 
 func (c *Connection) Subscribe(channel string) bool {
@@ -79,15 +104,104 @@ func (c *Connection) SelectDB(dbIndex int) {
 }
 
 func NewConnection(conn net.Conn) *Connection {
+	now := time.Now()
 	return &Connection{
-		conn:     conn,
-		mu:       &sync.Mutex{},
-		channels: make(map[string]bool),
-		watching: make(map[string]uint32),
-		flags:    0,
-		queue:    make([][][]byte, 0),
-		txErrs:   make([]error, 0),
+		id:              atomic.AddInt64(&nextID, 1),
+		conn:            conn,
+		mu:              &sync.Mutex{},
+		channels:        make(map[string]bool),
+		watching:        make(map[string]uint32),
+		flags:           0,
+		queue:           make([][][]byte, 0),
+		txErrs:          make([]error, 0),
+		createdAt:       now,
+		lastInteraction: now,
+	}
+}
+
+func (c *Connection) GetID() int64 {
+	return c.id
+}
+
+func (c *Connection) GetProtocol() int {
+	version := atomic.LoadInt32(&c.protocol)
+	if version == 0 {
+		return 2
+	}
+	return int(version)
+}
+
+func (c *Connection) SetProtocol(version int) {
+	atomic.StoreInt32(&c.protocol, int32(version))
+}
+
+func (c *Connection) GetUser() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.user
+}
+
+func (c *Connection) SetUser(user string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.user = user
+}
+
+func (c *Connection) GetName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+func (c *Connection) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+func (c *Connection) GetCreatedAt() time.Time {
+	return c.createdAt
+}
+
+// GetLastInteraction return the time of the last command, the idle time of the client is counted from it
+func (c *Connection) GetLastInteraction() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastInteraction
+}
+
+func (c *Connection) GetLastCmd() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCmd
+}
+
+// SetLastCmd record the command executing now and refresh the time of the last interaction
+func (c *Connection) SetLastCmd(cmd string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCmd = cmd
+	c.lastInteraction = time.Now()
+}
+
+func (c *Connection) hasFlag(flag uint64) bool {
+	return atomic.LoadUint64(&c.flags)&flag > 0
+}
+
+func (c *Connection) setFlag(flag uint64, state bool) {
+	if !state {
+		atomic.AndUint64(&c.flags, ^flag)
+		return
 	}
+	atomic.OrUint64(&c.flags, flag)
+}
+
+func (c *Connection) IsNoEvict() bool {
+	return c.hasFlag(flagNoEvict)
+}
+
+func (c *Connection) SetNoEvict(state bool) {
+	c.setFlag(flagNoEvict, state)
 }
 
 func (c *Connection) Write(msg []byte) (int, error) {
@@ -100,13 +214,19 @@ func (c *Connection) Write(msg []byte) (int, error) {
 
 func (c *Connection) Close() error {
 	c.sendDataWait.WaitWithTimeout(MaxTimeOut)
+	// keep the mutex, AfterClientClose still reads the channels after closing
+	c.mu.Lock()
 	c.channels = nil
+	c.mu.Unlock()
 	c.watching = nil
-	c.mu = nil
 	return c.conn.Close()
 }
 
 func (c *Connection) RemoteAddr() string {
+	// the fake connection has no remote address
+	if c.conn == nil {
+		return ""
+	}
 	return c.conn.RemoteAddr().String()
 }
 
@@ -119,17 +239,23 @@ func (c *Connection) GetWatching() map[string]uint32 {
 
 // InitMulit: judge is there already has transcation
 func (c *Connection) InitMulti() bool {
-	return c.flags&flagMulti > 0
+	return c.hasFlag(flagMulti)
 }
 
 func (c *Connection) SetMulti(state bool) {
 	if !state {
 		c.queue = nil
 		c.watching = nil
-		c.flags &= ^flagMulti
-		return
 	}
-	c.flags |= flagMulti
+	c.setFlag(flagMulti, state)
+}
+
+func (c *Connection) IsAsking() bool {
+	return c.hasFlag(flagAsking)
+}
+
+func (c *Connection) SetAsking(state bool) {
+	c.setFlag(flagAsking, state)
 }
 
 func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
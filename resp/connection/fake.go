@@ -1,5 +1,11 @@
 package connection
 
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
 const (
 	BUFFER_SIZE = 1 << 10
 )
@@ -12,9 +18,15 @@ type FakeConnection struct {
 }
 
 func NewFakeConnection() *FakeConnection {
+	now := time.Now()
 	fake := &FakeConnection{}
+	fake.id = atomic.AddInt64(&nextID, 1)
+	fake.mu = &sync.Mutex{}
+	fake.createdAt = now
+	fake.lastInteraction = now
 	fake.buf = make([]byte, 0, BUFFER_SIZE)
 	fake.offset = 0
+	fake.user = INTERNAL_USER
 	return fake
 }
 
@@ -44,8 +44,16 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 
 	client := connection.NewConnection(conn)
 	r.activeConn.Store(client, struct{}{})
-
-	reader := bufio.NewReader(conn)
+	r.db.AfterClientConnect(client)
+
+	// the disconnection is noticed by the parser even if the handler is blocked by the command,
+	// so the blocked client is woken up at once
+	reader := bufio.NewReader(&disconnectReader{
+		reader: conn,
+		onDisconnect: func() {
+			r.db.AfterClientClose(client)
+		},
+	})
 	payLoads := parse.ParseStream(reader)
 	for payLoad := range payLoads {
 		if payLoad.Error != nil {
@@ -89,8 +97,10 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 			reply = protocol.NewUnknownReply()
 		}
 
-		_, _ = conn.Write(reply.ToByte())
+		_, _ = conn.Write(protocol.Marshal(reply, client.GetProtocol()))
 	}
+	// the stream is closed by the io error, e.g. the client is gone or the tls handshake failed
+	r.closeSingleClient(client)
 }
 
 func (r *RespHandler) Close() error {
@@ -109,3 +119,18 @@ func (r *RespHandler) closeSingleClient(client redis.Conn) {
 	r.db.AfterClientClose(client)
 	r.activeConn.Delete(client)
 }
+
+// disconnectReader call onDisconnect once when the reading fails, e.g. the client is gone or closed
+type disconnectReader struct {
+	reader       io.Reader
+	once         sync.Once
+	onDisconnect func()
+}
+
+func (d *disconnectReader) Read(p []byte) (int, error) {
+	n, err := d.reader.Read(p)
+	if err != nil {
+		d.once.Do(d.onDisconnect)
+	}
+	return n, err
+}
@@ -7,19 +7,36 @@ import (
 	"github.com/xzwsloser/Go-redis/lib/logger"
 	"github.com/xzwsloser/Go-redis/resp/protocol"
 	"io"
+	"math"
 	"strconv"
 )
 
 /**
+resp2:
 1. +OK\r\n
 2. -Err message\r\n
 3. :100\r\n
 4. $4\r\nPING\r\n
 5. *3\r\n$3\r\nSET\r\n$3\r\nKEY\r\n$5\r\nVALUE\r\n
+resp3:
+6. _\r\n
+7. ,1.5\r\n
+8. #t\r\n
+9. (12345678901234567890\r\n
+10. !9\r\nERR boom!\r\n
+11. =8\r\ntxt:text\r\n
+12. %1\r\n+key\r\n:1\r\n
+13. ~2\r\n+a\r\n+b\r\n
+14. >2\r\n+message\r\n+hi\r\n
+15. |1\r\n+ttl\r\n:3\r\n (the attribute before a reply, it is skipped)
 */
 
 const (
 	Protocol_Err_Message = "Protocol Err: "
+	// MAX_BULK_LEN is the max length of a bulk string like proto-max-bulk-len of redis
+	MAX_BULK_LEN = 512 << 20
+	// MAX_NESTING_DEPTH is the max depth of the nested aggregate replies, the deeper one is a protocol error
+	MAX_NESTING_DEPTH = 128
 )
 
 type PayLoad struct {
@@ -27,16 +44,13 @@ type PayLoad struct {
 	Error error
 }
 
-type readState struct {
-	isParsingLine bool
-	expectedArgs  int
-	args          [][]byte
-	bulkLen       int
-	msgType       byte
+// ioError wraps the error of the reader, the stream is over once it occurs
+type ioError struct {
+	err error
 }
 
-func (s *readState) finished() bool {
-	return s.expectedArgs > 0 && s.expectedArgs == len(s.args)
+func (e *ioError) Error() string {
+	return e.err.Error()
 }
 
 func NewProtocolError(msg string) error {
@@ -51,7 +65,7 @@ func ParseStream(reader io.Reader) <-chan *PayLoad {
 	return ch
 }
 
-// parse0 the core of state machine
+// parse0 read the replies one by one until the reader is closed
 func parse0(reader io.Reader, ch chan<- *PayLoad) {
 	// in this goroutinue  do not let the error throwed to the main goroutinue
 	defer func() {
@@ -61,207 +75,210 @@ func parse0(reader io.Reader, ch chan<- *PayLoad) {
 	}()
 
 	bufioReader := bufio.NewReader(reader)
-	var state readState
-	state.isParsingLine = false
 	for {
-		msg, ioErr, err := readLine(bufioReader, &state)
+		reply, err := readReply(bufioReader, 0)
 		if err != nil {
 			// if the connection is closed , close the channel
-			if ioErr {
-				// logger.Error("parse0 IO Err: %s", err.Error())
+			var ioErr *ioError
+			if errors.As(err, &ioErr) {
 				close(ch)
 				return
 			}
 
-			logger.Error("parse0 readLine Err: %v", err.Error())
-
+			logger.Error("parse0 readReply Err: %v", err.Error())
 			ch <- &PayLoad{
 				Error: err,
 			}
-
-			state = readState{}
 			continue
 		}
 
-		// not begin to parse a new message
-		if !state.isParsingLine {
-			if msg[0] == '*' {
-				err := parseMultiBulkMsg(msg, &state)
-				if err != nil {
-					logger.Error("parse multi header Err: %v", err.Error())
-					ch <- &PayLoad{
-						Error: err,
-					}
-					state = readState{}
-					continue
-				}
-
-				if state.expectedArgs == 0 {
-					ch <- &PayLoad{
-						Data: protocol.NewEmptyReply(),
-					}
-
-					state = readState{}
-					continue
-				}
-
-			} else if msg[0] == '$' {
-				err := parseBulkMsg(msg, &state)
-				if err != nil {
-					ch <- &PayLoad{
-						Error: err,
-					}
-
-					state = readState{}
-					continue
-				}
-			} else {
-				reply, err := parseSingleLine(msg)
-				if err != nil {
-					ch <- &PayLoad{
-						Data:  reply,
-						Error: err,
-					}
-					continue
-				}
-
-				ch <- &PayLoad{
-					Data: reply,
-				}
-			}
-		} else {
-			// is parsing the content after *n\r\n
-			err := readBody(msg, &state)
-			if err != nil {
-				ch <- &PayLoad{
-					Error: err,
-				}
+		ch <- &PayLoad{
+			Data: reply,
+		}
+	}
+}
 
-				state = readState{}
-				continue
-			}
+// readLine read a line end with \r\n and return it without \r\n
+func readLine(reader *bufio.Reader) ([]byte, error) {
+	msg, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, &ioError{err: err}
+	}
 
-			if state.finished() {
-				if state.msgType == '*' {
-					reply := protocol.NewMultiReply(state.args)
-					ch <- &PayLoad{
-						Data: reply,
-					}
+	if len(msg) < 2 || msg[len(msg)-2] != '\r' {
+		return nil, NewProtocolError(string(msg))
+	}
+	return msg[:len(msg)-2], nil
+}
 
-					state = readState{}
-				} else if state.msgType == '$' {
-					reply := protocol.NewBulkReply(state.args[0])
-					ch <- &PayLoad{
-						Data: reply,
-					}
+// readBulk read the content of the bulk string by the length in the header
+func readBulk(reader *bufio.Reader, size int) ([]byte, error) {
+	msg := make([]byte, size+2)
+	if _, err := io.ReadFull(reader, msg); err != nil {
+		return nil, &ioError{err: err}
+	}
 
-					state = readState{}
-				}
-			}
+	if msg[size] != '\r' || msg[size+1] != '\n' {
+		return nil, NewProtocolError(string(msg))
+	}
+	return msg[:size], nil
+}
 
-		}
+// parseLength parse the length in the header e.g $4 *3, -1 means null
+func parseLength(line []byte, max int) (int, error) {
+	size, err := strconv.Atoi(string(line[1:]))
+	if err != nil || size < -1 || size > max {
+		return 0, NewProtocolError(string(line))
 	}
+	return size, nil
 }
 
-// readLine parse the context of a single line by the bulklen of the state(juding the header of the content)
-func readLine(reader *bufio.Reader, state *readState) ([]byte, bool, error) {
-	var (
-		msg []byte
-		err error
-	)
+// readReply read a complete reply, the aggregate replies are read recursively and depth is the level of it.
+// the top level array of strings is the MulitBulkReply, which is the request of the client
+func readReply(reader *bufio.Reader, depth int) (redis.Reply, error) {
+	line, err := readLine(reader)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, NewProtocolError("empty line")
+	}
 
-	if state.bulkLen == 0 {
-		msg, err = reader.ReadBytes('\n')
+	switch line[0] {
+	case '+':
+		return protocol.NewStatusReply(string(line[1:])), nil
+	case '-':
+		return protocol.NewErrReply(string(line[1:])), nil
+	case ':':
+		value, err := strconv.ParseInt(string(line[1:]), 10, 64)
 		if err != nil {
-			return nil, true, err
+			return nil, NewProtocolError(string(line))
 		}
-
-		if len(msg) < 1 || msg[len(msg)-1] != '\n' {
-			return nil, false, NewProtocolError(string(msg))
-		}
-	} else {
-		msg = make([]byte, state.bulkLen+2)
-		_, err = io.ReadFull(reader, msg)
+		return protocol.NewIntReply(value), nil
+	case '_':
+		return protocol.NewNullReply(), nil
+	case ',':
+		value, err := parseDouble(string(line[1:]))
 		if err != nil {
-			return nil, true, err
+			return nil, NewProtocolError(string(line))
 		}
-
-		if len(msg) < 2 || msg[len(msg)-2] != '\r' || msg[len(msg)-1] != '\n' {
-			return nil, false, NewProtocolError(string(msg))
+		return protocol.NewDoubleReply(value), nil
+	case '#':
+		if len(line) != 2 || (line[1] != 't' && line[1] != 'f') {
+			return nil, NewProtocolError(string(line))
 		}
-
-		state.bulkLen = 0
-	}
-
-	return msg, false, nil
-}
-
-// parseSingleLine parse single line e.g +OK\r\n :123\r\n ...
-func parseSingleLine(msg []byte) (redis.Reply, error) {
-	var res redis.Reply
-	if msg[0] == '+' {
-		status := msg[1 : len(msg)-2]
-		res = protocol.NewStatusReply(string(status))
-	} else if msg[0] == '-' {
-		errMsg := msg[1 : len(msg)-2]
-		res = protocol.NewErrReply(string(errMsg))
-	} else {
-		value := msg[1 : len(msg)-2]
-		val, err := strconv.ParseInt(string(value), 10, 64)
-		if err != nil {
-			return nil, NewProtocolError(string(msg))
+		return protocol.NewBooleanReply(line[1] == 't'), nil
+	case '(':
+		return protocol.NewBigNumberReply(string(line[1:])), nil
+	case '$', '!', '=':
+		return readBulkReply(reader, line)
+	case '*', '%', '~', '>':
+		return readAggregate(reader, line, depth)
+	case '|':
+		// the attribute is the auxiliary data, skip it and read the reply following
+		if _, err = readAggregate(reader, line, depth+1); err != nil {
+			return nil, err
 		}
-		res = protocol.NewIntReply(val)
+		return readReply(reader, depth)
 	}
-	return res, nil
+	return nil, NewProtocolError(string(line))
 }
 
-// parseBulkMsg method parse the request e.g $4\r\n
-func parseBulkMsg(msg []byte, state *readState) error {
-	msgLenStr := string(msg[1 : len(msg)-2])
-	msgLen, err := strconv.Atoi(msgLenStr)
+func readBulkReply(reader *bufio.Reader, line []byte) (redis.Reply, error) {
+	size, err := parseLength(line, MAX_BULK_LEN)
 	if err != nil {
-		return NewProtocolError(string(msg))
+		return nil, err
+	}
+	if size == -1 {
+		return protocol.NewNullBulkReply(), nil
+	}
+	content, err := readBulk(reader, size)
+	if err != nil {
+		return nil, err
 	}
 
-	state.bulkLen = msgLen
-	state.isParsingLine = true
-	state.expectedArgs = 1
-	state.args = make([][]byte, 0, 1)
-	state.msgType = '$'
-
-	return nil
+	switch line[0] {
+	case '!':
+		return protocol.NewErrReply(string(content)), nil
+	case '=':
+		// the first three bytes is the format e.g txt:xxx
+		if len(content) < 4 || content[3] != ':' {
+			return nil, NewProtocolError(string(content))
+		}
+		return protocol.NewVerbatimReply(string(content[:3]), content[4:]), nil
+	}
+	return protocol.NewBulkReply(content), nil
 }
 
-// parseMultiBulkMsg parse the Multi Header e.g *3\r\n
-func parseMultiBulkMsg(msg []byte, state *readState) error {
-	lineStr := string(msg[1 : len(msg)-2])
-	argsLen, err := strconv.Atoi(lineStr)
+func readAggregate(reader *bufio.Reader, line []byte, depth int) (redis.Reply, error) {
+	// the stack of the goroutine would be exhausted by the deeply nested aggregates
+	if depth >= MAX_NESTING_DEPTH {
+		return nil, NewProtocolError("too deeply nested aggregate")
+	}
+	size, err := parseLength(line, math.MaxInt32)
 	if err != nil {
-		return NewProtocolError(string(msg))
+		return nil, err
+	}
+	if size == -1 {
+		return protocol.NewNullBulkReply(), nil
+	}
+	count := size
+	if line[0] == '%' || line[0] == '|' {
+		count = size * 2
 	}
 
-	state.expectedArgs = argsLen
-	state.isParsingLine = true
-	state.args = make([][]byte, 0, argsLen)
-	state.msgType = '*'
-	return nil
+	replies := make([]redis.Reply, 0, min(count, 1024))
+	for i := 0; i < count; i++ {
+		reply, err := readReply(reader, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		replies = append(replies, reply)
+	}
+
+	switch line[0] {
+	case '%', '|':
+		return protocol.NewMapReply(replies), nil
+	case '~':
+		return protocol.NewSetReply(replies), nil
+	case '>':
+		return protocol.NewPushReply(replies), nil
+	}
+	if count == 0 {
+		return protocol.NewEmptyReply(), nil
+	}
+	if depth == 0 {
+		if args, ok := stringArgs(replies); ok {
+			return protocol.NewMultiReply(args), nil
+		}
+	}
+	return protocol.NewMultiRawReply(replies), nil
 }
 
-// readBody read the next info of the header    e.g PING\r\n  or $4\r\n
-func readBody(msg []byte, state *readState) error {
-	var contentStr string
-	if msg[0] == '$' {
-		contentStr = string(msg[1 : len(msg)-2])
-		contentLen, err := strconv.Atoi(contentStr)
-		if err != nil {
-			return NewProtocolError(string(msg))
+// stringArgs get the strings of the array if all the elements are strings
+func stringArgs(replies []redis.Reply) ([][]byte, bool) {
+	args := make([][]byte, len(replies))
+	for i, reply := range replies {
+		switch r := reply.(type) {
+		case *protocol.BulkReply:
+			args[i] = r.Content()
+		case *protocol.StatusReply:
+			args[i] = []byte(r.Status())
+		default:
+			return nil, false
 		}
+	}
+	return args, true
+}
 
-		state.bulkLen = contentLen
-	} else {
-		contentStr = string(msg[0 : len(msg)-2])
-		state.args = append(state.args, []byte(contentStr))
+func parseDouble(s string) (float64, error) {
+	switch s {
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
 	}
-	return nil
+	return strconv.ParseFloat(s, 64)
 }
@@ -2,7 +2,9 @@ package parse
 
 import (
 	"bytes"
+	"github.com/xzwsloser/Go-redis/resp/protocol"
 	"log"
+	"strings"
 	"testing"
 )
 
@@ -16,3 +18,79 @@ func TestParseMsgSingleLine(t *testing.T) {
 		log.Println("======")
 	}
 }
+
+func TestParseResp3(t *testing.T) {
+	input := "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n" +
+		"_\r\n" +
+		",1.5\r\n" +
+		"#f\r\n" +
+		"(12345678901234567890\r\n" +
+		"!5\r\nERR x\r\n" +
+		"=6\r\ntxt:hi\r\n" +
+		"%1\r\n+k\r\n:1\r\n" +
+		"~2\r\n+a\r\n+b\r\n" +
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$3\r\nmsg\r\n" +
+		"|1\r\n+ttl\r\n:3\r\n:7\r\n" +
+		"*2\r\n:1\r\n*1\r\n$-1\r\n" +
+		"?bad\r\n" +
+		"*0\r\n"
+	expected := []string{
+		"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n",
+		"_\r\n",
+		",1.5\r\n",
+		"#f\r\n",
+		"(12345678901234567890\r\n",
+		"-ERR x\r\n",
+		"=6\r\ntxt:hi\r\n",
+		"%1\r\n+k\r\n:1\r\n",
+		"~2\r\n+a\r\n+b\r\n",
+		">3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$3\r\nmsg\r\n",
+		":7\r\n",
+		"*2\r\n:1\r\n*1\r\n_\r\n",
+		"error",
+		"*0\r\n",
+	}
+	i := 0
+	for payLoad := range ParseStream(strings.NewReader(input)) {
+		if i >= len(expected) {
+			t.Fatal("too many payloads")
+		}
+		var got string
+		if payLoad.Error != nil {
+			got = "error"
+		} else {
+			got = string(protocol.Marshal(payLoad.Data, protocol.RESP3))
+		}
+		if got != expected[i] {
+			t.Errorf("payload %d err, expected %q, got %q", i, expected[i], got)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("expected %d payloads, got %d", len(expected), i)
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	ch := ParseStream(strings.NewReader("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$0\r\n\r\n"))
+	payLoad := <-ch
+	request, ok := payLoad.Data.(*protocol.MulitBulkReply)
+	if !ok || len(request.Args) != 3 || string(request.Args[0]) != "SET" || len(request.Args[2]) != 0 {
+		t.Error("the request should be parsed as MulitBulkReply")
+	}
+}
+
+func TestParseNestingDepth(t *testing.T) {
+	nested := strings.Repeat("*1\r\n", MAX_NESTING_DEPTH) + ":1\r\n"
+	payLoad := <-ParseStream(strings.NewReader(nested))
+	if payLoad.Error != nil {
+		t.Error("the aggregate within the depth limit should be parsed: ", payLoad.Error)
+	}
+
+	// the deeply nested aggregate is rejected instead of overflowing the stack
+	tooDeep := strings.Repeat("*1\r\n", 20_000_000)
+	payLoad = <-ParseStream(strings.NewReader(tooDeep))
+	if payLoad.Error == nil || !strings.Contains(payLoad.Error.Error(), "nested") {
+		t.Error("the too deeply nested aggregate should be a protocol error")
+	}
+}
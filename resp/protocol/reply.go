@@ -35,6 +35,10 @@ func NewStatusReply(status string) *StatusReply {
 	}
 }
 
+func (s *StatusReply) Status() string {
+	return s.status
+}
+
 func (s *StatusReply) ToByte() []byte {
 	return []byte("+" + s.status + CRLF)
 }
@@ -103,6 +107,11 @@ func NewBulkReply(content []byte) *BulkReply {
 	}
 }
 
+// Content get the string without the header
+func (b *BulkReply) Content() []byte {
+	return b.content
+}
+
 func (b *BulkReply) ToByte() []byte {
 	lStr := strconv.Itoa(int(len(b.content)))
 	return []byte("$" + lStr + CRLF + string(b.content) + CRLF)
@@ -189,6 +198,10 @@ func (m *MultiRawReply) ToByte() []byte {
 	return buf.Bytes()
 }
 
+func (m *MultiRawReply) ToResp3() []byte {
+	return writeAggregate('*', len(m.replies), m.replies, RESP3)
+}
+
 var nullBulkBytes = []byte("$-1\r\n")
 
 // NullBulkReply is empty string
@@ -199,6 +212,27 @@ func (r *NullBulkReply) ToByte() []byte {
 	return nullBulkBytes
 }
 
+// ToResp3 the null bulk is replaced by the null of resp3
+func (r *NullBulkReply) ToResp3() []byte {
+	return []byte("_" + CRLF)
+}
+
 func NewNullBulkReply() *NullBulkReply {
 	return &NullBulkReply{}
 }
+
+// NullArrayReply is the null array, e.g. the reply of BLPOP when it is timeout
+type NullArrayReply struct{}
+
+func (r *NullArrayReply) ToByte() []byte {
+	return []byte("*-1" + CRLF)
+}
+
+// ToResp3 the null array is replaced by the null of resp3
+func (r *NullArrayReply) ToResp3() []byte {
+	return []byte("_" + CRLF)
+}
+
+func NewNullArrayReply() *NullArrayReply {
+	return &NullArrayReply{}
+}
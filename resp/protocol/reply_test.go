@@ -3,6 +3,7 @@ package protocol
 import (
 	"github.com/xzwsloser/Go-redis/interface/redis"
 	"log"
+	"math"
 	"testing"
 )
 
@@ -32,3 +33,35 @@ func disPlay(reply redis.Reply, description string) {
 	log.Print(string(reply.ToByte()))
 	log.Println("===================")
 }
+
+func TestResp3Reply(t *testing.T) {
+	cases := []struct {
+		reply redis.Reply
+		resp2 string
+		resp3 string
+	}{
+		{NewNullReply(), "$-1\r\n", "_\r\n"},
+		{NewNullBulkReply(), "$-1\r\n", "_\r\n"},
+		{NewNullArrayReply(), "*-1\r\n", "_\r\n"},
+		{NewDoubleReply(1.5), "$3\r\n1.5\r\n", ",1.5\r\n"},
+		{NewDoubleReply(math.Inf(-1)), "$4\r\n-inf\r\n", ",-inf\r\n"},
+		{NewBooleanReply(true), ":1\r\n", "#t\r\n"},
+		{NewBigNumberReply("12345678901234567890"), "$20\r\n12345678901234567890\r\n", "(12345678901234567890\r\n"},
+		{NewVerbatimReply("txt", []byte("hi")), "$2\r\nhi\r\n", "=6\r\ntxt:hi\r\n"},
+		{NewMapReply([]redis.Reply{NewBulkReply([]byte("k")), NewDoubleReply(2)}),
+			"*2\r\n$1\r\nk\r\n$1\r\n2\r\n", "%1\r\n$1\r\nk\r\n,2\r\n"},
+		{NewSetReply(BulkStrings([][]byte{[]byte("a")})), "*1\r\n$1\r\na\r\n", "~1\r\n$1\r\na\r\n"},
+		{NewPushReply([]redis.Reply{NewBulkReply([]byte("message")), NewIntReply(1)}),
+			"*2\r\n$7\r\nmessage\r\n:1\r\n", ">2\r\n$7\r\nmessage\r\n:1\r\n"},
+		// the nested reply is also encoded by resp3
+		{NewMultiRawReply([]redis.Reply{NewNullBulkReply(), NewOkReply()}), "*2\r\n$-1\r\n+OK\r\n", "*2\r\n_\r\n+OK\r\n"},
+	}
+	for _, c := range cases {
+		if resp2 := string(Marshal(c.reply, RESP2)); resp2 != c.resp2 {
+			t.Errorf("resp2 err, expected %q, got %q", c.resp2, resp2)
+		}
+		if resp3 := string(Marshal(c.reply, RESP3)); resp3 != c.resp3 {
+			t.Errorf("resp3 err, expected %q, got %q", c.resp3, resp3)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package protocol
+
+import (
+	"bytes"
+	"github.com/xzwsloser/Go-redis/interface/redis"
+	"math"
+	"strconv"
+)
+
+/**
+the types added by resp3, the client switches to resp3 by HELLO 3
+1. Null:
+	_\r\n
+2. Double:
+	,1.5\r\n
+3. Boolean:
+	#t\r\n
+4. Big Number:
+	(3492890328409238509324850943850943825024385\r\n
+5. Verbatim String:
+	=15\r\ntxt:Some string\r\n
+6. Map:
+	%1\r\n+key\r\n:1\r\n
+7. Set:
+	~2\r\n+a\r\n+b\r\n
+8. Push:
+	>3\r\n$7\r\nmessage\r\n$2\r\nch\r\n$3\r\nmsg\r\n
+ToByte of these types is the fallback of resp2, ToResp3 is the native format
+*/
+
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// Marshal encode the reply by the protocol version negotiated by the client
+func Marshal(reply redis.Reply, version int) []byte {
+	if version == RESP3 {
+		if r, ok := reply.(redis.Resp3Reply); ok {
+			return r.ToResp3()
+		}
+	}
+	return reply.ToByte()
+}
+
+// NullReply is the null of resp3, it is the null bulk in resp2
+type NullReply struct{}
+
+func NewNullReply() *NullReply {
+	return &NullReply{}
+}
+
+func (*NullReply) ToByte() []byte {
+	return nullBulkBytes
+}
+
+func (*NullReply) ToResp3() []byte {
+	return []byte("_" + CRLF)
+}
+
+// DoubleReply is the float number, it is a bulk string in resp2
+type DoubleReply struct {
+	value float64
+}
+
+func NewDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{
+		value: value,
+	}
+}
+
+func (d *DoubleReply) Value() float64 {
+	return d.value
+}
+
+// FormatDouble format the float like redis, e.g 1.5 inf -inf nan
+func FormatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func (d *DoubleReply) ToByte() []byte {
+	return NewBulkReply([]byte(FormatDouble(d.value))).ToByte()
+}
+
+func (d *DoubleReply) ToResp3() []byte {
+	return []byte("," + FormatDouble(d.value) + CRLF)
+}
+
+// BooleanReply is the true or false, it is 1 or 0 in resp2
+type BooleanReply struct {
+	value bool
+}
+
+func NewBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{
+		value: value,
+	}
+}
+
+func (b *BooleanReply) Value() bool {
+	return b.value
+}
+
+func (b *BooleanReply) ToByte() []byte {
+	if b.value {
+		return []byte(":1" + CRLF)
+	}
+	return []byte(":0" + CRLF)
+}
+
+func (b *BooleanReply) ToResp3() []byte {
+	if b.value {
+		return []byte("#t" + CRLF)
+	}
+	return []byte("#f" + CRLF)
+}
+
+// BigNumberReply is the integer out of the range of int64, it is a bulk string in resp2
+type BigNumberReply struct {
+	value string
+}
+
+func NewBigNumberReply(value string) *BigNumberReply {
+	return &BigNumberReply{
+		value: value,
+	}
+}
+
+func (b *BigNumberReply) Value() string {
+	return b.value
+}
+
+func (b *BigNumberReply) ToByte() []byte {
+	return NewBulkReply([]byte(b.value)).ToByte()
+}
+
+func (b *BigNumberReply) ToResp3() []byte {
+	return []byte("(" + b.value + CRLF)
+}
+
+// VerbatimReply is the string with a three bytes format e.g txt mkd, it is a bulk string in resp2
+type VerbatimReply struct {
+	format  string
+	content []byte
+}
+
+func NewVerbatimReply(format string, content []byte) *VerbatimReply {
+	return &VerbatimReply{
+		format:  format,
+		content: content,
+	}
+}
+
+func (v *VerbatimReply) Format() string {
+	return v.format
+}
+
+func (v *VerbatimReply) Content() []byte {
+	return v.content
+}
+
+func (v *VerbatimReply) ToByte() []byte {
+	return NewBulkReply(v.content).ToByte()
+}
+
+func (v *VerbatimReply) ToResp3() []byte {
+	body := v.format + ":" + string(v.content)
+	return []byte("=" + strconv.Itoa(len(body)) + CRLF + body + CRLF)
+}
+
+// MapReply is the key value pairs, the entries are key1 value1 key2 value2 ...
+// it is a flat array in resp2
+type MapReply struct {
+	entries []redis.Reply
+}
+
+func NewMapReply(entries []redis.Reply) *MapReply {
+	return &MapReply{
+		entries: entries,
+	}
+}
+
+func (m *MapReply) Entries() []redis.Reply {
+	return m.entries
+}
+
+func (m *MapReply) ToByte() []byte {
+	return writeAggregate('*', len(m.entries), m.entries, RESP2)
+}
+
+func (m *MapReply) ToResp3() []byte {
+	return writeAggregate('%', len(m.entries)/2, m.entries, RESP3)
+}
+
+// SetReply is the unordered members, it is an array in resp2
+type SetReply struct {
+	members []redis.Reply
+}
+
+func NewSetReply(members []redis.Reply) *SetReply {
+	return &SetReply{
+		members: members,
+	}
+}
+
+func (s *SetReply) Members() []redis.Reply {
+	return s.members
+}
+
+func (s *SetReply) ToByte() []byte {
+	return writeAggregate('*', len(s.members), s.members, RESP2)
+}
+
+func (s *SetReply) ToResp3() []byte {
+	return writeAggregate('~', len(s.members), s.members, RESP3)
+}
+
+// PushReply is the out of band data e.g the message of pub/sub, it is an array in resp2
+type PushReply struct {
+	replies []redis.Reply
+}
+
+func NewPushReply(replies []redis.Reply) *PushReply {
+	return &PushReply{
+		replies: replies,
+	}
+}
+
+func (p *PushReply) Replies() []redis.Reply {
+	return p.replies
+}
+
+func (p *PushReply) ToByte() []byte {
+	return writeAggregate('*', len(p.replies), p.replies, RESP2)
+}
+
+func (p *PushReply) ToResp3() []byte {
+	return writeAggregate('>', len(p.replies), p.replies, RESP3)
+}
+
+// BulkStrings wrap the strings as the bulk replies, used to build the aggregate replies
+func BulkStrings(args [][]byte) []redis.Reply {
+	replies := make([]redis.Reply, len(args))
+	for i, arg := range args {
+		replies[i] = NewBulkReply(arg)
+	}
+	return replies
+}
+
+func writeAggregate(prefix byte, size int, replies []redis.Reply, version int) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(prefix)
+	buf.WriteString(strconv.Itoa(size))
+	buf.WriteString(CRLF)
+	for _, reply := range replies {
+		buf.Write(Marshal(reply, version))
+	}
+	return buf.Bytes()
+}